@@ -7,10 +7,18 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/notification_service/internal/amqp"
 	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/contacts"
 	"github.com/notification_service/internal/email"
+	"github.com/notification_service/internal/grpcapi"
+	"github.com/notification_service/internal/httpapi"
+	"github.com/notification_service/internal/ingest"
 	"github.com/notification_service/internal/kafka"
+	"github.com/notification_service/internal/models"
 	"github.com/notification_service/internal/notifications"
+	"github.com/notification_service/internal/redisstream"
+	"github.com/notification_service/internal/schemaregistry"
 	"github.com/notification_service/internal/supabase"
 	"github.com/notification_service/internal/telegram"
 )
@@ -30,12 +38,17 @@ func main() {
 		log.Fatalf("Failed to create Supabase client: %v", err)
 	}
 
+	// Register a notifier per notification type; notifications of a type
+	// without one fail
+	notifiers := notifications.NewRegistry()
+
 	// Create SendGrid client
-	var emailClient *email.SendGridClient
 	if cfg.SendGrid.APIKey != "" {
-		emailClient, err = email.NewSendGridClient(cfg)
+		emailClient, err := email.NewSendGridClient(cfg)
 		if err != nil {
 			log.Printf("Warning: Failed to create SendGrid client: %v", err)
+		} else {
+			notifiers.Register(models.NotificationTypeEmail, emailClient)
 		}
 	} else {
 		log.Println("Warning: SendGrid API key not provided, email notifications will not be available")
@@ -48,30 +61,134 @@ func main() {
 		if err != nil {
 			log.Printf("Warning: Failed to create Telegram client: %v", err)
 		} else {
+			notifiers.Register(models.NotificationTypeTelegram, telegramClient)
 			// Start the Telegram bot in the background
 			go telegramClient.StartBot()
-			defer telegramClient.StopBot()
 		}
 	} else {
 		log.Println("Warning: Telegram bot token not provided, Telegram notifications will not be available")
 	}
 
+	// Create schema registry client for Protobuf and Avro payloads
+	var registryClient *schemaregistry.Client
+	if cfg.SchemaRegistry.URL != "" {
+		registryClient, err = schemaregistry.NewClient(cfg)
+		if err != nil {
+			log.Fatalf("Failed to create schema registry client: %v", err)
+		}
+	}
+
+	// Status events are passed to gRPC status watchers, and published to
+	// Kafka if configured
+	statusBroadcaster := notifications.NewStatusBroadcaster()
+	statusPublishers := notifications.StatusPublishers{statusBroadcaster}
+
+	// Create Kafka producer for retries, dead letters and status events
+	var producer *kafka.Producer
+	if cfg.Service.Transport == config.TransportKafka {
+		producer, err = kafka.NewProducer(cfg)
+		if err != nil {
+			log.Fatalf("Failed to create Kafka producer: %v", err)
+		}
+
+		if cfg.Kafka.StatusTopic != "" {
+			statusPublishers = append(statusPublishers, kafka.NewStatusPublisher(producer, cfg.Kafka.StatusTopic))
+		} else {
+			log.Println("Warning: Kafka status topic not provided, status events will not be published")
+		}
+	} else {
+		log.Printf("Warning: status events are only published with the %s transport", config.TransportKafka)
+	}
+
+	// Create the resolver of the channels messages omit, caching its lookups
+	// if a TTL is set
+	var contactResolver notifications.ContactResolver
+	var contactCache httpapi.ContactCache
+	var resolver contacts.Resolver
+	switch cfg.Contacts.Source {
+	case config.ContactsSourceSupabase:
+		resolver = contacts.NewDirectory(supabaseClient)
+	case config.ContactsSourceFile:
+		resolver, err = contacts.LoadFile(cfg.Contacts.File)
+		if err != nil {
+			log.Fatalf("Failed to load contacts: %v", err)
+		}
+	}
+	if resolver != nil {
+		contactResolver = resolver
+		if cfg.Contacts.CacheTTL > 0 {
+			cache := contacts.NewCache(resolver, cfg.Contacts.CacheTTL)
+			contactResolver, contactCache = cache, cache
+		}
+	}
+
+	// Create the store of the preferences users opted out with, if any
+	var preferenceStore notifications.PreferenceStore
+	if cfg.Preferences.Source == config.PreferencesSourceSupabase {
+		preferenceStore = supabaseClient
+	}
+
 	// Create notification service
-	notificationService := notifications.NewService(supabaseClient, emailClient, telegramClient)
+	notificationService := notifications.NewService(cfg, supabaseClient, notifiers, contactResolver, preferenceStore, statusPublishers)
 
-	// Create Kafka consumer
-	consumer, err := kafka.NewConsumer(cfg, notificationService.ProcessNotification)
+	// Create the message source, with the handlers routes can refer to by name
+	handlers := map[string]ingest.Handler{
+		config.DefaultHandler: notificationService.ProcessNotification,
+	}
+	var source ingest.Source
+	switch cfg.Service.Transport {
+	case config.TransportRedis:
+		source, err = redisstream.NewSource(cfg, handlers, registryClient)
+	case config.TransportAMQP:
+		source, err = amqp.NewSource(cfg, handlers, registryClient)
+	default:
+		source, err = kafka.NewConsumer(cfg, handlers, producer, registryClient)
+	}
 	if err != nil {
-		log.Fatalf("Failed to create Kafka consumer: %v", err)
+		log.Fatalf("Failed to create %s message source: %v", cfg.Service.Transport, err)
+	}
+
+	// Create the HTTP and gRPC APIs, which send submitted notifications or
+	// enqueue them to the consumed topic
+	var enqueuer notifications.Enqueuer
+	if producer != nil {
+		enqueuer = kafka.NewNotificationPublisher(producer, cfg.Kafka.Topic)
+	}
+	submitter, err := notifications.NewSubmitter(cfg, notificationService, enqueuer)
+	if err != nil {
+		log.Fatalf("Failed to create notification submitter: %v", err)
+	}
+
+	// Bulk resends run in the background, through the submitter
+	bulkResender := notifications.NewBulkResender(cfg, supabaseClient, submitter)
+
+	var httpServer *httpapi.Server
+	if cfg.HTTP.Addr != "" {
+		httpServer = httpapi.NewServer(cfg, submitter, notificationService, bulkResender, contactCache)
+	}
+
+	var grpcServer *grpcapi.Server
+	if cfg.GRPC.Addr != "" {
+		grpcServer = grpcapi.NewServer(cfg, submitter, notificationService, statusBroadcaster)
 	}
 
 	// Set up signal handling for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Start Kafka consumer
-	if err := consumer.Start(ctx); err != nil {
-		log.Fatalf("Failed to start Kafka consumer: %v", err)
+	// Start consuming
+	if err := source.Start(ctx); err != nil {
+		log.Fatalf("Failed to start message source: %v", err)
+	}
+
+	bulkResender.Start()
+	if httpServer != nil {
+		httpServer.Start()
+	}
+	if grpcServer != nil {
+		if err := grpcServer.Start(); err != nil {
+			log.Fatalf("Failed to start gRPC API: %v", err)
+		}
 	}
 
 	// Wait for termination signal
@@ -80,9 +197,48 @@ func main() {
 	<-signalChan
 
 	log.Println("Received termination signal, shutting down...")
-	
-	// Stop Kafka consumer
-	consumer.Stop()
-	
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Service.ShutdownTimeout)
+	defer shutdownCancel()
+
+	// Stop accepting requests and finish the ones being served, which may
+	// still send or enqueue notifications
+	if httpServer != nil {
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Failed to shut down HTTP API: %v", err)
+		}
+	}
+	if grpcServer != nil {
+		grpcServer.Shutdown(shutdownCtx)
+	}
+
+	// Interrupt bulk resends; other instances take them over
+	bulkResender.Stop(shutdownCtx)
+
+	// Stop fetching and wait for in-flight notifications
+	report := source.Stop(shutdownCtx)
+
+	// Flush retries, dead letters and status events published by the last handlers
+	undelivered := 0
+	if producer != nil {
+		undelivered = producer.Close(shutdownCtx)
+	}
+
+	if telegramClient != nil {
+		telegramClient.StopBot()
+	}
+
+	if len(report.Abandoned) > 0 || undelivered > 0 {
+		log.Printf("Shutdown deadline exceeded: %d messages abandoned, %d produced messages undelivered",
+			len(report.Abandoned), undelivered)
+		for _, m := range report.Abandoned {
+			if m.MessageID != "" {
+				log.Printf("Abandoned message %s from %s (in flight: %t)", m.MessageID, m.Topic, m.InFlight)
+				continue
+			}
+			log.Printf("Abandoned message from topic %s [%d] at offset %d (in flight: %t)", m.Topic, m.Partition, m.Offset, m.InFlight)
+		}
+	}
+
 	log.Println("Notification service stopped")
 } 
\ No newline at end of file
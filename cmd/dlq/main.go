@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/kafka"
+	"github.com/notification_service/internal/supabase"
+)
+
+const usage = `Usage: dlq <command> [options]
+
+Commands:
+  list      List the messages in the dead-letter topic
+  inspect   Show a single dead letter with its headers and payload
+  redrive   Republish dead letters to the topic they were first consumed from
+
+Run "dlq <command> -h" for the options of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	switch os.Args[1] {
+	case "list":
+		list(cfg, os.Args[2:])
+	case "inspect":
+		inspect(cfg, os.Args[2:])
+	case "redrive":
+		redrive(cfg, os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// list prints a one-line summary of each dead letter
+func list(cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	errorClass := flags.String("class", "", "Only list dead letters with this error class")
+	flags.Parse(args)
+
+	reader := newReader(cfg, cfg.Kafka.GroupID+".dlq-inspect")
+	defer reader.Close()
+
+	count := 0
+	err := reader.Scan(false, func(dl *kafka.DeadLetter) error {
+		if *errorClass != "" && dl.ErrorClass != *errorClass {
+			return nil
+		}
+
+		count++
+		fmt.Printf("%d/%d\t%s\t%s\tattempt=%d\tsource=%s[%s]@%s\t%s\n",
+			dl.Partition, dl.Offset, dl.FailedAt, dl.ErrorClass, dl.Attempt,
+			dl.SourceTopic, dl.SourcePartition, dl.SourceOffset, dl.ErrorMessage)
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to list dead letters: %v", err)
+	}
+
+	fmt.Printf("%d dead letters in %s\n", count, cfg.Kafka.DeadLetterTopic)
+}
+
+// inspect prints the full contents of one dead letter
+func inspect(cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+	partition := flags.Int("partition", 0, "Partition of the dead letter")
+	offset := flags.Int64("offset", -1, "Offset of the dead letter (required)")
+	flags.Parse(args)
+
+	if *offset < 0 {
+		log.Fatal("Offset is required")
+	}
+
+	reader := newReader(cfg, cfg.Kafka.GroupID+".dlq-inspect")
+	defer reader.Close()
+
+	dl, err := reader.Get(int32(*partition), *offset)
+	if err != nil {
+		log.Fatalf("Failed to read dead letter: %v", err)
+	}
+
+	fmt.Printf("Position: %d/%d\n", dl.Partition, dl.Offset)
+	fmt.Printf("Key: %s\n", string(dl.Key))
+	fmt.Println("Headers:")
+	for _, h := range dl.Headers {
+		fmt.Printf("  %s: %s\n", h.Key, string(h.Value))
+	}
+	fmt.Printf("Payload:\n%s\n", string(dl.Value))
+}
+
+// redrive republishes dead letters to the topic they were first consumed from
+func redrive(cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("redrive", flag.ExitOnError)
+	partition := flags.Int("partition", 0, "Partition of a single dead letter to redrive")
+	offset := flags.Int64("offset", -1, "Offset of a single dead letter to redrive")
+	all := flags.Bool("all", false, "Redrive every dead letter not redriven before")
+	topic := flags.String("topic", "", "Topic to republish to (default: the topic the message was first consumed from)")
+	flags.Parse(args)
+
+	if *all == (*offset >= 0) {
+		log.Fatal("Exactly one of -all or -offset is required")
+	}
+
+	producer, err := kafka.NewProducer(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create Kafka producer: %v", err)
+	}
+	defer producer.Close(context.Background())
+
+	// Redriven notifications are moved back to retrying in the store so
+	// the consumer sends them again
+	store, err := supabase.NewClient(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create Supabase client: %v", err)
+	}
+
+	if !*all {
+		reader := newReader(cfg, cfg.Kafka.GroupID+".dlq-inspect")
+		defer reader.Close()
+
+		dl, err := reader.Get(int32(*partition), *offset)
+		if err != nil {
+			log.Fatalf("Failed to read dead letter: %v", err)
+		}
+		target := redriveTopic(dl, *topic)
+		if err := kafka.Redrive(producer, store, dl, target); err != nil {
+			log.Fatalf("Failed to redrive dead letter: %v", err)
+		}
+
+		fmt.Printf("Redrove %d/%d to %s\n", dl.Partition, dl.Offset, target)
+		return
+	}
+
+	// Redriving everything commits progress so a later run does not
+	// republish the same dead letters again
+	reader := newReader(cfg, cfg.Kafka.GroupID+".dlq-redrive")
+	defer reader.Close()
+
+	count, skipped := 0, 0
+	err = reader.Scan(true, func(dl *kafka.DeadLetter) error {
+		err := kafka.Redrive(producer, store, dl, redriveTopic(dl, *topic))
+		switch {
+		case errors.Is(err, kafka.ErrNotRedrivable):
+			// The notification was resent or redriven since, so the dead
+			// letter is done with
+			log.Printf("Skipping %d/%d: %v", dl.Partition, dl.Offset, err)
+			skipped++
+		case err != nil:
+			return err
+		default:
+			count++
+		}
+		return reader.Commit(dl)
+	})
+	if err != nil {
+		log.Fatalf("Failed to redrive dead letters after %d messages: %v", count, err)
+	}
+
+	fmt.Printf("Redrove %d dead letters, skipped %d\n", count, skipped)
+}
+
+// redriveTopic returns override if set, otherwise the topic the dead letter
+// was first consumed from
+func redriveTopic(dl *kafka.DeadLetter, override string) string {
+	if override != "" {
+		return override
+	}
+	if dl.OriginalTopic != "" {
+		return dl.OriginalTopic
+	}
+	return dl.SourceTopic
+}
+
+// newReader creates a dead-letter reader or exits
+func newReader(cfg *config.Config, groupID string) *kafka.DeadLetterReader {
+	reader, err := kafka.NewDeadLetterReader(cfg, groupID)
+	if err != nil {
+		log.Fatalf("Failed to create dead-letter reader: %v", err)
+	}
+	return reader
+}
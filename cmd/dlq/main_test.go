@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/notification_service/internal/kafka"
+)
+
+func TestRedriveTopic(t *testing.T) {
+	tests := []struct {
+		name     string
+		dl       kafka.DeadLetter
+		override string
+		want     string
+	}{
+		{
+			name: "first attempt",
+			dl:   kafka.DeadLetter{SourceTopic: "notifications"},
+			want: "notifications",
+		},
+		{
+			name: "retry",
+			dl:   kafka.DeadLetter{SourceTopic: "notifications.retry.1m0s", OriginalTopic: "notifications"},
+			want: "notifications",
+		},
+		{
+			name:     "override",
+			dl:       kafka.DeadLetter{SourceTopic: "notifications.retry.1m0s", OriginalTopic: "notifications"},
+			override: "notifications.replay",
+			want:     "notifications.replay",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redriveTopic(&tt.dl, tt.override); got != tt.want {
+				t.Errorf("redriveTopic = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/notification_service/internal/models"
+)
+
+const usage = `Usage: resend <command> [options]
+
+Commands:
+  preview   Count the failed notifications a bulk resend would resend
+  start     Start a bulk resend job
+  list      List the newest bulk resend jobs
+  inspect   Show the progress of a bulk resend job
+  pause     Pause a running bulk resend job
+  resume    Resume a paused or failed bulk resend job
+
+The commands call the HTTP API at $NOTIFICATION_API_URL
+(default http://localhost:8080), or the URL given with -api, with the
+bearer token in $NOTIFICATION_API_TOKEN, or given with -token.
+Run "resend <command> -h" for the options of a command.
+`
+
+// defaultAPIURL is the API called when NOTIFICATION_API_URL is not set
+const defaultAPIURL = "http://localhost:8080"
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "preview":
+		preview(os.Args[2:])
+	case "start":
+		start(os.Args[2:])
+	case "list":
+		list(os.Args[2:])
+	case "inspect":
+		inspect(os.Args[2:])
+	case "pause":
+		operate("pause", os.Args[2:])
+	case "resume":
+		operate("resume", os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// preview prints the number of notifications a bulk resend would resend
+func preview(args []string) {
+	flags := flag.NewFlagSet("preview", flag.ExitOnError)
+	api := apiFlags(flags)
+	filter := filterFlags(flags)
+	flags.Parse(args)
+
+	var res struct {
+		Count int `json:"count"`
+	}
+	api.call(http.MethodPost, "/v1/bulk-resends:preview", filter(), &res)
+
+	fmt.Printf("%d failed notifications match\n", res.Count)
+}
+
+// start creates a bulk resend job
+func start(args []string) {
+	flags := flag.NewFlagSet("start", flag.ExitOnError)
+	api := apiFlags(flags)
+	filter := filterFlags(flags)
+	rate := flags.Int("rate", 0, "Notifications resent per second (default: the service's BULK_RESEND_DEFAULT_RATE)")
+	reason := flags.String("reason", "", "Why the notifications are resent, recorded in the audit log")
+	flags.Parse(args)
+
+	req := struct {
+		*models.BulkResendFilter
+		Rate   int    `json:"rate,omitempty"`
+		Reason string `json:"reason,omitempty"`
+	}{filter(), *rate, *reason}
+
+	var job models.BulkResendJob
+	api.call(http.MethodPost, "/v1/bulk-resends", req, &job)
+
+	fmt.Printf("Started bulk resend %s of %d notifications at %d per second\n", job.ID, job.Total, job.Rate)
+}
+
+// list prints a one-line summary of each of the newest jobs
+func list(args []string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	api := apiFlags(flags)
+	flags.Parse(args)
+
+	var res struct {
+		Jobs []models.BulkResendJob `json:"jobs"`
+	}
+	api.call(http.MethodGet, "/v1/bulk-resends", nil, &res)
+
+	for i := range res.Jobs {
+		job := &res.Jobs[i]
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\n", job.ID, job.CreatedAt.Format(time.RFC3339), job.Status, progress(job), job.Actor)
+	}
+}
+
+// inspect prints a job, and with -watch its progress until it stops running
+func inspect(args []string) {
+	flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+	api := apiFlags(flags)
+	id := flags.String("id", "", "ID of the job (required)")
+	watch := flags.Duration("watch", 0, "Print the progress at this interval until the job stops running")
+	flags.Parse(args)
+
+	if *id == "" {
+		log.Fatal("ID is required")
+	}
+
+	var job models.BulkResendJob
+	api.call(http.MethodGet, "/v1/bulk-resends/"+url.PathEscape(*id), nil, &job)
+
+	out, _ := json.MarshalIndent(job, "", "  ")
+	fmt.Println(string(out))
+
+	for *watch > 0 && job.Status == models.BulkJobStatusRunning {
+		time.Sleep(*watch)
+		api.call(http.MethodGet, "/v1/bulk-resends/"+url.PathEscape(*id), nil, &job)
+		fmt.Printf("%s\t%s\t%s\n", time.Now().Format(time.RFC3339), job.Status, progress(&job))
+	}
+}
+
+// operate pauses or resumes a job
+func operate(operation string, args []string) {
+	flags := flag.NewFlagSet(operation, flag.ExitOnError)
+	api := apiFlags(flags)
+	id := flags.String("id", "", "ID of the job (required)")
+	reason := flags.String("reason", "", "Why the job is "+operation+"d")
+	flags.Parse(args)
+
+	if *id == "" {
+		log.Fatal("ID is required")
+	}
+
+	req := map[string]string{}
+	if *reason != "" {
+		req["reason"] = *reason
+	}
+
+	var job models.BulkResendJob
+	api.call(http.MethodPost, "/v1/bulk-resends/"+url.PathEscape(*id)+":"+operation, req, &job)
+
+	fmt.Printf("Bulk resend %s is %s: %s\n", job.ID, job.Status, progress(&job))
+}
+
+// progress summarizes the counters of a job
+func progress(job *models.BulkResendJob) string {
+	return fmt.Sprintf("%d/%d processed, %d resent, %d skipped, %d failed",
+		job.Processed, job.Total, job.Resent, job.Skipped, job.Failed)
+}
+
+// apiClient calls the HTTP API for the commands
+type apiClient struct {
+	url   string
+	token string
+}
+
+// apiFlags adds the -api and -token flags, the base URL of the HTTP API and
+// the bearer token identifying the caller, who is recorded as the actor
+func apiFlags(flags *flag.FlagSet) *apiClient {
+	apiURL := os.Getenv("NOTIFICATION_API_URL")
+	if apiURL == "" {
+		apiURL = defaultAPIURL
+	}
+
+	a := &apiClient{}
+	flags.StringVar(&a.url, "api", apiURL, "Base URL of the HTTP API")
+	flags.StringVar(&a.token, "token", os.Getenv("NOTIFICATION_API_TOKEN"), "Bearer token of the HTTP API")
+	return a
+}
+
+// filterFlags adds the flags selecting failed notifications, returning a
+// function that builds the filter once the flags are parsed
+func filterFlags(flags *flag.FlagSet) func() *models.BulkResendFilter {
+	after := flags.String("after", "", "Only notifications created at or after this RFC 3339 time (required)")
+	before := flags.String("before", "", "Only notifications created before this RFC 3339 time (default: now)")
+	notificationType := flags.String("type", "", "Only notifications of this type")
+	classes := flags.String("class", "", "Only notifications that failed with these comma-separated error classes")
+	users := flags.String("users", "", "Only notifications of these comma-separated user IDs")
+	usersFile := flags.String("users-file", "", "Only notifications of the user IDs in this file, one per line")
+
+	return func() *models.BulkResendFilter {
+		filter := &models.BulkResendFilter{
+			CreatedAfter:  parseTime("after", *after),
+			CreatedBefore: parseTime("before", *before),
+			Type:          models.NotificationType(*notificationType),
+			ErrorClasses:  splitList(*classes),
+			UserIDs:       splitList(*users),
+		}
+		if *usersFile != "" {
+			filter.UserIDs = append(filter.UserIDs, readLines(*usersFile)...)
+		}
+		return filter
+	}
+}
+
+// parseTime parses the RFC 3339 time of a flag, or returns the zero time if
+// it is empty
+func parseTime(name, value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		log.Fatalf("Invalid -%s: %v", name, err)
+	}
+	return t
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// readLines returns the non-empty lines of a file
+func readLines(path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return lines
+}
+
+// call sends a request to the API and decodes the response into res, or
+// exits with the API's error
+func (a *apiClient) call(method, path string, body, res interface{}) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			log.Fatalf("Failed to encode request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(a.url, "/")+path, reader)
+	if err != nil {
+		log.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatalf("Failed to call the API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Code    string              `json:"code"`
+				Message string              `json:"message"`
+				Fields  []models.FieldError `json:"fields"`
+			} `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil {
+			log.Fatalf("API responded %s", resp.Status)
+		}
+		for _, field := range apiErr.Error.Fields {
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", field.Field, field.Message)
+		}
+		log.Fatalf("API responded %s: %s", resp.Status, apiErr.Error.Message)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		log.Fatalf("Failed to decode response: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package amqp
+
+import (
+	"context"
+	"errors"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// errRefused is returned when the broker does not confirm a published message
+var errRefused = errors.New("broker refused the message")
+
+// connection is the part of an AMQP connection the source uses, so that tests
+// can run it without a broker
+type connection interface {
+	Channel() (channel, error)
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+// channel is the part of an AMQP channel the source uses
+type channel interface {
+	Confirm(noWait bool) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Cancel(consumer string, noWait bool) error
+	// Publish publishes msg to queue through the default exchange and waits
+	// for the broker's confirm
+	Publish(ctx context.Context, queue string, msg amqp.Publishing) error
+}
+
+// brokerConnection is a connection to an AMQP broker
+type brokerConnection struct {
+	*amqp.Connection
+}
+
+// dialBroker connects to the AMQP broker at url
+func dialBroker(url string) (connection, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	return brokerConnection{conn}, nil
+}
+
+// Channel opens a channel on the connection
+func (c brokerConnection) Channel() (channel, error) {
+	ch, err := c.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return brokerChannel{ch}, nil
+}
+
+// brokerChannel is a channel of a brokerConnection
+type brokerChannel struct {
+	*amqp.Channel
+}
+
+// Publish publishes msg to queue through the default exchange and waits for
+// the broker's confirm
+func (c brokerChannel) Publish(ctx context.Context, queue string, msg amqp.Publishing) error {
+	confirm, err := c.PublishWithDeferredConfirmWithContext(ctx, "", queue, false, false, msg)
+	if err != nil {
+		return err
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return errRefused
+	}
+	return nil
+}
@@ -0,0 +1,508 @@
+package amqp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/ingest"
+	"github.com/notification_service/internal/models"
+	"github.com/notification_service/internal/schemaregistry"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// headerContentType carries the delivery's content type to the decoder
+const headerContentType = "content-type"
+
+// reconnectDelay is how long the source waits before reconnecting to the
+// broker after losing the connection
+const reconnectDelay = 5 * time.Second
+
+// errStopped is returned when the source is stopped while it connects
+var errStopped = errors.New("amqp source stopped")
+
+// Source consumes durable AMQP 0-9-1 queues with manual acknowledgements.
+// Handled deliveries are acked. A delivery that failed transiently is
+// republished to the queue's retry queue, from which the broker returns it
+// after RetryDelay; one that failed permanently, could not be decoded or ran
+// out of deliveries is republished to the dead-letter queue. Deliveries that
+// cannot be republished are nacked and requeued.
+type Source struct {
+	cfg    config.AMQPConfig
+	routes *ingest.Router
+	queues []string
+	// dial connects to the broker, and reconnectDelay is how long a lost
+	// connection waits before being re-established
+	dial           func(url string) (connection, error)
+	reconnectDelay time.Duration
+
+	mu        sync.Mutex
+	started   bool
+	stopped   bool
+	quit      chan struct{}
+	conn      connection
+	consumers []channel
+	// publisher republishes retries and dead letters with publisher confirms
+	publisher channel
+	publishMu sync.Mutex
+	wg        sync.WaitGroup
+	// inFlight maps the deliveries being handled to their queue
+	inFlight map[*amqp.Delivery]string
+}
+
+// NewSource creates a source consuming the queues named by the configured
+// routes. Payloads framed with a schema ID are decoded with schemas from
+// registry, which may be nil.
+func NewSource(cfg *config.Config, handlers map[string]ingest.Handler, registry *schemaregistry.Client) (*Source, error) {
+	return newSource(cfg, handlers, registry, dialBroker)
+}
+
+// newSource creates a source connecting to the broker with dial
+func newSource(cfg *config.Config, handlers map[string]ingest.Handler, registry *schemaregistry.Client, dial func(url string) (connection, error)) (*Source, error) {
+	routes, err := ingest.NewRouter(cfg.Kafka.Routes, handlers, ingest.NewSchemaDecoder(registry))
+	if err != nil {
+		return nil, err
+	}
+
+	// Stop cancels the consumers by their tag, so one is needed even if the
+	// host name could not be determined
+	amqpCfg := cfg.AMQP
+	if amqpCfg.ConsumerTag == "" {
+		amqpCfg.ConsumerTag = fallbackConsumerTag()
+		log.Printf("No AMQP consumer tag configured, using %s", amqpCfg.ConsumerTag)
+	}
+
+	return &Source{
+		cfg:            amqpCfg,
+		routes:         routes,
+		queues:         routes.Subscriptions(),
+		dial:           dial,
+		reconnectDelay: reconnectDelay,
+		quit:           make(chan struct{}),
+		inFlight:       make(map[*amqp.Delivery]string),
+	}, nil
+}
+
+// fallbackConsumerTag returns a consumer tag unique to this process
+func fallbackConsumerTag() string {
+	return fmt.Sprintf("notification-service-%d-%d", os.Getpid(), time.Now().UnixNano())
+}
+
+// retryQueue names the queue holding the retries of queue until they are due
+func retryQueue(queue string) string {
+	return queue + ".retry"
+}
+
+// Start connects to the broker, declares the queues and begins consuming.
+// If the connection is lost it is re-established until Stop is called.
+func (s *Source) Start(ctx context.Context) error {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return errors.New("amqp source already started")
+	}
+	s.started = true
+	s.mu.Unlock()
+
+	if err := s.connect(ctx); err != nil {
+		s.mu.Lock()
+		s.started = false
+		s.mu.Unlock()
+		return err
+	}
+
+	log.Printf("Consuming AMQP queues %v", s.queues)
+	return nil
+}
+
+// connect opens a connection, declares the queues and starts the workers of
+// every queue. s.mu is only held once the connection is set up, so that Stop
+// does not wait for the broker; if the source was stopped meanwhile, the
+// connection is closed and errStopped returned.
+func (s *Source) connect(ctx context.Context) error {
+	conn, err := s.dial(s.cfg.URL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to AMQP broker: %w", err)
+	}
+
+	publisher, err := s.setup(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	var consumers []channel
+	var deliveries []<-chan amqp.Delivery
+	for _, queue := range s.queues {
+		ch, err := conn.Channel()
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to open AMQP channel: %w", err)
+		}
+		if err := ch.Qos(s.cfg.Prefetch, 0, false); err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to set prefetch on queue %s: %w", queue, err)
+		}
+
+		d, err := ch.Consume(queue, s.cfg.ConsumerTag, false, false, false, false, nil)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to consume queue %s: %w", queue, err)
+		}
+		consumers = append(consumers, ch)
+		deliveries = append(deliveries, d)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		conn.Close()
+		return errStopped
+	}
+
+	// The channels of the previous connection are only replaced once the
+	// new one is fully set up
+	s.conn = conn
+	s.consumers = consumers
+	s.publishMu.Lock()
+	s.publisher = publisher
+	s.publishMu.Unlock()
+	for i, queue := range s.queues {
+		for j := 0; j < s.cfg.Concurrency; j++ {
+			s.wg.Add(1)
+			go s.consume(ctx, queue, deliveries[i])
+		}
+	}
+
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	go s.watch(ctx, closed)
+
+	return nil
+}
+
+// watch reconnects when the connection is closed by anything but Stop
+func (s *Source) watch(ctx context.Context, closed <-chan *amqp.Error) {
+	err, ok := <-closed
+	if !ok || err == nil {
+		return
+	}
+	log.Printf("AMQP connection lost: %v", err)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.quit:
+			return
+		case <-time.After(s.reconnectDelay):
+		}
+
+		err := s.connect(ctx)
+		switch {
+		case err == nil:
+			log.Println("AMQP connection re-established")
+			return
+		case errors.Is(err, errStopped):
+			return
+		}
+		log.Printf("Error reconnecting to AMQP broker: %v", err)
+	}
+}
+
+// setup declares the queues and their retry queues, and returns the
+// publishing channel
+func (s *Source) setup(conn connection) (channel, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open AMQP channel: %w", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	for _, queue := range s.queues {
+		if _, err := ch.QueueDeclare(queue, true, false, false, false, nil); err != nil {
+			return nil, fmt.Errorf("failed to declare queue %s: %w", queue, err)
+		}
+
+		// Expired retries are dead-lettered back onto the queue through the
+		// default exchange
+		_, err := ch.QueueDeclare(retryQueue(queue), true, false, false, false, amqp.Table{
+			"x-message-ttl":             s.cfg.RetryDelay.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": queue,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to declare queue %s: %w", retryQueue(queue), err)
+		}
+	}
+
+	if s.cfg.DeadLetterQueue != "" {
+		if _, err := ch.QueueDeclare(s.cfg.DeadLetterQueue, true, false, false, false, nil); err != nil {
+			return nil, fmt.Errorf("failed to declare queue %s: %w", s.cfg.DeadLetterQueue, err)
+		}
+	}
+
+	return ch, nil
+}
+
+// consume handles deliveries until the consumer is cancelled or ctx is done
+func (s *Source) consume(ctx context.Context, queue string, deliveries <-chan amqp.Delivery) {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d, ok := <-deliveries:
+			if !ok {
+				return
+			}
+			s.handle(queue, &d)
+		}
+	}
+}
+
+// handle decodes a delivery, hands it to its queue's handler and settles it
+func (s *Source) handle(queue string, d *amqp.Delivery) {
+	s.track(queue, d)
+	defer s.untrack(d)
+
+	rt := s.routes.Match(queue)
+	if rt == nil {
+		s.deadLetter(queue, d, ingest.ErrorClassNoRoute, fmt.Errorf("no route for queue %s", queue))
+		return
+	}
+
+	headers := deliveryHeaders(d)
+	notification, err := rt.Decoder.Decode(d.Body, headers)
+	if err != nil {
+		log.Printf("Error decoding delivery from queue %s: %v", queue, err)
+		s.deadLetter(queue, d, ingest.ErrorClassDecode, err)
+		return
+	}
+
+	if notification.Priority == "" {
+		notification.Priority = rt.Priority
+	}
+
+	attempt, _ := strconv.Atoi(headers[ingest.HeaderAttempt])
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	env := &models.Envelope{
+		Message:        notification,
+		Headers:        headers,
+		Topic:          queue,
+		Timestamp:      d.Timestamp,
+		MessageID:      deliveryID(d),
+		NotificationID: headers[ingest.HeaderNotificationID],
+		Attempt:        attempt,
+		MaxAttempts:    s.cfg.MaxDeliveries,
+	}
+
+	err = rt.Handler(env)
+	if err == nil {
+		s.ack(d)
+		return
+	}
+
+	log.Printf("Error handling delivery from queue %s: %v", queue, err)
+
+	if class := ingest.ClassifyError(err); class != "" {
+		s.deadLetter(queue, d, class, err)
+		return
+	}
+	if attempt >= s.cfg.MaxDeliveries {
+		log.Printf("Giving up on notification %s after %d attempts", env.NotificationID, attempt)
+		s.deadLetter(queue, d, ingest.ErrorClassRetriesExhausted, err)
+		return
+	}
+
+	retryHeaders := amqp.Table{
+		ingest.HeaderAttempt: strconv.Itoa(attempt + 1),
+	}
+	if env.NotificationID != "" {
+		retryHeaders[ingest.HeaderNotificationID] = env.NotificationID
+	}
+	if err := s.republish(retryQueue(queue), d, retryHeaders); err != nil {
+		log.Printf("Error scheduling retry, requeueing: %v", err)
+		s.nack(d)
+		return
+	}
+	s.ack(d)
+}
+
+// deadLetter republishes a delivery to the dead-letter queue with the
+// failure headers and acks it. Without a dead-letter queue the delivery is
+// rejected, which drops it unless the queue has a dead-letter exchange.
+func (s *Source) deadLetter(queue string, d *amqp.Delivery, class string, cause error) {
+	if s.cfg.DeadLetterQueue == "" {
+		if err := d.Reject(false); err != nil {
+			log.Printf("Error rejecting delivery: %v", err)
+		}
+		return
+	}
+
+	err := s.republish(s.cfg.DeadLetterQueue, d, amqp.Table{
+		ingest.HeaderErrorClass:   class,
+		ingest.HeaderErrorMessage: cause.Error(),
+		ingest.HeaderSourceTopic:  queue,
+	})
+	if err != nil {
+		log.Printf("Error dead-lettering delivery, requeueing: %v", err)
+		s.nack(d)
+		return
+	}
+	s.ack(d)
+}
+
+// republish publishes a persistent copy of a delivery with extra headers to
+// queue through the default exchange and waits for the broker's confirm
+func (s *Source) republish(queue string, d *amqp.Delivery, extra amqp.Table) error {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	for k, v := range extra {
+		headers[k] = v
+	}
+
+	s.publishMu.Lock()
+	defer s.publishMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := s.publisher.Publish(ctx, queue, amqp.Publishing{
+		Headers:       headers,
+		ContentType:   d.ContentType,
+		MessageId:     d.MessageId,
+		CorrelationId: d.CorrelationId,
+		Timestamp:     d.Timestamp,
+		DeliveryMode:  amqp.Persistent,
+		Body:          d.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish to queue %s: %w", queue, err)
+	}
+	return nil
+}
+
+// ack acknowledges a delivery
+func (s *Source) ack(d *amqp.Delivery) {
+	if err := d.Ack(false); err != nil {
+		log.Printf("Error acking delivery: %v", err)
+	}
+}
+
+// nack returns a delivery to its queue
+func (s *Source) nack(d *amqp.Delivery) {
+	if err := d.Nack(false, true); err != nil {
+		log.Printf("Error nacking delivery: %v", err)
+	}
+}
+
+// track records a delivery being handled
+func (s *Source) track(queue string, d *amqp.Delivery) {
+	s.mu.Lock()
+	s.inFlight[d] = queue
+	s.mu.Unlock()
+}
+
+// untrack clears a handled delivery
+func (s *Source) untrack(d *amqp.Delivery) {
+	s.mu.Lock()
+	delete(s.inFlight, d)
+	s.mu.Unlock()
+}
+
+// Stop cancels the consumers and waits until ctx is done for the deliveries
+// being handled, then closes the connection. Deliveries that were not
+// settled by then are reported as abandoned; the broker requeues them.
+func (s *Source) Stop(ctx context.Context) ingest.ShutdownReport {
+	s.mu.Lock()
+	if !s.started || s.stopped {
+		s.mu.Unlock()
+		return ingest.ShutdownReport{}
+	}
+	s.stopped = true
+	close(s.quit)
+	consumers := s.consumers
+	s.mu.Unlock()
+
+	// Cancelling closes the delivery channels once the prefetched
+	// deliveries have been handed out, ending the workers
+	for _, ch := range consumers {
+		if err := ch.Cancel(s.cfg.ConsumerTag, false); err != nil {
+			log.Printf("Error cancelling AMQP consumer: %v", err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	var report ingest.ShutdownReport
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.mu.Lock()
+		for d, queue := range s.inFlight {
+			report.Abandoned = append(report.Abandoned, ingest.AbandonedMessage{
+				Topic:     queue,
+				MessageID: deliveryID(d),
+				InFlight:  true,
+			})
+		}
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return report
+	}
+	if err := s.conn.Close(); err != nil && !errors.Is(err, amqp.ErrClosed) {
+		log.Printf("Error closing AMQP connection: %v", err)
+	}
+	return report
+}
+
+// deliveryHeaders converts the AMQP headers of a delivery to strings, adding
+// its content type
+func deliveryHeaders(d *amqp.Delivery) map[string]string {
+	headers := make(map[string]string, len(d.Headers)+1)
+	for k, v := range d.Headers {
+		switch value := v.(type) {
+		case string:
+			headers[k] = value
+		case []byte:
+			headers[k] = string(value)
+		default:
+			headers[k] = fmt.Sprint(value)
+		}
+	}
+	if d.ContentType != "" {
+		headers[headerContentType] = d.ContentType
+	}
+	return headers
+}
+
+// deliveryID identifies a delivery by its message ID, or its delivery tag if
+// the publisher did not set one
+func deliveryID(d *amqp.Delivery) string {
+	if d.MessageId != "" {
+		return d.MessageId
+	}
+	return "delivery-" + strconv.FormatUint(d.DeliveryTag, 10)
+}
@@ -0,0 +1,574 @@
+package amqp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/ingest"
+	"github.com/notification_service/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	testQueue           = "notifications"
+	testDeadLetterQueue = "notifications.dlq"
+	testPayload         = `{"user_id":"user-1","type":"email","channel":"a@example.com","content":"Hello"}`
+)
+
+// published is a message published to a queue of a fakeBroker
+type published struct {
+	queue string
+	msg   amqp.Publishing
+}
+
+// fakeBroker stands in for an AMQP broker: it records the queues declared and
+// the messages published through its connections, hands out the deliveries
+// of a queue to its latest consumer, and records how each delivery, by tag,
+// was settled
+type fakeBroker struct {
+	mu         sync.Mutex
+	declared   map[string]amqp.Table
+	published  []published
+	publishErr error
+	consumers  map[string]chan amqp.Delivery
+	settled    map[uint64]string
+	nextTag    uint64
+	conns      []*fakeConnection
+	// dials counts the connections made; while gate is set, dialling waits
+	// until it is closed
+	dials int
+	gate  chan struct{}
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{
+		declared:  make(map[string]amqp.Table),
+		consumers: make(map[string]chan amqp.Delivery),
+		settled:   make(map[uint64]string),
+	}
+}
+
+func (b *fakeBroker) dial(url string) (connection, error) {
+	b.mu.Lock()
+	b.dials++
+	gate := b.gate
+	b.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	conn := &fakeConnection{broker: b}
+	b.conns = append(b.conns, conn)
+	return conn, nil
+}
+
+// deliver hands a message to the consumer of queue and returns its delivery tag
+func (b *fakeBroker) deliver(t *testing.T, queue string, msg amqp.Publishing) uint64 {
+	t.Helper()
+
+	b.mu.Lock()
+	b.nextTag++
+	tag := b.nextTag
+	deliveries := b.consumers[queue]
+	b.mu.Unlock()
+	if deliveries == nil {
+		t.Fatalf("no consumer of queue %s", queue)
+	}
+
+	deliveries <- amqp.Delivery{
+		Acknowledger:  b,
+		DeliveryTag:   tag,
+		Headers:       msg.Headers,
+		ContentType:   msg.ContentType,
+		MessageId:     msg.MessageId,
+		CorrelationId: msg.CorrelationId,
+		Timestamp:     msg.Timestamp,
+		Body:          msg.Body,
+	}
+	return tag
+}
+
+// settlement returns how the delivery with the tag was settled, or "" if it
+// was not
+func (b *fakeBroker) settlement(tag uint64) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.settled[tag]
+}
+
+// publishedTo returns the messages published to queue
+func (b *fakeBroker) publishedTo(queue string) []amqp.Publishing {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var msgs []amqp.Publishing
+	for _, p := range b.published {
+		if p.queue == queue {
+			msgs = append(msgs, p.msg)
+		}
+	}
+	return msgs
+}
+
+func (b *fakeBroker) Ack(tag uint64, multiple bool) error {
+	return b.settle(tag, "ack")
+}
+
+func (b *fakeBroker) Nack(tag uint64, multiple, requeue bool) error {
+	if requeue {
+		return b.settle(tag, "requeue")
+	}
+	return b.settle(tag, "nack")
+}
+
+func (b *fakeBroker) Reject(tag uint64, requeue bool) error {
+	if requeue {
+		return b.settle(tag, "requeue")
+	}
+	return b.settle(tag, "reject")
+}
+
+func (b *fakeBroker) settle(tag uint64, how string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if previous, ok := b.settled[tag]; ok {
+		return errors.New("delivery already settled: " + previous)
+	}
+	b.settled[tag] = how
+	return nil
+}
+
+// fakeConnection is a connection to a fakeBroker
+type fakeConnection struct {
+	broker   *fakeBroker
+	mu       sync.Mutex
+	closed   bool
+	notifies []chan *amqp.Error
+	channels []*fakeChannel
+}
+
+func (c *fakeConnection) Channel() (channel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := &fakeChannel{broker: c.broker}
+	c.channels = append(c.channels, ch)
+	return ch, nil
+}
+
+func (c *fakeConnection) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notifies = append(c.notifies, receiver)
+	return receiver
+}
+
+func (c *fakeConnection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return amqp.ErrClosed
+	}
+	c.closed = true
+	for _, receiver := range c.notifies {
+		close(receiver)
+	}
+	return nil
+}
+
+// lose closes the connection as the broker does when it goes away, ending
+// the deliveries of its channels
+func (c *fakeConnection) lose() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for _, ch := range c.channels {
+		ch.Cancel("", false)
+	}
+	for _, receiver := range c.notifies {
+		receiver <- amqp.ErrClosed
+		close(receiver)
+	}
+}
+
+func (c *fakeConnection) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// fakeChannel is a channel of a fakeConnection
+type fakeChannel struct {
+	broker     *fakeBroker
+	deliveries chan amqp.Delivery
+	cancel     sync.Once
+}
+
+func (c *fakeChannel) Confirm(noWait bool) error { return nil }
+
+func (c *fakeChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	c.broker.declared[name] = args
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *fakeChannel) Qos(prefetchCount, prefetchSize int, global bool) error { return nil }
+
+func (c *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	c.deliveries = make(chan amqp.Delivery)
+	c.broker.consumers[queue] = c.deliveries
+	return c.deliveries, nil
+}
+
+func (c *fakeChannel) Cancel(consumer string, noWait bool) error {
+	c.cancel.Do(func() {
+		if c.deliveries != nil {
+			close(c.deliveries)
+		}
+	})
+	return nil
+}
+
+func (c *fakeChannel) Publish(ctx context.Context, queue string, msg amqp.Publishing) error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.broker.publishErr != nil {
+		return c.broker.publishErr
+	}
+	c.broker.published = append(c.broker.published, published{queue: queue, msg: msg})
+	return nil
+}
+
+// recorder is a handler recording the envelopes it is called with and
+// returning the errors queued for it, in order
+type recorder struct {
+	mu   sync.Mutex
+	envs []models.Envelope
+	errs []error
+	// notificationID is set on the envelopes, as the service does when it
+	// stores the notification
+	notificationID string
+}
+
+func (r *recorder) handle(env *models.Envelope) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if env.NotificationID == "" {
+		env.NotificationID = r.notificationID
+	}
+	r.envs = append(r.envs, *env)
+	if len(r.errs) > 0 {
+		err := r.errs[0]
+		r.errs = r.errs[1:]
+		return err
+	}
+	return nil
+}
+
+// handled returns the envelopes handled so far
+func (r *recorder) handled() []models.Envelope {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]models.Envelope(nil), r.envs...)
+}
+
+// testConfig returns a configuration consuming testQueue, giving up after 3
+// deliveries
+func testConfig() *config.Config {
+	return &config.Config{
+		Kafka: config.KafkaConfig{
+			Routes: []config.RouteConfig{{Topic: testQueue, Handler: config.DefaultHandler}},
+		},
+		AMQP: config.AMQPConfig{
+			ConsumerTag:     "consumer-1",
+			Prefetch:        4,
+			Concurrency:     2,
+			RetryDelay:      30 * time.Second,
+			MaxDeliveries:   3,
+			DeadLetterQueue: testDeadLetterQueue,
+		},
+	}
+}
+
+// startSource starts a source on broker, stopped when the test ends
+func startSource(t *testing.T, broker *fakeBroker, cfg *config.Config, handler ingest.Handler) *Source {
+	t.Helper()
+
+	source, err := newSource(cfg, map[string]ingest.Handler{config.DefaultHandler: handler}, nil, broker.dial)
+	if err != nil {
+		t.Fatalf("newSource: %v", err)
+	}
+	source.reconnectDelay = time.Millisecond
+	if err := source.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		source.Stop(ctx)
+	})
+	return source
+}
+
+// eventually fails the test if cond does not become true within a second
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// message is a JSON delivery with a trace-id header
+func message(payload string, headers amqp.Table) amqp.Publishing {
+	table := amqp.Table{"trace-id": "abc"}
+	for k, v := range headers {
+		table[k] = v
+	}
+	return amqp.Publishing{
+		Headers:     table,
+		ContentType: "application/json",
+		MessageId:   "msg-1",
+		Body:        []byte(payload),
+	}
+}
+
+func TestSourceDeclaresQueues(t *testing.T) {
+	broker := newFakeBroker()
+	startSource(t, broker, testConfig(), (&recorder{}).handle)
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	if _, ok := broker.declared[testQueue]; !ok {
+		t.Errorf("queue %s not declared", testQueue)
+	}
+	if _, ok := broker.declared[testDeadLetterQueue]; !ok {
+		t.Errorf("dead-letter queue %s not declared", testDeadLetterQueue)
+	}
+
+	// Retries expire after the retry delay back onto the queue
+	args, ok := broker.declared[testQueue+".retry"]
+	if !ok {
+		t.Fatalf("retry queue not declared")
+	}
+	if args["x-message-ttl"] != int64(30000) {
+		t.Errorf("x-message-ttl = %v, want 30000", args["x-message-ttl"])
+	}
+	if args["x-dead-letter-exchange"] != "" || args["x-dead-letter-routing-key"] != testQueue {
+		t.Errorf("dead-lettered to %v/%v, want the default exchange and %s",
+			args["x-dead-letter-exchange"], args["x-dead-letter-routing-key"], testQueue)
+	}
+}
+
+func TestSourceAcksHandledDeliveries(t *testing.T) {
+	broker := newFakeBroker()
+	handler := &recorder{}
+	startSource(t, broker, testConfig(), handler.handle)
+
+	tag := broker.deliver(t, testQueue, message(testPayload, nil))
+	eventually(t, "the delivery to be acked", func() bool { return broker.settlement(tag) == "ack" })
+
+	env := handler.handled()[0]
+	if env.Message.UserID != "user-1" || env.Topic != testQueue || env.MessageID != "msg-1" {
+		t.Errorf("envelope = %+v", env)
+	}
+	if env.Headers["trace-id"] != "abc" || env.Headers[headerContentType] != "application/json" {
+		t.Errorf("headers = %v, want trace-id and the content type", env.Headers)
+	}
+	if env.Attempt != 1 || env.MaxAttempts != 3 {
+		t.Errorf("attempt %d of %d, want 1 of 3", env.Attempt, env.MaxAttempts)
+	}
+	if msgs := broker.publishedTo(testDeadLetterQueue); len(msgs) != 0 {
+		t.Errorf("%d dead letters, want none", len(msgs))
+	}
+}
+
+func TestSourceRetriesTransientFailures(t *testing.T) {
+	broker := newFakeBroker()
+	handler := &recorder{
+		errs:           []error{errors.New("provider unavailable")},
+		notificationID: "notification-1",
+	}
+	startSource(t, broker, testConfig(), handler.handle)
+
+	tag := broker.deliver(t, testQueue, message(testPayload, nil))
+	eventually(t, "the delivery to be acked", func() bool { return broker.settlement(tag) == "ack" })
+
+	retries := broker.publishedTo(testQueue + ".retry")
+	if len(retries) != 1 {
+		t.Fatalf("%d retries published, want 1", len(retries))
+	}
+	retry := retries[0]
+	if retry.Headers[ingest.HeaderAttempt] != "2" || retry.Headers[ingest.HeaderNotificationID] != "notification-1" {
+		t.Errorf("retry headers = %v, want attempt 2 of notification-1", retry.Headers)
+	}
+	if retry.Headers["trace-id"] != "abc" || string(retry.Body) != testPayload || retry.DeliveryMode != amqp.Persistent {
+		t.Errorf("retry = %+v, want a persistent copy with the original headers", retry)
+	}
+
+	// The broker returns the retry to the queue once it expires
+	tag = broker.deliver(t, testQueue, retry)
+	eventually(t, "the retry to be acked", func() bool { return broker.settlement(tag) == "ack" })
+
+	env := handler.handled()[1]
+	if env.Attempt != 2 || env.NotificationID != "notification-1" {
+		t.Errorf("retry handled as attempt %d of %q, want attempt 2 of notification-1", env.Attempt, env.NotificationID)
+	}
+}
+
+func TestSourceDeadLetters(t *testing.T) {
+	unavailable := errors.New("provider unavailable")
+
+	tests := []struct {
+		name    string
+		payload string
+		headers amqp.Table
+		err     error
+		class   string
+	}{
+		{
+			name:    "decode error",
+			payload: `{"user_id":`,
+			class:   ingest.ErrorClassDecode,
+		},
+		{
+			name:    "permanent failure",
+			payload: testPayload,
+			err:     models.NewPermanentError(errors.New("address rejected")),
+			class:   ingest.ErrorClassPermanent,
+		},
+		{
+			name:    "deliveries exhausted",
+			payload: testPayload,
+			headers: amqp.Table{ingest.HeaderAttempt: "3"},
+			err:     unavailable,
+			class:   ingest.ErrorClassRetriesExhausted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := newFakeBroker()
+			handler := &recorder{}
+			if tt.err != nil {
+				handler.errs = []error{tt.err}
+			}
+			startSource(t, broker, testConfig(), handler.handle)
+
+			tag := broker.deliver(t, testQueue, message(tt.payload, tt.headers))
+			eventually(t, "the delivery to be acked", func() bool { return broker.settlement(tag) == "ack" })
+
+			letters := broker.publishedTo(testDeadLetterQueue)
+			if len(letters) != 1 {
+				t.Fatalf("%d dead letters, want 1", len(letters))
+			}
+			headers := letters[0].Headers
+			if headers[ingest.HeaderErrorClass] != tt.class || headers[ingest.HeaderSourceTopic] != testQueue {
+				t.Errorf("dead letter headers = %v, want class %s from %s", headers, tt.class, testQueue)
+			}
+			if headers["trace-id"] != "abc" || string(letters[0].Body) != tt.payload {
+				t.Errorf("dead letter = %+v, want the original headers and payload", letters[0])
+			}
+			if retries := broker.publishedTo(testQueue + ".retry"); len(retries) != 0 {
+				t.Errorf("%d retries published, want none", len(retries))
+			}
+		})
+	}
+}
+
+func TestSourceRequeuesWhenRepublishFails(t *testing.T) {
+	broker := newFakeBroker()
+	broker.publishErr = errors.New("channel closed")
+	handler := &recorder{errs: []error{errors.New("provider unavailable")}}
+	startSource(t, broker, testConfig(), handler.handle)
+
+	tag := broker.deliver(t, testQueue, message(testPayload, nil))
+	eventually(t, "the delivery to be requeued", func() bool { return broker.settlement(tag) == "requeue" })
+}
+
+func TestSourceRejectsWithoutDeadLetterQueue(t *testing.T) {
+	broker := newFakeBroker()
+	cfg := testConfig()
+	cfg.AMQP.DeadLetterQueue = ""
+	startSource(t, broker, cfg, (&recorder{}).handle)
+
+	tag := broker.deliver(t, testQueue, message(`{"user_id":`, nil))
+	eventually(t, "the delivery to be rejected", func() bool { return broker.settlement(tag) == "reject" })
+
+	if _, ok := broker.declared[""]; ok {
+		t.Error("declared a dead-letter queue without a name")
+	}
+}
+
+func TestSourceReconnects(t *testing.T) {
+	broker := newFakeBroker()
+	handler := &recorder{}
+	startSource(t, broker, testConfig(), handler.handle)
+
+	broker.mu.Lock()
+	first := broker.conns[0]
+	broker.mu.Unlock()
+	first.lose()
+
+	eventually(t, "the source to reconnect", func() bool {
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+		return len(broker.conns) == 2
+	})
+	tag := broker.deliver(t, testQueue, message(testPayload, nil))
+	eventually(t, "the delivery to be acked", func() bool { return broker.settlement(tag) == "ack" })
+}
+
+func TestSourceStopsWhileReconnecting(t *testing.T) {
+	broker := newFakeBroker()
+	source := startSource(t, broker, testConfig(), (&recorder{}).handle)
+
+	// The broker does not answer the reconnection until released
+	gate := make(chan struct{})
+	broker.mu.Lock()
+	broker.gate = gate
+	first := broker.conns[0]
+	broker.mu.Unlock()
+	first.lose()
+	eventually(t, "the source to reconnect", func() bool {
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+		return broker.dials == 2
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		source.Stop(context.Background())
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop waited for the broker to answer")
+	}
+
+	// The connection made after Stop is closed right away
+	close(gate)
+	eventually(t, "the late connection", func() bool {
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+		return len(broker.conns) == 2
+	})
+	broker.mu.Lock()
+	late := broker.conns[1]
+	broker.mu.Unlock()
+	eventually(t, "the late connection to be closed", late.isClosed)
+}
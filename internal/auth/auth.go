@@ -0,0 +1,76 @@
+// Package auth authenticates the clients of the HTTP and gRPC APIs by the
+// bearer token they present, and carries the name of the authenticated
+// client in the request context.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrMissingToken is returned when no credentials were presented
+	ErrMissingToken = errors.New("missing authorization")
+	// ErrNotBearer is returned when the credentials are not a bearer token
+	ErrNotBearer = errors.New("authorization must be a bearer token")
+	// ErrInvalidToken is returned when the token is not one of the clients'
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// callerKey is the context key of the authenticated client name
+type callerKey struct{}
+
+// WithCaller returns ctx carrying the name of the authenticated client
+func WithCaller(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, callerKey{}, name)
+}
+
+// Caller returns the name of the client that authenticated the request, or
+// "" if it was not authenticated
+func Caller(ctx context.Context) string {
+	name, _ := ctx.Value(callerKey{}).(string)
+	return name
+}
+
+// Tokens checks bearer tokens against the configured client tokens
+type Tokens struct {
+	// tokens maps each token to its client name
+	tokens map[string]string
+}
+
+// NewTokens creates the tokens of clients, keyed by client name
+func NewTokens(clients map[string]string) *Tokens {
+	tokens := make(map[string]string, len(clients))
+	for name, token := range clients {
+		tokens[token] = name
+	}
+	return &Tokens{tokens: tokens}
+}
+
+// Authenticate returns the name of the client presenting authorization, the
+// value of an Authorization header of the form "Bearer <token>"
+func (t *Tokens) Authenticate(authorization string) (string, error) {
+	if authorization == "" {
+		return "", ErrMissingToken
+	}
+
+	scheme, presented, found := strings.Cut(authorization, " ")
+	if !found || !strings.EqualFold(scheme, "bearer") {
+		return "", ErrNotBearer
+	}
+
+	// Compare against every token so the time taken does not reveal a match
+	caller := ""
+	for token, name := range t.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(presented)) == 1 {
+			caller = name
+		}
+	}
+	if caller == "" {
+		return "", ErrInvalidToken
+	}
+
+	return caller, nil
+}
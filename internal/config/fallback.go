@@ -0,0 +1,64 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/notification_service/internal/models"
+)
+
+// FallbackConfig holds the fallback policies of the notification types
+type FallbackConfig struct {
+	// Policies apply to the notifications of a type that do not set their
+	// own, keyed by type
+	Policies map[models.NotificationType]*models.FallbackPolicy
+}
+
+// loadFallbackPolicies reads the fallback policies file at path, a JSON
+// object mapping notification types to their policy. There are no policies
+// if path is empty.
+func loadFallbackPolicies(path string) (map[models.NotificationType]*models.FallbackPolicy, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fallback policies file: %w", err)
+	}
+
+	var policies map[models.NotificationType]*models.FallbackPolicy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("failed to parse fallback policies file %s: %w", path, err)
+	}
+
+	return policies, nil
+}
+
+// Validate checks that the fallback policies are well formed. Whether a
+// notifier is registered for their types is only known once the notifiers
+// are, so the service checks that when it starts.
+func (f *FallbackConfig) Validate() error {
+	var errs []error
+	for notificationType, policy := range f.Policies {
+		if notificationType == "" {
+			errs = append(errs, errors.New("fallback policy of an empty notification type"))
+			continue
+		}
+		if policy == nil {
+			errs = append(errs, fmt.Errorf("fallback policy of %s must be an object", notificationType))
+			continue
+		}
+		if err := policy.Validate(nil); err != nil {
+			errs = append(errs, fmt.Errorf("fallback policy of %s: %w", notificationType, err))
+		}
+		for _, channel := range policy.Channels {
+			if channel == notificationType {
+				errs = append(errs, fmt.Errorf("fallback policy of %s must not fall back to %s", notificationType, channel))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// RouteConfig maps Kafka topics to the handler that processes their messages
+type RouteConfig struct {
+	// Topic is a topic name, or a regular expression if it starts with "^"
+	Topic string `json:"topic"`
+	// Handler is the name of the handler registered for the route
+	Handler string `json:"handler"`
+	// Priority is applied to messages that do not specify one
+	Priority string `json:"priority,omitempty"`
+	// Format is the payload encoding: "json" (the default), "protobuf" or
+	// "avro". Payloads framed with a schema registry ID are decoded by their
+	// schema instead.
+	Format string `json:"format,omitempty"`
+}
+
+// IsPattern reports whether the route subscribes to a topic pattern
+func (r RouteConfig) IsPattern() bool {
+	return strings.HasPrefix(r.Topic, "^")
+}
+
+// DefaultHandler is the handler name used when no routes file is configured
+const DefaultHandler = "notifications"
+
+// loadRoutes reads the routes file at path, a JSON array of RouteConfig. If
+// path is empty a single route consumes topic with the default handler.
+func loadRoutes(path, topic string) ([]RouteConfig, error) {
+	if path == "" {
+		return []RouteConfig{{Topic: topic, Handler: DefaultHandler}}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routes file: %w", err)
+	}
+
+	var routes []RouteConfig
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil, fmt.Errorf("failed to parse routes file %s: %w", path, err)
+	}
+
+	return routes, nil
+}
+
+// validateRoutes checks that routes are well formed and that no pattern
+// would also subscribe to the retry or dead-letter topics
+func (k *KafkaConfig) validateRoutes() []error {
+	var errs []error
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if len(k.Routes) == 0 {
+		addErr("KAFKA_ROUTES_FILE must define at least one route")
+	}
+
+	internalTopics := []string{k.DeadLetterTopic}
+	if k.StatusTopic != "" {
+		internalTopics = append(internalTopics, k.StatusTopic)
+	}
+	for _, delay := range k.RetryDelays {
+		internalTopics = append(internalTopics, RetryTopic(k.Topic, delay))
+	}
+
+	seen := make(map[string]bool)
+	for i, route := range k.Routes {
+		if route.Topic == "" {
+			addErr("route %d: topic must be provided", i)
+			continue
+		}
+		if seen[route.Topic] {
+			addErr("route %d: topic %s is routed more than once", i, route.Topic)
+		}
+		seen[route.Topic] = true
+
+		if route.Handler == "" {
+			addErr("route %s: handler must be provided", route.Topic)
+		}
+
+		if !route.IsPattern() {
+			continue
+		}
+
+		pattern, err := regexp.Compile(route.Topic)
+		if err != nil {
+			addErr("route %s: invalid topic pattern: %v", route.Topic, err)
+			continue
+		}
+		for _, topic := range internalTopics {
+			if pattern.MatchString(topic) {
+				addErr("route %s: pattern matches internal topic %s", route.Topic, topic)
+			}
+		}
+	}
+
+	return errs
+}
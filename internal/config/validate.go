@@ -0,0 +1,420 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/notification_service/internal/models"
+)
+
+// managedKafkaProperties are librdkafka settings derived from dedicated
+// configuration fields, which KAFKA_PROPERTIES may not override
+var managedKafkaProperties = map[string]string{
+	"bootstrap.servers":        "KAFKA_BOOTSTRAP_SERVERS",
+	"group.id":                 "KAFKA_GROUP_ID",
+	"auto.offset.reset":        "KAFKA_AUTO_OFFSET_RESET",
+	"session.timeout.ms":       "KAFKA_SESSION_TIMEOUT",
+	"max.poll.interval.ms":     "KAFKA_MAX_POLL_INTERVAL",
+	"enable.auto.commit":       "KAFKA_COMMIT_MODE",
+	"enable.auto.offset.store": "KAFKA_COMMIT_MODE",
+	"security.protocol":        "KAFKA_SECURITY_PROTOCOL",
+	"sasl.mechanisms":          "KAFKA_SASL_MECHANISM",
+	"sasl.mechanism":           "KAFKA_SASL_MECHANISM",
+	"sasl.username":            "KAFKA_SASL_USERNAME",
+	"sasl.password":            "KAFKA_SASL_PASSWORD",
+	"ssl.ca.location":          "KAFKA_SSL_CA_LOCATION",
+	"ssl.certificate.location": "KAFKA_SSL_CERTIFICATE_LOCATION",
+	"ssl.key.location":         "KAFKA_SSL_KEY_LOCATION",
+	"ssl.key.password":         "KAFKA_SSL_KEY_PASSWORD",
+}
+
+// Validate checks the configuration for missing or inconsistent settings
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Service.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("SHUTDOWN_TIMEOUT must be positive"))
+	}
+
+	// The Kafka settings only apply to the Kafka transport, except for the
+	// routes, which every transport uses
+	switch c.Service.Transport {
+	case TransportKafka:
+		if err := c.Kafka.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	case TransportRedis:
+		if err := c.Redis.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	case TransportAMQP:
+		if err := c.AMQP.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	default:
+		errs = append(errs, fmt.Errorf("INGEST_TRANSPORT must be %s, %s or %s, got %q", TransportKafka, TransportRedis, TransportAMQP, c.Service.Transport))
+	}
+
+	switch c.Service.SubmitMode {
+	case SubmitModeInline:
+	case SubmitModeEnqueue:
+		if c.Service.Transport != TransportKafka {
+			errs = append(errs, fmt.Errorf("SUBMIT_MODE=%s requires INGEST_TRANSPORT=%s", SubmitModeEnqueue, TransportKafka))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("SUBMIT_MODE must be %s or %s, got %q", SubmitModeInline, SubmitModeEnqueue, c.Service.SubmitMode))
+	}
+
+	if c.HTTP.Addr != "" {
+		if err := c.HTTP.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.GRPC.Addr != "" {
+		if err := c.GRPC.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := c.BulkResend.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Fallback.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Contacts.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Preferences.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Streams and queues cannot be subscribed to by pattern
+	if c.Service.Transport != TransportKafka {
+		errs = append(errs, c.Kafka.validateRoutes()...)
+		for _, route := range c.Kafka.Routes {
+			if route.IsPattern() {
+				errs = append(errs, fmt.Errorf("route %s: topic patterns are not supported with INGEST_TRANSPORT=%s", route.Topic, c.Service.Transport))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate checks the Redis configuration for missing or inconsistent settings
+func (r *RedisConfig) Validate() error {
+	var errs []error
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if r.Addr == "" {
+		addErr("REDIS_ADDR must be provided")
+	}
+	if r.Group == "" {
+		addErr("REDIS_GROUP must be provided")
+	}
+	if r.Consumer == "" {
+		addErr("REDIS_CONSUMER must be provided")
+	}
+	if r.BatchSize <= 0 {
+		addErr("REDIS_BATCH_SIZE must be positive")
+	}
+	if r.BlockTimeout <= 0 {
+		addErr("REDIS_BLOCK_TIMEOUT must be positive")
+	}
+	if r.ClaimMinIdle <= 0 {
+		addErr("REDIS_CLAIM_MIN_IDLE must be positive")
+	}
+	if r.ClaimInterval <= 0 {
+		addErr("REDIS_CLAIM_INTERVAL must be positive")
+	}
+	if r.MaxDeliveries <= 0 {
+		addErr("REDIS_MAX_DELIVERIES must be positive")
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate checks the HTTP API configuration for missing or inconsistent settings
+func (h *HTTPConfig) Validate() error {
+	var errs []error
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if len(h.AuthTokens) == 0 {
+		addErr("HTTP_AUTH_TOKENS is required when HTTP_ADDR is set")
+	}
+	for name, token := range h.AuthTokens {
+		if token == "" {
+			addErr("HTTP_AUTH_TOKENS: client %s has an empty token", name)
+		}
+	}
+	if h.MaxBodyBytes <= 0 {
+		addErr("HTTP_MAX_BODY_BYTES must be positive")
+	}
+	if h.MaxBatchSize <= 0 {
+		addErr("HTTP_MAX_BATCH_SIZE must be positive")
+	}
+	if h.ReadTimeout <= 0 || h.WriteTimeout <= 0 {
+		addErr("HTTP_READ_TIMEOUT and HTTP_WRITE_TIMEOUT must be positive")
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate checks the gRPC API configuration for missing or inconsistent settings
+func (g *GRPCConfig) Validate() error {
+	var errs []error
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if len(g.AuthTokens) == 0 {
+		addErr("GRPC_AUTH_TOKENS is required when GRPC_ADDR is set")
+	}
+	for name, token := range g.AuthTokens {
+		if token == "" {
+			addErr("GRPC_AUTH_TOKENS: client %s has an empty token", name)
+		}
+	}
+	if g.DefaultTimeout <= 0 || g.MaxTimeout <= 0 {
+		addErr("GRPC_DEFAULT_TIMEOUT and GRPC_MAX_TIMEOUT must be positive")
+	} else if g.DefaultTimeout > g.MaxTimeout {
+		addErr("GRPC_DEFAULT_TIMEOUT must not exceed GRPC_MAX_TIMEOUT")
+	}
+	if g.MaxBatchSize <= 0 {
+		addErr("GRPC_MAX_BATCH_SIZE must be positive")
+	}
+	if g.WatchPollInterval <= 0 {
+		addErr("GRPC_WATCH_POLL_INTERVAL must be positive")
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate checks the bulk resend configuration for missing or inconsistent settings
+func (b *BulkResendConfig) Validate() error {
+	var errs []error
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if b.DefaultRate <= 0 || b.MaxRate <= 0 {
+		addErr("BULK_RESEND_DEFAULT_RATE and BULK_RESEND_MAX_RATE must be positive")
+	} else if b.DefaultRate > b.MaxRate {
+		addErr("BULK_RESEND_DEFAULT_RATE must not exceed BULK_RESEND_MAX_RATE")
+	}
+	if b.StaleAfter <= 0 {
+		addErr("BULK_RESEND_STALE_AFTER must be positive")
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate checks the contacts configuration for missing or inconsistent settings
+func (c *ContactsConfig) Validate() error {
+	var errs []error
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	switch c.Source {
+	case ContactsSourceSupabase, ContactsSourceNone:
+	case ContactsSourceFile:
+		if c.File == "" {
+			addErr("CONTACTS_FILE must be provided with CONTACTS_SOURCE=%s", ContactsSourceFile)
+		}
+	default:
+		addErr("CONTACTS_SOURCE must be %s, %s or %s, got %q", ContactsSourceSupabase, ContactsSourceFile, ContactsSourceNone, c.Source)
+	}
+	if c.CacheTTL < 0 {
+		addErr("CONTACTS_CACHE_TTL must not be negative")
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate checks the preferences configuration for missing or inconsistent settings
+func (c *PreferencesConfig) Validate() error {
+	var errs []error
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	switch c.Source {
+	case PreferencesSourceSupabase, PreferencesSourceNone:
+	default:
+		addErr("PREFERENCES_SOURCE must be %s or %s, got %q", PreferencesSourceSupabase, PreferencesSourceNone, c.Source)
+	}
+	for _, category := range c.RequiredCategories {
+		if !models.ValidCategory(category) {
+			addErr("PREFERENCES_REQUIRED_CATEGORIES: invalid category %q", category)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate checks the AMQP configuration for missing or inconsistent settings
+func (a *AMQPConfig) Validate() error {
+	var errs []error
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if a.URL == "" {
+		addErr("AMQP_URL must be provided")
+	}
+	if a.Prefetch <= 0 {
+		addErr("AMQP_PREFETCH must be positive")
+	}
+	if a.Concurrency <= 0 {
+		addErr("AMQP_CONCURRENCY must be positive")
+	}
+	if a.Concurrency > a.Prefetch {
+		addErr("AMQP_CONCURRENCY (%d) must not exceed AMQP_PREFETCH (%d)", a.Concurrency, a.Prefetch)
+	}
+	if a.RetryDelay <= 0 {
+		addErr("AMQP_RETRY_DELAY must be positive")
+	}
+	if a.MaxDeliveries <= 0 {
+		addErr("AMQP_MAX_DELIVERIES must be positive")
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate checks the Kafka configuration for missing or inconsistent settings
+func (k *KafkaConfig) Validate() error {
+	var errs []error
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if k.BootstrapServers == "" {
+		addErr("KAFKA_BOOTSTRAP_SERVERS must be provided")
+	}
+	if k.Topic == "" {
+		addErr("KAFKA_TOPIC must be provided")
+	}
+	if k.GroupID == "" {
+		addErr("KAFKA_GROUP_ID must be provided")
+	}
+
+	switch k.AutoOffsetReset {
+	case "earliest", "latest", "error":
+	default:
+		addErr("KAFKA_AUTO_OFFSET_RESET must be earliest, latest or error, got %q", k.AutoOffsetReset)
+	}
+
+	if k.SessionTimeout <= 0 {
+		addErr("KAFKA_SESSION_TIMEOUT must be positive")
+	}
+	if k.MaxPollInterval < k.SessionTimeout {
+		addErr("KAFKA_MAX_POLL_INTERVAL (%s) must not be less than KAFKA_SESSION_TIMEOUT (%s)", k.MaxPollInterval, k.SessionTimeout)
+	}
+
+	switch k.CommitMode {
+	case CommitModeAuto, CommitModeManual:
+	default:
+		addErr("KAFKA_COMMIT_MODE must be %s or %s, got %q", CommitModeAuto, CommitModeManual, k.CommitMode)
+	}
+	if k.CommitMode == CommitModeManual && k.CommitBatchSize <= 0 {
+		addErr("KAFKA_COMMIT_BATCH_SIZE must be positive")
+	}
+
+	for _, delay := range k.RetryDelays {
+		if delay <= 0 {
+			addErr("KAFKA_RETRY_DELAYS must be positive, got %s", delay)
+		}
+	}
+	if k.WorkerConcurrency <= 0 {
+		addErr("KAFKA_WORKER_CONCURRENCY must be positive")
+	}
+	if k.WorkerQueueDepth < 0 {
+		addErr("KAFKA_WORKER_QUEUE_DEPTH must not be negative")
+	}
+
+	errs = append(errs, k.validateSecurity()...)
+	errs = append(errs, k.validateRoutes()...)
+
+	for key := range k.Properties {
+		if setting, ok := managedKafkaProperties[key]; ok {
+			addErr("KAFKA_PROPERTIES may not set %s, use %s instead", key, setting)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateSecurity checks that SASL and TLS settings match the security protocol
+func (k *KafkaConfig) validateSecurity() []error {
+	var errs []error
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	var usesSASL, usesTLS bool
+	switch k.SecurityProtocol {
+	case SecurityProtocolPlaintext:
+	case SecurityProtocolSSL:
+		usesTLS = true
+	case SecurityProtocolSASLPlaintext:
+		usesSASL = true
+	case SecurityProtocolSASLSSL:
+		usesSASL, usesTLS = true, true
+	default:
+		addErr("KAFKA_SECURITY_PROTOCOL must be one of %s, %s, %s or %s, got %q",
+			SecurityProtocolPlaintext, SecurityProtocolSSL, SecurityProtocolSASLPlaintext, SecurityProtocolSASLSSL, k.SecurityProtocol)
+		return errs
+	}
+
+	if usesSASL {
+		switch strings.ToUpper(k.SASLMechanism) {
+		case "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+		case "":
+			addErr("KAFKA_SASL_MECHANISM must be provided when KAFKA_SECURITY_PROTOCOL is %s", k.SecurityProtocol)
+		default:
+			addErr("KAFKA_SASL_MECHANISM must be PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512, got %q", k.SASLMechanism)
+		}
+		if k.SASLUsername == "" || k.SASLPassword == "" {
+			addErr("KAFKA_SASL_USERNAME and KAFKA_SASL_PASSWORD must be provided when KAFKA_SECURITY_PROTOCOL is %s", k.SecurityProtocol)
+		}
+	} else if k.SASLMechanism != "" || k.SASLUsername != "" || k.SASLPassword != "" {
+		addErr("SASL settings require KAFKA_SECURITY_PROTOCOL %s or %s", SecurityProtocolSASLPlaintext, SecurityProtocolSASLSSL)
+	}
+
+	if !usesTLS {
+		if k.SSLCALocation != "" || k.SSLCertificateLocation != "" || k.SSLKeyLocation != "" || k.SSLKeyPassword != "" {
+			addErr("TLS settings require KAFKA_SECURITY_PROTOCOL %s or %s", SecurityProtocolSSL, SecurityProtocolSASLSSL)
+		}
+		return errs
+	}
+
+	if (k.SSLCertificateLocation == "") != (k.SSLKeyLocation == "") {
+		addErr("KAFKA_SSL_CERTIFICATE_LOCATION and KAFKA_SSL_KEY_LOCATION must be provided together")
+	}
+	if k.SSLKeyPassword != "" && k.SSLKeyLocation == "" {
+		addErr("KAFKA_SSL_KEY_PASSWORD requires KAFKA_SSL_KEY_LOCATION")
+	}
+
+	tlsFiles := []struct{ setting, path string }{
+		{"KAFKA_SSL_CA_LOCATION", k.SSLCALocation},
+		{"KAFKA_SSL_CERTIFICATE_LOCATION", k.SSLCertificateLocation},
+		{"KAFKA_SSL_KEY_LOCATION", k.SSLKeyLocation},
+	}
+	for _, f := range tlsFiles {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			addErr("%s: %v", f.setting, err)
+		}
+	}
+
+	return errs
+}
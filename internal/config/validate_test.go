@@ -0,0 +1,225 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validKafkaConfig returns a valid plaintext Kafka configuration
+func validKafkaConfig() KafkaConfig {
+	return KafkaConfig{
+		BootstrapServers:  "localhost:9092",
+		Topic:             "notifications",
+		GroupID:           "notification-service",
+		AutoOffsetReset:   "earliest",
+		SessionTimeout:    10 * time.Second,
+		MaxPollInterval:   5 * time.Minute,
+		CommitMode:        CommitModeManual,
+		CommitBatchSize:   100,
+		RetryDelays:       []time.Duration{time.Minute},
+		WorkerConcurrency: 4,
+		WorkerQueueDepth:  16,
+		SecurityProtocol:  SecurityProtocolPlaintext,
+		DeadLetterTopic:   "notifications.dlq",
+		Routes:            []RouteConfig{{Topic: "notifications", Handler: DefaultHandler}},
+	}
+}
+
+// validConfig returns a valid configuration consuming through transport
+func validConfig(transport string) *Config {
+	return &Config{
+		Service: ServiceConfig{ShutdownTimeout: 30 * time.Second, Transport: transport, SubmitMode: SubmitModeInline},
+		Kafka:   validKafkaConfig(),
+		Redis: RedisConfig{
+			Addr:          "localhost:6379",
+			Group:         "notification-service",
+			Consumer:      "consumer-1",
+			BatchSize:     10,
+			BlockTimeout:  time.Second,
+			ClaimMinIdle:  time.Minute,
+			ClaimInterval: time.Minute,
+			MaxDeliveries: 5,
+		},
+		AMQP: AMQPConfig{
+			URL:           "amqp://localhost",
+			Prefetch:      10,
+			Concurrency:   4,
+			RetryDelay:    time.Second,
+			MaxDeliveries: 5,
+		},
+		BulkResend:  BulkResendConfig{DefaultRate: 10, MaxRate: 100, StaleAfter: time.Minute},
+		Contacts:    ContactsConfig{Source: ContactsSourceNone},
+		Preferences: PreferencesConfig{Source: PreferencesSourceNone},
+	}
+}
+
+// tempFile creates an empty file and returns its path
+func tempFile(t *testing.T, name string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+// checkError fails the test unless err mentions want, or is nil if want is
+// empty
+func checkError(t *testing.T, err error, want string) {
+	t.Helper()
+	switch {
+	case want == "" && err != nil:
+		t.Errorf("Validate: %v", err)
+	case want != "" && err == nil:
+		t.Errorf("Validate succeeded, want an error about %s", want)
+	case want != "" && !strings.Contains(err.Error(), want):
+		t.Errorf("Validate = %v, want an error about %s", err, want)
+	}
+}
+
+func TestKafkaConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(k *KafkaConfig)
+		want   string
+	}{
+		{name: "valid", modify: func(k *KafkaConfig) {}},
+		{name: "no bootstrap servers", modify: func(k *KafkaConfig) { k.BootstrapServers = "" }, want: "KAFKA_BOOTSTRAP_SERVERS"},
+		{name: "no group", modify: func(k *KafkaConfig) { k.GroupID = "" }, want: "KAFKA_GROUP_ID"},
+		{name: "unknown offset reset", modify: func(k *KafkaConfig) { k.AutoOffsetReset = "smallest" }, want: "KAFKA_AUTO_OFFSET_RESET"},
+		{name: "poll interval below session timeout", modify: func(k *KafkaConfig) { k.MaxPollInterval = time.Second }, want: "KAFKA_MAX_POLL_INTERVAL"},
+		{name: "unknown commit mode", modify: func(k *KafkaConfig) { k.CommitMode = "sometimes" }, want: "KAFKA_COMMIT_MODE"},
+		{name: "manual commits without a batch size", modify: func(k *KafkaConfig) { k.CommitBatchSize = 0 }, want: "KAFKA_COMMIT_BATCH_SIZE"},
+		{name: "auto commits without a batch size", modify: func(k *KafkaConfig) { k.CommitMode, k.CommitBatchSize = CommitModeAuto, 0 }},
+		{name: "negative retry delay", modify: func(k *KafkaConfig) { k.RetryDelays = []time.Duration{-time.Second} }, want: "KAFKA_RETRY_DELAYS"},
+		{name: "no workers", modify: func(k *KafkaConfig) { k.WorkerConcurrency = 0 }, want: "KAFKA_WORKER_CONCURRENCY"},
+		{name: "no routes", modify: func(k *KafkaConfig) { k.Routes = nil }, want: "KAFKA_ROUTES_FILE"},
+		{name: "managed property", modify: func(k *KafkaConfig) { k.Properties = map[string]string{"group.id": "other"} }, want: "KAFKA_PROPERTIES may not set group.id"},
+		{name: "other property", modify: func(k *KafkaConfig) { k.Properties = map[string]string{"fetch.min.bytes": "1024"} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := validKafkaConfig()
+			tt.modify(&k)
+			checkError(t, k.Validate(), tt.want)
+		})
+	}
+}
+
+func TestKafkaConfigValidateSecurity(t *testing.T) {
+	caFile := tempFile(t, "ca.pem")
+	certFile := tempFile(t, "client.pem")
+	keyFile := tempFile(t, "client.key")
+	sasl := func(k *KafkaConfig) {
+		k.SASLMechanism, k.SASLUsername, k.SASLPassword = "SCRAM-SHA-512", "user", "password"
+	}
+
+	tests := []struct {
+		name   string
+		modify func(k *KafkaConfig)
+		want   string
+	}{
+		{name: "plaintext", modify: func(k *KafkaConfig) {}},
+		{name: "unknown protocol", modify: func(k *KafkaConfig) { k.SecurityProtocol = "tls" }, want: "KAFKA_SECURITY_PROTOCOL must be one of"},
+		{name: "SASL settings without SASL", modify: sasl, want: "SASL settings require"},
+		{name: "TLS settings without TLS", modify: func(k *KafkaConfig) { k.SSLCALocation = caFile }, want: "TLS settings require"},
+		{
+			name: "SASL",
+			modify: func(k *KafkaConfig) {
+				k.SecurityProtocol = SecurityProtocolSASLPlaintext
+				sasl(k)
+			},
+		},
+		{
+			name: "SASL without a mechanism",
+			modify: func(k *KafkaConfig) {
+				k.SecurityProtocol, k.SASLUsername, k.SASLPassword = SecurityProtocolSASLPlaintext, "user", "password"
+			},
+			want: "KAFKA_SASL_MECHANISM must be provided",
+		},
+		{
+			name: "unknown SASL mechanism",
+			modify: func(k *KafkaConfig) {
+				k.SecurityProtocol = SecurityProtocolSASLPlaintext
+				sasl(k)
+				k.SASLMechanism = "GSSAPI"
+			},
+			want: "KAFKA_SASL_MECHANISM must be PLAIN",
+		},
+		{
+			name:   "SASL without credentials",
+			modify: func(k *KafkaConfig) { k.SecurityProtocol, k.SASLMechanism = SecurityProtocolSASLPlaintext, "PLAIN" },
+			want:   "KAFKA_SASL_USERNAME and KAFKA_SASL_PASSWORD",
+		},
+		{name: "TLS with the system CAs", modify: func(k *KafkaConfig) { k.SecurityProtocol = SecurityProtocolSSL }},
+		{
+			name: "mutual TLS",
+			modify: func(k *KafkaConfig) {
+				k.SecurityProtocol = SecurityProtocolSSL
+				k.SSLCALocation, k.SSLCertificateLocation, k.SSLKeyLocation, k.SSLKeyPassword = caFile, certFile, keyFile, "secret"
+			},
+		},
+		{
+			name: "certificate without key",
+			modify: func(k *KafkaConfig) {
+				k.SecurityProtocol, k.SSLCertificateLocation = SecurityProtocolSSL, certFile
+			},
+			want: "must be provided together",
+		},
+		{
+			name:   "key password without key",
+			modify: func(k *KafkaConfig) { k.SecurityProtocol, k.SSLKeyPassword = SecurityProtocolSSL, "secret" },
+			want:   "KAFKA_SSL_KEY_PASSWORD requires KAFKA_SSL_KEY_LOCATION",
+		},
+		{
+			name: "missing CA file",
+			modify: func(k *KafkaConfig) {
+				k.SecurityProtocol, k.SSLCALocation = SecurityProtocolSSL, filepath.Join(t.TempDir(), "missing.pem")
+			},
+			want: "KAFKA_SSL_CA_LOCATION",
+		},
+		{
+			name: "SASL over TLS",
+			modify: func(k *KafkaConfig) {
+				k.SecurityProtocol, k.SSLCALocation = SecurityProtocolSASLSSL, caFile
+				sasl(k)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := validKafkaConfig()
+			tt.modify(&k)
+			checkError(t, k.Validate(), tt.want)
+		})
+	}
+}
+
+func TestConfigValidatesKafkaOnlyForKafkaTransport(t *testing.T) {
+	tests := []struct {
+		transport string
+		want      string
+	}{
+		{transport: TransportKafka, want: "KAFKA_BOOTSTRAP_SERVERS"},
+		{transport: TransportRedis},
+		{transport: TransportAMQP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.transport, func(t *testing.T) {
+			cfg := validConfig(tt.transport)
+			cfg.Kafka.BootstrapServers = ""
+			cfg.Kafka.SecurityProtocol = SecurityProtocolSASLSSL
+			checkError(t, cfg.Validate(), tt.want)
+		})
+	}
+
+	// Every transport routes messages by the Kafka routes
+	for _, transport := range []string{TransportRedis, TransportAMQP} {
+		cfg := validConfig(transport)
+		cfg.Kafka.Routes = []RouteConfig{{Topic: "notifications"}}
+		checkError(t, cfg.Validate(), "handler must be provided")
+	}
+}
@@ -0,0 +1,95 @@
+package contacts
+
+import (
+	"sync"
+	"time"
+
+	"github.com/notification_service/internal/models"
+)
+
+// Cache caches the contacts looked up by another resolver for a TTL. Users
+// without contacts are cached too; failed lookups are not.
+type Cache struct {
+	resolver Resolver
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// generation changes with every invalidation, so that lookups started
+	// before one do not cache what they read
+	generation uint64
+	// sweepAt is when expired entries are dropped next
+	sweepAt time.Time
+}
+
+// cacheEntry is the cached contacts of a user
+type cacheEntry struct {
+	contacts  map[models.NotificationType]string
+	expiresAt time.Time
+}
+
+// NewCache creates a cache in front of resolver keeping lookups for ttl
+func NewCache(resolver Resolver, ttl time.Duration) *Cache {
+	return &Cache{
+		resolver: resolver,
+		ttl:      ttl,
+		entries:  make(map[string]cacheEntry),
+		sweepAt:  time.Now().Add(ttl),
+	}
+}
+
+// Contacts returns the cached contacts of a user, looking them up if they
+// are not cached or expired
+func (c *Cache) Contacts(userID string) (map[models.NotificationType]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[userID]
+	generation := c.generation
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.contacts, nil
+	}
+
+	contacts, err := c.resolver.Contacts(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.After(c.sweepAt) {
+		c.evictExpired(now)
+		c.sweepAt = now.Add(c.ttl)
+	}
+	if c.generation == generation {
+		c.entries[userID] = cacheEntry{contacts: contacts, expiresAt: now.Add(c.ttl)}
+	}
+	return contacts, nil
+}
+
+// Invalidate drops the cached contacts of a user, so the next lookup reads
+// them again, e.g. after the user changed them
+func (c *Cache) Invalidate(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, userID)
+	c.generation++
+}
+
+// InvalidateAll drops all cached contacts
+func (c *Cache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]cacheEntry)
+	c.generation++
+}
+
+// evictExpired drops the entries that expired before now. c.mu must be held.
+func (c *Cache) evictExpired(now time.Time) {
+	for userID, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, userID)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package contacts
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/notification_service/internal/models"
+)
+
+// countingResolver counts the lookups of the directory it wraps, and fails
+// them with err if set
+type countingResolver struct {
+	directory *Memory
+
+	mu      sync.Mutex
+	lookups int
+	err     error
+}
+
+func (r *countingResolver) Contacts(userID string) (map[models.NotificationType]string, error) {
+	r.mu.Lock()
+	r.lookups++
+	err := r.err
+	r.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return r.directory.Contacts(userID)
+}
+
+func (r *countingResolver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lookups
+}
+
+// lookup returns the email address of a user through resolver
+func lookup(t *testing.T, resolver Resolver, userID string) string {
+	t.Helper()
+
+	contacts, err := resolver.Contacts(userID)
+	if err != nil {
+		t.Fatalf("Contacts(%s): %v", userID, err)
+	}
+	return contacts[models.NotificationTypeEmail]
+}
+
+func TestCacheKeepsLookupsForTTL(t *testing.T) {
+	directory := NewMemory()
+	directory.Set("user-1", models.NotificationTypeEmail, "old@example.com")
+	resolver := &countingResolver{directory: directory}
+	cache := NewCache(resolver, 50*time.Millisecond)
+
+	if got := lookup(t, cache, "user-1"); got != "old@example.com" {
+		t.Errorf("email = %q, want old@example.com", got)
+	}
+
+	// The cached address is returned until it expires
+	directory.Set("user-1", models.NotificationTypeEmail, "new@example.com")
+	if got := lookup(t, cache, "user-1"); got != "old@example.com" {
+		t.Errorf("email = %q, want the cached old@example.com", got)
+	}
+	if n := resolver.count(); n != 1 {
+		t.Errorf("%d lookups, want 1", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if got := lookup(t, cache, "user-1"); got != "new@example.com" {
+		t.Errorf("email = %q after the TTL, want new@example.com", got)
+	}
+	if n := resolver.count(); n != 2 {
+		t.Errorf("%d lookups, want 2", n)
+	}
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	directory := NewMemory()
+	directory.Set("user-1", models.NotificationTypeEmail, "one@example.com")
+	directory.Set("user-2", models.NotificationTypeEmail, "two@example.com")
+	resolver := &countingResolver{directory: directory}
+	cache := NewCache(resolver, time.Hour)
+
+	lookup(t, cache, "user-1")
+	lookup(t, cache, "user-2")
+
+	directory.Set("user-1", models.NotificationTypeEmail, "new-one@example.com")
+	directory.Set("user-2", models.NotificationTypeEmail, "new-two@example.com")
+	cache.Invalidate("user-1")
+	if got := lookup(t, cache, "user-1"); got != "new-one@example.com" {
+		t.Errorf("user-1 email = %q after Invalidate, want new-one@example.com", got)
+	}
+	if got := lookup(t, cache, "user-2"); got != "two@example.com" {
+		t.Errorf("user-2 email = %q, want the cached two@example.com", got)
+	}
+
+	cache.InvalidateAll()
+	if got := lookup(t, cache, "user-2"); got != "new-two@example.com" {
+		t.Errorf("user-2 email = %q after InvalidateAll, want new-two@example.com", got)
+	}
+	if n := resolver.count(); n != 4 {
+		t.Errorf("%d lookups, want 4", n)
+	}
+}
+
+func TestCacheNotFound(t *testing.T) {
+	resolver := &countingResolver{directory: NewMemory()}
+	cache := NewCache(resolver, time.Hour)
+
+	// Users without contacts are cached like any other
+	for i := 0; i < 2; i++ {
+		contacts, err := cache.Contacts("unknown")
+		if err != nil {
+			t.Fatalf("Contacts: %v", err)
+		}
+		if len(contacts) != 0 {
+			t.Errorf("contacts = %v, want none", contacts)
+		}
+	}
+	if n := resolver.count(); n != 1 {
+		t.Errorf("%d lookups, want 1", n)
+	}
+}
+
+func TestCacheDoesNotCacheErrors(t *testing.T) {
+	directory := NewMemory()
+	directory.Set("user-1", models.NotificationTypeEmail, "user@example.com")
+	lookupErr := errors.New("contacts unavailable")
+	resolver := &countingResolver{directory: directory, err: lookupErr}
+	cache := NewCache(resolver, time.Hour)
+
+	if _, err := cache.Contacts("user-1"); !errors.Is(err, lookupErr) {
+		t.Fatalf("err = %v, want %v", err, lookupErr)
+	}
+
+	resolver.mu.Lock()
+	resolver.err = nil
+	resolver.mu.Unlock()
+	if got := lookup(t, cache, "user-1"); got != "user@example.com" {
+		t.Errorf("email = %q, want user@example.com", got)
+	}
+	if n := resolver.count(); n != 2 {
+		t.Errorf("%d lookups, want 2", n)
+	}
+}
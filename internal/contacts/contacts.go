@@ -0,0 +1,45 @@
+// Package contacts resolves the addresses of users from their user IDs, so
+// that producers can notify a user without knowing their email address or
+// Telegram chat ID.
+package contacts
+
+import (
+	"fmt"
+
+	"github.com/notification_service/internal/models"
+	"github.com/notification_service/internal/supabase"
+)
+
+// Resolver looks up the verified contact points of users
+type Resolver interface {
+	// Contacts returns a user's addresses by notification type, which is
+	// empty if the user has none. The map must not be modified.
+	Contacts(userID string) (map[models.NotificationType]string, error)
+}
+
+// Directory resolves contacts from the Supabase contacts table
+type Directory struct {
+	client *supabase.Client
+}
+
+// NewDirectory creates a resolver reading the Supabase contacts table
+func NewDirectory(client *supabase.Client) *Directory {
+	return &Directory{client: client}
+}
+
+// Contacts returns the verified addresses of a user. If the user has several
+// of a type, the most recently updated one is returned.
+func (d *Directory) Contacts(userID string) (map[models.NotificationType]string, error) {
+	contacts, err := d.client.ListVerifiedContacts(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up contacts of user %s: %w", userID, err)
+	}
+
+	addresses := make(map[models.NotificationType]string, len(contacts))
+	for _, contact := range contacts {
+		if _, ok := addresses[contact.Type]; !ok {
+			addresses[contact.Type] = contact.Channel
+		}
+	}
+	return addresses, nil
+}
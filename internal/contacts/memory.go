@@ -0,0 +1,71 @@
+package contacts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/notification_service/internal/models"
+)
+
+// Memory resolves contacts from an in-memory directory, for tests and for
+// deployments that read contacts from a file
+type Memory struct {
+	mu       sync.RWMutex
+	contacts map[string]map[models.NotificationType]string
+}
+
+// NewMemory creates an empty in-memory directory
+func NewMemory() *Memory {
+	return &Memory{contacts: make(map[string]map[models.NotificationType]string)}
+}
+
+// LoadFile creates an in-memory directory from the JSON file at path, an
+// object mapping user IDs to their addresses by notification type:
+//
+//	{"user-123": {"email": "user@example.com", "telegram": "123456789"}}
+func LoadFile(path string) (*Memory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read contacts file: %w", err)
+	}
+
+	m := NewMemory()
+	if err := json.Unmarshal(data, &m.contacts); err != nil {
+		return nil, fmt.Errorf("failed to parse contacts file %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Set sets the address of a user for a notification type
+func (m *Memory) Set(userID string, notificationType models.NotificationType, channel string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Maps handed out by Contacts are never modified
+	addresses := make(map[models.NotificationType]string, len(m.contacts[userID])+1)
+	for t, c := range m.contacts[userID] {
+		addresses[t] = c
+	}
+	addresses[notificationType] = channel
+	m.contacts[userID] = addresses
+}
+
+// Delete removes all addresses of a user
+func (m *Memory) Delete(userID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.contacts, userID)
+}
+
+// Contacts returns the addresses of a user
+func (m *Memory) Contacts(userID string) (map[models.NotificationType]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if addresses, ok := m.contacts[userID]; ok {
+		return addresses, nil
+	}
+	return map[models.NotificationType]string{}, nil
+}
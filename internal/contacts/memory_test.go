@@ -0,0 +1,43 @@
+package contacts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/notification_service/internal/models"
+)
+
+func TestMemory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contacts.json")
+	data := `{"user-1": {"email": "user@example.com", "telegram": "12345"}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	directory, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	contacts, err := directory.Contacts("user-1")
+	if err != nil {
+		t.Fatalf("Contacts: %v", err)
+	}
+	if contacts[models.NotificationTypeEmail] != "user@example.com" || contacts[models.NotificationTypeTelegram] != "12345" {
+		t.Errorf("contacts = %v", contacts)
+	}
+
+	// Maps handed out before are not modified by Set
+	directory.Set("user-1", models.NotificationTypeEmail, "new@example.com")
+	if contacts[models.NotificationTypeEmail] != "user@example.com" {
+		t.Errorf("Set modified a returned map: %v", contacts)
+	}
+	if got := lookup(t, directory, "user-1"); got != "new@example.com" {
+		t.Errorf("email = %q after Set, want new@example.com", got)
+	}
+
+	directory.Delete("user-1")
+	if contacts, _ := directory.Contacts("user-1"); len(contacts) != 0 {
+		t.Errorf("contacts = %v after Delete, want none", contacts)
+	}
+}
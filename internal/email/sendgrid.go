@@ -1,8 +1,10 @@
 package email
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/notification_service/internal/config"
 	"github.com/notification_service/internal/models"
@@ -36,21 +38,43 @@ func NewSendGridClient(cfg *config.Config) (*SendGridClient, error) {
 	}, nil
 }
 
-// SendEmail sends an email notification using SendGrid
-func (s *SendGridClient) SendEmail(notification *models.Notification) error {
+// Name implements notifications.Notifier
+func (s *SendGridClient) Name() string {
+	return "sendgrid"
+}
+
+// Capabilities implements notifications.Notifier
+func (s *SendGridClient) Capabilities() models.Capabilities {
+	return models.Capabilities{
+		Subject:          true,
+		MaxContentLength: models.MaxEmailContentLength,
+	}
+}
+
+// Send sends an email notification using SendGrid
+func (s *SendGridClient) Send(ctx context.Context, notification *models.Notification) (models.Receipt, error) {
 	from := mail.NewEmail(s.fromName, s.fromEmail)
 	to := mail.NewEmail("", notification.Channel) // Channel contains the recipient's email address
-	
+
 	message := mail.NewSingleEmail(from, notification.Subject, to, notification.Content, notification.Content)
-	
-	response, err := s.client.Send(message)
+
+	response, err := s.client.SendWithContext(ctx, message)
 	if err != nil {
-		return fmt.Errorf("failed to send email: %w", err)
+		return models.Receipt{}, fmt.Errorf("failed to send email: %w", err)
 	}
-	
+
 	if response.StatusCode >= 400 {
-		return fmt.Errorf("failed to send email, status code: %d, body: %s", response.StatusCode, response.Body)
+		err := fmt.Errorf("failed to send email, status code: %d, body: %s", response.StatusCode, response.Body)
+		// Client errors other than rate limiting will fail the same way on retry
+		if response.StatusCode < 500 && response.StatusCode != http.StatusTooManyRequests {
+			return models.Receipt{}, models.NewPermanentError(err)
+		}
+		return models.Receipt{}, err
 	}
-	
-	return nil
-} 
\ No newline at end of file
+
+	receipt := models.Receipt{Notifier: s.Name()}
+	if ids := response.Headers["X-Message-Id"]; len(ids) > 0 {
+		receipt.MessageID = ids[0]
+	}
+	return receipt, nil
+}
@@ -0,0 +1,161 @@
+package grpcapi
+
+import (
+	"log"
+	"time"
+
+	"github.com/notification_service/internal/models"
+	"github.com/notification_service/pkg/notificationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// toMessage converts a SendRequest to a notification message
+func toMessage(req *notificationpb.SendRequest) *models.KafkaNotificationMessage {
+	msg := &models.KafkaNotificationMessage{
+		UserID:   req.UserId,
+		Type:     models.NotificationType(req.Type),
+		Channel:  req.Channel,
+		Subject:  req.Subject,
+		Content:  req.Content,
+		Priority: models.NotificationPriority(req.Priority),
+		Category: req.Category,
+	}
+	if req.Metadata != nil {
+		msg.Metadata = req.Metadata.AsMap()
+	}
+	for _, r := range req.Recipients {
+		msg.Recipients = append(msg.Recipients, models.Recipient{Type: models.NotificationType(r.Type), Channel: r.Channel})
+	}
+	if len(req.Contacts) > 0 {
+		msg.Contacts = make(map[models.NotificationType]string, len(req.Contacts))
+		for notificationType, channel := range req.Contacts {
+			msg.Contacts[models.NotificationType(notificationType)] = channel
+		}
+	}
+	if req.Fallback != nil {
+		msg.Fallback = &models.FallbackPolicy{On: req.Fallback.On, Timeout: req.Fallback.Timeout}
+		for _, channel := range req.Fallback.Channels {
+			msg.Fallback.Channels = append(msg.Fallback.Channels, models.NotificationType(channel))
+		}
+	}
+	return msg
+}
+
+// toNotification converts a stored notification to its API form
+func toNotification(n *models.Notification) *notificationpb.Notification {
+	notification := &notificationpb.Notification{
+		Id:            n.ID,
+		UserId:        n.UserID,
+		Type:          string(n.Type),
+		Channel:       n.Channel,
+		Subject:       n.Subject,
+		Content:       n.Content,
+		Priority:      string(n.Priority),
+		Status:        string(n.Status),
+		Attempts:      int32(n.Attempts),
+		CreatedAt:     timestamp(n.CreatedAt),
+		UpdatedAt:     timestamp(n.UpdatedAt),
+		Error:         n.Error,
+		ErrorClass:    n.ErrorClass,
+		CorrelationId: n.CorrelationID,
+		ResendOf:      n.ResendOf,
+		SentType:      string(n.SentType),
+		SentChannel:   n.SentChannel,
+
+		Category:          n.Category,
+		SuppressionReason: n.SuppressionReason,
+	}
+	if n.SentAt != nil {
+		notification.SentAt = timestamp(*n.SentAt)
+	}
+
+	for _, r := range n.Recipients {
+		notification.Recipients = append(notification.Recipients, &notificationpb.Recipient{Type: string(r.Type), Channel: r.Channel})
+	}
+	for i := range n.Deliveries {
+		notification.Deliveries = append(notification.Deliveries, toDelivery(&n.Deliveries[i]))
+	}
+
+	if len(n.Contacts) > 0 {
+		notification.Contacts = make(map[string]string, len(n.Contacts))
+		for notificationType, channel := range n.Contacts {
+			notification.Contacts[string(notificationType)] = channel
+		}
+	}
+	if n.Fallback != nil {
+		notification.Fallback = &notificationpb.FallbackPolicy{On: n.Fallback.On, Timeout: n.Fallback.Timeout}
+		for _, channel := range n.Fallback.Channels {
+			notification.Fallback.Channels = append(notification.Fallback.Channels, string(channel))
+		}
+	}
+	for _, a := range n.ChannelAttempts {
+		notification.ChannelAttempts = append(notification.ChannelAttempts, &notificationpb.ChannelAttempt{
+			Attempt:    int32(a.Attempt),
+			Type:       string(a.Type),
+			Channel:    a.Channel,
+			Notifier:   a.Notifier,
+			MessageId:  a.MessageID,
+			Error:      a.Error,
+			ErrorClass: a.ErrorClass,
+			Condition:  a.Condition,
+			StartedAt:  timestamp(a.StartedAt),
+		})
+	}
+
+	if len(n.Metadata) > 0 {
+		metadata, err := structpb.NewStruct(n.Metadata)
+		if err != nil {
+			log.Printf("Failed to convert metadata of notification %s: %v", n.ID, err)
+		} else {
+			notification.Metadata = metadata
+		}
+	}
+
+	return notification
+}
+
+// toDelivery converts a delivery of a multi-channel notification to its API
+// form
+func toDelivery(d *models.Delivery) *notificationpb.Delivery {
+	delivery := &notificationpb.Delivery{
+		Id:         d.ID,
+		Type:       string(d.Type),
+		Channel:    d.Channel,
+		Status:     string(d.Status),
+		Attempts:   int32(d.Attempts),
+		Notifier:   d.Notifier,
+		MessageId:  d.MessageID,
+		Error:      d.Error,
+		ErrorClass: d.ErrorClass,
+
+		SuppressionReason: d.SuppressionReason,
+	}
+	if d.SentAt != nil {
+		delivery.SentAt = timestamp(*d.SentAt)
+	}
+	return delivery
+}
+
+// toStatusEvent converts a status event to its API form
+func toStatusEvent(event *models.StatusEvent) *notificationpb.StatusEvent {
+	return &notificationpb.StatusEvent{
+		NotificationId: event.NotificationID,
+		Status:         string(event.Status),
+		UserId:         event.UserID,
+		Type:           string(event.Type),
+		Attempt:        int32(event.Attempt),
+		CorrelationId:  event.CorrelationID,
+		Error:          event.Error,
+		Reason:         event.Reason,
+		OccurredAt:     timestamp(event.OccurredAt),
+	}
+}
+
+// timestamp converts t, leaving the zero time unset
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
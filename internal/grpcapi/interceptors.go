@@ -0,0 +1,97 @@
+package grpcapi
+
+import (
+	"context"
+	"time"
+
+	"github.com/notification_service/internal/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Caller returns the name of the client that authenticated the call, as
+// configured in GRPC_AUTH_TOKENS
+func Caller(ctx context.Context) string {
+	return auth.Caller(ctx)
+}
+
+// authenticator checks the bearer token of each call against the configured
+// client tokens
+type authenticator struct {
+	tokens *auth.Tokens
+}
+
+// newAuthenticator creates an authenticator for tokens keyed by client name
+func newAuthenticator(clients map[string]string) *authenticator {
+	return &authenticator{tokens: auth.NewTokens(clients)}
+}
+
+// authenticate returns ctx carrying the caller's name, or an UNAUTHENTICATED
+// error
+func (a *authenticator) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var authorization string
+	if values := md.Get("authorization"); len(values) > 0 {
+		authorization = values[0]
+	}
+
+	caller, err := a.tokens.Authenticate(authorization)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return auth.WithCaller(ctx, caller), nil
+}
+
+// unary authenticates unary calls
+func (a *authenticator) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// stream authenticates streaming calls
+func (a *authenticator) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticatedStream is a server stream whose context carries the caller
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context carrying the caller
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// deadlineInterceptor gives unary calls without a deadline one of
+// defaultTimeout, and shortens longer deadlines to maxTimeout
+func deadlineInterceptor(defaultTimeout, maxTimeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		timeout := defaultTimeout
+		if deadline, ok := ctx.Deadline(); ok {
+			timeout = time.Until(deadline)
+			if timeout <= 0 {
+				return nil, status.Error(codes.DeadlineExceeded, "deadline already exceeded")
+			}
+		}
+		if timeout > maxTimeout {
+			timeout = maxTimeout
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,115 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/models"
+	"github.com/notification_service/pkg/notificationpb"
+	"google.golang.org/grpc"
+)
+
+// maxWatchedNotifications limits the notification IDs of a WatchStatus call
+const maxWatchedNotifications = 100
+
+// Submitter validates and sends or enqueues notifications
+type Submitter interface {
+	Submit(env *models.Envelope) (models.NotificationStatus, error)
+	Resend(id, actor, reason string) (string, models.NotificationStatus, error)
+	Mode() string
+}
+
+// NotificationStore reads and cancels stored notifications
+type NotificationStore interface {
+	GetNotification(id string) (*models.Notification, error)
+	CancelNotification(id, actor, reason string) (*models.Notification, error)
+}
+
+// StatusSubscriber passes the status events of this instance to watchers
+type StatusSubscriber interface {
+	Subscribe(ids []string) (<-chan *models.StatusEvent, func())
+}
+
+// Server is the gRPC API, implementing notificationpb.NotificationServiceServer
+type Server struct {
+	notificationpb.UnimplementedNotificationServiceServer
+
+	submitter         Submitter
+	store             NotificationStore
+	statuses          StatusSubscriber
+	persistedHeaders  []string
+	maxBatchSize      int
+	watchPollInterval time.Duration
+
+	addr   string
+	server *grpc.Server
+	// quit is closed on shutdown to end the status watches
+	quit chan struct{}
+}
+
+// NewServer creates the gRPC API, authenticating calls with the configured
+// tokens and bounding their deadlines
+func NewServer(cfg *config.Config, submitter Submitter, store NotificationStore, statuses StatusSubscriber) *Server {
+	s := &Server{
+		submitter:         submitter,
+		store:             store,
+		statuses:          statuses,
+		persistedHeaders:  cfg.Service.PersistedHeaders,
+		maxBatchSize:      cfg.GRPC.MaxBatchSize,
+		watchPollInterval: cfg.GRPC.WatchPollInterval,
+		addr:              cfg.GRPC.Addr,
+		quit:              make(chan struct{}),
+	}
+
+	auth := newAuthenticator(cfg.GRPC.AuthTokens)
+	s.server = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(auth.unary, deadlineInterceptor(cfg.GRPC.DefaultTimeout, cfg.GRPC.MaxTimeout)),
+		grpc.ChainStreamInterceptor(auth.stream),
+	)
+	notificationpb.RegisterNotificationServiceServer(s.server, s)
+
+	return s
+}
+
+// Start serves the API in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+	}
+
+	s.serve(listener)
+	return nil
+}
+
+// serve serves the API on listener in the background
+func (s *Server) serve(listener net.Listener) {
+	go func() {
+		log.Printf("gRPC API listening on %s (%s mode)", listener.Addr(), s.submitter.Mode())
+		if err := s.server.Serve(listener); err != nil {
+			log.Printf("gRPC API stopped: %v", err)
+		}
+	}()
+}
+
+// Shutdown ends the status watches, stops accepting calls and waits until
+// ctx is done for the calls being served, after which they are cancelled
+func (s *Server) Shutdown(ctx context.Context) {
+	close(s.quit)
+
+	done := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.server.Stop()
+	}
+}
@@ -0,0 +1,385 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/models"
+	"github.com/notification_service/internal/supabase"
+	"github.com/notification_service/pkg/notificationpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testToken is the token of the client "ops" in the test configuration
+const testToken = "secret"
+
+// fakeSubmitter stores every notification as pending, taking delay to do so
+type fakeSubmitter struct {
+	mu        sync.Mutex
+	delay     time.Duration
+	submitted int
+}
+
+func (s *fakeSubmitter) Submit(env *models.Envelope) (models.NotificationStatus, error) {
+	time.Sleep(s.delay)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.submitted++
+	env.NotificationID = "n-" + strconv.Itoa(s.submitted)
+	return models.NotificationStatusPending, nil
+}
+
+func (s *fakeSubmitter) Resend(id, actor, reason string) (string, models.NotificationStatus, error) {
+	return "", "", errors.New("not implemented")
+}
+
+func (s *fakeSubmitter) Mode() string { return "enqueue" }
+
+func (s *fakeSubmitter) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.submitted
+}
+
+// fakeStore holds the statuses of notifications by ID
+type fakeStore struct {
+	mu       sync.Mutex
+	statuses map[string]models.NotificationStatus
+}
+
+func (s *fakeStore) GetNotification(id string) (*models.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	notificationStatus, ok := s.statuses[id]
+	if !ok {
+		return nil, supabase.ErrNotFound
+	}
+	return &models.Notification{ID: id, UserID: "user-1", Status: notificationStatus}, nil
+}
+
+func (s *fakeStore) CancelNotification(id, actor, reason string) (*models.Notification, error) {
+	return nil, errors.New("not implemented")
+}
+
+// fakeStatuses passes the events sent on events to every watcher
+type fakeStatuses struct {
+	events chan *models.StatusEvent
+}
+
+func (s *fakeStatuses) Subscribe(ids []string) (<-chan *models.StatusEvent, func()) {
+	return s.events, func() {}
+}
+
+// testServer is an API served over an in-memory connection
+type testServer struct {
+	server    *Server
+	client    notificationpb.NotificationServiceClient
+	submitter *fakeSubmitter
+	store     *fakeStore
+	statuses  *fakeStatuses
+}
+
+// testConfig returns a configuration accepting testToken for "ops", with
+// batches of at most 3 notifications
+func testConfig() *config.Config {
+	return &config.Config{GRPC: config.GRPCConfig{
+		AuthTokens:        map[string]string{"ops": testToken},
+		DefaultTimeout:    time.Second,
+		MaxTimeout:        2 * time.Second,
+		MaxBatchSize:      3,
+		WatchPollInterval: time.Hour,
+	}}
+}
+
+// startServer serves the API with cfg over an in-memory connection until the
+// test ends
+func startServer(t *testing.T, cfg *config.Config) *testServer {
+	t.Helper()
+
+	ts := &testServer{
+		submitter: &fakeSubmitter{},
+		store:     &fakeStore{statuses: make(map[string]models.NotificationStatus)},
+		statuses:  &fakeStatuses{events: make(chan *models.StatusEvent, 10)},
+	}
+	ts.server = NewServer(cfg, ts.submitter, ts.store, ts.statuses)
+
+	listener := bufconn.Listen(1 << 20)
+	ts.server.serve(listener)
+	t.Cleanup(ts.server.server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	ts.client = notificationpb.NewNotificationServiceClient(conn)
+
+	return ts
+}
+
+// authorized returns a context carrying the authorization of "ops"
+func authorized() context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+testToken)
+}
+
+// email returns a valid email notification request
+func email() *notificationpb.SendRequest {
+	return &notificationpb.SendRequest{
+		UserId:  "user-1",
+		Type:    string(models.NotificationTypeEmail),
+		Channel: "user@example.com",
+		Subject: "Hello",
+		Content: "Hello",
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	ts := startServer(t, testConfig())
+
+	tests := []struct {
+		name          string
+		authorization string
+	}{
+		{name: "missing"},
+		{name: "wrong scheme", authorization: "Basic b3BzOnNlY3JldA=="},
+		{name: "invalid token", authorization: "Bearer wrong"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.authorization != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", tt.authorization)
+			}
+
+			_, err := ts.client.Send(ctx, email())
+			if code := status.Code(err); code != codes.Unauthenticated {
+				t.Errorf("Send = %v, want UNAUTHENTICATED", err)
+			}
+
+			// Streams are authenticated before the first message
+			stream, err := ts.client.WatchStatus(ctx, &notificationpb.WatchStatusRequest{NotificationIds: []string{"n-1"}})
+			if err == nil {
+				_, err = stream.Recv()
+			}
+			if code := status.Code(err); code != codes.Unauthenticated {
+				t.Errorf("WatchStatus = %v, want UNAUTHENTICATED", err)
+			}
+		})
+	}
+	if n := ts.submitter.count(); n != 0 {
+		t.Errorf("%d notifications submitted without authentication", n)
+	}
+
+	t.Run("valid token", func(t *testing.T) {
+		resp, err := ts.client.Send(authorized(), email())
+		if err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		if resp.Id != "n-1" || resp.Status != string(models.NotificationStatusPending) {
+			t.Errorf("response = %v, want n-1 pending", resp)
+		}
+	})
+}
+
+func TestDeadlineInterceptor(t *testing.T) {
+	interceptor := deadlineInterceptor(time.Second, 2*time.Second)
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		want    time.Duration
+	}{
+		{name: "no deadline", want: time.Second},
+		{name: "shorter deadline", timeout: 500 * time.Millisecond, want: 500 * time.Millisecond},
+		{name: "longer deadline", timeout: time.Minute, want: 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			var remaining time.Duration
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				deadline, ok := ctx.Deadline()
+				if !ok {
+					t.Fatal("handler called without a deadline")
+				}
+				remaining = time.Until(deadline)
+				return nil, nil
+			})
+			if err != nil {
+				t.Fatalf("interceptor: %v", err)
+			}
+			if remaining > tt.want || remaining < tt.want-100*time.Millisecond {
+				t.Errorf("handler deadline in %s, want %s", remaining, tt.want)
+			}
+		})
+	}
+
+	t.Run("expired deadline", func(t *testing.T) {
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			t.Error("handler called after the deadline")
+			return nil, nil
+		})
+		if code := status.Code(err); code != codes.DeadlineExceeded {
+			t.Errorf("interceptor = %v, want DEADLINE_EXCEEDED", err)
+		}
+	})
+}
+
+func TestSendBatchStopsAtTheDefaultDeadline(t *testing.T) {
+	cfg := testConfig()
+	cfg.GRPC.DefaultTimeout = 50 * time.Millisecond
+	ts := startServer(t, cfg)
+	ts.submitter.delay = 30 * time.Millisecond
+
+	_, err := ts.client.SendBatch(authorized(), &notificationpb.SendBatchRequest{
+		Notifications: []*notificationpb.SendRequest{email(), email(), email()},
+	})
+	if code := status.Code(err); code != codes.DeadlineExceeded {
+		t.Fatalf("SendBatch = %v, want DEADLINE_EXCEEDED", err)
+	}
+	if n := ts.submitter.count(); n != 2 {
+		t.Errorf("%d notifications submitted, want 2 before the deadline", n)
+	}
+}
+
+func TestSendBatchLimits(t *testing.T) {
+	ts := startServer(t, testConfig())
+
+	for _, size := range []int{0, 4} {
+		req := &notificationpb.SendBatchRequest{}
+		for i := 0; i < size; i++ {
+			req.Notifications = append(req.Notifications, email())
+		}
+		if _, err := ts.client.SendBatch(authorized(), req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("SendBatch of %d = %v, want INVALID_ARGUMENT", size, err)
+		}
+	}
+	if n := ts.submitter.count(); n != 0 {
+		t.Fatalf("%d notifications of rejected batches submitted", n)
+	}
+
+	invalid := email()
+	invalid.Channel = ""
+	resp, err := ts.client.SendBatch(authorized(), &notificationpb.SendBatchRequest{
+		Notifications: []*notificationpb.SendRequest{email(), invalid, email()},
+	})
+	if err != nil {
+		t.Fatalf("SendBatch: %v", err)
+	}
+	if len(resp.Results) != 3 {
+		t.Fatalf("%d results, want 3", len(resp.Results))
+	}
+	for i, result := range resp.Results {
+		if result.Index != int32(i) {
+			t.Errorf("result %d has index %d", i, result.Index)
+		}
+	}
+}
+
+// recv receives the next event of a stream
+func recv(t *testing.T, stream notificationpb.NotificationService_WatchStatusClient) *notificationpb.StatusEvent {
+	t.Helper()
+	event, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	return event
+}
+
+func TestWatchStatusEndsWhenAllFinal(t *testing.T) {
+	ts := startServer(t, testConfig())
+	ts.store.statuses["n-1"] = models.NotificationStatusPending
+	ts.store.statuses["n-2"] = models.NotificationStatusSent
+
+	stream, err := ts.client.WatchStatus(authorized(), &notificationpb.WatchStatusRequest{NotificationIds: []string{"n-1", "n-2"}})
+	if err != nil {
+		t.Fatalf("WatchStatus: %v", err)
+	}
+
+	// The current statuses are sent first
+	initial := map[string]string{}
+	for i := 0; i < 2; i++ {
+		event := recv(t, stream)
+		initial[event.NotificationId] = event.Status
+	}
+	if initial["n-1"] != "pending" || initial["n-2"] != "sent" {
+		t.Errorf("initial statuses = %v, want n-1 pending and n-2 sent", initial)
+	}
+
+	ts.statuses.events <- &models.StatusEvent{NotificationID: "n-2", Status: models.NotificationStatusFailed}
+	ts.statuses.events <- &models.StatusEvent{NotificationID: "n-1", Status: models.NotificationStatusRetrying, Attempt: 2}
+	ts.statuses.events <- &models.StatusEvent{NotificationID: "n-1", Status: models.NotificationStatusSent, Attempt: 2}
+
+	// n-2 is final already, so only the events of n-1 are sent
+	if event := recv(t, stream); event.NotificationId != "n-1" || event.Status != "retrying" || event.Attempt != 2 {
+		t.Errorf("event = %v, want n-1 retrying on attempt 2", event)
+	}
+	if event := recv(t, stream); event.NotificationId != "n-1" || event.Status != "sent" {
+		t.Errorf("event = %v, want n-1 sent", event)
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Errorf("Recv = %v, want the stream to end", err)
+	}
+}
+
+func TestWatchStatusEndsOnShutdown(t *testing.T) {
+	ts := startServer(t, testConfig())
+	ts.store.statuses["n-1"] = models.NotificationStatusPending
+
+	stream, err := ts.client.WatchStatus(authorized(), &notificationpb.WatchStatusRequest{NotificationIds: []string{"n-1"}})
+	if err != nil {
+		t.Fatalf("WatchStatus: %v", err)
+	}
+	recv(t, stream)
+
+	go ts.server.Shutdown(context.Background())
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("Recv = %v, want UNAVAILABLE", err)
+	}
+}
+
+func TestWatchStatusLimits(t *testing.T) {
+	ts := startServer(t, testConfig())
+
+	ids := make([]string, maxWatchedNotifications+1)
+	for i := range ids {
+		ids[i] = "n-" + strconv.Itoa(i)
+	}
+	for _, ids := range [][]string{nil, ids} {
+		stream, err := ts.client.WatchStatus(authorized(), &notificationpb.WatchStatusRequest{NotificationIds: ids})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if code := status.Code(err); code != codes.InvalidArgument {
+			t.Errorf("WatchStatus of %d notifications = %v, want INVALID_ARGUMENT", len(ids), err)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/notification_service/internal/models"
+	"github.com/notification_service/internal/notifications"
+	"github.com/notification_service/internal/supabase"
+	"github.com/notification_service/pkg/notificationpb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataRequestID identifies a call; it is recorded as the message ID in
+// the notification's origin metadata
+const MetadataRequestID = "x-request-id"
+
+// Error codes of SendResponse and SendResult
+const (
+	codeValidationFailed = "validation_failed"
+	codeDeliveryFailed   = "delivery_failed"
+	codeEnqueueFailed    = "enqueue_failed"
+	codeInternal         = "internal_error"
+)
+
+// Send validates and submits a notification
+func (s *Server) Send(ctx context.Context, req *notificationpb.SendRequest) (*notificationpb.SendResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	result := s.submit(md, req, first(md.Get(MetadataRequestID)))
+
+	if result.Error != nil && result.Id == "" {
+		return nil, errorStatus(result.Error)
+	}
+	return &notificationpb.SendResponse{Id: result.Id, Status: result.Status, Error: result.Error}, nil
+}
+
+// SendBatch submits several notifications, each on its own
+func (s *Server) SendBatch(ctx context.Context, req *notificationpb.SendBatchRequest) (*notificationpb.SendBatchResponse, error) {
+	switch {
+	case len(req.Notifications) == 0:
+		return nil, status.Error(codes.InvalidArgument, "notifications must not be empty")
+	case len(req.Notifications) > s.maxBatchSize:
+		return nil, status.Errorf(codes.InvalidArgument, "batch has %d notifications, the limit is %d", len(req.Notifications), s.maxBatchSize)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	requestID := first(md.Get(MetadataRequestID))
+
+	resp := &notificationpb.SendBatchResponse{Results: make([]*notificationpb.SendResult, len(req.Notifications))}
+	for i, notification := range req.Notifications {
+		// The caller stops waiting at the deadline, so do not submit more
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+
+		messageID := ""
+		if requestID != "" {
+			messageID = fmt.Sprintf("%s/%d", requestID, i)
+		}
+
+		result := s.submit(md, notification, messageID)
+		result.Index = int32(i)
+		resp.Results[i] = result
+	}
+
+	return resp, nil
+}
+
+// GetNotification returns a stored notification
+func (s *Server) GetNotification(ctx context.Context, req *notificationpb.GetNotificationRequest) (*notificationpb.Notification, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	notification, err := s.store.GetNotification(req.Id)
+	if err != nil {
+		return nil, storeStatus(err)
+	}
+	return toNotification(notification), nil
+}
+
+// CancelNotification cancels a pending notification
+func (s *Server) CancelNotification(ctx context.Context, req *notificationpb.CancelNotificationRequest) (*notificationpb.Notification, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	notification, err := s.store.CancelNotification(req.Id, Caller(ctx), req.Reason)
+	if err != nil {
+		return nil, storeStatus(err)
+	}
+	return toNotification(notification), nil
+}
+
+// ResendNotification resends a failed notification as a new one
+func (s *Server) ResendNotification(ctx context.Context, req *notificationpb.ResendNotificationRequest) (*notificationpb.ResendNotificationResponse, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	id, notificationStatus, err := s.submitter.Resend(req.Id, Caller(ctx), req.Reason)
+	if errors.Is(err, supabase.ErrNotFound) || errors.Is(err, notifications.ErrNotResendable) {
+		return nil, storeStatus(err)
+	}
+
+	result := submitResult(id, notificationStatus, err)
+	if result.Error != nil && result.Id == "" {
+		return nil, errorStatus(result.Error)
+	}
+	return &notificationpb.ResendNotificationResponse{
+		Id:       result.Id,
+		Status:   result.Status,
+		Error:    result.Error,
+		ResendOf: req.Id,
+	}, nil
+}
+
+// WatchStatus streams the status of notifications until they are all final.
+// Events of this instance are streamed as they happen; changes made by other
+// instances are seen by reading the notifications every watchPollInterval.
+func (s *Server) WatchStatus(req *notificationpb.WatchStatusRequest, stream notificationpb.NotificationService_WatchStatusServer) error {
+	switch {
+	case len(req.NotificationIds) == 0:
+		return status.Error(codes.InvalidArgument, "notification_ids must not be empty")
+	case len(req.NotificationIds) > maxWatchedNotifications:
+		return status.Errorf(codes.InvalidArgument, "at most %d notifications can be watched", maxWatchedNotifications)
+	}
+
+	// Subscribe before the first read so no change is missed in between
+	events, unsubscribe := s.statuses.Subscribe(req.NotificationIds)
+	defer unsubscribe()
+
+	w := &watch{stream: stream, last: make(map[string]*notificationpb.StatusEvent, len(req.NotificationIds))}
+	for _, id := range req.NotificationIds {
+		w.last[id] = nil
+	}
+
+	if err := s.poll(w); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(s.watchPollInterval)
+	defer ticker.Stop()
+
+	for !w.done() {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case <-s.quit:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case event := <-events:
+			if err := w.send(toStatusEvent(event)); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := s.poll(w); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// watch is the state of a WatchStatus stream
+type watch struct {
+	stream notificationpb.NotificationService_WatchStatusServer
+	// last is the last event sent for each watched notification, nil if none
+	last map[string]*notificationpb.StatusEvent
+}
+
+// send sends event unless it repeats the status and attempt last sent for
+// its notification, or the notification already reached a final status
+func (w *watch) send(event *notificationpb.StatusEvent) error {
+	last := w.last[event.NotificationId]
+	if last != nil && (models.NotificationStatus(last.Status).IsFinal() ||
+		(last.Status == event.Status && last.Attempt == event.Attempt)) {
+		return nil
+	}
+
+	w.last[event.NotificationId] = event
+	return w.stream.Send(event)
+}
+
+// done reports whether every watched notification reached a final status
+func (w *watch) done() bool {
+	for _, last := range w.last {
+		if last == nil || !models.NotificationStatus(last.Status).IsFinal() {
+			return false
+		}
+	}
+	return true
+}
+
+// poll reads the watched notifications that are not final yet and sends their
+// status if it changed
+func (s *Server) poll(w *watch) error {
+	for id, last := range w.last {
+		if last != nil && models.NotificationStatus(last.Status).IsFinal() {
+			continue
+		}
+
+		notification, err := s.store.GetNotification(id)
+		if err != nil {
+			return storeStatus(err)
+		}
+
+		event := &notificationpb.StatusEvent{
+			NotificationId: notification.ID,
+			Status:         string(notification.Status),
+			UserId:         notification.UserID,
+			Type:           string(notification.Type),
+			Attempt:        int32(notification.Attempts),
+			CorrelationId:  notification.CorrelationID,
+			Error:          notification.Error,
+			Reason:         notification.SuppressionReason,
+			OccurredAt:     timestamp(notification.UpdatedAt),
+		}
+		if err := w.send(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// submit validates and submits one notification
+func (s *Server) submit(md metadata.MD, req *notificationpb.SendRequest, messageID string) *notificationpb.SendResult {
+	msg := toMessage(req)
+	env := &models.Envelope{
+		Message:   msg,
+		Key:       msg.UserID,
+		Headers:   s.headers(md),
+		MessageID: messageID,
+		Timestamp: time.Now(),
+	}
+
+	notificationStatus, err := s.submitter.Submit(env)
+	return submitResult(env.NotificationID, notificationStatus, err)
+}
+
+// submitResult describes the outcome of submitting a notification. id is
+// empty if nothing was stored.
+func submitResult(id string, notificationStatus models.NotificationStatus, err error) *notificationpb.SendResult {
+	// Invalid notifications are rejected without being stored
+	var validationErr *models.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return &notificationpb.SendResult{Error: validationError(validationErr)}
+	case id == "":
+		log.Printf("Failed to store notification: %v", err)
+		return &notificationpb.SendResult{Error: &notificationpb.Error{Code: codeInternal, Message: "failed to store notification"}}
+	}
+
+	result := &notificationpb.SendResult{Id: id, Status: string(notificationStatus)}
+	switch {
+	case errors.Is(err, notifications.ErrEnqueue):
+		result.Error = &notificationpb.Error{Code: codeEnqueueFailed, Message: "failed to enqueue notification"}
+	case err != nil:
+		result.Error = &notificationpb.Error{Code: codeDeliveryFailed, Message: err.Error()}
+	}
+	return result
+}
+
+// headers returns the persisted headers present in the call metadata
+func (s *Server) headers(md metadata.MD) map[string]string {
+	headers := make(map[string]string)
+	for _, name := range s.persistedHeaders {
+		if value := first(md.Get(name)); value != "" {
+			headers[name] = value
+		}
+	}
+	return headers
+}
+
+// first returns the first of values, or "" if there are none
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// validationError converts a validation error to its API form
+func validationError(err *models.ValidationError) *notificationpb.Error {
+	fields := make([]*notificationpb.FieldViolation, len(err.Errors))
+	for i, fe := range err.Errors {
+		fields[i] = &notificationpb.FieldViolation{Field: fe.Field, Code: fe.Code, Message: fe.Message}
+	}
+	return &notificationpb.Error{Code: codeValidationFailed, Message: "notification is invalid", Fields: fields}
+}
+
+// errorStatus converts the error of a notification that was not stored to a
+// gRPC status. Validation errors carry a google.rpc.BadRequest detail.
+func errorStatus(apiErr *notificationpb.Error) error {
+	if apiErr.Code != codeValidationFailed {
+		return status.Error(codes.Internal, apiErr.Message)
+	}
+
+	st := status.New(codes.InvalidArgument, apiErr.Message)
+	badRequest := &errdetails.BadRequest{}
+	for _, field := range apiErr.Fields {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field.Field,
+			Description: field.Message,
+		})
+	}
+	if detailed, err := st.WithDetails(badRequest); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// storeStatus converts an error reading, cancelling or resending a
+// notification to a gRPC status
+func storeStatus(err error) error {
+	switch {
+	case errors.Is(err, supabase.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, notifications.ErrNotCancellable), errors.Is(err, notifications.ErrNotResendable):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	log.Printf("Failed to access notification: %v", err)
+	return status.Error(codes.Internal, "failed to access notification")
+}
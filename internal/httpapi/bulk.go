@@ -0,0 +1,161 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/notification_service/internal/auth"
+	"github.com/notification_service/internal/models"
+	"github.com/notification_service/internal/notifications"
+	"github.com/notification_service/internal/supabase"
+)
+
+// Operations on a bulk resend job, as in POST /v1/bulk-resends/{id}:pause
+const (
+	operationPause  = "pause"
+	operationResume = "resume"
+)
+
+// bulkResendRequest is the body of a bulk resend: the filter selecting the
+// failed notifications, the rate, and the reason recorded in the audit log
+// of every resend, with the authenticated client as the actor
+type bulkResendRequest struct {
+	models.BulkResendFilter
+	Rate   int    `json:"rate,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// previewResponse is the number of notifications a bulk resend would resend
+type previewResponse struct {
+	Count int `json:"count"`
+}
+
+// bulkJobsResponse lists the newest bulk resend jobs
+type bulkJobsResponse struct {
+	Jobs []models.BulkResendJob `json:"jobs"`
+}
+
+// handleBulkPreview counts the failed notifications a bulk resend would
+// resend
+func (s *Server) handleBulkPreview(w http.ResponseWriter, r *http.Request) {
+	var filter models.BulkResendFilter
+	if !s.decode(w, r, &filter) {
+		return
+	}
+
+	count, err := s.bulk.Preview(&filter)
+	if s.writeValidationError(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to preview bulk resend: %v", err)
+		writeError(w, http.StatusInternalServerError, codeInternal, "failed to count notifications", nil)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, previewResponse{Count: count})
+}
+
+// handleBulkCreate starts a bulk resend job
+func (s *Server) handleBulkCreate(w http.ResponseWriter, r *http.Request) {
+	var req bulkResendRequest
+	if !s.decode(w, r, &req) {
+		return
+	}
+
+	job, err := s.bulk.Create(&req.BulkResendFilter, req.Rate, auth.Caller(r.Context()), req.Reason)
+	if s.writeValidationError(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to create bulk resend: %v", err)
+		writeError(w, http.StatusInternalServerError, codeInternal, "failed to create bulk resend", nil)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, job)
+}
+
+// handleBulkList returns the newest bulk resend jobs
+func (s *Server) handleBulkList(w http.ResponseWriter, r *http.Request) {
+	jobs, err := s.bulk.List()
+	if err != nil {
+		log.Printf("Failed to list bulk resends: %v", err)
+		writeError(w, http.StatusInternalServerError, codeInternal, "failed to list bulk resends", nil)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, bulkJobsResponse{Jobs: jobs})
+}
+
+// handleBulkJob routes the requests for a single bulk resend job:
+// GET /v1/bulk-resends/{id} and POST /v1/bulk-resends/{id}:<operation>
+func (s *Server) handleBulkJob(w http.ResponseWriter, r *http.Request) {
+	id, operation, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/bulk-resends/"), ":")
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, codeNotFound, "not found", nil)
+		return
+	}
+
+	var handlers methods
+	switch operation {
+	case "":
+		handlers = methods{http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+			job, err := s.bulk.Get(id)
+			s.writeJob(w, id, job, err)
+		}}
+	case operationPause:
+		handlers = methods{http.MethodPost: func(w http.ResponseWriter, r *http.Request) {
+			s.handleBulkOperation(w, r, id, s.bulk.Pause)
+		}}
+	case operationResume:
+		handlers = methods{http.MethodPost: func(w http.ResponseWriter, r *http.Request) {
+			s.handleBulkOperation(w, r, id, s.bulk.Resume)
+		}}
+	default:
+		writeError(w, http.StatusNotFound, codeNotFound, "unknown operation "+operation, nil)
+		return
+	}
+	handlers.handle(w, r)
+}
+
+// handleBulkOperation pauses or resumes a bulk resend job
+func (s *Server) handleBulkOperation(w http.ResponseWriter, r *http.Request, id string, operation func(id, actor, reason string) (*models.BulkResendJob, error)) {
+	req, ok := s.decodeOperation(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := operation(id, auth.Caller(r.Context()), req.Reason)
+	s.writeJob(w, id, job, err)
+}
+
+// writeJob writes a bulk resend job, or the error that occurred reading or
+// changing it
+func (s *Server) writeJob(w http.ResponseWriter, id string, job *models.BulkResendJob, err error) {
+	switch {
+	case errors.Is(err, supabase.ErrJobNotFound):
+		writeError(w, http.StatusNotFound, codeNotFound, "bulk resend "+id+" not found", nil)
+	case errors.Is(err, notifications.ErrNotPausable), errors.Is(err, notifications.ErrNotResumable):
+		writeError(w, http.StatusConflict, codeConflict, err.Error(), nil)
+	case err != nil:
+		log.Printf("Failed to handle bulk resend %s: %v", id, err)
+		writeError(w, http.StatusInternalServerError, codeInternal, "failed to handle bulk resend", nil)
+	default:
+		writeJSON(w, http.StatusOK, job)
+	}
+}
+
+// writeValidationError writes the response for an invalid request, returning
+// whether it did
+func (s *Server) writeValidationError(w http.ResponseWriter, err error) bool {
+	var validationErr *models.ValidationError
+	if !errors.As(err, &validationErr) {
+		return false
+	}
+
+	writeError(w, http.StatusUnprocessableEntity, codeValidationFailed, "request is invalid", validationErr.Errors)
+	return true
+}
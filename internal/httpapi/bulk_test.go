@@ -0,0 +1,112 @@
+package httpapi
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/notification_service/internal/models"
+)
+
+// fakeBulkResender records who created, paused and resumed its jobs
+type fakeBulkResender struct {
+	mu      sync.Mutex
+	actors  map[string]string
+	reasons map[string]string
+}
+
+func newFakeBulkResender() *fakeBulkResender {
+	return &fakeBulkResender{actors: make(map[string]string), reasons: make(map[string]string)}
+}
+
+// record records the actor and reason of an operation
+func (b *fakeBulkResender) record(operation, actor, reason string) *models.BulkResendJob {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.actors[operation], b.reasons[operation] = actor, reason
+	return &models.BulkResendJob{ID: "job-1", Actor: actor, Reason: reason}
+}
+
+func (b *fakeBulkResender) Preview(filter *models.BulkResendFilter) (int, error) {
+	return 0, nil
+}
+
+func (b *fakeBulkResender) Create(filter *models.BulkResendFilter, rate int, actor, reason string) (*models.BulkResendJob, error) {
+	return b.record("create", actor, reason), nil
+}
+
+func (b *fakeBulkResender) Get(id string) (*models.BulkResendJob, error) {
+	return &models.BulkResendJob{ID: id}, nil
+}
+
+func (b *fakeBulkResender) List() ([]models.BulkResendJob, error) {
+	return []models.BulkResendJob{}, nil
+}
+
+func (b *fakeBulkResender) Pause(id, actor, reason string) (*models.BulkResendJob, error) {
+	return b.record("pause", actor, reason), nil
+}
+
+func (b *fakeBulkResender) Resume(id, actor, reason string) (*models.BulkResendJob, error) {
+	return b.record("resume", actor, reason), nil
+}
+
+func TestBulkRoutesRequireAuthentication(t *testing.T) {
+	bulk := newFakeBulkResender()
+	handler := NewServer(testConfig(), nil, nil, bulk, nil).Handler()
+
+	routes := []struct {
+		method, target string
+	}{
+		{http.MethodGet, "/v1/bulk-resends"},
+		{http.MethodPost, "/v1/bulk-resends"},
+		{http.MethodPost, "/v1/bulk-resends:preview"},
+		{http.MethodGet, "/v1/bulk-resends/job-1"},
+		{http.MethodPost, "/v1/bulk-resends/job-1:pause"},
+		{http.MethodPost, "/v1/bulk-resends/job-1:resume"},
+	}
+	for _, route := range routes {
+		if w := serve(handler, route.method, route.target, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s = %d, want 401", route.method, route.target, w.Code)
+		}
+	}
+	if len(bulk.actors) != 0 {
+		t.Errorf("operations %v performed without authentication", bulk.actors)
+	}
+}
+
+func TestBulkOperationsRecordTheCallerAsActor(t *testing.T) {
+	bulk := newFakeBulkResender()
+	handler := NewServer(testConfig(), nil, nil, bulk, nil).Handler()
+
+	w := post(handler, "/v1/bulk-resends", `{"created_after": "2024-05-01T10:00:00Z", "reason": "outage"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s, want 201", w.Code, w.Body)
+	}
+	if w := post(handler, "/v1/bulk-resends/job-1:pause", `{"reason": "checking"}`); w.Code != http.StatusOK {
+		t.Fatalf("pause = %d %s, want 200", w.Code, w.Body)
+	}
+	if w := post(handler, "/v1/bulk-resends/job-1:resume", ""); w.Code != http.StatusOK {
+		t.Fatalf("resume = %d %s, want 200", w.Code, w.Body)
+	}
+
+	want := map[string]string{"create": "outage", "pause": "checking", "resume": ""}
+	for operation, reason := range want {
+		if bulk.actors[operation] != "ops" || bulk.reasons[operation] != reason {
+			t.Errorf("%s by %q for %q, want ops for %q", operation, bulk.actors[operation], bulk.reasons[operation], reason)
+		}
+	}
+}
+
+func TestBulkCreateRejectsAnActorInTheBody(t *testing.T) {
+	bulk := newFakeBulkResender()
+	handler := NewServer(testConfig(), nil, nil, bulk, nil).Handler()
+
+	w := post(handler, "/v1/bulk-resends", `{"created_after": "2024-05-01T10:00:00Z", "actor": "someone-else"}`)
+	if w.Code != http.StatusBadRequest || errorCode(t, w) != codeInvalidJSON {
+		t.Errorf("create = %d %s, want 400", w.Code, w.Body)
+	}
+	if _, ok := bulk.actors["create"]; ok {
+		t.Error("job created with the actor of the body")
+	}
+}
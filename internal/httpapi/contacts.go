@@ -0,0 +1,34 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+)
+
+// operationInvalidate drops a user's cached contacts, as in
+// POST /v1/contacts/{user_id}:invalidate
+const operationInvalidate = "invalidate"
+
+// ContactCache caches the contacts channels are resolved from
+type ContactCache interface {
+	Invalidate(userID string)
+}
+
+// handleContacts routes the requests for a user's contacts:
+// POST /v1/contacts/{user_id}:invalidate
+func (s *Server) handleContacts(w http.ResponseWriter, r *http.Request) {
+	userID, operation, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/contacts/"), ":")
+	if userID == "" || strings.Contains(userID, "/") {
+		writeError(w, http.StatusNotFound, codeNotFound, "not found", nil)
+		return
+	}
+	if operation != operationInvalidate {
+		writeError(w, http.StatusNotFound, codeNotFound, "unknown operation "+operation, nil)
+		return
+	}
+
+	methods{http.MethodPost: func(w http.ResponseWriter, r *http.Request) {
+		s.contacts.Invalidate(userID)
+		w.WriteHeader(http.StatusNoContent)
+	}}.handle(w, r)
+}
@@ -0,0 +1,221 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/notification_service/internal/models"
+	"github.com/notification_service/internal/notifications"
+)
+
+// HeaderRequestID identifies a request; it is recorded as the message ID in
+// the notification's origin metadata
+const HeaderRequestID = "X-Request-ID"
+
+// Error codes
+const (
+	codeUnauthenticated      = "unauthenticated"
+	codeMethodNotAllowed     = "method_not_allowed"
+	codeUnsupportedMediaType = "unsupported_media_type"
+	codeRequestTooLarge      = "request_too_large"
+	codeInvalidJSON          = "invalid_json"
+	codeInvalidBatch         = "invalid_batch"
+	codeValidationFailed     = "validation_failed"
+	codeDeliveryFailed       = "delivery_failed"
+	codeEnqueueFailed        = "enqueue_failed"
+	codeInternal             = "internal_error"
+)
+
+// apiError is the body of error responses and of failed batch items
+type apiError struct {
+	Code    string              `json:"code"`
+	Message string              `json:"message"`
+	Fields  []models.FieldError `json:"fields,omitempty"`
+}
+
+// errorResponse wraps an apiError
+type errorResponse struct {
+	Error *apiError `json:"error"`
+}
+
+// result is the outcome of one submitted notification
+type result struct {
+	ID     string                    `json:"id,omitempty"`
+	Status models.NotificationStatus `json:"status,omitempty"`
+	Error  *apiError                 `json:"error,omitempty"`
+}
+
+// batchRequest is the body of a batch request
+type batchRequest struct {
+	Notifications []models.KafkaNotificationMessage `json:"notifications"`
+}
+
+// batchResult is the outcome of one notification of a batch
+type batchResult struct {
+	Index int `json:"index"`
+	result
+}
+
+// batchResponse is the body of a batch response, with a result per
+// notification in request order
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+// handleCreate submits a single notification
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var msg models.KafkaNotificationMessage
+	if !s.decode(w, r, &msg) {
+		return
+	}
+
+	res, status := s.submit(r, &msg, r.Header.Get(HeaderRequestID))
+	if res.Error != nil && res.ID == "" {
+		writeJSON(w, status, errorResponse{Error: res.Error})
+		return
+	}
+	writeJSON(w, status, res)
+}
+
+// handleBatch submits several notifications. Each is validated and submitted
+// on its own, so the response is 200 OK with a result per notification even
+// if some of them failed.
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	if !s.decode(w, r, &req) {
+		return
+	}
+
+	switch {
+	case len(req.Notifications) == 0:
+		writeError(w, http.StatusBadRequest, codeInvalidBatch, "notifications must not be empty", nil)
+		return
+	case len(req.Notifications) > s.maxBatchSize:
+		writeError(w, http.StatusRequestEntityTooLarge, codeInvalidBatch,
+			fmt.Sprintf("batch has %d notifications, the limit is %d", len(req.Notifications), s.maxBatchSize), nil)
+		return
+	}
+
+	requestID := r.Header.Get(HeaderRequestID)
+	resp := batchResponse{Results: make([]batchResult, len(req.Notifications))}
+	for i := range req.Notifications {
+		messageID := ""
+		if requestID != "" {
+			messageID = fmt.Sprintf("%s/%d", requestID, i)
+		}
+
+		res, _ := s.submit(r, &req.Notifications[i], messageID)
+		resp.Results[i] = batchResult{Index: i, result: res}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// submit validates a message and sends or enqueues it, depending on the
+// submit mode. It returns the result along with the HTTP status describing it.
+func (s *Server) submit(r *http.Request, msg *models.KafkaNotificationMessage, messageID string) (result, int) {
+	env := &models.Envelope{
+		Message:   msg,
+		Key:       msg.UserID,
+		Headers:   s.headers(r),
+		MessageID: messageID,
+		Timestamp: time.Now(),
+	}
+
+	status, err := s.submitter.Submit(env)
+	return submitResult(env.NotificationID, status, err)
+}
+
+// submitResult describes the outcome of submitting a notification, along
+// with the HTTP status describing it. id is empty if nothing was stored.
+func submitResult(id string, status models.NotificationStatus, err error) (result, int) {
+	// Invalid requests are rejected without being stored
+	var validationErr *models.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return result{Error: &apiError{Code: codeValidationFailed, Message: "notification is invalid", Fields: validationErr.Errors}},
+			http.StatusUnprocessableEntity
+	case id == "":
+		log.Printf("Failed to store notification: %v", err)
+		return result{Error: &apiError{Code: codeInternal, Message: "failed to store notification"}}, http.StatusInternalServerError
+	case errors.Is(err, notifications.ErrEnqueue):
+		return result{
+			ID:     id,
+			Status: status,
+			Error:  &apiError{Code: codeEnqueueFailed, Message: "failed to enqueue notification"},
+		}, http.StatusServiceUnavailable
+	case err != nil:
+		return result{
+			ID:     id,
+			Status: status,
+			Error:  &apiError{Code: codeDeliveryFailed, Message: err.Error()},
+		}, http.StatusBadGateway
+	case status == models.NotificationStatusPending:
+		return result{ID: id, Status: status}, http.StatusAccepted
+	}
+	return result{ID: id, Status: status}, http.StatusCreated
+}
+
+// headers returns the persisted headers present on the request, keyed by
+// their configured (lowercase) names like message headers
+func (s *Server) headers(r *http.Request) map[string]string {
+	headers := make(map[string]string)
+	for _, name := range s.persistedHeaders {
+		if value := r.Header.Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+	return headers
+}
+
+// decode reads a JSON request body of at most maxBodyBytes into v, writing
+// an error response and returning false if it cannot
+func (s *Server) decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != "application/json" {
+			writeError(w, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "content type must be application/json", nil)
+			return false
+		}
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxBodyBytes))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("request body must contain a single JSON object")
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, codeRequestTooLarge,
+				fmt.Sprintf("request body exceeds %d bytes", maxBytesErr.Limit), nil)
+			return false
+		}
+		writeError(w, http.StatusBadRequest, codeInvalidJSON, err.Error(), nil)
+		return false
+	}
+
+	return true
+}
+
+// writeError writes an error response
+func writeError(w http.ResponseWriter, status int, code, message string, fields []models.FieldError) {
+	writeJSON(w, status, errorResponse{Error: &apiError{Code: code, Message: message, Fields: fields}})
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/notification_service/internal/auth"
+	"github.com/notification_service/internal/notifications"
+	"github.com/notification_service/internal/supabase"
+)
+
+// Error codes of operations on a notification
+const (
+	codeNotFound = "not_found"
+	codeConflict = "conflict"
+)
+
+// Operations on a notification, as in POST /v1/notifications/{id}:resend
+const (
+	operationResend = "resend"
+	operationCancel = "cancel"
+)
+
+// operationRequest is the body of an operation on a notification. The reason
+// is recorded in the audit log, with the authenticated client as the actor.
+type operationRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// resendResult is the outcome of resending a notification
+type resendResult struct {
+	result
+	ResendOf string `json:"resend_of"`
+}
+
+// handleNotification routes the requests for a single notification:
+// GET /v1/notifications/{id} and POST /v1/notifications/{id}:<operation>
+func (s *Server) handleNotification(w http.ResponseWriter, r *http.Request) {
+	id, operation, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/notifications/"), ":")
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, codeNotFound, "not found", nil)
+		return
+	}
+
+	var handlers methods
+	switch operation {
+	case "":
+		handlers = methods{http.MethodGet: func(w http.ResponseWriter, r *http.Request) { s.handleGet(w, r, id) }}
+	case operationResend:
+		handlers = methods{http.MethodPost: func(w http.ResponseWriter, r *http.Request) { s.handleResend(w, r, id) }}
+	case operationCancel:
+		handlers = methods{http.MethodPost: func(w http.ResponseWriter, r *http.Request) { s.handleCancel(w, r, id) }}
+	default:
+		writeError(w, http.StatusNotFound, codeNotFound, "unknown operation "+operation, nil)
+		return
+	}
+	handlers.handle(w, r)
+}
+
+// handleResend resends a failed notification as a new one
+func (s *Server) handleResend(w http.ResponseWriter, r *http.Request, id string) {
+	req, ok := s.decodeOperation(w, r)
+	if !ok {
+		return
+	}
+
+	newID, status, err := s.submitter.Resend(id, auth.Caller(r.Context()), req.Reason)
+	if s.writeOperationError(w, id, err) {
+		return
+	}
+
+	res, code := submitResult(newID, status, err)
+	writeJSON(w, code, resendResult{result: res, ResendOf: id})
+}
+
+// handleCancel cancels a pending or retrying notification
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request, id string) {
+	req, ok := s.decodeOperation(w, r)
+	if !ok {
+		return
+	}
+
+	notification, err := s.store.CancelNotification(id, auth.Caller(r.Context()), req.Reason)
+	if s.writeOperationError(w, id, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to cancel notification %s: %v", id, err)
+		writeError(w, http.StatusInternalServerError, codeInternal, "failed to cancel notification", nil)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, notification)
+}
+
+// decodeOperation reads the body of an operation, which may be empty
+func (s *Server) decodeOperation(w http.ResponseWriter, r *http.Request) (*operationRequest, bool) {
+	var req operationRequest
+	if r.ContentLength == 0 {
+		return &req, true
+	}
+	if !s.decode(w, r, &req) {
+		return nil, false
+	}
+	return &req, true
+}
+
+// writeOperationError writes the response for a notification that does not
+// exist or is not in a status the operation applies to, returning whether it
+// did
+func (s *Server) writeOperationError(w http.ResponseWriter, id string, err error) bool {
+	switch {
+	case errors.Is(err, supabase.ErrNotFound):
+		writeError(w, http.StatusNotFound, codeNotFound, "notification "+id+" not found", nil)
+	case errors.Is(err, notifications.ErrNotResendable), errors.Is(err, notifications.ErrNotCancellable):
+		writeError(w, http.StatusConflict, codeConflict, err.Error(), nil)
+	default:
+		return false
+	}
+	return true
+}
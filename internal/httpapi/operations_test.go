@@ -0,0 +1,79 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/notification_service/internal/models"
+)
+
+// fakeSubmitter records the resends it is asked for
+type fakeSubmitter struct {
+	mu           sync.Mutex
+	resentBy     string
+	resendReason string
+}
+
+func (s *fakeSubmitter) Submit(env *models.Envelope) (models.NotificationStatus, error) {
+	env.NotificationID = "n-new"
+	return models.NotificationStatusPending, nil
+}
+
+func (s *fakeSubmitter) Resend(id, actor, reason string) (string, models.NotificationStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resentBy, s.resendReason = actor, reason
+	return "n-new", models.NotificationStatusPending, nil
+}
+
+func (s *fakeSubmitter) Mode() string { return "enqueue" }
+
+// post serves a POST request with body, authenticated as the client "ops"
+func post(handler http.Handler, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+testToken)
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestOperationsRecordTheCallerAsActor(t *testing.T) {
+	store := newFakeStore(models.Notification{ID: "n-1", Status: models.NotificationStatusPending})
+	submitter := &fakeSubmitter{}
+	handler := NewServer(testConfig(), submitter, store, nil, nil).Handler()
+
+	w := post(handler, "/v1/notifications/n-1:cancel", `{"reason": "duplicate"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("cancel = %d %s, want 200", w.Code, w.Body)
+	}
+	if store.cancelledBy != "ops" || store.cancelReason != "duplicate" {
+		t.Errorf("cancelled by %q for %q, want ops for duplicate", store.cancelledBy, store.cancelReason)
+	}
+
+	w = post(handler, "/v1/notifications/n-1:resend", "")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("resend without a body = %d %s, want 202", w.Code, w.Body)
+	}
+	if submitter.resentBy != "ops" || submitter.resendReason != "" {
+		t.Errorf("resent by %q for %q, want ops without a reason", submitter.resentBy, submitter.resendReason)
+	}
+}
+
+func TestOperationsRejectAnActorInTheBody(t *testing.T) {
+	store := newFakeStore(models.Notification{ID: "n-1", Status: models.NotificationStatusPending})
+	handler := NewServer(testConfig(), &fakeSubmitter{}, store, nil, nil).Handler()
+
+	w := post(handler, "/v1/notifications/n-1:cancel", `{"actor": "someone-else", "reason": "duplicate"}`)
+	if w.Code != http.StatusBadRequest || errorCode(t, w) != codeInvalidJSON {
+		t.Errorf("cancel = %d %s, want 400", w.Code, w.Body)
+	}
+	if store.cancelledBy != "" {
+		t.Errorf("cancelled by %q, want not cancelled", store.cancelledBy)
+	}
+}
@@ -0,0 +1,149 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/notification_service/internal/models"
+	"github.com/notification_service/internal/supabase"
+)
+
+// metadataParamPrefix prefixes the query parameters filtering by metadata,
+// e.g. metadata.order_id=123
+const metadataParamPrefix = "metadata."
+
+// codeInvalidQuery is the error code of malformed listings
+const codeInvalidQuery = "invalid_query"
+
+// handleGet returns a notification by ID
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, id string) {
+	notification, err := s.store.GetNotification(id)
+	switch {
+	case errors.Is(err, supabase.ErrNotFound):
+		writeError(w, http.StatusNotFound, codeNotFound, "notification "+id+" not found", nil)
+		return
+	case err != nil:
+		log.Printf("Failed to get notification %s: %v", id, err)
+		writeError(w, http.StatusInternalServerError, codeInternal, "failed to get notification", nil)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, notification)
+}
+
+// handleList returns a page of the notifications matching the query
+// parameters
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r.URL.Query())
+	if err == nil {
+		err = query.Validate()
+	}
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		writeError(w, http.StatusBadRequest, codeInvalidQuery, "query is invalid", validationErr.Errors)
+		return
+	}
+
+	page, err := s.store.ListNotifications(query)
+	switch {
+	case errors.Is(err, supabase.ErrInvalidCursor):
+		writeError(w, http.StatusBadRequest, codeInvalidQuery, "query is invalid", []models.FieldError{
+			{Field: "cursor", Code: models.ValidationCodeInvalid, Message: "is not a cursor of this listing"},
+		})
+		return
+	case err != nil:
+		log.Printf("Failed to list notifications: %v", err)
+		writeError(w, http.StatusInternalServerError, codeInternal, "failed to list notifications", nil)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// parseQuery parses the query parameters of a listing. Malformed and unknown
+// parameters are reported in a *models.ValidationError.
+func parseQuery(params url.Values) (*models.NotificationQuery, error) {
+	query := &models.NotificationQuery{
+		Order: models.SortDescending,
+		Limit: models.DefaultQueryLimit,
+	}
+	filter := &query.Filter
+	v := &models.ValidationError{}
+	invalid := func(field, message string) {
+		v.Errors = append(v.Errors, models.FieldError{Field: field, Code: models.ValidationCodeInvalid, Message: message})
+	}
+	parseTime := func(name string) time.Time {
+		t, err := time.Parse(time.RFC3339Nano, params.Get(name))
+		if err != nil {
+			invalid(name, "must be an RFC 3339 time")
+		}
+		return t
+	}
+
+	// Sorted so errors are reported in a stable order
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		values := params[name]
+		switch {
+		case name == "user_id":
+			filter.UserIDs = splitValues(values)
+		case name == "type":
+			filter.Type = models.NotificationType(values[0])
+		case name == "status":
+			for _, status := range splitValues(values) {
+				filter.Statuses = append(filter.Statuses, models.NotificationStatus(status))
+			}
+		case name == "error_class":
+			filter.ErrorClasses = splitValues(values)
+		case name == "created_after":
+			filter.CreatedAfter = parseTime(name)
+		case name == "created_before":
+			filter.CreatedBefore = parseTime(name)
+		case strings.HasPrefix(name, metadataParamPrefix):
+			if filter.Metadata == nil {
+				filter.Metadata = make(map[string]string)
+			}
+			filter.Metadata[strings.TrimPrefix(name, metadataParamPrefix)] = values[0]
+		case name == "order":
+			query.Order = models.SortOrder(values[0])
+		case name == "limit":
+			limit, err := strconv.Atoi(values[0])
+			if err != nil {
+				invalid(name, "must be a number")
+			}
+			query.Limit = limit
+		case name == "cursor":
+			query.Cursor = values[0]
+		default:
+			invalid(name, "unknown parameter")
+		}
+	}
+
+	if len(v.Errors) > 0 {
+		return nil, v
+	}
+	return query, nil
+}
+
+// splitValues returns the values of a parameter that can be repeated or
+// comma-separated
+func splitValues(values []string) []string {
+	var split []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			split = append(split, strings.TrimSpace(part))
+		}
+	}
+	return split
+}
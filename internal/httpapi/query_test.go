@@ -0,0 +1,121 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/notification_service/internal/models"
+	"github.com/notification_service/internal/supabase"
+)
+
+// fakeStore serves stored notifications and records the calls made to it
+type fakeStore struct {
+	mu            sync.Mutex
+	notifications map[string]*models.Notification
+	calls         int
+	// cancelledBy and cancelReason are the actor and reason of the last
+	// cancellation
+	cancelledBy  string
+	cancelReason string
+}
+
+func newFakeStore(notifications ...models.Notification) *fakeStore {
+	store := &fakeStore{notifications: make(map[string]*models.Notification)}
+	for i := range notifications {
+		store.notifications[notifications[i].ID] = &notifications[i]
+	}
+	return store
+}
+
+func (s *fakeStore) GetNotification(id string) (*models.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	n, ok := s.notifications[id]
+	if !ok {
+		return nil, supabase.ErrNotFound
+	}
+	return n, nil
+}
+
+func (s *fakeStore) ListNotifications(query *models.NotificationQuery) (*models.NotificationPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	page := &models.NotificationPage{}
+	for _, n := range s.notifications {
+		page.Notifications = append(page.Notifications, *n)
+	}
+	return page, nil
+}
+
+func (s *fakeStore) CancelNotification(id, actor, reason string) (*models.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	n, ok := s.notifications[id]
+	if !ok {
+		return nil, supabase.ErrNotFound
+	}
+	n.Status = models.NotificationStatusCancelled
+	s.cancelledBy, s.cancelReason = actor, reason
+	return n, nil
+}
+
+// callCount returns the number of calls made to the store
+func (s *fakeStore) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func TestQueryRoutesRequireAuthentication(t *testing.T) {
+	store := newFakeStore(models.Notification{ID: "n-1", UserID: "user-1", Status: models.NotificationStatusSent})
+	handler := NewServer(testConfig(), nil, store, nil, nil).Handler()
+
+	for _, target := range []string{"/v1/notifications?user_id=user-1", "/v1/notifications/n-1"} {
+		t.Run(target, func(t *testing.T) {
+			if w := serve(handler, http.MethodGet, target, ""); w.Code != http.StatusUnauthorized {
+				t.Errorf("status without a token = %d, want 401", w.Code)
+			}
+			if w := serve(handler, http.MethodGet, target, "Bearer wrong"); w.Code != http.StatusUnauthorized {
+				t.Errorf("status with an invalid token = %d, want 401", w.Code)
+			}
+			if calls := store.callCount(); calls != 0 {
+				t.Errorf("%d store calls for unauthenticated requests, want none", calls)
+			}
+		})
+	}
+}
+
+func TestGetAndList(t *testing.T) {
+	store := newFakeStore(models.Notification{ID: "n-1", UserID: "user-1", Status: models.NotificationStatusSent})
+	handler := NewServer(testConfig(), nil, store, nil, nil).Handler()
+
+	w := serve(handler, http.MethodGet, "/v1/notifications/n-1", "Bearer "+testToken)
+	var notification models.Notification
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &notification) != nil || notification.ID != "n-1" {
+		t.Errorf("get = %d %s, want notification n-1", w.Code, w.Body)
+	}
+
+	w = serve(handler, http.MethodGet, "/v1/notifications/n-2", "Bearer "+testToken)
+	if w.Code != http.StatusNotFound || errorCode(t, w) != codeNotFound {
+		t.Errorf("get of an unknown notification = %d %s, want 404", w.Code, w.Body)
+	}
+
+	w = serve(handler, http.MethodGet, "/v1/notifications?user_id=user-1", "Bearer "+testToken)
+	var page models.NotificationPage
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &page) != nil || len(page.Notifications) != 1 {
+		t.Errorf("list = %d %s, want the notification", w.Code, w.Body)
+	}
+
+	w = serve(handler, http.MethodGet, "/v1/notifications?limit=none", "Bearer "+testToken)
+	if w.Code != http.StatusBadRequest || errorCode(t, w) != codeInvalidQuery {
+		t.Errorf("list with an invalid limit = %d %s, want 400", w.Code, w.Body)
+	}
+}
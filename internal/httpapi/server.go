@@ -0,0 +1,160 @@
+package httpapi
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/notification_service/internal/auth"
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/models"
+)
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// Submitter validates and sends or enqueues notifications
+type Submitter interface {
+	Submit(env *models.Envelope) (models.NotificationStatus, error)
+	Resend(id, actor, reason string) (string, models.NotificationStatus, error)
+	Mode() string
+}
+
+// NotificationStore reads and cancels stored notifications
+type NotificationStore interface {
+	GetNotification(id string) (*models.Notification, error)
+	ListNotifications(query *models.NotificationQuery) (*models.NotificationPage, error)
+	CancelNotification(id, actor, reason string) (*models.Notification, error)
+}
+
+// BulkResender runs jobs resending failed notifications in bulk
+type BulkResender interface {
+	Preview(filter *models.BulkResendFilter) (int, error)
+	Create(filter *models.BulkResendFilter, rate int, actor, reason string) (*models.BulkResendJob, error)
+	Get(id string) (*models.BulkResendJob, error)
+	List() ([]models.BulkResendJob, error)
+	Pause(id, actor, reason string) (*models.BulkResendJob, error)
+	Resume(id, actor, reason string) (*models.BulkResendJob, error)
+}
+
+// Server is the HTTP API, which submits and queries notifications
+type Server struct {
+	submitter        Submitter
+	store            NotificationStore
+	bulk             BulkResender
+	contacts         ContactCache
+	tokens           *auth.Tokens
+	maxBodyBytes     int64
+	maxBatchSize     int
+	persistedHeaders []string
+
+	server *http.Server
+}
+
+// NewServer creates the HTTP API. The contacts endpoint is only served if
+// contacts is not nil.
+func NewServer(cfg *config.Config, submitter Submitter, store NotificationStore, bulk BulkResender, contacts ContactCache) *Server {
+	s := &Server{
+		submitter:        submitter,
+		store:            store,
+		bulk:             bulk,
+		contacts:         contacts,
+		tokens:           auth.NewTokens(cfg.HTTP.AuthTokens),
+		maxBodyBytes:     int64(cfg.HTTP.MaxBodyBytes),
+		maxBatchSize:     cfg.HTTP.MaxBatchSize,
+		persistedHeaders: cfg.Service.PersistedHeaders,
+	}
+
+	s.server = &http.Server{
+		Addr:         cfg.HTTP.Addr,
+		Handler:      s.Handler(),
+		ReadTimeout:  cfg.HTTP.ReadTimeout,
+		WriteTimeout: cfg.HTTP.WriteTimeout,
+	}
+
+	return s
+}
+
+// Handler returns the routes of the API, which all require a bearer token
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/notifications", methods{
+		http.MethodGet:  s.handleList,
+		http.MethodPost: s.handleCreate,
+	}.handle)
+	mux.HandleFunc("/v1/notifications/", s.handleNotification)
+	mux.HandleFunc("/v1/notifications:batch", methods{http.MethodPost: s.handleBatch}.handle)
+	mux.HandleFunc("/v1/bulk-resends", methods{
+		http.MethodGet:  s.handleBulkList,
+		http.MethodPost: s.handleBulkCreate,
+	}.handle)
+	mux.HandleFunc("/v1/bulk-resends/", s.handleBulkJob)
+	mux.HandleFunc("/v1/bulk-resends:preview", methods{http.MethodPost: s.handleBulkPreview}.handle)
+	if s.contacts != nil {
+		mux.HandleFunc("/v1/contacts/", s.handleContacts)
+	}
+	mux.HandleFunc("/openapi.yaml", methods{http.MethodGet: s.handleOpenAPI}.handle)
+	return s.authenticated(mux)
+}
+
+// authenticated serves requests bearing one of the configured client tokens
+// with next, with the client's name in the request context, and rejects
+// the others with 401
+func (s *Server) authenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller, err := s.tokens.Authenticate(r.Header.Get("Authorization"))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, codeUnauthenticated, err.Error(), nil)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithCaller(r.Context(), caller)))
+	})
+}
+
+// Start serves the API in the background
+func (s *Server) Start() {
+	go func() {
+		log.Printf("HTTP API listening on %s (%s mode)", s.server.Addr, s.submitter.Mode())
+		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP API stopped: %v", err)
+		}
+	}()
+}
+
+// Shutdown stops accepting requests and waits until ctx is done for the
+// requests being served
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// methods routes the requests to a path by method
+type methods map[string]http.HandlerFunc
+
+// handle serves a request with the handler of its method, rejecting other
+// methods
+func (m methods) handle(w http.ResponseWriter, r *http.Request) {
+	if handler, ok := m[r.Method]; ok {
+		handler(w, r)
+		return
+	}
+
+	allowed := make([]string, 0, len(m))
+	for method := range m {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "method "+r.Method+" not allowed", nil)
+}
+
+// handleOpenAPI serves the OpenAPI description of the API
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,94 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/notification_service/internal/auth"
+	"github.com/notification_service/internal/config"
+)
+
+// testToken is the token of the client "ops" in the test configuration
+const testToken = "secret"
+
+// testConfig returns the configuration of the API under test
+func testConfig() *config.Config {
+	return &config.Config{HTTP: config.HTTPConfig{
+		AuthTokens:   map[string]string{"ops": testToken},
+		MaxBodyBytes: 1 << 20,
+		MaxBatchSize: 10,
+	}}
+}
+
+// serve serves a request to handler with the given Authorization header,
+// if any, and returns the response
+func serve(handler http.Handler, method, target, authorization string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// errorCode returns the code of the error response w holds
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	var body errorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error == nil {
+		t.Fatalf("response %q is not an error: %v", w.Body.String(), err)
+	}
+	return body.Error.Code
+}
+
+func TestAuthentication(t *testing.T) {
+	handler := NewServer(testConfig(), nil, nil, nil, nil).Handler()
+
+	tests := []struct {
+		name          string
+		authorization string
+	}{
+		{name: "missing"},
+		{name: "wrong scheme", authorization: "Basic b3BzOnNlY3JldA=="},
+		{name: "invalid token", authorization: "Bearer wrong"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(handler, http.MethodGet, "/openapi.yaml", tt.authorization)
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want 401", w.Code)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want Bearer", got)
+			}
+			if code := errorCode(t, w); code != codeUnauthenticated {
+				t.Errorf("code = %q, want %q", code, codeUnauthenticated)
+			}
+		})
+	}
+
+	t.Run("valid token", func(t *testing.T) {
+		w := serve(handler, http.MethodGet, "/openapi.yaml", "Bearer "+testToken)
+		if w.Code != http.StatusOK {
+			t.Errorf("status = %d, want 200", w.Code)
+		}
+	})
+}
+
+func TestAuthenticatedRequestsCarryTheCaller(t *testing.T) {
+	s := &Server{tokens: auth.NewTokens(map[string]string{"ops": testToken})}
+
+	var caller string
+	handler := s.authenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller = auth.Caller(r.Context())
+	}))
+
+	serve(handler, http.MethodGet, "/", "Bearer "+testToken)
+	if caller != "ops" {
+		t.Errorf("caller = %q, want ops", caller)
+	}
+}
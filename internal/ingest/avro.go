@@ -0,0 +1,58 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/notification_service/internal/models"
+)
+
+var (
+	notificationCodecOnce sync.Once
+	notificationCodec     *goavro.Codec
+	notificationCodecErr  error
+)
+
+// AvroDecoder decodes payloads in the NotificationMessage Avro format defined
+// in models/notification.avsc
+var AvroDecoder Decoder = DecoderFunc(func(value []byte, _ map[string]string) (*models.KafkaNotificationMessage, error) {
+	notificationCodecOnce.Do(func() {
+		notificationCodec, notificationCodecErr = newAvroCodec(models.AvroSchema)
+	})
+	if notificationCodecErr != nil {
+		return nil, notificationCodecErr
+	}
+	return decodeAvro(notificationCodec, value)
+})
+
+// newAvroCodec compiles an Avro schema. The codec renders unions as plain
+// JSON values so records map directly onto the JSON message format.
+func newAvroCodec(schema string) (*goavro.Codec, error) {
+	codec, err := goavro.NewCodecForStandardJSONFull(schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Avro schema: %w", err)
+	}
+	return codec, nil
+}
+
+// decodeAvro decodes an Avro record written with codec's schema. Fields are
+// matched to the message by name, as in the JSON format.
+func decodeAvro(codec *goavro.Codec, value []byte) (*models.KafkaNotificationMessage, error) {
+	native, _, err := codec.NativeFromBinary(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode Avro payload: %w", err)
+	}
+
+	textual, err := codec.TextualFromNative(nil, native)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode Avro payload: %w", err)
+	}
+
+	var notification models.KafkaNotificationMessage
+	if err := json.Unmarshal(textual, &notification); err != nil {
+		return nil, fmt.Errorf("failed to decode Avro payload: %w", err)
+	}
+	return &notification, nil
+}
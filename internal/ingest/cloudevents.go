@@ -0,0 +1,153 @@
+package ingest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/notification_service/internal/models"
+)
+
+// CloudEvents 1.0 Kafka protocol binding
+const (
+	// cloudEventsSpecVersion is the only supported CloudEvents version
+	cloudEventsSpecVersion = "1.0"
+	// cloudEventsHeaderPrefix prefixes the event attributes in binary mode
+	cloudEventsHeaderPrefix = "ce_"
+	// cloudEventsContentType marks a structured mode event
+	cloudEventsContentType = "application/cloudevents+json"
+	// headerContentType is the Kafka header carrying the payload media type
+	headerContentType = "content-type"
+)
+
+// metadataCloudEvent is the notification metadata key holding the attributes
+// of the CloudEvent a message was delivered in
+const metadataCloudEvent = "cloudevent"
+
+// cloudEvent holds the CloudEvent attributes recorded on a notification
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+// validate checks the required context attributes
+func (e *cloudEvent) validate() error {
+	if e.SpecVersion != cloudEventsSpecVersion {
+		return fmt.Errorf("unsupported CloudEvents specversion %q", e.SpecVersion)
+	}
+
+	var missing []string
+	if e.ID == "" {
+		missing = append(missing, "id")
+	}
+	if e.Source == "" {
+		missing = append(missing, "source")
+	}
+	if e.Type == "" {
+		missing = append(missing, "type")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("CloudEvent is missing required attributes: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// isBinaryCloudEvent reports whether the headers carry a binary mode CloudEvent
+func isBinaryCloudEvent(headers map[string]string) bool {
+	_, ok := headers[cloudEventsHeaderPrefix+"specversion"]
+	return ok
+}
+
+// isStructuredCloudEvent reports whether value is a structured mode
+// CloudEvent, either by its content type or by a specversion in the body
+func isStructuredCloudEvent(value []byte, headers map[string]string) bool {
+	if strings.HasPrefix(headers[headerContentType], cloudEventsContentType) {
+		return true
+	}
+
+	var probe struct {
+		SpecVersion string `json:"specversion"`
+	}
+	return json.Unmarshal(value, &probe) == nil && probe.SpecVersion != ""
+}
+
+// decodeBinaryCloudEvent decodes a binary mode CloudEvent: the attributes are
+// ce_ headers and the payload is the event data
+func decodeBinaryCloudEvent(value []byte, headers map[string]string) (*models.KafkaNotificationMessage, error) {
+	event := &cloudEvent{
+		SpecVersion:     headers[cloudEventsHeaderPrefix+"specversion"],
+		ID:              headers[cloudEventsHeaderPrefix+"id"],
+		Source:          headers[cloudEventsHeaderPrefix+"source"],
+		Type:            headers[cloudEventsHeaderPrefix+"type"],
+		Time:            headers[cloudEventsHeaderPrefix+"time"],
+		DataContentType: headers[headerContentType],
+	}
+	if err := event.validate(); err != nil {
+		return nil, err
+	}
+
+	return event.notification(value)
+}
+
+// decodeStructuredCloudEvent decodes a structured mode CloudEvent: the
+// attributes and the data are members of one JSON object
+func decodeStructuredCloudEvent(value []byte) (*models.KafkaNotificationMessage, error) {
+	var event cloudEvent
+	if err := json.Unmarshal(value, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode CloudEvent: %w", err)
+	}
+	if err := event.validate(); err != nil {
+		return nil, err
+	}
+
+	data := []byte(event.Data)
+	if event.DataBase64 != "" {
+		decoded, err := base64.StdEncoding.DecodeString(event.DataBase64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode CloudEvent data_base64: %w", err)
+		}
+		data = decoded
+	}
+
+	return event.notification(data)
+}
+
+// notification decodes the event data as a notification message and records
+// the event attributes in its metadata
+func (e *cloudEvent) notification(data []byte) (*models.KafkaNotificationMessage, error) {
+	if len(data) == 0 {
+		return nil, errors.New("CloudEvent has no data")
+	}
+	if e.DataContentType != "" && !strings.Contains(e.DataContentType, "json") {
+		return nil, fmt.Errorf("unsupported CloudEvent datacontenttype %q", e.DataContentType)
+	}
+
+	var notification models.KafkaNotificationMessage
+	if err := json.Unmarshal(data, &notification); err != nil {
+		return nil, fmt.Errorf("failed to decode CloudEvent data: %w", err)
+	}
+
+	attributes := map[string]interface{}{
+		"id":     e.ID,
+		"source": e.Source,
+		"type":   e.Type,
+	}
+	if e.Time != "" {
+		attributes["time"] = e.Time
+	}
+
+	if notification.Metadata == nil {
+		notification.Metadata = make(map[string]interface{}, 1)
+	}
+	notification.Metadata[metadataCloudEvent] = attributes
+
+	return &notification, nil
+}
@@ -0,0 +1,116 @@
+package ingest
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+// notificationData is the data of the test events
+const notificationData = `{"user_id":"user-1","type":"email","channel":"a@example.com","content":"Hello","metadata":{"order":"42"}}`
+
+// binaryHeaders returns the headers of a binary mode event
+func binaryHeaders() map[string]string {
+	return map[string]string{
+		"ce_specversion": "1.0",
+		"ce_id":          "event-1",
+		"ce_source":      "/orders",
+		"ce_type":        "order.shipped",
+		"ce_time":        "2024-05-01T10:00:00Z",
+		"content-type":   "application/json",
+	}
+}
+
+func TestJSONDecoderCloudEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		headers map[string]string
+		// event is the recorded event attributes, nil for a plain message
+		event map[string]interface{}
+	}{
+		{
+			name:    "binary mode",
+			value:   notificationData,
+			headers: binaryHeaders(),
+			event:   map[string]interface{}{"id": "event-1", "source": "/orders", "type": "order.shipped", "time": "2024-05-01T10:00:00Z"},
+		},
+		{
+			name:    "structured mode",
+			value:   `{"specversion":"1.0","id":"event-2","source":"/orders","type":"order.shipped","datacontenttype":"application/json","data":` + notificationData + `}`,
+			headers: map[string]string{"content-type": "application/cloudevents+json; charset=utf-8"},
+			event:   map[string]interface{}{"id": "event-2", "source": "/orders", "type": "order.shipped"},
+		},
+		{
+			name:  "structured mode without content type",
+			value: `{"specversion":"1.0","id":"event-3","source":"/orders","type":"order.shipped","data":` + notificationData + `}`,
+			event: map[string]interface{}{"id": "event-3", "source": "/orders", "type": "order.shipped"},
+		},
+		{
+			name:  "data_base64",
+			value: `{"specversion":"1.0","id":"event-4","source":"/orders","type":"order.shipped","data_base64":"` + base64.StdEncoding.EncodeToString([]byte(notificationData)) + `"}`,
+			event: map[string]interface{}{"id": "event-4", "source": "/orders", "type": "order.shipped"},
+		},
+		{
+			name:    "plain JSON",
+			value:   notificationData,
+			headers: map[string]string{"content-type": "application/json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := JSONDecoder.Decode([]byte(tt.value), tt.headers)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if msg.UserID != "user-1" || msg.Type != "email" || msg.Channel != "a@example.com" || msg.Content != "Hello" {
+				t.Errorf("message = %+v", msg)
+			}
+			if msg.Metadata["order"] != "42" {
+				t.Errorf("metadata = %v, want the data's metadata kept", msg.Metadata)
+			}
+
+			event, recorded := msg.Metadata[metadataCloudEvent]
+			if tt.event == nil {
+				if recorded {
+					t.Errorf("plain message recorded as CloudEvent %v", event)
+				}
+				return
+			}
+			if !reflect.DeepEqual(event, tt.event) {
+				t.Errorf("recorded event = %v, want %v", event, tt.event)
+			}
+		})
+	}
+}
+
+func TestJSONDecoderRejectsInvalidCloudEvents(t *testing.T) {
+	withoutSource := binaryHeaders()
+	delete(withoutSource, "ce_source")
+	unsupportedVersion := binaryHeaders()
+	unsupportedVersion["ce_specversion"] = "0.3"
+	xmlData := binaryHeaders()
+	xmlData["content-type"] = "application/xml"
+
+	tests := []struct {
+		name    string
+		value   string
+		headers map[string]string
+	}{
+		{name: "binary mode without source", value: notificationData, headers: withoutSource},
+		{name: "unsupported specversion", value: notificationData, headers: unsupportedVersion},
+		{name: "binary mode without data", headers: binaryHeaders()},
+		{name: "non-JSON data", value: "<notification/>", headers: xmlData},
+		{name: "structured mode without id", value: `{"specversion":"1.0","source":"/orders","type":"order.shipped","data":` + notificationData + `}`},
+		{name: "structured mode without data", value: `{"specversion":"1.0","id":"event-1","source":"/orders","type":"order.shipped"}`},
+		{name: "invalid data_base64", value: `{"specversion":"1.0","id":"event-1","source":"/orders","type":"order.shipped","data_base64":"not base64!"}`},
+		{name: "malformed structured event", value: `{"specversion":"1.0",`, headers: map[string]string{"content-type": "application/cloudevents+json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if msg, err := JSONDecoder.Decode([]byte(tt.value), tt.headers); err == nil {
+				t.Errorf("Decode = %+v, want an error", msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/notification_service/internal/models"
+)
+
+// Payload formats routes can select
+const (
+	FormatJSON     = "json"
+	FormatProtobuf = "protobuf"
+	FormatAvro     = "avro"
+)
+
+// Decoder converts a message payload into a notification message
+type Decoder interface {
+	Decode(value []byte, headers map[string]string) (*models.KafkaNotificationMessage, error)
+}
+
+// DecoderFunc adapts a function to the Decoder interface
+type DecoderFunc func(value []byte, headers map[string]string) (*models.KafkaNotificationMessage, error)
+
+// Decode calls f
+func (f DecoderFunc) Decode(value []byte, headers map[string]string) (*models.KafkaNotificationMessage, error) {
+	return f(value, headers)
+}
+
+// JSONDecoder decodes payloads in the KafkaNotificationMessage JSON format.
+// CloudEvents 1.0 in binary or structured mode are detected and their data
+// decoded in the same format.
+var JSONDecoder Decoder = DecoderFunc(func(value []byte, headers map[string]string) (*models.KafkaNotificationMessage, error) {
+	if isBinaryCloudEvent(headers) {
+		return decodeBinaryCloudEvent(value, headers)
+	}
+	if isStructuredCloudEvent(value, headers) {
+		return decodeStructuredCloudEvent(value)
+	}
+
+	var notification models.KafkaNotificationMessage
+	if err := json.Unmarshal(value, &notification); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON payload: %w", err)
+	}
+	return &notification, nil
+})
+
+// decoders are the payload formats routes can select
+var decoders = map[string]Decoder{
+	FormatJSON:     JSONDecoder,
+	FormatProtobuf: ProtobufDecoder,
+	FormatAvro:     AvroDecoder,
+}
+
+// DecoderFor returns the decoder for a route format, JSON if format is empty.
+// Payloads framed with a schema ID are decoded by their registered schema
+// whatever the format.
+func DecoderFor(format string, schemas *SchemaDecoder) (Decoder, error) {
+	if format == "" {
+		format = FormatJSON
+	}
+
+	decoder, ok := decoders[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown payload format: %q", format)
+	}
+	return &framedDecoder{schemas: schemas, unframed: decoder}, nil
+}
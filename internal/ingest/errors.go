@@ -0,0 +1,59 @@
+package ingest
+
+import (
+	"errors"
+
+	"github.com/notification_service/internal/models"
+)
+
+// Error classes recorded on dead-lettered messages
+const (
+	// ErrorClassDecode means the payload could not be decoded
+	ErrorClassDecode = "decode"
+	// ErrorClassNoRoute means no route matched the message's topic
+	ErrorClassNoRoute = "no_route"
+	// ErrorClassValidation means the message failed schema validation
+	ErrorClassValidation = "validation"
+	// ErrorClassPermanent means the handler failed with a permanent error
+	ErrorClassPermanent = "permanent"
+	// ErrorClassRetriesExhausted means every retry failed
+	ErrorClassRetriesExhausted = "retries_exhausted"
+	// ErrorClassRetryFailed means the message could not be scheduled for retry
+	ErrorClassRetryFailed = "retry_failed"
+)
+
+// Headers tracking the redelivery of a message
+const (
+	// HeaderAttempt is the 1-based delivery attempt the message represents
+	HeaderAttempt = "x-attempt"
+	// HeaderNotificationID is the ID of the notification row being retried
+	HeaderNotificationID = "x-notification-id"
+)
+
+// Headers describing why a message was dead-lettered
+const (
+	// HeaderErrorClass is the kind of failure, one of the ErrorClass constants
+	HeaderErrorClass = "x-error-class"
+	// HeaderErrorMessage is the error that sent the message to the dead-letter topic
+	HeaderErrorMessage = "x-error-message"
+	// HeaderSourceTopic is the topic the message was consumed from
+	HeaderSourceTopic = "x-source-topic"
+	// HeaderSourcePartition is the partition the message was consumed from
+	HeaderSourcePartition = "x-source-partition"
+	// HeaderSourceOffset is the offset the message was consumed from
+	HeaderSourceOffset = "x-source-offset"
+)
+
+// ClassifyError returns the dead-letter class of a handler error that must
+// not be retried, or "" if the error is transient
+func ClassifyError(err error) string {
+	var validationErr *models.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return ErrorClassValidation
+	case models.IsPermanent(err):
+		return ErrorClassPermanent
+	default:
+		return ""
+	}
+}
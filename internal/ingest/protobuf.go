@@ -0,0 +1,202 @@
+package ingest
+
+import (
+	"fmt"
+
+	"github.com/notification_service/internal/models"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ProtobufDecoder decodes payloads in the NotificationMessage Protobuf format
+// defined in models/notification.proto
+var ProtobufDecoder Decoder = DecoderFunc(func(value []byte, _ map[string]string) (*models.KafkaNotificationMessage, error) {
+	notification, err := decodeProtobuf(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode Protobuf payload: %w", err)
+	}
+	return notification, nil
+})
+
+// decodeProtobuf decodes a NotificationMessage by field number. Unknown
+// fields are skipped so producers can add fields before consumers know them.
+func decodeProtobuf(b []byte) (*models.KafkaNotificationMessage, error) {
+	notification := &models.KafkaNotificationMessage{}
+	var metadata *structpb.Struct
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			notification.SchemaVersion = int(int32(v))
+		case (num >= 2 && num <= 7 || num == 12) && typ == protowire.BytesType:
+			var v string
+			v, n = protowire.ConsumeString(b)
+			switch num {
+			case 2:
+				notification.UserID = v
+			case 3:
+				notification.Type = models.NotificationType(v)
+			case 4:
+				notification.Channel = v
+			case 5:
+				notification.Subject = v
+			case 6:
+				notification.Content = v
+			case 7:
+				notification.Priority = models.NotificationPriority(v)
+			case 12:
+				notification.Category = v
+			}
+		case num == 8 && typ == protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(b)
+			if n < 0 {
+				break
+			}
+			if metadata == nil {
+				metadata = &structpb.Struct{}
+			}
+			// Repeated occurrences of a message field are merged
+			if err := (proto.UnmarshalOptions{Merge: true}).Unmarshal(v, metadata); err != nil {
+				return nil, fmt.Errorf("invalid metadata: %w", err)
+			}
+		case num == 9 && typ == protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(b)
+			if n < 0 {
+				break
+			}
+			var recipient models.Recipient
+			err := decodeStrings(v, func(num protowire.Number, v string) {
+				switch num {
+				case 1:
+					recipient.Type = models.NotificationType(v)
+				case 2:
+					recipient.Channel = v
+				}
+			})
+			if err != nil {
+				return nil, fmt.Errorf("invalid recipient: %w", err)
+			}
+			notification.Recipients = append(notification.Recipients, recipient)
+		case num == 10 && typ == protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(b)
+			if n < 0 {
+				break
+			}
+			// Map entries are messages with the key and value as fields 1 and 2
+			var key, value string
+			err := decodeStrings(v, func(num protowire.Number, v string) {
+				switch num {
+				case 1:
+					key = v
+				case 2:
+					value = v
+				}
+			})
+			if err != nil {
+				return nil, fmt.Errorf("invalid contact: %w", err)
+			}
+			if notification.Contacts == nil {
+				notification.Contacts = make(map[models.NotificationType]string)
+			}
+			notification.Contacts[models.NotificationType(key)] = value
+		case num == 11 && typ == protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(b)
+			if n < 0 {
+				break
+			}
+			// Repeated occurrences of a message field are merged
+			if notification.Fallback == nil {
+				notification.Fallback = &models.FallbackPolicy{}
+			}
+			fallback := notification.Fallback
+			err := decodeStrings(v, func(num protowire.Number, v string) {
+				switch num {
+				case 1:
+					fallback.Channels = append(fallback.Channels, models.NotificationType(v))
+				case 2:
+					fallback.On = append(fallback.On, v)
+				case 3:
+					fallback.Timeout = v
+				}
+			})
+			if err != nil {
+				return nil, fmt.Errorf("invalid fallback: %w", err)
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+
+	if metadata != nil {
+		notification.Metadata = metadata.AsMap()
+	}
+	return notification, nil
+}
+
+// decodeStrings decodes a message whose fields are all strings, passing
+// each to fn by field number. Fields of other wire types are skipped.
+func decodeStrings(b []byte, fn func(num protowire.Number, v string)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if typ == protowire.BytesType {
+			var v string
+			v, n = protowire.ConsumeString(b)
+			if n >= 0 {
+				fn(num, v)
+			}
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+
+	return nil
+}
+
+// consumeMessageIndexes strips the message indexes that follow the schema ID
+// of Confluent framed Protobuf payloads. They locate the message type within
+// the schema; the notification schema declares a single message.
+func consumeMessageIndexes(b []byte) ([]byte, error) {
+	count, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		return nil, protowire.ParseError(n)
+	}
+	b = b[n:]
+
+	// A count of zero is shorthand for the first message
+	for i := int64(0); i < protowire.DecodeZigZag(count); i++ {
+		_, n = protowire.ConsumeVarint(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return b, nil
+}
@@ -0,0 +1,95 @@
+package ingest
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/models"
+)
+
+// Route is a resolved RouteConfig: the handler, decoder and default priority
+// for the messages of a topic
+type Route struct {
+	Topic    string
+	Handler  Handler
+	Decoder  Decoder
+	Priority models.NotificationPriority
+
+	pattern *regexp.Regexp
+}
+
+// Router finds the route of a message by its topic. Exact topic names take
+// precedence over patterns, which are tried in configuration order.
+type Router struct {
+	topics   map[string]*Route
+	patterns []*Route
+}
+
+// NewRouter resolves the configured routes against the registered handlers
+func NewRouter(routes []config.RouteConfig, handlers map[string]Handler, schemas *SchemaDecoder) (*Router, error) {
+	r := &Router{topics: make(map[string]*Route)}
+
+	for _, rc := range routes {
+		handler, ok := handlers[rc.Handler]
+		if !ok {
+			return nil, fmt.Errorf("route %s: no handler named %q", rc.Topic, rc.Handler)
+		}
+
+		decoder, err := DecoderFor(rc.Format, schemas)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", rc.Topic, err)
+		}
+
+		priority := models.NotificationPriority(rc.Priority)
+		switch priority {
+		case "", models.NotificationPriorityLow, models.NotificationPriorityNormal, models.NotificationPriorityHigh:
+		default:
+			return nil, fmt.Errorf("route %s: unknown priority %q", rc.Topic, rc.Priority)
+		}
+
+		rt := &Route{
+			Topic:    rc.Topic,
+			Handler:  handler,
+			Decoder:  decoder,
+			Priority: priority,
+		}
+
+		if rc.IsPattern() {
+			rt.pattern, err = regexp.Compile(rc.Topic)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: invalid topic pattern: %w", rc.Topic, err)
+			}
+			r.patterns = append(r.patterns, rt)
+		} else {
+			r.topics[rc.Topic] = rt
+		}
+	}
+
+	return r, nil
+}
+
+// Subscriptions returns the topics and patterns to subscribe to
+func (r *Router) Subscriptions() []string {
+	var topics []string
+	for topic := range r.topics {
+		topics = append(topics, topic)
+	}
+	for _, rt := range r.patterns {
+		topics = append(topics, rt.Topic)
+	}
+	return topics
+}
+
+// Match returns the route for topic, or nil if no route matches
+func (r *Router) Match(topic string) *Route {
+	if rt, ok := r.topics[topic]; ok {
+		return rt
+	}
+	for _, rt := range r.patterns {
+		if rt.pattern.MatchString(topic) {
+			return rt
+		}
+	}
+	return nil
+}
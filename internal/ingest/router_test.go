@@ -0,0 +1,138 @@
+package ingest
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/models"
+)
+
+// namedHandlers returns handlers that record their name in *called
+func namedHandlers(called *string, names ...string) map[string]Handler {
+	handlers := make(map[string]Handler, len(names))
+	for _, name := range names {
+		name := name
+		handlers[name] = func(env *models.Envelope) error {
+			*called = name
+			return nil
+		}
+	}
+	return handlers
+}
+
+func TestRouterMatch(t *testing.T) {
+	var called string
+	handlers := namedHandlers(&called, config.DefaultHandler, "orders", "billing", "events")
+	router, err := NewRouter([]config.RouteConfig{
+		{Topic: "notifications", Handler: config.DefaultHandler},
+		{Topic: "^orders\\..*", Handler: "orders", Priority: "high"},
+		{Topic: "^.*\\.events$", Handler: "events"},
+		{Topic: "orders.billing", Handler: "billing", Format: FormatProtobuf},
+	}, handlers, NewSchemaDecoder(nil))
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+
+	tests := []struct {
+		topic    string
+		handler  string
+		priority models.NotificationPriority
+	}{
+		{topic: "notifications", handler: config.DefaultHandler},
+		{topic: "orders.shipped", handler: "orders", priority: models.NotificationPriorityHigh},
+		// Exact topics take precedence over patterns
+		{topic: "orders.billing", handler: "billing"},
+		// Patterns are tried in configuration order
+		{topic: "orders.events", handler: "orders", priority: models.NotificationPriorityHigh},
+		{topic: "user.events", handler: "events"},
+		{topic: "unknown"},
+		// Topics neither named nor matched by a pattern have no route
+		{topic: "notifications.dlq"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.topic, func(t *testing.T) {
+			route := router.Match(tt.topic)
+			if tt.handler == "" {
+				if route != nil {
+					t.Errorf("Match = route %s, want none", route.Topic)
+				}
+				return
+			}
+			if route == nil {
+				t.Fatalf("Match = nil, want the %s handler", tt.handler)
+			}
+
+			called = ""
+			if err := route.Handler(&models.Envelope{Topic: tt.topic}); err != nil {
+				t.Fatalf("handler: %v", err)
+			}
+			if called != tt.handler {
+				t.Errorf("handler %q called, want %q", called, tt.handler)
+			}
+			if route.Priority != tt.priority || route.Decoder == nil {
+				t.Errorf("route = %+v, want priority %q and a decoder", route, tt.priority)
+			}
+		})
+	}
+
+	subscriptions := router.Subscriptions()
+	sort.Strings(subscriptions)
+	want := []string{"^.*\\.events$", "^orders\\..*", "notifications", "orders.billing"}
+	if !reflect.DeepEqual(subscriptions, want) {
+		t.Errorf("subscriptions = %v, want %v", subscriptions, want)
+	}
+}
+
+func TestRouterDefaultHandler(t *testing.T) {
+	var called string
+	router, err := NewRouter([]config.RouteConfig{{Topic: "notifications", Handler: config.DefaultHandler}},
+		namedHandlers(&called, config.DefaultHandler), NewSchemaDecoder(nil))
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+
+	route := router.Match("notifications")
+	if route == nil {
+		t.Fatal("Match = nil, want the default route")
+	}
+	msg, err := route.Decoder.Decode([]byte(`{"user_id":"user-1","type":"email","channel":"a@example.com","content":"Hello"}`), nil)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if msg.UserID != "user-1" {
+		t.Errorf("message = %+v, want it decoded as JSON", msg)
+	}
+	if route.Handler(&models.Envelope{Message: msg}); called != config.DefaultHandler {
+		t.Errorf("handler %q called, want the default handler", called)
+	}
+	if router.Match("other") != nil {
+		t.Error("Match of an unrouted topic returned a route")
+	}
+}
+
+func TestNewRouterErrors(t *testing.T) {
+	var called string
+	handlers := namedHandlers(&called, config.DefaultHandler)
+
+	tests := []struct {
+		name  string
+		route config.RouteConfig
+		want  string
+	}{
+		{name: "unknown handler", route: config.RouteConfig{Topic: "orders", Handler: "orders"}, want: `no handler named "orders"`},
+		{name: "unknown format", route: config.RouteConfig{Topic: "orders", Handler: config.DefaultHandler, Format: "xml"}, want: "unknown payload format"},
+		{name: "unknown priority", route: config.RouteConfig{Topic: "orders", Handler: config.DefaultHandler, Priority: "urgent"}, want: "unknown priority"},
+		{name: "invalid pattern", route: config.RouteConfig{Topic: "^orders(", Handler: config.DefaultHandler}, want: "invalid topic pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRouter([]config.RouteConfig{tt.route}, handlers, NewSchemaDecoder(nil))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewRouter = %v, want an error about %s", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package ingest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/notification_service/internal/models"
+	"github.com/notification_service/internal/schemaregistry"
+)
+
+// magicByte starts payloads framed in the Confluent wire format: the magic
+// byte, a 4-byte big-endian schema ID, then the encoded message
+const magicByte = 0x00
+
+// schemaRegistry resolves schema IDs
+type schemaRegistry interface {
+	Schema(id int) (*schemaregistry.Schema, error)
+}
+
+// SchemaDecoder decodes framed payloads by the type of their registered
+// schema. Avro codecs are compiled once per schema ID.
+type SchemaDecoder struct {
+	registry schemaRegistry
+
+	mu     sync.Mutex
+	codecs map[int]*goavro.Codec
+}
+
+// NewSchemaDecoder creates a decoder for framed payloads. registry may be
+// nil, in which case framed payloads fail to decode.
+func NewSchemaDecoder(registry *schemaregistry.Client) *SchemaDecoder {
+	d := &SchemaDecoder{codecs: make(map[int]*goavro.Codec)}
+	// A nil *Client must not become a non-nil schemaRegistry
+	if registry != nil {
+		d.registry = registry
+	}
+	return d
+}
+
+// framedDecoder decodes framed payloads with the schema decoder and any
+// other payload with the route's decoder
+type framedDecoder struct {
+	schemas  *SchemaDecoder
+	unframed Decoder
+}
+
+// Decode implements Decoder
+func (d *framedDecoder) Decode(value []byte, headers map[string]string) (*models.KafkaNotificationMessage, error) {
+	if len(value) < 5 || value[0] != magicByte {
+		return d.unframed.Decode(value, headers)
+	}
+	return d.schemas.decode(value, headers)
+}
+
+// decode decodes a framed payload
+func (d *SchemaDecoder) decode(value []byte, headers map[string]string) (*models.KafkaNotificationMessage, error) {
+	id := int(binary.BigEndian.Uint32(value[1:5]))
+	payload := value[5:]
+
+	if d.registry == nil {
+		return nil, fmt.Errorf("payload is framed with schema ID %d but no schema registry is configured", id)
+	}
+
+	schema, err := d.registry.Schema(id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch schema.Type {
+	case schemaregistry.SchemaTypeAvro:
+		codec, err := d.codec(schema)
+		if err != nil {
+			return nil, fmt.Errorf("schema %d: %w", id, err)
+		}
+		return decodeAvro(codec, payload)
+	case schemaregistry.SchemaTypeProtobuf:
+		payload, err = consumeMessageIndexes(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode Protobuf message indexes: %w", err)
+		}
+		return ProtobufDecoder.Decode(payload, headers)
+	case schemaregistry.SchemaTypeJSON:
+		return JSONDecoder.Decode(payload, headers)
+	default:
+		return nil, fmt.Errorf("schema %d has unsupported type %q", id, schema.Type)
+	}
+}
+
+// codec returns the compiled Avro codec of a schema
+func (d *SchemaDecoder) codec(schema *schemaregistry.Schema) (*goavro.Codec, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if codec, ok := d.codecs[schema.ID]; ok {
+		return codec, nil
+	}
+
+	codec, err := newAvroCodec(schema.Schema)
+	if err != nil {
+		return nil, err
+	}
+	d.codecs[schema.ID] = codec
+	return codec, nil
+}
@@ -0,0 +1,174 @@
+package ingest
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/notification_service/internal/schemaregistry"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// fakeRegistry serves schemas from a map and counts lookups
+type fakeRegistry struct {
+	schemas map[int]*schemaregistry.Schema
+	lookups int
+}
+
+func (r *fakeRegistry) Schema(id int) (*schemaregistry.Schema, error) {
+	r.lookups++
+	schema, ok := r.schemas[id]
+	if !ok {
+		return nil, errors.New("schema not found")
+	}
+	return schema, nil
+}
+
+// registeredAvroSchema is a producer's schema, narrower than the built-in
+// one, to show framed payloads are decoded with their registered schema
+const registeredAvroSchema = `{
+	"type": "record",
+	"name": "Notification",
+	"fields": [
+		{"name": "user_id", "type": "string"},
+		{"name": "type", "type": "string"},
+		{"name": "channel", "type": "string"},
+		{"name": "subject", "type": ["null", "string"], "default": null},
+		{"name": "content", "type": "string"}
+	]
+}`
+
+// newTestSchemaDecoder returns a decoder resolving schemas from registry
+func newTestSchemaDecoder(registry schemaRegistry) *SchemaDecoder {
+	d := NewSchemaDecoder(nil)
+	d.registry = registry
+	return d
+}
+
+// frame prefixes payload with the magic byte and schema ID
+func frame(id int, payload []byte) []byte {
+	b := make([]byte, 5, 5+len(payload))
+	b[0] = magicByte
+	binary.BigEndian.PutUint32(b[1:5], uint32(id))
+	return append(b, payload...)
+}
+
+// avroPayload encodes a JSON record with an Avro schema
+func avroPayload(t *testing.T, schema, record string) []byte {
+	t.Helper()
+	codec, err := goavro.NewCodecForStandardJSONFull(schema)
+	if err != nil {
+		t.Fatalf("codec: %v", err)
+	}
+	native, _, err := codec.NativeFromTextual([]byte(record))
+	if err != nil {
+		t.Fatalf("NativeFromTextual: %v", err)
+	}
+	encoded, err := codec.BinaryFromNative(nil, native)
+	if err != nil {
+		t.Fatalf("BinaryFromNative: %v", err)
+	}
+	return encoded
+}
+
+// protobufPayload encodes a NotificationMessage by field number
+func protobufPayload() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, "user-1")
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendString(b, "telegram")
+	b = protowire.AppendTag(b, 4, protowire.BytesType)
+	b = protowire.AppendString(b, "12345")
+	b = protowire.AppendTag(b, 6, protowire.BytesType)
+	b = protowire.AppendString(b, "Hello")
+	return b
+}
+
+func TestSchemaDecoderAvro(t *testing.T) {
+	registry := &fakeRegistry{schemas: map[int]*schemaregistry.Schema{
+		3: {ID: 3, Type: schemaregistry.SchemaTypeAvro, Schema: registeredAvroSchema},
+	}}
+	d := newTestSchemaDecoder(registry)
+
+	payload := avroPayload(t, registeredAvroSchema,
+		`{"user_id":"user-1","type":"email","channel":"a@example.com","subject":"Hi","content":"Hello"}`)
+
+	for i := 0; i < 2; i++ {
+		msg, err := d.decode(frame(3, payload), nil)
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if msg.UserID != "user-1" || msg.Type != "email" || msg.Channel != "a@example.com" || msg.Subject != "Hi" || msg.Content != "Hello" {
+			t.Errorf("message = %+v", msg)
+		}
+	}
+
+	if len(d.codecs) != 1 {
+		t.Errorf("%d codecs compiled, want 1", len(d.codecs))
+	}
+}
+
+func TestSchemaDecoderProtobuf(t *testing.T) {
+	registry := &fakeRegistry{schemas: map[int]*schemaregistry.Schema{
+		4: {ID: 4, Type: schemaregistry.SchemaTypeProtobuf, Schema: `syntax = "proto3";`},
+	}}
+	d := newTestSchemaDecoder(registry)
+
+	indexes := map[string][]byte{
+		// A count of zero is shorthand for the first message
+		"shorthand": {0},
+		// One index, zig-zag encoded, pointing at the first message
+		"explicit": {2, 0},
+	}
+	for name, prefix := range indexes {
+		t.Run(name, func(t *testing.T) {
+			payload := append(append([]byte(nil), prefix...), protobufPayload()...)
+			msg, err := d.decode(frame(4, payload), nil)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if msg.UserID != "user-1" || msg.Type != "telegram" || msg.Channel != "12345" || msg.Content != "Hello" {
+				t.Errorf("message = %+v", msg)
+			}
+		})
+	}
+}
+
+func TestSchemaDecoderErrors(t *testing.T) {
+	registry := &fakeRegistry{schemas: map[int]*schemaregistry.Schema{
+		5: {ID: 5, Type: "XML"},
+		6: {ID: 6, Type: schemaregistry.SchemaTypeAvro, Schema: `{"type":`},
+	}}
+	d := newTestSchemaDecoder(registry)
+
+	for _, id := range []int{5, 6, 99} {
+		if _, err := d.decode(frame(id, []byte{0}), nil); err == nil {
+			t.Errorf("schema %d: decode succeeded", id)
+		}
+	}
+
+	if _, err := NewSchemaDecoder(nil).decode(frame(3, []byte{0}), nil); err == nil {
+		t.Error("decode succeeded without a registry")
+	}
+}
+
+func TestFramedDecoderFallsBackToRouteFormat(t *testing.T) {
+	registry := &fakeRegistry{}
+	decoder, err := DecoderFor(FormatJSON, newTestSchemaDecoder(registry))
+	if err != nil {
+		t.Fatalf("DecoderFor: %v", err)
+	}
+
+	msg, err := decoder.Decode([]byte(`{"user_id":"user-1","type":"email","channel":"a@example.com","content":"Hello"}`), nil)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if msg.UserID != "user-1" {
+		t.Errorf("message = %+v", msg)
+	}
+	if registry.lookups != 0 {
+		t.Errorf("%d schema lookups for an unframed payload", registry.lookups)
+	}
+}
@@ -0,0 +1,48 @@
+// Package ingest defines the sources notification messages are consumed
+// from, and the routing and payload decoding they share.
+package ingest
+
+import (
+	"context"
+
+	"github.com/notification_service/internal/models"
+)
+
+// Handler processes a decoded message. A nil error means the message was
+// handled and its offset may be committed.
+type Handler func(env *models.Envelope) error
+
+// Source consumes messages and hands them to the handler of their route
+type Source interface {
+	// Start begins consuming in the background
+	Start(ctx context.Context) error
+	// Stop stops consuming and waits, until ctx is done, for the messages
+	// already being handled
+	Stop(ctx context.Context) ShutdownReport
+}
+
+// ShutdownReport describes what happened to in-flight messages when a
+// source was stopped
+type ShutdownReport struct {
+	// Abandoned lists the messages that had not been handled when the
+	// shutdown deadline passed. Their offsets were not committed, so they
+	// will be redelivered.
+	Abandoned []AbandonedMessage
+}
+
+// AbandonedMessage identifies a message abandoned during shutdown
+type AbandonedMessage struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	// MessageID identifies the message in sources without offsets
+	MessageID string
+	// InFlight is set if the handler was still running, as opposed to the
+	// message waiting to be handled
+	InFlight bool
+}
+
+// Merge appends the abandoned messages of other to r
+func (r *ShutdownReport) Merge(other ShutdownReport) {
+	r.Abandoned = append(r.Abandoned, other.Abandoned...)
+}
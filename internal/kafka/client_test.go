@@ -0,0 +1,231 @@
+package kafka
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/ingest"
+)
+
+// fakeClient is an in-process stand-in for a broker connection. Messages and
+// rebalance events are delivered in the order they were queued, and every
+// call that changes broker state is recorded.
+type fakeClient struct {
+	mu          sync.Mutex
+	rebalanceCb kafka.RebalanceCb
+	messages    []*kafka.Message
+	events      []kafka.Event
+	readErrs    []error
+	commits     [][]kafka.TopicPartition
+	stores      [][]kafka.TopicPartition
+	commitErr   error
+	paused      []kafka.TopicPartition
+	resumed     []kafka.TopicPartition
+	seeks       []kafka.TopicPartition
+	closed      bool
+}
+
+func (f *fakeClient) SubscribeTopics(topics []string, rebalanceCb kafka.RebalanceCb) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rebalanceCb = rebalanceCb
+	return nil
+}
+
+// ReadMessage returns the next queued read error, or delivers the next
+// rebalance event through the rebalance callback, as librdkafka does from
+// within a poll, or else returns the next message
+func (f *fakeClient) ReadMessage(timeout time.Duration) (*kafka.Message, error) {
+	f.mu.Lock()
+	if len(f.readErrs) > 0 {
+		err := f.readErrs[0]
+		f.readErrs = f.readErrs[1:]
+		f.mu.Unlock()
+		return nil, err
+	}
+	if len(f.events) > 0 {
+		event := f.events[0]
+		f.events = f.events[1:]
+		cb := f.rebalanceCb
+		f.mu.Unlock()
+
+		if cb != nil {
+			cb(nil, event)
+		}
+		return nil, kafka.NewError(kafka.ErrTimedOut, "rebalanced", false)
+	}
+	if len(f.messages) > 0 {
+		msg := f.messages[0]
+		f.messages = f.messages[1:]
+		f.mu.Unlock()
+		return msg, nil
+	}
+	f.mu.Unlock()
+
+	if timeout > 5*time.Millisecond {
+		timeout = 5 * time.Millisecond
+	}
+	time.Sleep(timeout)
+	return nil, kafka.NewError(kafka.ErrTimedOut, "timed out", false)
+}
+
+func (f *fakeClient) CommitOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.commitErr != nil {
+		err := f.commitErr
+		f.commitErr = nil
+		return nil, err
+	}
+	f.commits = append(f.commits, append([]kafka.TopicPartition(nil), offsets...))
+	return offsets, nil
+}
+
+func (f *fakeClient) StoreOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stores = append(f.stores, append([]kafka.TopicPartition(nil), offsets...))
+	return offsets, nil
+}
+
+func (f *fakeClient) Pause(partitions []kafka.TopicPartition) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.paused = append(f.paused, partitions...)
+	return nil
+}
+
+func (f *fakeClient) Resume(partitions []kafka.TopicPartition) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.resumed = append(f.resumed, partitions...)
+	return nil
+}
+
+func (f *fakeClient) Seek(partition kafka.TopicPartition, timeoutMs int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seeks = append(f.seeks, partition)
+	return nil
+}
+
+func (f *fakeClient) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+// publish queues a message at offset on a partition of topic
+func (f *fakeClient) publish(topic string, partition int32, offset kafka.Offset, value string) *kafka.Message {
+	msg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: partition, Offset: offset},
+		Value:          []byte(value),
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = append(f.messages, msg)
+	return msg
+}
+
+// revoke queues the revocation of partitions
+func (f *fakeClient) revoke(partitions ...kafka.TopicPartition) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, kafka.RevokedPartitions{Partitions: partitions})
+}
+
+// committed returns the last offset committed for a partition of topic, or
+// kafka.OffsetInvalid if none was
+func (f *fakeClient) committed(topic string, partition int32) kafka.Offset {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return lastOffset(f.commits, topic, partition)
+}
+
+// stored returns the last offset stored for a partition of topic, or
+// kafka.OffsetInvalid if none was
+func (f *fakeClient) stored(topic string, partition int32) kafka.Offset {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return lastOffset(f.stores, topic, partition)
+}
+
+// lastOffset returns the last offset of a partition of topic in batches of
+// offsets, or kafka.OffsetInvalid if there is none
+func lastOffset(batches [][]kafka.TopicPartition, topic string, partition int32) kafka.Offset {
+	offset := kafka.OffsetInvalid
+	for _, batch := range batches {
+		for _, tp := range batch {
+			if *tp.Topic == topic && tp.Partition == partition {
+				offset = tp.Offset
+			}
+		}
+	}
+	return offset
+}
+
+// commitCount returns the number of successful commits
+func (f *fakeClient) commitCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.commits)
+}
+
+// pending returns the number of queued messages not yet read
+func (f *fakeClient) pending() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.messages)
+}
+
+// testTopic is the topic the consumers under test read
+const testTopic = "notifications"
+
+// testMessage is a notification payload in the JSON format
+const testMessage = `{"user_id":"u1","type":"email","channel":"u1@example.com","subject":"Hi","content":"Hello"}`
+
+// testConfig returns the configuration of a consumer in the given commit mode
+func testConfig(commitMode string) *config.Config {
+	return &config.Config{Kafka: config.KafkaConfig{
+		Topic:             testTopic,
+		GroupID:           "notification-service",
+		CommitMode:        commitMode,
+		CommitBatchSize:   100,
+		CommitInterval:    time.Hour,
+		WorkerConcurrency: 4,
+		WorkerQueueDepth:  16,
+		Routes:            []config.RouteConfig{{Topic: testTopic, Handler: "notify"}},
+	}}
+}
+
+// newTestConsumer returns a consumer of testTopic reading from a fake
+// client and passing messages to handler
+func newTestConsumer(t *testing.T, cfg *config.Config, handler ingest.Handler) (*Consumer, *fakeClient) {
+	t.Helper()
+
+	routes, err := ingest.NewRouter(cfg.Kafka.Routes, map[string]ingest.Handler{"notify": handler}, ingest.NewSchemaDecoder(nil))
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+
+	fake := &fakeClient{}
+	return newConsumer(fake, cfg, routes.Subscriptions(), routes, nil, nil), fake
+}
+
+// eventually fails the test if cond does not hold within a second
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
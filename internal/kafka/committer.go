@@ -0,0 +1,215 @@
+package kafka
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// partitionKey identifies a topic partition in the committer's bookkeeping
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// partitionOffsets tracks the messages of one partition that have been
+// dispatched to workers, in offset order
+type partitionOffsets struct {
+	partition kafka.TopicPartition
+	inflight  []inflightOffset
+	// next is the offset after the highest dispatched message
+	next kafka.Offset
+	// committed is the last offset committed for the partition
+	committed kafka.Offset
+}
+
+// inflightOffset is a dispatched message and whether its handler returned
+type inflightOffset struct {
+	offset kafka.Offset
+	done   bool
+}
+
+// commitOffset is the offset that can safely be committed: the lowest
+// message still being handled, or the next message if none are in flight
+func (p *partitionOffsets) commitOffset() kafka.Offset {
+	for len(p.inflight) > 0 && p.inflight[0].done {
+		p.inflight = p.inflight[1:]
+	}
+	if len(p.inflight) > 0 {
+		return p.inflight[0].offset
+	}
+	return p.next
+}
+
+// commitFunc commits or stores offsets, like the client's CommitOffsets and
+// StoreOffsets
+type commitFunc func(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error)
+
+// offsetCommitter batches offset commits in manual commit mode, and stores
+// offsets for the client to commit in auto commit mode. Messages complete out
+// of order when handled by concurrent workers, so for each partition only
+// offsets below the lowest in-flight message are committed. A crash can at
+// worst redeliver messages, never lose them.
+type offsetCommitter struct {
+	mu          sync.Mutex
+	commitFn    commitFunc
+	batchSize   int
+	interval    time.Duration
+	partitions  map[partitionKey]*partitionOffsets
+	uncommitted int
+	lastCommit  time.Time
+}
+
+// newOffsetCommitter creates a committer that commits with commitFn after
+// batchSize processed messages or once interval has passed, whichever comes
+// first
+func newOffsetCommitter(commitFn commitFunc, batchSize int, interval time.Duration) *offsetCommitter {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	return &offsetCommitter{
+		commitFn:   commitFn,
+		batchSize:  batchSize,
+		interval:   interval,
+		partitions: make(map[partitionKey]*partitionOffsets),
+		lastCommit: time.Now(),
+	}
+}
+
+// track records that the message at tp has been dispatched for handling.
+// Messages of a partition must be tracked in offset order.
+func (oc *offsetCommitter) track(tp kafka.TopicPartition) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	key := partitionKey{topic: *tp.Topic, partition: tp.Partition}
+	p, ok := oc.partitions[key]
+	if !ok {
+		p = &partitionOffsets{
+			partition: kafka.TopicPartition{Topic: tp.Topic, Partition: tp.Partition},
+			committed: kafka.OffsetInvalid,
+		}
+		oc.partitions[key] = p
+	}
+
+	p.inflight = append(p.inflight, inflightOffset{offset: tp.Offset})
+	p.next = tp.Offset + 1
+}
+
+// done records that the handler has returned for the message at tp
+func (oc *offsetCommitter) done(tp kafka.TopicPartition) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	p, ok := oc.partitions[partitionKey{topic: *tp.Topic, partition: tp.Partition}]
+	if !ok {
+		// The partition was revoked while the message was being handled
+		return
+	}
+
+	for i := range p.inflight {
+		if p.inflight[i].offset == tp.Offset {
+			p.inflight[i].done = true
+			oc.uncommitted++
+			return
+		}
+	}
+}
+
+// maybeCommit commits processed offsets if the batch is full or the commit
+// interval has elapsed
+func (oc *offsetCommitter) maybeCommit() {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	if oc.uncommitted == 0 {
+		return
+	}
+	if oc.uncommitted < oc.batchSize && time.Since(oc.lastCommit) < oc.interval {
+		return
+	}
+
+	if err := oc.commitLocked(nil); err != nil {
+		log.Printf("Error committing offsets: %v", err)
+	}
+}
+
+// commit commits processed offsets of all partitions
+func (oc *offsetCommitter) commit() error {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	return oc.commitLocked(nil)
+}
+
+// revoke commits processed offsets for partitions that are being revoked
+// during a rebalance and stops tracking them
+func (oc *offsetCommitter) revoke(partitions []kafka.TopicPartition) error {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	keys := make(map[partitionKey]bool, len(partitions))
+	for _, tp := range partitions {
+		keys[partitionKey{topic: *tp.Topic, partition: tp.Partition}] = true
+	}
+
+	err := oc.commitLocked(keys)
+	for key := range keys {
+		delete(oc.partitions, key)
+	}
+	return err
+}
+
+// commitLocked commits the committable offset of each partition that moved
+// since its last commit, restricted to only when it is non-nil. oc.mu must
+// be held.
+func (oc *offsetCommitter) commitLocked(only map[partitionKey]bool) error {
+	var offsets []kafka.TopicPartition
+	var moved []*partitionOffsets
+	for key, p := range oc.partitions {
+		if only != nil && !only[key] {
+			continue
+		}
+
+		offset := p.commitOffset()
+		if offset == p.committed {
+			continue
+		}
+
+		tp := p.partition
+		tp.Offset = offset
+		offsets = append(offsets, tp)
+		moved = append(moved, p)
+	}
+
+	oc.lastCommit = time.Now()
+
+	if len(offsets) > 0 {
+		committed, err := oc.commitFn(offsets)
+		if err != nil {
+			// The processed messages stay uncommitted so the next commit
+			// retries them
+			return fmt.Errorf("failed to commit offsets: %w", err)
+		}
+
+		for i, p := range moved {
+			p.committed = offsets[i].Offset
+		}
+
+		for _, tp := range committed {
+			if tp.Error != nil {
+				log.Printf("Error committing offset %d for %s [%d]: %v", tp.Offset, *tp.Topic, tp.Partition, tp.Error)
+			}
+		}
+	}
+
+	// Other partitions may still have processed messages after a partial
+	// commit
+	if only == nil {
+		oc.uncommitted = 0
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// partitionAt returns the position of a message in partition 0 of testTopic
+func partitionAt(offset kafka.Offset) kafka.TopicPartition {
+	topic := testTopic
+	return kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: offset}
+}
+
+func TestCommitterCommitsFullBatches(t *testing.T) {
+	fake := &fakeClient{}
+	oc := newOffsetCommitter(fake.CommitOffsets, 2, time.Hour)
+
+	for offset := kafka.Offset(0); offset < 3; offset++ {
+		oc.track(partitionAt(offset))
+	}
+
+	oc.done(partitionAt(0))
+	oc.maybeCommit()
+	if n := fake.commitCount(); n != 0 {
+		t.Fatalf("committed %d times before the batch was full", n)
+	}
+
+	oc.done(partitionAt(1))
+	oc.maybeCommit()
+	if got := fake.committed(testTopic, 0); got != 2 {
+		t.Errorf("committed offset = %v, want 2", got)
+	}
+}
+
+func TestCommitterCommitsAfterInterval(t *testing.T) {
+	fake := &fakeClient{}
+	oc := newOffsetCommitter(fake.CommitOffsets, 100, time.Millisecond)
+
+	oc.track(partitionAt(0))
+	oc.done(partitionAt(0))
+	time.Sleep(2 * time.Millisecond)
+	oc.maybeCommit()
+
+	if got := fake.committed(testTopic, 0); got != 1 {
+		t.Errorf("committed offset = %v, want 1", got)
+	}
+}
+
+func TestCommitterStopsAtLowestInFlight(t *testing.T) {
+	fake := &fakeClient{}
+	oc := newOffsetCommitter(fake.CommitOffsets, 1, time.Hour)
+
+	for offset := kafka.Offset(0); offset < 3; offset++ {
+		oc.track(partitionAt(offset))
+	}
+
+	// Later messages completing first must not commit past the first
+	oc.done(partitionAt(2))
+	oc.done(partitionAt(1))
+	oc.maybeCommit()
+	if got := fake.committed(testTopic, 0); got > 0 {
+		t.Fatalf("committed offset %v while offset 0 is in flight", got)
+	}
+
+	oc.done(partitionAt(0))
+	oc.maybeCommit()
+	if got := fake.committed(testTopic, 0); got != 3 {
+		t.Errorf("committed offset = %v, want 3", got)
+	}
+}
+
+func TestCommitterRetriesFailedCommit(t *testing.T) {
+	fake := &fakeClient{commitErr: errors.New("broker unavailable")}
+	oc := newOffsetCommitter(fake.CommitOffsets, 1, time.Hour)
+
+	oc.track(partitionAt(0))
+	oc.done(partitionAt(0))
+
+	oc.maybeCommit()
+	if n := fake.commitCount(); n != 0 {
+		t.Fatalf("commit succeeded %d times, want it to fail", n)
+	}
+
+	// No further message completes, yet the next commit retries
+	oc.maybeCommit()
+	if got := fake.committed(testTopic, 0); got != 1 {
+		t.Errorf("committed offset = %v, want 1", got)
+	}
+}
+
+func TestCommitterRevoke(t *testing.T) {
+	fake := &fakeClient{}
+	oc := newOffsetCommitter(fake.CommitOffsets, 100, time.Hour)
+
+	oc.track(partitionAt(0))
+	oc.track(partitionAt(1))
+	oc.done(partitionAt(0))
+
+	if err := oc.revoke([]kafka.TopicPartition{partitionAt(kafka.OffsetInvalid)}); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if got := fake.committed(testTopic, 0); got != 1 {
+		t.Errorf("committed offset = %v, want 1", got)
+	}
+
+	// A message of a revoked partition completing later is not committed
+	oc.done(partitionAt(1))
+	if err := oc.commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if got := fake.committed(testTopic, 0); got != 1 {
+		t.Errorf("committed offset after revoke = %v, want 1", got)
+	}
+}
@@ -0,0 +1,50 @@
+package kafka
+
+import (
+	"strings"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/notification_service/internal/config"
+)
+
+// clientConfig returns the librdkafka settings shared by consumers and
+// producers: brokers, security and passthrough properties
+func clientConfig(cfg *config.KafkaConfig) *kafka.ConfigMap {
+	configMap := &kafka.ConfigMap{
+		"bootstrap.servers": cfg.BootstrapServers,
+		"security.protocol": cfg.SecurityProtocol,
+	}
+
+	if cfg.SASLMechanism != "" {
+		configMap.SetKey("sasl.mechanisms", strings.ToUpper(cfg.SASLMechanism))
+		configMap.SetKey("sasl.username", cfg.SASLUsername)
+		configMap.SetKey("sasl.password", cfg.SASLPassword)
+	}
+
+	if cfg.SSLCALocation != "" {
+		configMap.SetKey("ssl.ca.location", cfg.SSLCALocation)
+	}
+	if cfg.SSLCertificateLocation != "" {
+		configMap.SetKey("ssl.certificate.location", cfg.SSLCertificateLocation)
+		configMap.SetKey("ssl.key.location", cfg.SSLKeyLocation)
+	}
+	if cfg.SSLKeyPassword != "" {
+		configMap.SetKey("ssl.key.password", cfg.SSLKeyPassword)
+	}
+
+	for key, value := range cfg.Properties {
+		configMap.SetKey(key, value)
+	}
+
+	return configMap
+}
+
+// consumerConfig returns the librdkafka settings for a consumer in groupID
+func consumerConfig(cfg *config.KafkaConfig, groupID string) *kafka.ConfigMap {
+	configMap := clientConfig(cfg)
+	configMap.SetKey("group.id", groupID)
+	configMap.SetKey("auto.offset.reset", cfg.AutoOffsetReset)
+	configMap.SetKey("session.timeout.ms", int(cfg.SessionTimeout.Milliseconds()))
+	configMap.SetKey("max.poll.interval.ms", int(cfg.MaxPollInterval.Milliseconds()))
+	return configMap
+}
@@ -2,109 +2,555 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/ingest"
 	"github.com/notification_service/internal/models"
+	"github.com/notification_service/internal/schemaregistry"
 )
 
-// MessageHandler is a function that processes Kafka messages
-type MessageHandler func(msg *models.KafkaNotificationMessage) error
+// client is the subset of *kafka.Consumer used by Consumer, so that the
+// in-memory Broker can be substituted for a real cluster
+type client interface {
+	SubscribeTopics(topics []string, rebalanceCb kafka.RebalanceCb) error
+	ReadMessage(timeout time.Duration) (*kafka.Message, error)
+	CommitOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error)
+	StoreOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error)
+	Pause(partitions []kafka.TopicPartition) error
+	Resume(partitions []kafka.TopicPartition) error
+	Seek(partition kafka.TopicPartition, timeoutMs int) error
+	Close() error
+}
 
 // Consumer represents a Kafka consumer
 type Consumer struct {
-	consumer *kafka.Consumer
-	topic    string
-	handler  MessageHandler
-	running  bool
-}
-
-// NewConsumer creates a new Kafka consumer
-func NewConsumer(cfg *config.Config, handler MessageHandler) (*Consumer, error) {
-	c, err := kafka.NewConsumer(&kafka.ConfigMap{
-		"bootstrap.servers":     cfg.Kafka.BootstrapServers,
-		"group.id":              "notification-service",
-		"auto.offset.reset":     "earliest",
-		"enable.auto.commit":    true,
-		"auto.commit.interval.ms": 5000,
+	consumer client
+	// topics are the topics and topic patterns subscribed to
+	topics    []string
+	routes    *ingest.Router
+	committer *offsetCommitter
+	retries   *retryPolicy
+	dlq       *deadLetterQueue
+	// delay is the backoff of the retry tier this consumer reads, zero for
+	// the main topic consumer
+	delay time.Duration
+	// paused holds partitions waiting for a retry's not-before time
+	paused map[partitionKey]pausedPartition
+	pool   *workerPool
+	// tiers are the consumers of the retry topics, owned by the main consumer
+	tiers []*Consumer
+
+	// mu guards the lifecycle state so Start and Stop may be called
+	// concurrently
+	mu      sync.Mutex
+	started bool
+	stopped bool
+	// quit is closed by Stop to end the consume loop
+	quit chan struct{}
+	// done is closed once the consume loop has exited
+	done chan struct{}
+	// unqueued holds messages fetched but not queued because Stop was called
+	unqueued []*kafka.Message
+}
+
+// pausedPartition is a partition paused until a delayed retry is due
+type pausedPartition struct {
+	partition kafka.TopicPartition
+	resumeAt  time.Time
+}
+
+// NewConsumer creates a new Kafka consumer subscribed to the configured
+// routes, each dispatching to the handler registered under the route's
+// handler name. When retry delays are configured,
+// failed messages are republished through producer and a consumer is created
+// for each retry tier. Messages that cannot be decoded or will not be retried
+// are published to the dead-letter topic. Payloads framed with a schema ID
+// are decoded with schemas from registry, which may be nil.
+func NewConsumer(cfg *config.Config, handlers map[string]ingest.Handler, producer *Producer, registry *schemaregistry.Client) (*Consumer, error) {
+	var p Publisher
+	if producer != nil {
+		p = producer
+	}
+
+	return newConsumerGroup(cfg, handlers, p, registry, func(groupID string) (client, error) {
+		c, err := newKafkaConsumer(cfg, groupID)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
 	})
+}
 
+// NewMemoryConsumer creates a consumer like NewConsumer that reads from and
+// publishes retries and dead letters to an in-memory broker instead of a
+// Kafka cluster
+func NewMemoryConsumer(cfg *config.Config, handlers map[string]ingest.Handler, broker *Broker) (*Consumer, error) {
+	return newConsumerGroup(cfg, handlers, broker, nil, broker.client)
+}
+
+// newConsumerGroup creates the main consumer and its retry tier consumers,
+// connecting each to its consumer group with newClient
+func newConsumerGroup(cfg *config.Config, handlers map[string]ingest.Handler, producer Publisher, registry *schemaregistry.Client, newClient func(groupID string) (client, error)) (*Consumer, error) {
+	routes, err := ingest.NewRouter(cfg.Kafka.Routes, handlers, ingest.NewSchemaDecoder(registry))
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newClient(cfg.Kafka.GroupID)
+	if err != nil {
+		return nil, err
+	}
+
+	var retries *retryPolicy
+	if len(cfg.Kafka.RetryDelays) > 0 && producer != nil {
+		retries = newRetryPolicy(producer, cfg.Kafka.Topic, cfg.Kafka.RetryDelays)
+	}
+
+	var dlq *deadLetterQueue
+	if cfg.Kafka.DeadLetterTopic != "" && producer != nil {
+		dlq = newDeadLetterQueue(producer, cfg.Kafka.DeadLetterTopic)
+	}
+
+	consumer := newConsumer(c, cfg, routes.Subscriptions(), routes, retries, dlq)
+
+	if retries != nil {
+		for _, delay := range cfg.Kafka.RetryDelays {
+			tc, err := newClient(config.RetryGroupID(cfg.Kafka.GroupID, delay))
+			if err != nil {
+				for _, tier := range consumer.tiers {
+					tier.close()
+				}
+				consumer.close()
+				return nil, err
+			}
+
+			// Retries of every route share the tier's topic and are routed
+			// by their original topic
+			tier := newConsumer(tc, cfg, []string{retries.topicFor(delay)}, routes, retries, dlq)
+			tier.delay = delay
+			consumer.tiers = append(consumer.tiers, tier)
+		}
+	}
+
+	return consumer, nil
+}
+
+// newKafkaConsumer creates a librdkafka consumer in the given consumer group
+func newKafkaConsumer(cfg *config.Config, groupID string) (*kafka.Consumer, error) {
+	configMap := consumerConfig(&cfg.Kafka, groupID)
+
+	switch cfg.Kafka.CommitMode {
+	case config.CommitModeAuto:
+		configMap.SetKey("enable.auto.commit", true)
+		configMap.SetKey("auto.commit.interval.ms", 5000)
+		// Only offsets stored once their message is handled are committed,
+		// not every offset read, which includes deferred retries
+		configMap.SetKey("enable.auto.offset.store", false)
+	case config.CommitModeManual:
+		configMap.SetKey("enable.auto.commit", false)
+	default:
+		return nil, fmt.Errorf("unknown Kafka commit mode: %q", cfg.Kafka.CommitMode)
+	}
+
+	c, err := kafka.NewConsumer(configMap)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kafka consumer: %w", err)
 	}
 
-	return &Consumer{
+	return c, nil
+}
+
+// newConsumer wires a Consumer around an already constructed client
+func newConsumer(c client, cfg *config.Config, topics []string, routes *ingest.Router, retries *retryPolicy, dlq *deadLetterQueue) *Consumer {
+	consumer := &Consumer{
 		consumer: c,
-		topic:    cfg.Kafka.Topic,
-		handler:  handler,
-	}, nil
+		topics:   topics,
+		routes:   routes,
+		retries:  retries,
+		dlq:      dlq,
+		paused:   make(map[partitionKey]pausedPartition),
+		pool:     newWorkerPool(cfg.Kafka.WorkerConcurrency, cfg.Kafka.WorkerQueueDepth),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	switch cfg.Kafka.CommitMode {
+	case config.CommitModeManual:
+		consumer.committer = newOffsetCommitter(c.CommitOffsets, cfg.Kafka.CommitBatchSize, cfg.Kafka.CommitInterval)
+	case config.CommitModeAuto:
+		// The client commits stored offsets in the background, so they are
+		// stored as soon as they are safe
+		consumer.committer = newOffsetCommitter(c.StoreOffsets, 1, 0)
+	}
+
+	return consumer
 }
 
 // Start begins consuming messages from Kafka
 func (c *Consumer) Start(ctx context.Context) error {
-	if c.running {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.started {
 		return fmt.Errorf("consumer is already running")
 	}
 
-	err := c.consumer.SubscribeTopics([]string{c.topic}, nil)
+	err := c.consumer.SubscribeTopics(c.topics, c.rebalance)
 	if err != nil {
 		return fmt.Errorf("failed to subscribe to topics: %w", err)
 	}
 
-	c.running = true
-	log.Printf("Kafka consumer started, listening to topic: %s", c.topic)
+	c.started = true
+	log.Printf("Kafka consumer started, listening to topics: %s", strings.Join(c.topics, ", "))
 
+	c.pool.start(c.process)
 	go c.consume(ctx)
+
+	for _, tier := range c.tiers {
+		if err := tier.Start(ctx); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// consume is the main message processing loop
+// consume is the main message processing loop. It decodes messages and
+// dispatches them to the worker pool until Stop is called or ctx is done.
 func (c *Consumer) consume(ctx context.Context) {
-	for c.running {
+	defer close(c.done)
+	defer c.pool.close()
+
+	for {
 		select {
 		case <-ctx.Done():
-			c.Stop()
+			return
+		case <-c.quit:
 			return
 		default:
+			c.resumeDuePartitions()
+
 			msg, err := c.consumer.ReadMessage(100 * time.Millisecond)
 			if err != nil {
 				// Timeout or no message available is not an error
-				if err.(kafka.Error).Code() != kafka.ErrTimedOut {
+				var kerr kafka.Error
+				if !errors.As(err, &kerr) || kerr.Code() != kafka.ErrTimedOut {
 					log.Printf("Error reading message: %v", err)
 				}
+				c.maybeCommit()
 				continue
 			}
 
-			log.Printf("Received message from topic %s [%d] at offset %d: %s",
-				*msg.TopicPartition.Topic, msg.TopicPartition.Partition, msg.TopicPartition.Offset, string(msg.Value))
-
-			var notification models.KafkaNotificationMessage
-			if err := json.Unmarshal(msg.Value, &notification); err != nil {
-				log.Printf("Error unmarshalling message: %v", err)
+			key := partitionKey{topic: *msg.TopicPartition.Topic, partition: msg.TopicPartition.Partition}
+			if _, paused := c.paused[key]; paused {
+				// Prefetched before the partition was paused, it will be
+				// read again once the partition resumes
 				continue
 			}
 
-			if err := c.handler(&notification); err != nil {
-				log.Printf("Error handling message: %v", err)
+			if c.deferUntilDue(msg) {
+				continue
 			}
+
+			log.Printf("Received message from topic %s [%d] at offset %d: %s",
+				*msg.TopicPartition.Topic, msg.TopicPartition.Partition, msg.TopicPartition.Offset, string(msg.Value))
+
+			c.dispatch(msg)
+			c.maybeCommit()
 		}
 	}
 }
 
-// Stop stops the consumer
-func (c *Consumer) Stop() {
-	if !c.running {
+// dispatch decodes a message with its route's decoder and queues it on the
+// worker responsible for its key: the Kafka message key, or the user ID if
+// the message has no key
+func (c *Consumer) dispatch(msg *kafka.Message) {
+	if c.committer != nil {
+		c.committer.track(msg.TopicPartition)
+	}
+
+	// Retried messages are routed by the topic they were first consumed from
+	topic := headerValue(msg.Headers, HeaderOriginalTopic)
+	if topic == "" {
+		topic = *msg.TopicPartition.Topic
+	}
+
+	rt := c.routes.Match(topic)
+	if rt == nil {
+		log.Printf("No route for topic %s", topic)
+		c.deadLetter(msg, headerValue(msg.Headers, HeaderNotificationID), ingest.ErrorClassNoRoute, fmt.Errorf("no route for topic %s", topic), attemptHeader(msg.Headers))
+		c.finish(msg)
+		return
+	}
+
+	headers := headerMap(msg.Headers)
+	notification, err := rt.Decoder.Decode(msg.Value, headers)
+	if err != nil {
+		log.Printf("Error decoding message: %v", err)
+		c.deadLetter(msg, headerValue(msg.Headers, HeaderNotificationID), ingest.ErrorClassDecode, err, attemptHeader(msg.Headers))
+		c.finish(msg)
 		return
 	}
 
-	c.running = false
+	if notification.Priority == "" {
+		notification.Priority = rt.Priority
+	}
+
+	env := &models.Envelope{
+		Message:   notification,
+		Key:       string(msg.Key),
+		Headers:   headers,
+		Topic:     *msg.TopicPartition.Topic,
+		Partition: msg.TopicPartition.Partition,
+		Offset:    int64(msg.TopicPartition.Offset),
+		Timestamp: msg.Timestamp,
+	}
+
+	key := msg.Key
+	if len(key) == 0 {
+		key = []byte(notification.UserID)
+	}
+
+	if !c.pool.submit(key, &job{msg: msg, route: rt, env: env}) {
+		// The consumer is stopping; the offset stays uncommitted so the
+		// message is redelivered
+		c.unqueued = append(c.unqueued, msg)
+	}
+}
+
+// process handles a job on a worker goroutine
+func (c *Consumer) process(j *job) {
+	c.handleMessage(j.msg, j.route.Handler, j.env)
+
+	// The handler has returned, either successfully or with a terminal
+	// failure, so the message must not be redelivered
+	c.finish(j.msg)
+}
+
+// finish marks a message as fully handled so its offset can be committed
+func (c *Consumer) finish(msg *kafka.Message) {
+	if c.committer != nil {
+		c.committer.done(msg.TopicPartition)
+	}
+}
+
+// handleMessage passes a decoded message to the handler. Transient failures
+// are scheduled for retry; anything else is dead-lettered.
+func (c *Consumer) handleMessage(msg *kafka.Message, handler ingest.Handler, env *models.Envelope) {
+	attempt := attemptHeader(msg.Headers)
+
+	env.NotificationID = headerValue(msg.Headers, HeaderNotificationID)
+	env.Attempt = attempt
+	env.MaxAttempts = 1
+	if c.retries != nil {
+		env.MaxAttempts = c.retries.maxAttempts()
+	}
+
+	err := handler(env)
+	if err == nil {
+		return
+	}
+
+	log.Printf("Error handling message: %v", err)
+
+	if class := ingest.ClassifyError(err); class != "" {
+		c.deadLetter(msg, env.NotificationID, class, err, attempt)
+		return
+	}
+
+	if c.retries == nil {
+		c.deadLetter(msg, env.NotificationID, ingest.ErrorClassRetriesExhausted, err, attempt)
+		return
+	}
+
+	scheduleErr := c.retries.schedule(msg, env.NotificationID, attempt)
+	switch {
+	case errors.Is(scheduleErr, errRetriesExhausted):
+		log.Printf("Giving up on notification %s after %d attempts", env.NotificationID, attempt)
+		c.deadLetter(msg, env.NotificationID, ingest.ErrorClassRetriesExhausted, err, attempt)
+	case scheduleErr != nil:
+		log.Printf("Error scheduling retry: %v", scheduleErr)
+		c.deadLetter(msg, env.NotificationID, ingest.ErrorClassRetryFailed, err, attempt)
+	default:
+		log.Printf("Scheduled attempt %d of notification %s", attempt+1, env.NotificationID)
+	}
+}
+
+// deadLetter publishes msg to the dead-letter topic, if one is configured
+func (c *Consumer) deadLetter(msg *kafka.Message, notificationID string, class string, cause error, attempt int) {
+	if c.dlq == nil {
+		return
+	}
+
+	if err := c.dlq.publish(msg, notificationID, class, cause, attempt); err != nil {
+		log.Printf("Error dead-lettering message: %v", err)
+	}
+}
+
+// deferUntilDue pauses the message's partition if it is a retry whose
+// not-before time has not been reached yet. The partition is rewound to the
+// message so it is read again when resumed.
+func (c *Consumer) deferUntilDue(msg *kafka.Message) bool {
+	if c.delay == 0 {
+		return false
+	}
+
+	notBefore := notBeforeHeader(msg.Headers)
+	if !time.Now().Before(notBefore) {
+		return false
+	}
+
+	tp := msg.TopicPartition
+	tp.Error = nil
+	if err := c.consumer.Pause([]kafka.TopicPartition{tp}); err != nil {
+		log.Printf("Error pausing %s [%d]: %v", *tp.Topic, tp.Partition, err)
+		return false
+	}
+	if err := c.consumer.Seek(tp, 0); err != nil {
+		log.Printf("Error seeking %s [%d] to offset %d: %v", *tp.Topic, tp.Partition, tp.Offset, err)
+	}
+
+	c.paused[partitionKey{topic: *tp.Topic, partition: tp.Partition}] = pausedPartition{
+		partition: tp,
+		resumeAt:  notBefore,
+	}
+	return true
+}
+
+// resumeDuePartitions resumes partitions whose pending retry is now due
+func (c *Consumer) resumeDuePartitions() {
+	now := time.Now()
+	for key, p := range c.paused {
+		if now.Before(p.resumeAt) {
+			continue
+		}
+
+		if err := c.consumer.Resume([]kafka.TopicPartition{p.partition}); err != nil {
+			log.Printf("Error resuming %s [%d]: %v", key.topic, key.partition, err)
+			continue
+		}
+		delete(c.paused, key)
+	}
+}
+
+// maybeCommit commits processed offsets when a commit batch is due
+func (c *Consumer) maybeCommit() {
+	if c.committer != nil {
+		c.committer.maybeCommit()
+	}
+}
+
+// rebalance commits processed offsets for partitions that are about to be
+// revoked so the next owner does not redeliver them
+func (c *Consumer) rebalance(_ *kafka.Consumer, event kafka.Event) error {
+	revoked, ok := event.(kafka.RevokedPartitions)
+	if !ok {
+		return nil
+	}
+
+	for _, tp := range revoked.Partitions {
+		delete(c.paused, partitionKey{topic: *tp.Topic, partition: tp.Partition})
+	}
+
+	if c.committer == nil {
+		return nil
+	}
+
+	if err := c.committer.revoke(revoked.Partitions); err != nil {
+		log.Printf("Error committing offsets for revoked partitions: %v", err)
+	}
+	return nil
+}
+
+// Stop stops fetching messages and waits for in-flight messages to be
+// handled until ctx is done, then commits the final offsets and closes the
+// consumer. Messages that were not handled in time are reported as
+// abandoned. Retry tier consumers are stopped in parallel.
+func (c *Consumer) Stop(ctx context.Context) ingest.ShutdownReport {
+	var (
+		mu     sync.Mutex
+		report ingest.ShutdownReport
+		wg     sync.WaitGroup
+	)
+
+	for _, tier := range c.tiers {
+		wg.Add(1)
+		go func(tier *Consumer) {
+			defer wg.Done()
+			tierReport := tier.Stop(ctx)
+
+			mu.Lock()
+			report.Merge(tierReport)
+			mu.Unlock()
+		}(tier)
+	}
+
+	ownReport := c.stop(ctx)
+	wg.Wait()
+
+	report.Merge(ownReport)
+	return report
+}
+
+// stop shuts down this consumer, without its retry tiers
+func (c *Consumer) stop(ctx context.Context) ingest.ShutdownReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var report ingest.ShutdownReport
+	if !c.started || c.stopped {
+		return report
+	}
+	c.stopped = true
+
+	// Stop fetching, including a dispatch blocked on a full worker queue
+	close(c.quit)
+	c.pool.interrupt()
+	<-c.done
+
+	inFlight, discarded := c.pool.drain(ctx)
+	for _, j := range inFlight {
+		report.Abandoned = append(report.Abandoned, abandonedMessage(j.msg, true))
+	}
+	for _, j := range discarded {
+		report.Abandoned = append(report.Abandoned, abandonedMessage(j.msg, false))
+	}
+	for _, msg := range c.unqueued {
+		report.Abandoned = append(report.Abandoned, abandonedMessage(msg, false))
+	}
+
+	if c.committer != nil {
+		if err := c.committer.commit(); err != nil {
+			log.Printf("Error committing final offsets: %v", err)
+		}
+	}
+
+	c.close()
+	return report
+}
+
+// abandonedMessage describes a message abandoned during shutdown
+func abandonedMessage(msg *kafka.Message, inFlight bool) ingest.AbandonedMessage {
+	return ingest.AbandonedMessage{
+		Topic:     *msg.TopicPartition.Topic,
+		Partition: msg.TopicPartition.Partition,
+		Offset:    int64(msg.TopicPartition.Offset),
+		InFlight:  inFlight,
+	}
+}
+
+// close closes the underlying client
+func (c *Consumer) close() {
 	if err := c.consumer.Close(); err != nil {
 		log.Printf("Error closing consumer: %v", err)
 	}
 
-	log.Println("Kafka consumer stopped")
-} 
\ No newline at end of file
+	log.Printf("Kafka consumer for topics %s stopped", strings.Join(c.topics, ", "))
+}
@@ -0,0 +1,267 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/ingest"
+	"github.com/notification_service/internal/models"
+)
+
+// countingHandler returns a handler counting the messages it handles
+func countingHandler(handled *atomic.Int32) func(env *models.Envelope) error {
+	return func(env *models.Envelope) error {
+		handled.Add(1)
+		return nil
+	}
+}
+
+func TestConsumerCommitsBatches(t *testing.T) {
+	cfg := testConfig(config.CommitModeManual)
+	cfg.Kafka.CommitBatchSize = 2
+
+	var handled atomic.Int32
+	consumer, fake := newTestConsumer(t, cfg, countingHandler(&handled))
+	for offset := kafka.Offset(0); offset < 4; offset++ {
+		fake.publish(testTopic, 0, offset, testMessage)
+	}
+
+	if err := consumer.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer consumer.Stop(context.Background())
+
+	eventually(t, "all offsets committed", func() bool {
+		return fake.committed(testTopic, 0) == 4
+	})
+	if n := handled.Load(); n != 4 {
+		t.Errorf("handled %d messages, want 4", n)
+	}
+}
+
+func TestConsumerCommitsOnRevoke(t *testing.T) {
+	cfg := testConfig(config.CommitModeManual)
+
+	var handled atomic.Int32
+	consumer, fake := newTestConsumer(t, cfg, countingHandler(&handled))
+	for offset := kafka.Offset(0); offset < 3; offset++ {
+		fake.publish(testTopic, 0, offset, testMessage)
+	}
+
+	if err := consumer.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer consumer.Stop(context.Background())
+
+	eventually(t, "messages handled", func() bool { return handled.Load() == 3 })
+	if n := fake.commitCount(); n != 0 {
+		t.Fatalf("committed %d times before the batch was full", n)
+	}
+
+	fake.revoke(partitionAt(kafka.OffsetInvalid))
+	eventually(t, "revoked offsets committed", func() bool {
+		return fake.committed(testTopic, 0) == 3
+	})
+}
+
+func TestConsumerCommitsOnStop(t *testing.T) {
+	cfg := testConfig(config.CommitModeManual)
+
+	var handled atomic.Int32
+	consumer, fake := newTestConsumer(t, cfg, countingHandler(&handled))
+	for offset := kafka.Offset(0); offset < 3; offset++ {
+		fake.publish(testTopic, 0, offset, testMessage)
+	}
+
+	if err := consumer.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	eventually(t, "messages handled", func() bool { return handled.Load() == 3 })
+
+	report := consumer.Stop(context.Background())
+	if len(report.Abandoned) != 0 {
+		t.Errorf("abandoned %+v, want none", report.Abandoned)
+	}
+	if got := fake.committed(testTopic, 0); got != 3 {
+		t.Errorf("committed offset = %v, want 3", got)
+	}
+	if !fake.closed {
+		t.Error("client not closed")
+	}
+}
+
+func TestConsumerAutoCommit(t *testing.T) {
+	cfg := testConfig(config.CommitModeAuto)
+	cfg.Kafka.CommitBatchSize = 1
+
+	var handled atomic.Int32
+	consumer, fake := newTestConsumer(t, cfg, countingHandler(&handled))
+	for offset := kafka.Offset(0); offset < 3; offset++ {
+		fake.publish(testTopic, 0, offset, testMessage)
+	}
+
+	if err := consumer.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	eventually(t, "offsets stored", func() bool {
+		return fake.stored(testTopic, 0) == 3
+	})
+	consumer.Stop(context.Background())
+
+	// Stored offsets are committed by the client in the background
+	if n := fake.commitCount(); n != 0 {
+		t.Errorf("committed %d times in auto-commit mode", n)
+	}
+}
+
+func TestConsumerAutoCommitSkipsDeferredRetries(t *testing.T) {
+	cfg := testConfig(config.CommitModeAuto)
+
+	var handled atomic.Int32
+	consumer, fake := newTestConsumer(t, cfg, countingHandler(&handled))
+	consumer.delay = time.Minute
+
+	fake.publish(testTopic, 0, 0, testMessage)
+	deferred := fake.publish(testTopic, 0, 1, testMessage)
+	notBefore := strconv.FormatInt(time.Now().Add(time.Minute).UnixMilli(), 10)
+	deferred.Headers = []kafka.Header{{Key: HeaderNotBefore, Value: []byte(notBefore)}}
+
+	if err := consumer.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	eventually(t, "partition paused", func() bool {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return len(fake.paused) == 1
+	})
+	consumer.Stop(context.Background())
+
+	if n := handled.Load(); n != 1 {
+		t.Errorf("handled %d messages, want 1", n)
+	}
+	if got := fake.stored(testTopic, 0); got != 1 {
+		t.Errorf("stored offset = %v, want 1, before the deferred message", got)
+	}
+}
+
+func TestConsumerSurvivesReadErrors(t *testing.T) {
+	cfg := testConfig(config.CommitModeManual)
+
+	var handled atomic.Int32
+	consumer, fake := newTestConsumer(t, cfg, countingHandler(&handled))
+	fake.readErrs = []error{
+		kafka.NewError(kafka.ErrTransport, "broker down", false),
+		errors.New("not a kafka.Error"),
+	}
+	fake.publish(testTopic, 0, 0, testMessage)
+
+	if err := consumer.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer consumer.Stop(context.Background())
+
+	eventually(t, "message handled", func() bool { return handled.Load() == 1 })
+}
+
+// blockingHandler returns a handler that counts the messages it starts
+// handling and returns once release is closed
+func blockingHandler(started *atomic.Int32, release <-chan struct{}) func(env *models.Envelope) error {
+	return func(env *models.Envelope) error {
+		started.Add(1)
+		<-release
+		return nil
+	}
+}
+
+func TestStopDrainsInFlightMessages(t *testing.T) {
+	cfg := testConfig(config.CommitModeManual)
+
+	var started atomic.Int32
+	release := make(chan struct{})
+	consumer, fake := newTestConsumer(t, cfg, blockingHandler(&started, release))
+	for offset := kafka.Offset(0); offset < 3; offset++ {
+		fake.publish(testTopic, 0, offset, testMessage)
+	}
+
+	if err := consumer.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	// The messages share a key, so one is in flight and two are queued
+	eventually(t, "messages dispatched", func() bool {
+		return started.Load() == 1 && fake.pending() == 0
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reports := make(chan ingest.ShutdownReport)
+	go func() { reports <- consumer.Stop(ctx) }()
+
+	select {
+	case <-reports:
+		t.Fatal("Stop returned while a message was in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	report := <-reports
+
+	if len(report.Abandoned) != 0 {
+		t.Errorf("abandoned %+v, want none", report.Abandoned)
+	}
+	if n := started.Load(); n != 3 {
+		t.Errorf("handled %d messages, want 3", n)
+	}
+	if got := fake.committed(testTopic, 0); got != 3 {
+		t.Errorf("committed offset = %v, want 3", got)
+	}
+}
+
+func TestStopReportsAbandonedMessages(t *testing.T) {
+	cfg := testConfig(config.CommitModeManual)
+
+	var started atomic.Int32
+	release := make(chan struct{})
+	defer close(release)
+	consumer, fake := newTestConsumer(t, cfg, blockingHandler(&started, release))
+	for offset := kafka.Offset(0); offset < 3; offset++ {
+		fake.publish(testTopic, 0, offset, testMessage)
+	}
+
+	if err := consumer.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	eventually(t, "messages dispatched", func() bool {
+		return started.Load() == 1 && fake.pending() == 0
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	report := consumer.Stop(ctx)
+
+	want := map[int64]bool{0: true, 1: false, 2: false}
+	if len(report.Abandoned) != len(want) {
+		t.Fatalf("abandoned %+v, want offsets 0 to 2", report.Abandoned)
+	}
+	for _, msg := range report.Abandoned {
+		inFlight, ok := want[msg.Offset]
+		if !ok || msg.InFlight != inFlight || msg.Topic != testTopic || msg.Partition != 0 {
+			t.Errorf("abandoned %+v", msg)
+		}
+		delete(want, msg.Offset)
+	}
+
+	// Abandoned messages are redelivered on the next start
+	if got := fake.committed(testTopic, 0); got > 0 {
+		t.Errorf("committed offset %v past an abandoned message", got)
+	}
+	if n := started.Load(); n != 1 {
+		t.Errorf("started %d messages after the deadline, want 1", n)
+	}
+}
@@ -0,0 +1,267 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/models"
+)
+
+// deadLetterQueue publishes messages that will not be retried to the
+// dead-letter topic, annotated with why and where they failed
+type deadLetterQueue struct {
+	producer Publisher
+	topic    string
+}
+
+// newDeadLetterQueue creates a dead-letter queue publishing to topic
+func newDeadLetterQueue(producer Publisher, topic string) *deadLetterQueue {
+	return &deadLetterQueue{
+		producer: producer,
+		topic:    topic,
+	}
+}
+
+// publish sends msg to the dead-letter topic with its original payload and
+// key. notificationID is recorded when a notification row already exists.
+func (q *deadLetterQueue) publish(msg *kafka.Message, notificationID string, class string, cause error, attempt int) error {
+	headers := withHeader(msg.Headers, HeaderErrorClass, class)
+	if notificationID != "" {
+		headers = withHeader(headers, HeaderNotificationID, notificationID)
+	}
+	headers = withHeader(headers, HeaderErrorMessage, cause.Error())
+	headers = withHeader(headers, HeaderSourceTopic, *msg.TopicPartition.Topic)
+	headers = withHeader(headers, HeaderSourcePartition, strconv.Itoa(int(msg.TopicPartition.Partition)))
+	headers = withHeader(headers, HeaderSourceOffset, strconv.FormatInt(int64(msg.TopicPartition.Offset), 10))
+	headers = withHeader(headers, HeaderAttempt, strconv.Itoa(attempt))
+	headers = withHeader(headers, HeaderFailedAt, time.Now().UTC().Format(time.RFC3339))
+
+	if err := q.producer.Publish(q.topic, msg.Key, msg.Value, headers); err != nil {
+		return fmt.Errorf("failed to publish to dead-letter topic %s: %w", q.topic, err)
+	}
+
+	log.Printf("Dead-lettered message from %s [%d] at offset %d: %s",
+		*msg.TopicPartition.Topic, msg.TopicPartition.Partition, msg.TopicPartition.Offset, class)
+	return nil
+}
+
+// DeadLetter is a message read back from the dead-letter topic
+type DeadLetter struct {
+	Partition       int32
+	Offset          int64
+	Key             []byte
+	Value           []byte
+	Headers         []kafka.Header
+	ErrorClass      string
+	ErrorMessage    string
+	SourceTopic     string
+	SourcePartition string
+	SourceOffset    string
+	OriginalTopic   string
+	Attempt         int
+	FailedAt        string
+}
+
+// newDeadLetter extracts the failure details recorded on a dead-lettered message
+func newDeadLetter(msg *kafka.Message) *DeadLetter {
+	return &DeadLetter{
+		Partition:       msg.TopicPartition.Partition,
+		Offset:          int64(msg.TopicPartition.Offset),
+		Key:             msg.Key,
+		Value:           msg.Value,
+		Headers:         msg.Headers,
+		ErrorClass:      headerValue(msg.Headers, HeaderErrorClass),
+		ErrorMessage:    headerValue(msg.Headers, HeaderErrorMessage),
+		SourceTopic:     headerValue(msg.Headers, HeaderSourceTopic),
+		SourcePartition: headerValue(msg.Headers, HeaderSourcePartition),
+		SourceOffset:    headerValue(msg.Headers, HeaderSourceOffset),
+		OriginalTopic:   headerValue(msg.Headers, HeaderOriginalTopic),
+		Attempt:         attemptHeader(msg.Headers),
+		FailedAt:        headerValue(msg.Headers, HeaderFailedAt),
+	}
+}
+
+// DeadLetterReader reads messages back from the dead-letter topic for
+// inspection and redrive
+type DeadLetterReader struct {
+	consumer *kafka.Consumer
+	topic    string
+}
+
+// NewDeadLetterReader creates a reader of the configured dead-letter topic.
+// Offsets are committed under groupID only when Commit is called.
+func NewDeadLetterReader(cfg *config.Config, groupID string) (*DeadLetterReader, error) {
+	configMap := consumerConfig(&cfg.Kafka, groupID)
+	configMap.SetKey("enable.auto.commit", false)
+
+	c, err := kafka.NewConsumer(configMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka consumer: %w", err)
+	}
+
+	return &DeadLetterReader{
+		consumer: c,
+		topic:    cfg.Kafka.DeadLetterTopic,
+	}, nil
+}
+
+// Scan calls fn for every dead letter currently in the topic, in partition
+// order. If fromCommitted is set, scanning starts after the last committed
+// offset of each partition instead of at the beginning.
+func (r *DeadLetterReader) Scan(fromCommitted bool, fn func(*DeadLetter) error) error {
+	metadata, err := r.consumer.GetMetadata(&r.topic, false, 10*1000)
+	if err != nil {
+		return fmt.Errorf("failed to get metadata for %s: %w", r.topic, err)
+	}
+
+	topicMetadata, ok := metadata.Topics[r.topic]
+	if !ok || topicMetadata.Error.Code() != kafka.ErrNoError {
+		return fmt.Errorf("dead-letter topic %s not found", r.topic)
+	}
+
+	for _, p := range topicMetadata.Partitions {
+		if err := r.scanPartition(p.ID, fromCommitted, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanPartition calls fn for every dead letter in a single partition
+func (r *DeadLetterReader) scanPartition(partition int32, fromCommitted bool, fn func(*DeadLetter) error) error {
+	low, high, err := r.consumer.QueryWatermarkOffsets(r.topic, partition, 10*1000)
+	if err != nil {
+		return fmt.Errorf("failed to query offsets of %s [%d]: %w", r.topic, partition, err)
+	}
+
+	start := low
+	if fromCommitted {
+		committed, err := r.consumer.Committed([]kafka.TopicPartition{{Topic: &r.topic, Partition: partition}}, 10*1000)
+		if err != nil {
+			return fmt.Errorf("failed to get committed offset of %s [%d]: %w", r.topic, partition, err)
+		}
+		if len(committed) == 1 && committed[0].Offset >= 0 && int64(committed[0].Offset) > start {
+			start = int64(committed[0].Offset)
+		}
+	}
+
+	if start >= high {
+		return nil
+	}
+
+	err = r.consumer.Assign([]kafka.TopicPartition{{Topic: &r.topic, Partition: partition, Offset: kafka.Offset(start)}})
+	if err != nil {
+		return fmt.Errorf("failed to assign %s [%d]: %w", r.topic, partition, err)
+	}
+	defer r.consumer.Unassign()
+
+	for offset := start; offset < high; {
+		msg, err := r.consumer.ReadMessage(10 * time.Second)
+		if err != nil {
+			return fmt.Errorf("failed to read %s [%d] at offset %d: %w", r.topic, partition, offset, err)
+		}
+
+		offset = int64(msg.TopicPartition.Offset) + 1
+		if err := fn(newDeadLetter(msg)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get reads the dead letter at the given partition and offset
+func (r *DeadLetterReader) Get(partition int32, offset int64) (*DeadLetter, error) {
+	err := r.consumer.Assign([]kafka.TopicPartition{{Topic: &r.topic, Partition: partition, Offset: kafka.Offset(offset)}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to assign %s [%d]: %w", r.topic, partition, err)
+	}
+	defer r.consumer.Unassign()
+
+	msg, err := r.consumer.ReadMessage(10 * time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s [%d] at offset %d: %w", r.topic, partition, offset, err)
+	}
+	if int64(msg.TopicPartition.Offset) != offset {
+		return nil, fmt.Errorf("no dead letter at %s [%d] offset %d", r.topic, partition, offset)
+	}
+
+	return newDeadLetter(msg), nil
+}
+
+// Commit records that dl has been handled, so that scans from the committed
+// offset skip it
+func (r *DeadLetterReader) Commit(dl *DeadLetter) error {
+	_, err := r.consumer.CommitOffsets([]kafka.TopicPartition{{
+		Topic:     &r.topic,
+		Partition: dl.Partition,
+		Offset:    kafka.Offset(dl.Offset + 1),
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to commit %s [%d] offset %d: %w", r.topic, dl.Partition, dl.Offset, err)
+	}
+	return nil
+}
+
+// Close closes the reader
+func (r *DeadLetterReader) Close() error {
+	return r.consumer.Close()
+}
+
+// ErrNotRedrivable is returned by Redrive when the notification of a dead
+// letter is no longer failed, e.g. because it was resent or redriven before
+var ErrNotRedrivable = errors.New("notification is not failed")
+
+// NotificationStore is the subset of the notification store used by Redrive
+type NotificationStore interface {
+	TransitionNotificationStatus(id string, from []models.NotificationStatus, to models.NotificationStatus) (*models.Notification, error)
+}
+
+// Redrive republishes a dead letter to topic with its failure and retry
+// headers removed, so it is processed as a fresh first attempt. The
+// notification ID is kept so the existing notification row is reused; the
+// row is moved from failed back to retrying first, since the consumer skips
+// notifications in a final status, and back to failed if publishing fails.
+func Redrive(producer Publisher, store NotificationStore, dl *DeadLetter, topic string) error {
+	var headers []kafka.Header
+	for _, h := range dl.Headers {
+		switch h.Key {
+		case HeaderErrorClass, HeaderErrorMessage, HeaderSourceTopic, HeaderSourcePartition,
+			HeaderSourceOffset, HeaderFailedAt, HeaderAttempt, HeaderNotBefore, HeaderOriginalTopic:
+			continue
+		}
+		headers = append(headers, h)
+	}
+	headers = withHeader(headers, HeaderRedrivenFrom, fmt.Sprintf("%d/%d", dl.Partition, dl.Offset))
+
+	id := headerValue(dl.Headers, HeaderNotificationID)
+	if id == "" {
+		return producer.Publish(topic, dl.Key, dl.Value, headers)
+	}
+
+	reopened, err := store.TransitionNotificationStatus(id,
+		[]models.NotificationStatus{models.NotificationStatusFailed}, models.NotificationStatusRetrying)
+	if err != nil {
+		return fmt.Errorf("failed to reopen notification %s: %w", id, err)
+	}
+	if reopened == nil {
+		return fmt.Errorf("%w: notification %s", ErrNotRedrivable, id)
+	}
+
+	if err := producer.Publish(topic, dl.Key, dl.Value, headers); err != nil {
+		_, revertErr := store.TransitionNotificationStatus(id,
+			[]models.NotificationStatus{models.NotificationStatusRetrying}, models.NotificationStatusFailed)
+		if revertErr != nil {
+			log.Printf("Failed to mark notification %s as failed again: %v", id, revertErr)
+		}
+		return err
+	}
+
+	return nil
+}
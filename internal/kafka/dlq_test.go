@@ -0,0 +1,198 @@
+package kafka
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/notification_service/internal/ingest"
+	"github.com/notification_service/internal/models"
+)
+
+const testDeadLetterTopic = "notifications.dlq"
+
+// fakeStore keeps the statuses of notifications by ID
+type fakeStore struct {
+	mu       sync.Mutex
+	statuses map[string]models.NotificationStatus
+	err      error
+}
+
+func (s *fakeStore) TransitionNotificationStatus(id string, from []models.NotificationStatus, to models.NotificationStatus) (*models.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return nil, s.err
+	}
+	status, ok := s.statuses[id]
+	if !ok {
+		return nil, nil
+	}
+	for _, f := range from {
+		if status == f {
+			s.statuses[id] = to
+			return &models.Notification{ID: id, Status: to}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *fakeStore) status(id string) models.NotificationStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statuses[id]
+}
+
+// failingPublisher fails every publish with err
+type failingPublisher struct {
+	err error
+}
+
+func (p failingPublisher) Publish(topic string, key, value []byte, headers []kafka.Header) error {
+	return p.err
+}
+
+// deadLetterOf returns the dead letter stored in a record of the dead-letter topic
+func deadLetterOf(r Record) *DeadLetter {
+	return newDeadLetter(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &r.Topic, Partition: r.Partition, Offset: kafka.Offset(r.Offset)},
+		Key:            r.Key,
+		Value:          r.Value,
+		Headers:        r.Headers,
+	})
+}
+
+// deadLettered dead-letters a retried message of the notification through
+// broker and returns it as read back from the dead-letter topic
+func deadLettered(t *testing.T, broker *Broker, notificationID string) *DeadLetter {
+	t.Helper()
+
+	topic := "notifications.retry.1s"
+	msg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 2, Offset: 7},
+		Key:            []byte("user-1"),
+		Value:          []byte(testMessage),
+		Headers: []kafka.Header{
+			{Key: "trace-id", Value: []byte("abc")},
+			{Key: HeaderOriginalTopic, Value: []byte(testTopic)},
+			{Key: HeaderNotBefore, Value: []byte("1700000000000")},
+		},
+	}
+
+	dlq := newDeadLetterQueue(broker, testDeadLetterTopic)
+	if err := dlq.publish(msg, notificationID, ingest.ErrorClassRetriesExhausted, errors.New("provider unavailable"), 3); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	records := broker.Records(testDeadLetterTopic)
+	if len(records) != 1 {
+		t.Fatalf("%d dead letters, want 1", len(records))
+	}
+	return deadLetterOf(records[0])
+}
+
+func TestDeadLetterQueuePublish(t *testing.T) {
+	broker := NewBroker(1)
+	dl := deadLettered(t, broker, "n-1")
+
+	if string(dl.Key) != "user-1" || string(dl.Value) != testMessage {
+		t.Errorf("dead letter = %q: %q, want the original key and payload", dl.Key, dl.Value)
+	}
+	if dl.ErrorClass != ingest.ErrorClassRetriesExhausted || dl.ErrorMessage != "provider unavailable" {
+		t.Errorf("error = %s: %q", dl.ErrorClass, dl.ErrorMessage)
+	}
+	if dl.SourceTopic != "notifications.retry.1s" || dl.SourcePartition != "2" || dl.SourceOffset != "7" {
+		t.Errorf("source = %s [%s] at %s, want notifications.retry.1s [2] at 7", dl.SourceTopic, dl.SourcePartition, dl.SourceOffset)
+	}
+	if dl.OriginalTopic != testTopic || dl.Attempt != 3 || dl.FailedAt == "" {
+		t.Errorf("dead letter = %+v, want the original topic, attempt 3 and a failure time", dl)
+	}
+	if id := headerValue(dl.Headers, HeaderNotificationID); id != "n-1" {
+		t.Errorf("notification ID = %q, want n-1", id)
+	}
+	if trace := headerValue(dl.Headers, "trace-id"); trace != "abc" {
+		t.Errorf("trace-id = %q, want the original header kept", trace)
+	}
+}
+
+func TestRedriveReopensFailedNotifications(t *testing.T) {
+	broker := NewBroker(1)
+	dl := deadLettered(t, broker, "n-1")
+	store := &fakeStore{statuses: map[string]models.NotificationStatus{"n-1": models.NotificationStatusFailed}}
+
+	if err := Redrive(broker, store, dl, testTopic); err != nil {
+		t.Fatalf("Redrive: %v", err)
+	}
+
+	if status := store.status("n-1"); status != models.NotificationStatusRetrying {
+		t.Errorf("status = %s, want retrying", status)
+	}
+
+	records := broker.Records(testTopic)
+	if len(records) != 1 {
+		t.Fatalf("%d records redriven, want 1", len(records))
+	}
+	r := records[0]
+	if string(r.Key) != "user-1" || string(r.Value) != testMessage {
+		t.Errorf("redriven %q: %q, want the original key and payload", r.Key, r.Value)
+	}
+	for _, key := range []string{HeaderErrorClass, HeaderErrorMessage, HeaderSourceTopic, HeaderSourcePartition,
+		HeaderSourceOffset, HeaderFailedAt, HeaderAttempt, HeaderNotBefore, HeaderOriginalTopic} {
+		if value := r.Header(key); value != "" {
+			t.Errorf("%s = %q, want it removed", key, value)
+		}
+	}
+	if r.Header(HeaderNotificationID) != "n-1" || r.Header("trace-id") != "abc" || r.Header(HeaderRedrivenFrom) != "0/0" {
+		t.Errorf("headers = %v, want the notification ID, trace-id and redriven-from kept", r.Headers)
+	}
+}
+
+func TestRedriveWithoutNotification(t *testing.T) {
+	broker := NewBroker(1)
+	dl := deadLettered(t, broker, "")
+	// Dead letters that never got a row, e.g. undecodable ones, do not touch the store
+	store := &fakeStore{err: errors.New("store unavailable")}
+
+	if err := Redrive(broker, store, dl, testTopic); err != nil {
+		t.Fatalf("Redrive: %v", err)
+	}
+	if records := broker.Records(testTopic); len(records) != 1 {
+		t.Errorf("%d records redriven, want 1", len(records))
+	}
+}
+
+func TestRedriveRejectsNotificationsNotFailed(t *testing.T) {
+	for _, status := range []models.NotificationStatus{models.NotificationStatusResent, models.NotificationStatusRetrying} {
+		t.Run(string(status), func(t *testing.T) {
+			broker := NewBroker(1)
+			dl := deadLettered(t, broker, "n-1")
+			store := &fakeStore{statuses: map[string]models.NotificationStatus{"n-1": status}}
+
+			if err := Redrive(broker, store, dl, testTopic); !errors.Is(err, ErrNotRedrivable) {
+				t.Fatalf("Redrive = %v, want ErrNotRedrivable", err)
+			}
+			if got := store.status("n-1"); got != status {
+				t.Errorf("status = %s, want %s", got, status)
+			}
+			if records := broker.Records(testTopic); len(records) != 0 {
+				t.Errorf("%d records redriven, want none", len(records))
+			}
+		})
+	}
+}
+
+func TestRedriveRevertsWhenPublishFails(t *testing.T) {
+	broker := NewBroker(1)
+	dl := deadLettered(t, broker, "n-1")
+	store := &fakeStore{statuses: map[string]models.NotificationStatus{"n-1": models.NotificationStatusFailed}}
+	publishErr := errors.New("broker unavailable")
+
+	if err := Redrive(failingPublisher{err: publishErr}, store, dl, testTopic); !errors.Is(err, publishErr) {
+		t.Fatalf("Redrive = %v, want %v", err, publishErr)
+	}
+	if status := store.status("n-1"); status != models.NotificationStatusFailed {
+		t.Errorf("status = %s, want failed again", status)
+	}
+}
@@ -0,0 +1,43 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/notification_service/internal/models"
+)
+
+// NotificationPublisher enqueues notification messages on the consumed
+// topic, for producers without a Kafka client of their own
+type NotificationPublisher struct {
+	producer *Producer
+	topic    string
+}
+
+// NewNotificationPublisher creates a notification publisher producing to topic
+func NewNotificationPublisher(producer *Producer, topic string) *NotificationPublisher {
+	return &NotificationPublisher{
+		producer: producer,
+		topic:    topic,
+	}
+}
+
+// Enqueue publishes a message in the JSON format, keyed by user ID, and waits
+// for the broker to acknowledge it. The ID of the already stored notification
+// is carried in the HeaderNotificationID header so the consumer sends it
+// instead of inserting another.
+func (p *NotificationPublisher) Enqueue(msg *models.KafkaNotificationMessage, notificationID string, headers map[string]string) error {
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification message: %w", err)
+	}
+
+	kafkaHeaders := make([]kafka.Header, 0, len(headers)+1)
+	for k, v := range headers {
+		kafkaHeaders = append(kafkaHeaders, kafka.Header{Key: k, Value: []byte(v)})
+	}
+	kafkaHeaders = append(kafkaHeaders, kafka.Header{Key: HeaderNotificationID, Value: []byte(notificationID)})
+
+	return p.producer.Publish(p.topic, []byte(msg.UserID), value, kafkaHeaders)
+}
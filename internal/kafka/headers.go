@@ -0,0 +1,84 @@
+package kafka
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/notification_service/internal/ingest"
+)
+
+// Headers set on messages republished by the consumer
+const (
+	// HeaderAttempt is the 1-based delivery attempt the message represents
+	HeaderAttempt = ingest.HeaderAttempt
+	// HeaderNotBefore is the unix time in milliseconds before which a retry
+	// must not be handled
+	HeaderNotBefore = "x-not-before"
+	// HeaderNotificationID is the ID of the notification row being retried
+	HeaderNotificationID = ingest.HeaderNotificationID
+	// HeaderOriginalTopic is the topic the message was first consumed from
+	HeaderOriginalTopic = "x-original-topic"
+
+	// Dead-letter headers shared with the other sources
+	HeaderErrorClass      = ingest.HeaderErrorClass
+	HeaderErrorMessage    = ingest.HeaderErrorMessage
+	HeaderSourceTopic     = ingest.HeaderSourceTopic
+	HeaderSourcePartition = ingest.HeaderSourcePartition
+	HeaderSourceOffset    = ingest.HeaderSourceOffset
+
+	// HeaderFailedAt is the RFC 3339 time the message was dead-lettered
+	HeaderFailedAt = "x-failed-at"
+	// HeaderRedrivenFrom records the dead-letter position a redriven message came from
+	HeaderRedrivenFrom = "x-redriven-from"
+)
+
+// headerValue returns the value of the last header named key, or "" if absent
+func headerValue(headers []kafka.Header, key string) string {
+	value := ""
+	for _, h := range headers {
+		if h.Key == key {
+			value = string(h.Value)
+		}
+	}
+	return value
+}
+
+// withHeader returns headers with any existing header named key replaced by value
+func withHeader(headers []kafka.Header, key, value string) []kafka.Header {
+	result := make([]kafka.Header, 0, len(headers)+1)
+	for _, h := range headers {
+		if h.Key != key {
+			result = append(result, h)
+		}
+	}
+	return append(result, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+// attemptHeader returns the attempt recorded on a message, defaulting to 1
+func attemptHeader(headers []kafka.Header) int {
+	attempt, err := strconv.Atoi(headerValue(headers, HeaderAttempt))
+	if err != nil || attempt < 1 {
+		return 1
+	}
+	return attempt
+}
+
+// notBeforeHeader returns the not-before time recorded on a message, or the
+// zero time if the message may be handled immediately
+func notBeforeHeader(headers []kafka.Header) time.Time {
+	millis, err := strconv.ParseInt(headerValue(headers, HeaderNotBefore), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(millis)
+}
+
+// headerMap returns headers as a map, keeping the last value of repeated keys
+func headerMap(headers []kafka.Header) map[string]string {
+	values := make(map[string]string, len(headers))
+	for _, h := range headers {
+		values[h.Key] = string(h.Value)
+	}
+	return values
+}
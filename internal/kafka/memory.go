@@ -0,0 +1,323 @@
+package kafka
+
+import (
+	"errors"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// errClientClosed is returned when reading from a closed broker client
+var errClientClosed = errors.New("client is closed")
+
+// Record is a message stored by the in-memory broker
+type Record struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   []kafka.Header
+	Timestamp time.Time
+}
+
+// Header returns the value of the last header named key, or "" if absent
+func (r *Record) Header(key string) string {
+	return headerValue(r.Headers, key)
+}
+
+// Broker is an in-memory stand-in for a Kafka cluster: topics are split into
+// partitions, records with the same key land on the same partition in
+// publish order, and consumer groups commit the next offset to read per
+// partition. It implements the producer and consumer client interfaces, so
+// a Consumer created with NewMemoryConsumer runs the production pipeline,
+// including its worker pool, offset commits, retry tiers and dead-letter
+// topic, e.g. in tests.
+type Broker struct {
+	partitions int
+
+	mu        sync.Mutex
+	topics    map[string][][]*Record
+	committed map[groupPartition]int64
+	// notify is closed and replaced whenever a record is published, waking
+	// the clients waiting for one
+	notify chan struct{}
+}
+
+// groupPartition identifies the committed offset of a consumer group
+type groupPartition struct {
+	group     string
+	topic     string
+	partition int32
+}
+
+// NewBroker creates an in-memory broker whose topics have the given number
+// of partitions. Topics are created on first use.
+func NewBroker(partitions int) *Broker {
+	if partitions < 1 {
+		partitions = 1
+	}
+
+	return &Broker{
+		partitions: partitions,
+		topics:     make(map[string][][]*Record),
+		committed:  make(map[groupPartition]int64),
+		notify:     make(chan struct{}),
+	}
+}
+
+// topic returns the partitions of the named topic, creating it if needed.
+// The caller must hold b.mu.
+func (b *Broker) topic(name string) [][]*Record {
+	t, ok := b.topics[name]
+	if !ok {
+		t = make([][]*Record, b.partitions)
+		b.topics[name] = t
+	}
+	return t
+}
+
+// Publish appends a record to topic. Records with a key are assigned a
+// partition by its hash, others go to partition 0.
+func (b *Broker) Publish(topic string, key, value []byte, headers []kafka.Header) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topic(topic)
+
+	partition := 0
+	if len(key) > 0 {
+		h := fnv.New32a()
+		h.Write(key)
+		partition = int(h.Sum32() % uint32(len(t)))
+	}
+
+	t[partition] = append(t[partition], &Record{
+		Topic:     topic,
+		Partition: int32(partition),
+		Offset:    int64(len(t[partition])),
+		Key:       key,
+		Value:     value,
+		Headers:   append([]kafka.Header(nil), headers...),
+		Timestamp: time.Now(),
+	})
+
+	close(b.notify)
+	b.notify = make(chan struct{})
+	return nil
+}
+
+// Records returns every record of topic, ordered by partition and offset
+func (b *Broker) Records(topic string) []Record {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var records []Record
+	for _, p := range b.topics[topic] {
+		for _, r := range p {
+			records = append(records, *r)
+		}
+	}
+	return records
+}
+
+// Committed returns the next offset group will read from a partition, 0 if
+// the group has not committed one
+func (b *Broker) Committed(group, topic string, partition int32) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.committed[groupPartition{group: group, topic: topic, partition: partition}]
+}
+
+// client returns a new connection of a member of the consumer group groupID
+func (b *Broker) client(groupID string) (client, error) {
+	return &brokerClient{
+		broker:    b,
+		group:     groupID,
+		positions: make(map[partitionKey]int64),
+		paused:    make(map[partitionKey]bool),
+	}, nil
+}
+
+// brokerClient is a consumer group member reading from the in-memory
+// broker. It is assigned every partition of the topics it subscribes to.
+type brokerClient struct {
+	broker *Broker
+	group  string
+
+	// mu guards the client state; it is taken before broker.mu
+	mu            sync.Mutex
+	subscriptions []string
+	patterns      []*regexp.Regexp
+	// positions are the next offsets to read, starting at the committed ones
+	positions map[partitionKey]int64
+	paused    map[partitionKey]bool
+	closed    bool
+}
+
+func (c *brokerClient) SubscribeTopics(topics []string, _ kafka.RebalanceCb) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, topic := range topics {
+		if strings.HasPrefix(topic, "^") {
+			pattern, err := regexp.Compile(topic)
+			if err != nil {
+				return err
+			}
+			c.patterns = append(c.patterns, pattern)
+			continue
+		}
+		c.subscriptions = append(c.subscriptions, topic)
+	}
+	return nil
+}
+
+// subscribed reports whether topic is subscribed to by name or pattern
+func (c *brokerClient) subscribed(topic string) bool {
+	for _, t := range c.subscriptions {
+		if t == topic {
+			return true
+		}
+	}
+	for _, pattern := range c.patterns {
+		if pattern.MatchString(topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next record of the first partition that is not
+// paused and has one, waiting up to timeout for one to be published
+func (c *brokerClient) ReadMessage(timeout time.Duration) (*kafka.Message, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		msg, wait, err := c.next()
+		if msg != nil || err != nil {
+			return msg, err
+		}
+
+		select {
+		case <-wait:
+		case <-deadline.C:
+			return nil, kafka.NewError(kafka.ErrTimedOut, "timed out", false)
+		}
+	}
+}
+
+// next returns the next record to read, or a channel that is closed when a
+// record is published
+func (c *brokerClient) next() (*kafka.Message, <-chan struct{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, nil, errClientClosed
+	}
+
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	names := make([]string, 0, len(b.topics))
+	for name := range b.topics {
+		if c.subscribed(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for partition, records := range b.topics[name] {
+			key := partitionKey{topic: name, partition: int32(partition)}
+			if c.paused[key] {
+				continue
+			}
+
+			offset, ok := c.positions[key]
+			if !ok {
+				offset = b.committed[groupPartition{group: c.group, topic: name, partition: int32(partition)}]
+			}
+			if offset >= int64(len(records)) {
+				continue
+			}
+			c.positions[key] = offset + 1
+
+			r := records[offset]
+			topic := r.Topic
+			return &kafka.Message{
+				TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: r.Partition, Offset: kafka.Offset(r.Offset)},
+				Key:            r.Key,
+				Value:          r.Value,
+				Headers:        append([]kafka.Header(nil), r.Headers...),
+				Timestamp:      r.Timestamp,
+			}, nil, nil
+		}
+	}
+
+	return nil, b.notify, nil
+}
+
+// CommitOffsets records the offsets as the next ones the group will read
+func (c *brokerClient) CommitOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, tp := range offsets {
+		b.committed[groupPartition{group: c.group, topic: *tp.Topic, partition: tp.Partition}] = int64(tp.Offset)
+	}
+	return offsets, nil
+}
+
+// StoreOffsets commits the offsets right away, as if the background commit
+// of the auto commit mode had run
+func (c *brokerClient) StoreOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+	return c.CommitOffsets(offsets)
+}
+
+func (c *brokerClient) Pause(partitions []kafka.TopicPartition) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, tp := range partitions {
+		c.paused[partitionKey{topic: *tp.Topic, partition: tp.Partition}] = true
+	}
+	return nil
+}
+
+func (c *brokerClient) Resume(partitions []kafka.TopicPartition) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, tp := range partitions {
+		delete(c.paused, partitionKey{topic: *tp.Topic, partition: tp.Partition})
+	}
+	return nil
+}
+
+// Seek makes the next read of the partition return the record at its offset
+func (c *brokerClient) Seek(partition kafka.TopicPartition, _ int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.positions[partitionKey{topic: *partition.Topic, partition: partition.Partition}] = int64(partition.Offset)
+	return nil
+}
+
+func (c *brokerClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	return nil
+}
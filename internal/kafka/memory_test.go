@@ -0,0 +1,120 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// read returns the value of the next message c reads, or "" if there is none
+func read(t *testing.T, c client) string {
+	t.Helper()
+
+	msg, err := c.ReadMessage(10 * time.Millisecond)
+	if err != nil {
+		var kerr kafka.Error
+		if errors.As(err, &kerr) && kerr.Code() == kafka.ErrTimedOut {
+			return ""
+		}
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	return string(msg.Value)
+}
+
+func TestBrokerKeepsKeysOnOnePartition(t *testing.T) {
+	broker := NewBroker(4)
+	for _, value := range []string{"1", "2", "3"} {
+		broker.Publish(testTopic, []byte("user-1"), []byte(value), nil)
+	}
+
+	records := broker.Records(testTopic)
+	if len(records) != 3 {
+		t.Fatalf("%d records, want 3", len(records))
+	}
+	for i, r := range records {
+		if r.Partition != records[0].Partition || r.Offset != int64(i) || string(r.Value) != []string{"1", "2", "3"}[i] {
+			t.Errorf("record %d = %+v, want offset %d on partition %d", i, r, i, records[0].Partition)
+		}
+	}
+}
+
+func TestBrokerGroupsResumeFromCommittedOffsets(t *testing.T) {
+	broker := NewBroker(1)
+	broker.Publish(testTopic, nil, []byte("first"), nil)
+	broker.Publish(testTopic, nil, []byte("second"), nil)
+
+	c, _ := broker.client("group")
+	c.SubscribeTopics([]string{testTopic}, nil)
+	if got := read(t, c); got != "first" {
+		t.Fatalf("read %q, want first", got)
+	}
+	c.CommitOffsets([]kafka.TopicPartition{{Topic: strPtr(testTopic), Partition: 0, Offset: 1}})
+	c.Close()
+
+	if committed := broker.Committed("group", testTopic, 0); committed != 1 {
+		t.Errorf("committed = %d, want 1", committed)
+	}
+
+	// A new member of the group resumes after the commit, another group
+	// starts at the beginning
+	c, _ = broker.client("group")
+	c.SubscribeTopics([]string{"^notif.*"}, nil)
+	if got := read(t, c); got != "second" {
+		t.Errorf("read %q, want second", got)
+	}
+	if got := read(t, c); got != "" {
+		t.Errorf("read %q, want nothing", got)
+	}
+
+	other, _ := broker.client("other")
+	other.SubscribeTopics([]string{testTopic}, nil)
+	if got := read(t, other); got != "first" {
+		t.Errorf("other group read %q, want first", got)
+	}
+}
+
+func TestBrokerPauseAndSeek(t *testing.T) {
+	broker := NewBroker(1)
+	broker.Publish(testTopic, nil, []byte("first"), nil)
+
+	c, _ := broker.client("group")
+	c.SubscribeTopics([]string{testTopic}, nil)
+	if got := read(t, c); got != "first" {
+		t.Fatalf("read %q, want first", got)
+	}
+
+	tp := kafka.TopicPartition{Topic: strPtr(testTopic), Partition: 0, Offset: 0}
+	c.Pause([]kafka.TopicPartition{tp})
+	c.Seek(tp, 0)
+	if got := read(t, c); got != "" {
+		t.Errorf("read %q from a paused partition, want nothing", got)
+	}
+
+	c.Resume([]kafka.TopicPartition{tp})
+	if got := read(t, c); got != "first" {
+		t.Errorf("read %q after seeking back, want first", got)
+	}
+}
+
+func TestBrokerWakesWaitingReaders(t *testing.T) {
+	broker := NewBroker(1)
+	c, _ := broker.client("group")
+	c.SubscribeTopics([]string{testTopic}, nil)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		broker.Publish(testTopic, nil, []byte("late"), nil)
+	}()
+
+	msg, err := c.ReadMessage(time.Second)
+	if err != nil || string(msg.Value) != "late" {
+		t.Errorf("ReadMessage = %v, %v, want the late message", msg, err)
+	}
+}
+
+// strPtr returns a pointer to s
+func strPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,155 @@
+package kafka
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/notification_service/internal/ingest"
+	"github.com/notification_service/internal/models"
+)
+
+// job is a decoded message waiting to be handled by a worker
+type job struct {
+	msg   *kafka.Message
+	route *ingest.Route
+	env   *models.Envelope
+}
+
+// workerPool handles messages concurrently. Each worker owns a queue and
+// messages are routed to queues by key, so messages sharing a key are handled
+// one at a time in the order they were consumed.
+type workerPool struct {
+	queues []chan *job
+	wg     sync.WaitGroup
+	// quit is closed to unblock a submit waiting on a full queue
+	quit chan struct{}
+	// abandon is closed to make workers discard their queued jobs
+	abandon chan struct{}
+
+	mu        sync.Mutex
+	active    map[*job]bool
+	discarded []*job
+}
+
+// newWorkerPool creates a pool of concurrency workers, each buffering up to
+// queueDepth messages
+func newWorkerPool(concurrency, queueDepth int) *workerPool {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if queueDepth < 0 {
+		queueDepth = 0
+	}
+
+	queues := make([]chan *job, concurrency)
+	for i := range queues {
+		queues[i] = make(chan *job, queueDepth)
+	}
+
+	return &workerPool{
+		queues:  queues,
+		quit:    make(chan struct{}),
+		abandon: make(chan struct{}),
+		active:  make(map[*job]bool),
+	}
+}
+
+// start launches the workers, each calling process for the jobs in its queue
+func (p *workerPool) start(process func(*job)) {
+	for _, queue := range p.queues {
+		p.wg.Add(1)
+		go func(queue chan *job) {
+			defer p.wg.Done()
+			for j := range queue {
+				p.run(j, process)
+			}
+		}(queue)
+	}
+}
+
+// run processes a single job unless the pool has been abandoned
+func (p *workerPool) run(j *job, process func(*job)) {
+	p.mu.Lock()
+	select {
+	case <-p.abandon:
+		p.discarded = append(p.discarded, j)
+		p.mu.Unlock()
+		return
+	default:
+	}
+	p.active[j] = true
+	p.mu.Unlock()
+
+	process(j)
+
+	p.mu.Lock()
+	delete(p.active, j)
+	p.mu.Unlock()
+}
+
+// submit queues a job on the worker responsible for key, blocking while
+// that worker's queue is full. It reports false if the pool was shut down
+// before the job could be queued.
+func (p *workerPool) submit(key []byte, j *job) bool {
+	h := fnv.New32a()
+	h.Write(key)
+
+	select {
+	case p.queues[h.Sum32()%uint32(len(p.queues))] <- j:
+		return true
+	case <-p.quit:
+		return false
+	}
+}
+
+// interrupt unblocks a pending submit. It may be called concurrently with
+// submit.
+func (p *workerPool) interrupt() {
+	close(p.quit)
+}
+
+// close stops accepting jobs. It must not be called concurrently with submit.
+func (p *workerPool) close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+}
+
+// drain waits for the workers to finish every queued job or for ctx to be
+// done. In the latter case queued jobs are discarded, and the jobs that were
+// discarded or still being processed are returned.
+func (p *workerPool) drain(ctx context.Context) (inFlight, discarded []*job) {
+	finished := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil, nil
+	case <-ctx.Done():
+	}
+
+	p.mu.Lock()
+	close(p.abandon)
+	for j := range p.active {
+		inFlight = append(inFlight, j)
+	}
+	p.mu.Unlock()
+
+	// Workers only need to empty their queues now, which is quick
+	for _, queue := range p.queues {
+		for j := range queue {
+			discarded = append(discarded, j)
+		}
+	}
+
+	p.mu.Lock()
+	discarded = append(discarded, p.discarded...)
+	p.mu.Unlock()
+
+	return inFlight, discarded
+}
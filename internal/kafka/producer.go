@@ -0,0 +1,149 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/notification_service/internal/config"
+)
+
+// Publisher is the subset of Producer used to republish messages, so that
+// the in-memory Broker can be substituted
+type Publisher interface {
+	Publish(topic string, key, value []byte, headers []kafka.Header) error
+}
+
+// errProducerClosed is returned when publishing after the producer was closed
+var errProducerClosed = errors.New("producer is closed")
+
+// Producer represents a Kafka producer
+type Producer struct {
+	producer *kafka.Producer
+
+	// mu guards closed; Publish holds it for reading so Close waits for
+	// messages being produced
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewProducer creates a new Kafka producer
+func NewProducer(cfg *config.Config) (*Producer, error) {
+	configMap := clientConfig(&cfg.Kafka)
+	configMap.SetKey("acks", "all")
+	configMap.SetKey("enable.idempotence", true)
+
+	p, err := kafka.NewProducer(configMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka producer: %w", err)
+	}
+
+	producer := &Producer{producer: p}
+	go producer.handleDeliveryReports()
+
+	return producer, nil
+}
+
+// handleDeliveryReports logs failed deliveries of messages published with
+// PublishAsync. It returns when the producer is closed.
+func (p *Producer) handleDeliveryReports() {
+	for e := range p.producer.Events() {
+		switch ev := e.(type) {
+		case *kafka.Message:
+			if ev.TopicPartition.Error != nil {
+				log.Printf("Failed to deliver message to %s: %v", *ev.TopicPartition.Topic, ev.TopicPartition.Error)
+			}
+		case kafka.Error:
+			log.Printf("Kafka producer error: %v", ev)
+		}
+	}
+}
+
+// Publish produces a message and waits for its delivery report
+func (p *Producer) Publish(topic string, key, value []byte, headers []kafka.Header) error {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return errProducerClosed
+	}
+
+	deliveryChan := make(chan kafka.Event, 1)
+
+	err := p.producer.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Key:            key,
+		Value:          value,
+		Headers:        headers,
+	}, deliveryChan)
+	p.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to produce message to %s: %w", topic, err)
+	}
+
+	event := <-deliveryChan
+	msg, ok := event.(*kafka.Message)
+	if !ok {
+		return fmt.Errorf("unexpected delivery event for %s: %v", topic, event)
+	}
+	if msg.TopicPartition.Error != nil {
+		return fmt.Errorf("failed to deliver message to %s: %w", topic, msg.TopicPartition.Error)
+	}
+
+	return nil
+}
+
+// PublishAsync queues a message for delivery without waiting for it to be
+// delivered. Delivery failures are logged. An error is only returned if the
+// message could not be queued, e.g. because the local queue is full.
+func (p *Producer) PublishAsync(topic string, key, value []byte, headers []kafka.Header) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return errProducerClosed
+	}
+
+	err := p.producer.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Key:            key,
+		Value:          value,
+		Headers:        headers,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to produce message to %s: %w", topic, err)
+	}
+
+	return nil
+}
+
+// Close flushes outstanding messages until ctx is done and closes the
+// producer. It returns the number of messages that were not delivered.
+func (p *Producer) Close(ctx context.Context) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return 0
+	}
+	p.closed = true
+
+	timeout := 15 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+		if timeout < 0 {
+			timeout = 0
+		}
+	}
+
+	remaining := p.producer.Flush(int(timeout.Milliseconds()))
+	if remaining > 0 {
+		log.Printf("Kafka producer closed with %d undelivered messages", remaining)
+	}
+	p.producer.Close()
+
+	return remaining
+}
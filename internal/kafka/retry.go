@@ -0,0 +1,68 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/notification_service/internal/config"
+)
+
+// errRetriesExhausted is returned when a message has used up all retry tiers
+var errRetriesExhausted = errors.New("retries exhausted")
+
+// retryPolicy republishes failed messages to a chain of delayed retry topics,
+// one per backoff delay. The retry topics are named after topic and shared by
+// all routes.
+type retryPolicy struct {
+	producer Publisher
+	topic    string
+	delays   []time.Duration
+}
+
+// newRetryPolicy creates a retry policy for messages consumed from topic
+func newRetryPolicy(producer Publisher, topic string, delays []time.Duration) *retryPolicy {
+	return &retryPolicy{
+		producer: producer,
+		topic:    topic,
+		delays:   delays,
+	}
+}
+
+// maxAttempts is the total number of attempts including the first delivery
+func (p *retryPolicy) maxAttempts() int {
+	return len(p.delays) + 1
+}
+
+// topicFor returns the retry topic for the tier with the given delay
+func (p *retryPolicy) topicFor(delay time.Duration) string {
+	return config.RetryTopic(p.topic, delay)
+}
+
+// schedule republishes msg, which failed on the given attempt, to the next
+// retry tier
+func (p *retryPolicy) schedule(msg *kafka.Message, notificationID string, attempt int) error {
+	if attempt >= p.maxAttempts() {
+		return errRetriesExhausted
+	}
+
+	delay := p.delays[attempt-1]
+	topic := p.topicFor(delay)
+
+	headers := withHeader(msg.Headers, HeaderAttempt, strconv.Itoa(attempt+1))
+	headers = withHeader(headers, HeaderNotBefore, strconv.FormatInt(time.Now().Add(delay).UnixMilli(), 10))
+	if headerValue(headers, HeaderOriginalTopic) == "" {
+		headers = withHeader(headers, HeaderOriginalTopic, *msg.TopicPartition.Topic)
+	}
+	if notificationID != "" {
+		headers = withHeader(headers, HeaderNotificationID, notificationID)
+	}
+
+	if err := p.producer.Publish(topic, msg.Key, msg.Value, headers); err != nil {
+		return fmt.Errorf("failed to schedule retry on %s: %w", topic, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package kafka
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/notification_service/internal/models"
+)
+
+// StatusPublisher publishes notification status events to a Kafka topic,
+// keyed by notification ID so that the events of a notification stay in order
+type StatusPublisher struct {
+	producer *Producer
+	topic    string
+}
+
+// NewStatusPublisher creates a status publisher producing to topic
+func NewStatusPublisher(producer *Producer, topic string) *StatusPublisher {
+	return &StatusPublisher{
+		producer: producer,
+		topic:    topic,
+	}
+}
+
+// PublishStatus queues a status event for delivery. It never blocks on the
+// broker; events that cannot be queued are logged and dropped.
+func (p *StatusPublisher) PublishStatus(event *models.StatusEvent) {
+	value, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error marshalling status event: %v", err)
+		return
+	}
+
+	var headers []kafka.Header
+	if event.CorrelationID != "" {
+		headers = append(headers, kafka.Header{Key: models.HeaderCorrelationID, Value: []byte(event.CorrelationID)})
+	}
+
+	if err := p.producer.PublishAsync(p.topic, []byte(event.NotificationID), value, headers); err != nil {
+		log.Printf("Error publishing %s status event for notification %s: %v", event.Status, event.NotificationID, err)
+	}
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// AuditAction is an operation performed on a notification on request
+type AuditAction string
+
+const (
+	// AuditActionResend means a failed notification was resent
+	AuditActionResend AuditAction = "resend"
+	// AuditActionCancel means a notification was cancelled before it was sent
+	AuditActionCancel AuditAction = "cancel"
+)
+
+// AuditEntry records who performed an operation on a notification, and why
+type AuditEntry struct {
+	ID             string                 `json:"id,omitempty"`
+	NotificationID string                 `json:"notification_id"`
+	Action         AuditAction            `json:"action"`
+	Actor          string                 `json:"actor"`
+	Reason         string                 `json:"reason,omitempty"`
+	Details        map[string]interface{} `json:"details,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+}
@@ -0,0 +1,105 @@
+package models
+
+import "time"
+
+// BulkJobStatus is the state of a bulk resend job
+type BulkJobStatus string
+
+const (
+	// BulkJobStatusRunning means the job is resending notifications
+	BulkJobStatusRunning BulkJobStatus = "running"
+	// BulkJobStatusPaused means the job was paused and can be resumed
+	BulkJobStatusPaused BulkJobStatus = "paused"
+	// BulkJobStatusCompleted means every selected notification was handled
+	BulkJobStatusCompleted BulkJobStatus = "completed"
+	// BulkJobStatusFailed means the job stopped on an error and can be resumed
+	BulkJobStatusFailed BulkJobStatus = "failed"
+)
+
+// BulkResendFilter selects the failed notifications a bulk resend resends.
+// Empty fields match every failed notification; CreatedAfter is required.
+type BulkResendFilter struct {
+	// CreatedAfter and CreatedBefore bound the creation time; the range
+	// includes CreatedAfter and excludes CreatedBefore. CreatedBefore is at
+	// most the creation time of the job, so the job never selects its own
+	// resends.
+	CreatedAfter  time.Time        `json:"created_after"`
+	CreatedBefore time.Time        `json:"created_before"`
+	Type          NotificationType `json:"type,omitempty"`
+	ErrorClasses  []string         `json:"error_classes,omitempty"`
+	UserIDs       []string         `json:"user_ids,omitempty"`
+}
+
+// BulkResendJob resends the failed notifications matching a filter at a
+// limited rate. Its progress is stored, so it can be paused, resumed and
+// inspected.
+type BulkResendJob struct {
+	ID     string           `json:"id,omitempty"`
+	Filter BulkResendFilter `json:"filter"`
+	// Rate is the number of notifications resent per second
+	Rate   int    `json:"rate"`
+	Actor  string `json:"actor"`
+	Reason string `json:"reason,omitempty"`
+
+	Status BulkJobStatus `json:"status"`
+	// Total is the number of notifications the filter matched when the job
+	// was created
+	Total int `json:"total"`
+	// Processed counts the notifications handled so far: Resent were
+	// resent, Skipped were no longer failed, and Failed could not be resent
+	Processed int `json:"processed"`
+	Resent    int `json:"resent"`
+	Skipped   int `json:"skipped"`
+	Failed    int `json:"failed"`
+	// Cursor is where the job continues in the filtered notifications
+	Cursor string `json:"cursor,omitempty"`
+	// Error is the last error the job met: why it failed, or why a
+	// notification could not be resent
+	Error string `json:"error,omitempty"`
+	// Owner is the instance running the job. Only the owner stores its
+	// progress, so that an instance stops running a job another one took
+	// over or resumed.
+	Owner string `json:"owner,omitempty"`
+
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// NotificationFilter returns the filter of the notifications to resend
+func (f *BulkResendFilter) NotificationFilter() NotificationFilter {
+	return NotificationFilter{
+		UserIDs:       f.UserIDs,
+		Type:          f.Type,
+		Statuses:      []NotificationStatus{NotificationStatusFailed},
+		ErrorClasses:  f.ErrorClasses,
+		CreatedAfter:  f.CreatedAfter,
+		CreatedBefore: f.CreatedBefore,
+	}
+}
+
+// Validate checks the filter, returning a *ValidationError listing every
+// invalid field
+func (f *BulkResendFilter) Validate() error {
+	v := &ValidationError{}
+	if f.CreatedAfter.IsZero() {
+		v.add("created_after", ValidationCodeRequired, "is required")
+	}
+
+	filter := f.NotificationFilter()
+	filter.validate(v)
+	for i := range v.Errors {
+		// The filter names these fields in the plural
+		switch v.Errors[i].Field {
+		case "user_id":
+			v.Errors[i].Field = "user_ids"
+		case "error_class":
+			v.Errors[i].Field = "error_classes"
+		}
+	}
+
+	if len(v.Errors) > 0 {
+		return v
+	}
+	return nil
+}
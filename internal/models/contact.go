@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Contact is one of a user's contact points, such as an email address or a
+// Telegram chat. Only verified contacts are notified.
+type Contact struct {
+	ID        string           `json:"id,omitempty"`
+	UserID    string           `json:"user_id"`
+	Type      NotificationType `json:"type"`
+	Channel   string           `json:"channel"`
+	Verified  bool             `json:"verified"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxRecipients is the limit on the recipients of a multi-channel message
+const MaxRecipients = 10
+
+// Recipient is one of the channels a multi-channel message is sent to
+type Recipient struct {
+	Type    NotificationType `json:"type"`
+	Channel string           `json:"channel"` // email address or telegram chat ID
+}
+
+// Delivery is the sending of a multi-channel notification to one of its
+// recipients. The notification's status aggregates those of its deliveries.
+type Delivery struct {
+	ID             string             `json:"id,omitempty"`
+	NotificationID string             `json:"notification_id"`
+	Type           NotificationType   `json:"type"`
+	Channel        string             `json:"channel"`
+	Status         NotificationStatus `json:"status"`
+	Attempts       int                `json:"attempts"`
+	// Notifier and MessageID are taken from the receipt once sent
+	Notifier   string     `json:"notifier,omitempty"`
+	MessageID  string     `json:"message_id,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	ErrorClass string     `json:"error_class,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	SentAt     *time.Time `json:"sent_at,omitempty"`
+	// SuppressionReason is why a suppressed delivery was not sent
+	SuppressionReason string `json:"suppression_reason,omitempty"`
+}
+
+// DeliveryError is returned when deliveries of a multi-channel notification
+// were not sent. Sent is the number of deliveries that were.
+type DeliveryError struct {
+	Sent   int
+	Unsent []Delivery
+}
+
+// Error implements the error interface
+func (e *DeliveryError) Error() string {
+	failures := make([]string, len(e.Unsent))
+	for i, d := range e.Unsent {
+		failures[i] = fmt.Sprintf("%s to %s: %s", d.Type, d.Channel, d.Error)
+	}
+	return fmt.Sprintf("%d of %d deliveries failed: %s", len(e.Unsent), e.Sent+len(e.Unsent), strings.Join(failures, "; "))
+}
+
+// AggregateStatus returns the status of a multi-channel notification from
+// those of its deliveries: pending or retrying while any delivery is, sent
+// if all of them were sent, partially sent if only some were, and failed if
+// none was. Suppressed deliveries are left out, unless all of them were
+// suppressed.
+func AggregateStatus(deliveries []Delivery) NotificationStatus {
+	sent, suppressed, retrying := 0, 0, false
+	for _, d := range deliveries {
+		switch d.Status {
+		case NotificationStatusPending:
+			return NotificationStatusPending
+		case NotificationStatusRetrying:
+			retrying = true
+		case NotificationStatusSent:
+			sent++
+		case NotificationStatusSuppressed:
+			suppressed++
+		}
+	}
+
+	switch {
+	case retrying:
+		return NotificationStatusRetrying
+	case suppressed == len(deliveries):
+		return NotificationStatusSuppressed
+	case sent+suppressed == len(deliveries):
+		return NotificationStatusSent
+	case sent > 0:
+		return NotificationStatusPartiallySent
+	}
+	return NotificationStatusFailed
+}
@@ -0,0 +1,37 @@
+package models
+
+import "testing"
+
+// deliveriesIn returns a delivery in each of statuses
+func deliveriesIn(statuses ...NotificationStatus) []Delivery {
+	deliveries := make([]Delivery, len(statuses))
+	for i, status := range statuses {
+		deliveries[i] = Delivery{Type: NotificationTypeEmail, Status: status}
+	}
+	return deliveries
+}
+
+func TestAggregateStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []NotificationStatus
+		want     NotificationStatus
+	}{
+		{"all sent", []NotificationStatus{NotificationStatusSent, NotificationStatusSent}, NotificationStatusSent},
+		{"partially sent", []NotificationStatus{NotificationStatusSent, NotificationStatusFailed}, NotificationStatusPartiallySent},
+		{"all failed", []NotificationStatus{NotificationStatusFailed, NotificationStatusFailed}, NotificationStatusFailed},
+		{"pending", []NotificationStatus{NotificationStatusSent, NotificationStatusPending, NotificationStatusRetrying}, NotificationStatusPending},
+		{"retrying", []NotificationStatus{NotificationStatusSent, NotificationStatusRetrying, NotificationStatusFailed}, NotificationStatusRetrying},
+		{"sent to all but suppressed", []NotificationStatus{NotificationStatusSent, NotificationStatusSuppressed}, NotificationStatusSent},
+		{"partially sent with suppressed", []NotificationStatus{NotificationStatusSent, NotificationStatusSuppressed, NotificationStatusFailed}, NotificationStatusPartiallySent},
+		{"failed but suppressed", []NotificationStatus{NotificationStatusFailed, NotificationStatusSuppressed}, NotificationStatusFailed},
+		{"all suppressed", []NotificationStatus{NotificationStatusSuppressed, NotificationStatusSuppressed}, NotificationStatusSuppressed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AggregateStatus(deliveriesIn(tt.statuses...)); got != tt.want {
+				t.Errorf("AggregateStatus(%v) = %s, want %s", tt.statuses, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Well-known headers producers may set on notification messages
+const (
+	// HeaderTraceID is the distributed trace the message belongs to
+	HeaderTraceID = "trace-id"
+	// HeaderCorrelationID links the message to the business event that caused it
+	HeaderCorrelationID = "correlation-id"
+	// HeaderIdempotencyKey identifies duplicate submissions of the same notification
+	HeaderIdempotencyKey = "idempotency-key"
+	// HeaderProducerService is the name of the service that produced the message
+	HeaderProducerService = "producer-service"
+)
+
+// Envelope carries a notification message together with the details of the
+// record it was consumed from
+type Envelope struct {
+	Message   *KafkaNotificationMessage
+	Key       string
+	Headers   map[string]string
+	Topic     string
+	Partition int32
+	Offset    int64
+	Timestamp time.Time
+	// MessageID identifies the record in sources without offsets, e.g. the
+	// entry ID of a Redis stream
+	MessageID string
+
+	// NotificationID is set when the message is a retry of an existing
+	// notification, and by the handler once the notification row exists
+	NotificationID string
+	// Attempt is the 1-based delivery attempt this message represents
+	Attempt int
+	// MaxAttempts is the number of attempts after which a failure is final
+	MaxAttempts int
+	// ResendOf is the ID of the failed notification this message resends
+	ResendOf string
+	// Resolved lists the channel fields of the message that were filled in
+	// from the user's contacts, e.g. "channel" or "contacts.telegram"
+	Resolved []string
+}
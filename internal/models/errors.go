@@ -0,0 +1,45 @@
+package models
+
+import "errors"
+
+// Error classes of failed notifications, recorded with their error
+const (
+	// ErrorClassValidation means the message was invalid
+	ErrorClassValidation = "validation"
+	// ErrorClassPermanent means sending failed in a way retrying cannot fix
+	ErrorClassPermanent = "permanent"
+	// ErrorClassTransient means sending failed transiently on the last attempt
+	ErrorClassTransient = "transient"
+	// ErrorClassEnqueue means a submitted notification could not be enqueued
+	ErrorClassEnqueue = "enqueue"
+)
+
+// PermanentError wraps a delivery failure that will not succeed if retried,
+// such as an invalid recipient or an unsupported notification type
+type PermanentError struct {
+	Err error
+}
+
+// NewPermanentError marks err as permanent
+func NewPermanentError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// Error implements the error interface
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// IsPermanent reports whether err, or any error it wraps, is permanent
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
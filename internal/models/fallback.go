@@ -0,0 +1,124 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Conditions under which a notification falls back to the next channel of
+// its fallback policy
+const (
+	// FallbackOnPermanent falls back when sending fails permanently, e.g.
+	// because the user blocked the Telegram bot
+	FallbackOnPermanent = "permanent"
+	// FallbackOnTransient falls back right away when sending fails
+	// transiently, instead of retrying the channel
+	FallbackOnTransient = "transient"
+	// FallbackOnTimeout falls back when sending takes longer than the
+	// policy's timeout
+	FallbackOnTimeout = "timeout"
+)
+
+// DefaultFallbackConditions are the conditions of policies that set none
+var DefaultFallbackConditions = []string{FallbackOnPermanent, FallbackOnTimeout}
+
+// FallbackPolicy lists the channels a notification falls back to, in order,
+// when sending it fails under one of the policy's conditions
+type FallbackPolicy struct {
+	// Channels are the notification types tried after the notification's
+	// own, sent to the user's address of that type in the message contacts
+	Channels []NotificationType `json:"channels"`
+	// On are the conditions that fall back; DefaultFallbackConditions if empty
+	On []string `json:"on,omitempty"`
+	// Timeout is how long sending through a channel may take, such as "10s".
+	// Sends do not time out if it is empty.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// ChannelAttempt records sending a notification through one channel of its
+// fallback chain
+type ChannelAttempt struct {
+	// Attempt is the delivery attempt of the notification
+	Attempt    int              `json:"attempt"`
+	Type       NotificationType `json:"type"`
+	Channel    string           `json:"channel"`
+	Notifier   string           `json:"notifier,omitempty"`
+	MessageID  string           `json:"message_id,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	ErrorClass string           `json:"error_class,omitempty"`
+	// Condition is the fallback condition the failure met, if the
+	// notification fell back to the next channel
+	Condition string    `json:"condition,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Falls reports whether a failure under condition falls back to the next
+// channel
+func (p *FallbackPolicy) Falls(condition string) bool {
+	conditions := p.On
+	if len(conditions) == 0 {
+		conditions = DefaultFallbackConditions
+	}
+	for _, c := range conditions {
+		if c == condition {
+			return true
+		}
+	}
+	return false
+}
+
+// TimeoutDuration returns the parsed Timeout, or 0 if sends do not time out
+func (p *FallbackPolicy) TimeoutDuration() time.Duration {
+	timeout, err := time.ParseDuration(p.Timeout)
+	if err != nil || timeout < 0 {
+		return 0
+	}
+	return timeout
+}
+
+// Validate checks the channels, conditions and timeout of the policy, and
+// that channels can send each type the policy falls back to. If channels is
+// nil, the types are not checked. It returns a *ValidationError if the
+// policy is invalid.
+func (p *FallbackPolicy) Validate(channels Channels) error {
+	v := &ValidationError{}
+	p.validate(v, "", channels)
+	if len(v.Errors) > 0 {
+		return v
+	}
+	return nil
+}
+
+// validate checks the policy, reporting its fields with prefix
+func (p *FallbackPolicy) validate(v *ValidationError, prefix string, channels Channels) {
+	if len(p.Channels) == 0 {
+		v.add(prefix+"channels", ValidationCodeRequired, "is required")
+	}
+	seen := make(map[NotificationType]bool, len(p.Channels))
+	for i, notificationType := range p.Channels {
+		field := fmt.Sprintf("%schannels[%d]", prefix, i)
+		switch {
+		case notificationType == "":
+			v.add(field, ValidationCodeRequired, "is required")
+		case channels != nil && !channels.Supports(notificationType):
+			v.add(field, ValidationCodeUnsupported, "no notifier is registered for notification type %q", notificationType)
+		case seen[notificationType]:
+			v.add(field, ValidationCodeInvalid, "duplicates an earlier channel")
+		}
+		seen[notificationType] = true
+	}
+
+	for i, condition := range p.On {
+		switch condition {
+		case FallbackOnPermanent, FallbackOnTransient, FallbackOnTimeout:
+		default:
+			v.add(fmt.Sprintf("%son[%d]", prefix, i), ValidationCodeUnsupported, "unsupported condition %q", condition)
+		}
+	}
+
+	if p.Timeout != "" {
+		if timeout, err := time.ParseDuration(p.Timeout); err != nil || timeout <= 0 {
+			v.add(prefix+"timeout", ValidationCodeInvalid, "must be a positive duration such as 10s")
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -24,29 +26,134 @@ const (
 	NotificationStatusSent NotificationStatus = "sent"
 	// NotificationStatusFailed means the notification sending failed
 	NotificationStatusFailed NotificationStatus = "failed"
+	// NotificationStatusRetrying means sending failed and another attempt is scheduled
+	NotificationStatusRetrying NotificationStatus = "retrying"
+	// NotificationStatusCancelled means the notification was cancelled before it was sent
+	NotificationStatusCancelled NotificationStatus = "cancelled"
+	// NotificationStatusPartiallySent means a multi-channel notification was
+	// sent to some of its recipients and failed for the others
+	NotificationStatusPartiallySent NotificationStatus = "partially_sent"
+	// NotificationStatusResent means the notification failed and was resent
+	// as a new notification, which refers to it by ResendOf
+	NotificationStatusResent NotificationStatus = "resent"
+	// NotificationStatusSuppressed means the notification was not sent
+	// because the user opted out of its category
+	NotificationStatusSuppressed NotificationStatus = "suppressed"
 )
 
-// Notification represents a notification that needs to be sent
+// IsFinal reports whether a notification in this status will not change anymore
+func (s NotificationStatus) IsFinal() bool {
+	switch s {
+	case NotificationStatusSent, NotificationStatusPartiallySent, NotificationStatusFailed,
+		NotificationStatusCancelled, NotificationStatusResent, NotificationStatusSuppressed:
+		return true
+	}
+	return false
+}
+
+// NotificationPriority represents how urgently a notification should be delivered
+type NotificationPriority string
+
+const (
+	// NotificationPriorityLow is for notifications that can wait, such as marketing
+	NotificationPriorityLow NotificationPriority = "low"
+	// NotificationPriorityNormal is the default priority
+	NotificationPriorityNormal NotificationPriority = "normal"
+	// NotificationPriorityHigh is for urgent notifications, such as security alerts
+	NotificationPriorityHigh NotificationPriority = "high"
+)
+
+// Notification represents a notification that needs to be sent. A
+// multi-channel notification has Recipients instead of a Type and Channel,
+// and is sent through a Delivery per recipient. A notification with a
+// fallback policy records each channel it was sent through in
+// ChannelAttempts, and the one it reached in SentType and SentChannel. A
+// notification the user opted out of is suppressed with a SuppressionReason.
 type Notification struct {
-	ID        string            `json:"id"`
-	UserID    string            `json:"user_id"`
-	Type      NotificationType  `json:"type"`
-	Channel   string            `json:"channel"` // email address or telegram chat ID
-	Subject   string            `json:"subject"`
-	Content   string            `json:"content"`
-	Status    NotificationStatus `json:"status"`
-	CreatedAt time.Time         `json:"created_at"`
-	UpdatedAt time.Time         `json:"updated_at"`
-	SentAt    *time.Time        `json:"sent_at,omitempty"`
-	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	ID            string                 `json:"id,omitempty"`
+	UserID        string                 `json:"user_id"`
+	Type          NotificationType       `json:"type"`
+	Channel       string                 `json:"channel"` // email address or telegram chat ID
+	Recipients    []Recipient            `json:"recipients,omitempty"`
+	Subject       string                 `json:"subject"`
+	Content       string                 `json:"content"`
+	Priority      NotificationPriority   `json:"priority,omitempty"`
+	Category      string                 `json:"category,omitempty"`
+	Status        NotificationStatus     `json:"status"`
+	Attempts      int                    `json:"attempts"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+	SentAt        *time.Time             `json:"sent_at,omitempty"`
+	Error         string                 `json:"error,omitempty"`
+	ErrorClass    string                 `json:"error_class,omitempty"`
+	CorrelationID string                 `json:"correlation_id,omitempty"`
+	ResendOf      string                 `json:"resend_of,omitempty"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+
+	Contacts        map[NotificationType]string `json:"contacts,omitempty"`
+	Fallback        *FallbackPolicy             `json:"fallback,omitempty"`
+	ChannelAttempts []ChannelAttempt            `json:"channel_attempts,omitempty"`
+	SentType        NotificationType            `json:"sent_type,omitempty"`
+	SentChannel     string                      `json:"sent_channel,omitempty"`
+
+	SuppressionReason string `json:"suppression_reason,omitempty"`
+
+	// Deliveries of a multi-channel notification, which are stored apart
+	Deliveries []Delivery `json:"deliveries,omitempty"`
 }
 
-// KafkaNotificationMessage represents a message received from Kafka
+// KafkaNotificationMessage represents a message received from Kafka. It is
+// sent either to a single Type and Channel, or to each of its Recipients.
 type KafkaNotificationMessage struct {
-	UserID    string           `json:"user_id"`
-	Type      NotificationType `json:"type"`
-	Channel   string           `json:"channel"`
-	Subject   string           `json:"subject"`
-	Content   string           `json:"content"`
-	Metadata  map[string]interface{} `json:"metadata,omitempty"`
-} 
\ No newline at end of file
+	SchemaVersion int                    `json:"schema_version,omitempty"`
+	UserID        string                 `json:"user_id"`
+	Type          NotificationType       `json:"type,omitempty"`
+	Channel       string                 `json:"channel,omitempty"`
+	Recipients    []Recipient            `json:"recipients,omitempty"`
+	Subject       string                 `json:"subject"`
+	Content       string                 `json:"content"`
+	Priority      NotificationPriority   `json:"priority,omitempty"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	// Category decides which of the user's preferences apply, such as
+	// "marketing"; DefaultCategory if empty
+	Category string `json:"category,omitempty"`
+	// Contacts are the user's addresses by notification type, which
+	// fallback channels are sent to
+	Contacts map[NotificationType]string `json:"contacts,omitempty"`
+	// Fallback overrides the fallback policy of the notification type
+	Fallback *FallbackPolicy `json:"fallback,omitempty"`
+}
+
+// WithoutChannels returns a copy of the message with the channel fields
+// cleared, named like the fields of validation errors: "channel",
+// "recipients[i].channel" or "contacts.<type>". It is used to drop the
+// channels resolved from the user's contacts before the message is published.
+func (m *KafkaNotificationMessage) WithoutChannels(fields []string) *KafkaNotificationMessage {
+	msg := *m
+	if len(fields) == 0 {
+		return &msg
+	}
+
+	msg.Recipients = append([]Recipient(nil), m.Recipients...)
+	if m.Contacts != nil {
+		msg.Contacts = make(map[NotificationType]string, len(m.Contacts))
+		for notificationType, channel := range m.Contacts {
+			msg.Contacts[notificationType] = channel
+		}
+	}
+
+	for _, field := range fields {
+		var i int
+		switch {
+		case field == "channel":
+			msg.Channel = ""
+		case strings.HasPrefix(field, "contacts."):
+			delete(msg.Contacts, NotificationType(strings.TrimPrefix(field, "contacts.")))
+		default:
+			if _, err := fmt.Sscanf(field, "recipients[%d].channel", &i); err == nil && i >= 0 && i < len(msg.Recipients) {
+				msg.Recipients[i].Channel = ""
+			}
+		}
+	}
+	return &msg
+}
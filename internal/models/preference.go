@@ -0,0 +1,64 @@
+package models
+
+import (
+	"regexp"
+	"time"
+)
+
+// Notification categories. Producers may use other categories too.
+const (
+	CategoryTransactional = "transactional"
+	CategoryMarketing     = "marketing"
+	CategorySecurity      = "security"
+)
+
+// DefaultCategory is the category of messages that do not set one
+const DefaultCategory = CategoryTransactional
+
+// MaxCategoryLength is the limit on a category name, in bytes
+const MaxCategoryLength = 64
+
+// categoryPattern matches a category name, such as "marketing" or
+// "order_updates"
+var categoryPattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// ValidCategory reports whether a category name is well formed
+func ValidCategory(category string) bool {
+	return len(category) <= MaxCategoryLength && categoryPattern.MatchString(category)
+}
+
+// Preference is whether a user receives the notifications of a category
+// through a notification type. A preference without a Type applies to every
+// type the user has no preference of its own for.
+type Preference struct {
+	ID        string           `json:"id,omitempty"`
+	UserID    string           `json:"user_id"`
+	Category  string           `json:"category"`
+	Type      NotificationType `json:"type,omitempty"`
+	Enabled   bool             `json:"enabled"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// Preferences are a user's preferences for a category
+type Preferences []Preference
+
+// Allows reports whether the preferences allow notifications of a category
+// through a type: by the preference for the category and type if there is
+// one, else by the one for the whole category. Users receive the categories
+// they have no preference for.
+func (p Preferences) Allows(category string, notificationType NotificationType) bool {
+	allowed := true
+	for _, preference := range p {
+		if preference.Category != category {
+			continue
+		}
+		switch preference.Type {
+		case notificationType:
+			return preference.Enabled
+		case "":
+			allowed = preference.Enabled
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"regexp"
+	"time"
+)
+
+// Limits of notification queries
+const (
+	// DefaultQueryLimit is the page size of queries that do not set one
+	DefaultQueryLimit = 50
+	// MaxQueryLimit is the largest page size
+	MaxQueryLimit = 500
+	// MaxFilterUserIDs is the largest number of users a filter can match,
+	// which keeps the storage query short enough for a URL
+	MaxFilterUserIDs = 100
+)
+
+// SortOrder is the order of notifications by creation time; notifications
+// created at the same time are ordered by ID in the same direction
+type SortOrder string
+
+const (
+	// SortDescending lists the newest notifications first, the default
+	SortDescending SortOrder = "desc"
+	// SortAscending lists the oldest notifications first
+	SortAscending SortOrder = "asc"
+)
+
+// metadataKeyPattern matches the metadata keys notifications can be filtered by
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// NotificationFilter selects notifications. Empty fields match every
+// notification.
+type NotificationFilter struct {
+	// UserIDs matches the notifications of any of the users
+	UserIDs  []string
+	Type     NotificationType
+	Statuses []NotificationStatus
+	// ErrorClasses matches notifications that failed with any of the
+	// ErrorClass constants
+	ErrorClasses []string
+	// CreatedAfter and CreatedBefore bound the creation time; the range
+	// includes CreatedAfter and excludes CreatedBefore
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// Metadata matches notifications whose top-level metadata values equal
+	// the given strings
+	Metadata map[string]string
+}
+
+// NotificationQuery is a page of notifications to list
+type NotificationQuery struct {
+	Filter NotificationFilter
+	Order  SortOrder
+	Limit  int
+	// Cursor is the NextCursor of the previous page, empty for the first
+	Cursor string
+}
+
+// NotificationPage is a page of listed notifications
+type NotificationPage struct {
+	Notifications []Notification `json:"notifications"`
+	// NextCursor fetches the next page; empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Validate checks the filter, returning a *ValidationError listing every
+// invalid field
+func (f *NotificationFilter) Validate() error {
+	v := &ValidationError{}
+	f.validate(v)
+	if len(v.Errors) > 0 {
+		return v
+	}
+	return nil
+}
+
+// validate records the invalid fields of the filter in v
+func (f *NotificationFilter) validate(v *ValidationError) {
+	if len(f.UserIDs) > MaxFilterUserIDs {
+		v.add("user_id", ValidationCodeInvalid, "must list at most %d users", MaxFilterUserIDs)
+	}
+	for _, userID := range f.UserIDs {
+		if userID == "" {
+			v.add("user_id", ValidationCodeInvalid, "must not be empty")
+			break
+		}
+	}
+
+	// Any type can be filtered on, as notifiers can be added and removed
+	// while their notifications stay stored
+
+	for _, status := range f.Statuses {
+		switch status {
+		case NotificationStatusPending, NotificationStatusSent, NotificationStatusPartiallySent, NotificationStatusFailed,
+			NotificationStatusRetrying, NotificationStatusCancelled, NotificationStatusResent, NotificationStatusSuppressed:
+		default:
+			v.add("status", ValidationCodeUnsupported, "unsupported status %q", status)
+		}
+	}
+
+	for _, class := range f.ErrorClasses {
+		switch class {
+		case ErrorClassValidation, ErrorClassPermanent, ErrorClassTransient, ErrorClassEnqueue:
+		default:
+			v.add("error_class", ValidationCodeUnsupported, "unsupported error class %q", class)
+		}
+	}
+
+	if !f.CreatedAfter.IsZero() && !f.CreatedBefore.IsZero() && !f.CreatedAfter.Before(f.CreatedBefore) {
+		v.add("created_before", ValidationCodeInvalid, "must be after created_after")
+	}
+
+	for key := range f.Metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			v.add("metadata."+key, ValidationCodeInvalid, "metadata keys must be 1 to 64 letters, digits, '_' or '-'")
+		}
+	}
+}
+
+// Validate checks the query, returning a *ValidationError listing every
+// invalid field
+func (q *NotificationQuery) Validate() error {
+	v := &ValidationError{}
+	q.Filter.validate(v)
+
+	switch q.Order {
+	case SortDescending, SortAscending:
+	default:
+		v.add("order", ValidationCodeInvalid, "must be %s or %s", SortDescending, SortAscending)
+	}
+
+	if q.Limit < 1 || q.Limit > MaxQueryLimit {
+		v.add("limit", ValidationCodeInvalid, "must be between 1 and %d", MaxQueryLimit)
+	}
+
+	if len(v.Errors) > 0 {
+		return v
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package models
+
+// Receipt is a provider's acknowledgement of a sent notification
+type Receipt struct {
+	// Notifier is the name of the notifier that sent the notification
+	Notifier string
+	// MessageID identifies the message at the provider, if it returned one
+	MessageID string
+}
+
+// Capabilities describes what a notifier can deliver
+type Capabilities struct {
+	// Subject reports whether the subject is delivered
+	Subject bool
+	// Markdown reports whether the content is rendered as Markdown
+	Markdown bool
+	// SubjectInContent reports whether the subject is sent as a heading of
+	// the content, so that it counts towards MaxContentLength
+	SubjectInContent bool
+	// MaxContentLength is the longest content in characters, or 0 if the
+	// provider sets no limit
+	MaxContentLength int
+}
+
+// Channels are the notification types that can be sent, with the
+// capabilities of the notifier sending each
+type Channels map[NotificationType]Capabilities
+
+// Supports reports whether notifications of a type can be sent
+func (c Channels) Supports(notificationType NotificationType) bool {
+	_, ok := c[notificationType]
+	return ok
+}
@@ -0,0 +1,9 @@
+package models
+
+import _ "embed"
+
+// AvroSchema is the Avro schema of KafkaNotificationMessage, used to decode
+// Avro payloads that are not framed with a schema registry ID
+//
+//go:embed notification.avsc
+var AvroSchema string
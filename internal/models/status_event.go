@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// StatusEvent is published whenever a notification changes status, so that
+// upstream services can follow delivery without polling the database
+type StatusEvent struct {
+	NotificationID string             `json:"notification_id"`
+	Status         NotificationStatus `json:"status"`
+	UserID         string             `json:"user_id"`
+	Type           NotificationType   `json:"type"`
+	Attempt        int                `json:"attempt"`
+	CorrelationID  string             `json:"correlation_id,omitempty"`
+	Error          string             `json:"error,omitempty"`
+	Reason         string             `json:"reason,omitempty"` // why a suppressed notification was not sent
+	OccurredAt     time.Time          `json:"occurred_at"`
+}
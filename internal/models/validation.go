@@ -0,0 +1,292 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// CurrentSchemaVersion is the newest KafkaNotificationMessage schema version.
+// Messages without a schema_version are treated as version 1.
+const CurrentSchemaVersion = 1
+
+// Limits enforced on notification messages
+const (
+	MaxUserIDLength       = 255
+	MaxEmailAddressLength = 254
+	MaxSubjectLength      = 255
+	MaxEmailContentLength = 100000
+	// MaxTelegramMessageLength is Telegram's limit on the formatted message,
+	// subject included
+	MaxTelegramMessageLength = 4096
+	// MaxMetadataSize is the limit on the JSON encoded metadata, in bytes
+	MaxMetadataSize = 16 * 1024
+)
+
+// telegramUsernamePattern matches a public Telegram @username
+var telegramUsernamePattern = regexp.MustCompile(`^@[A-Za-z][A-Za-z0-9_]{4,31}$`)
+
+// FieldError describes why a single field of a message is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Validation error codes
+const (
+	ValidationCodeRequired    = "required"
+	ValidationCodeInvalid     = "invalid"
+	ValidationCodeTooLong     = "too_long"
+	ValidationCodeUnsupported = "unsupported"
+	// ValidationCodeUnresolved means an omitted channel could not be looked
+	// up among the user's contacts
+	ValidationCodeUnresolved = "unresolved"
+)
+
+// ValidationError is returned when a message fails validation. It lists
+// every invalid field, not just the first.
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		messages[i] = fmt.Sprintf("%s: %s", fe.Field, fe.Message)
+	}
+	return "invalid notification message: " + strings.Join(messages, "; ")
+}
+
+// add records an invalid field
+func (e *ValidationError) add(field, code, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks the message against its schema version: required fields,
+// that channels can send each notification type, the channel format of the
+// types that have one, length limits, including the content limits of the
+// channels, and metadata size. It returns a *ValidationError if the message
+// is invalid.
+func (m *KafkaNotificationMessage) Validate(channels Channels) error {
+	v := &ValidationError{}
+
+	if m.SchemaVersion < 0 || m.SchemaVersion > CurrentSchemaVersion {
+		v.add("schema_version", ValidationCodeUnsupported, "schema version %d is not supported, the newest is %d", m.SchemaVersion, CurrentSchemaVersion)
+		return v
+	}
+
+	if m.UserID == "" {
+		v.add("user_id", ValidationCodeRequired, "is required")
+	} else if len(m.UserID) > MaxUserIDLength {
+		v.add("user_id", ValidationCodeTooLong, "must be at most %d bytes", MaxUserIDLength)
+	}
+
+	if m.Content == "" {
+		v.add("content", ValidationCodeRequired, "is required")
+	}
+	if utf8.RuneCountInString(m.Subject) > MaxSubjectLength {
+		v.add("subject", ValidationCodeTooLong, "must be at most %d characters", MaxSubjectLength)
+	}
+
+	switch {
+	case len(m.Recipients) == 0:
+		if m.validateRecipient(v, channels, "", m.Type, m.Channel) {
+			m.validateContentLength(v, channels, m.Type)
+		}
+		m.validateFallback(v, channels)
+	case m.Fallback != nil:
+		v.add("fallback", ValidationCodeInvalid, "is not supported for messages with recipients")
+	case m.Type != "" || m.Channel != "":
+		v.add("recipients", ValidationCodeInvalid, "must not be set along with type and channel")
+	case len(m.Recipients) > MaxRecipients:
+		v.add("recipients", ValidationCodeTooLong, "must have at most %d recipients", MaxRecipients)
+	default:
+		seen := make(map[Recipient]bool, len(m.Recipients))
+		checked := make(map[NotificationType]bool)
+		for i, r := range m.Recipients {
+			prefix := fmt.Sprintf("recipients[%d].", i)
+			if seen[r] {
+				v.add(prefix+"channel", ValidationCodeInvalid, "duplicates an earlier %s recipient", r.Type)
+				continue
+			}
+			seen[r] = true
+
+			// Content limits are reported once per type
+			if m.validateRecipient(v, channels, prefix, r.Type, r.Channel) && !checked[r.Type] {
+				checked[r.Type] = true
+				m.validateContentLength(v, channels, r.Type)
+			}
+		}
+	}
+
+	// Contacts are checked in a stable order, so errors are too
+	contactTypes := make([]NotificationType, 0, len(m.Contacts))
+	for notificationType := range m.Contacts {
+		contactTypes = append(contactTypes, notificationType)
+	}
+	sort.Slice(contactTypes, func(i, j int) bool { return contactTypes[i] < contactTypes[j] })
+
+	for _, notificationType := range contactTypes {
+		channel := m.Contacts[notificationType]
+		field := fmt.Sprintf("contacts.%s", notificationType)
+		if !channels.Supports(notificationType) {
+			v.add(field, ValidationCodeUnsupported, "no notifier is registered for notification type %q", notificationType)
+			continue
+		}
+		validateChannel(v, field, notificationType, channel)
+	}
+
+	if m.Category != "" && !ValidCategory(m.Category) {
+		v.add("category", ValidationCodeInvalid, "must be at most %d bytes of lowercase letters, digits, _ and -, starting with a letter", MaxCategoryLength)
+	}
+
+	switch m.Priority {
+	case "", NotificationPriorityLow, NotificationPriorityNormal, NotificationPriorityHigh:
+	default:
+		v.add("priority", ValidationCodeInvalid, "must be low, normal or high")
+	}
+
+	if len(m.Metadata) > 0 {
+		encoded, err := json.Marshal(m.Metadata)
+		if err != nil {
+			v.add("metadata", ValidationCodeInvalid, "cannot be encoded as JSON: %v", err)
+		} else if len(encoded) > MaxMetadataSize {
+			v.add("metadata", ValidationCodeTooLong, "must be at most %d bytes when encoded as JSON", MaxMetadataSize)
+		}
+	}
+
+	if len(v.Errors) > 0 {
+		return v
+	}
+	return nil
+}
+
+// validateFallback checks the fallback policy of a single-channel message:
+// each fallback channel needs an address in the contacts, and the content
+// must fit its limits
+func (m *KafkaNotificationMessage) validateFallback(v *ValidationError, channels Channels) {
+	if m.Fallback == nil {
+		return
+	}
+
+	m.Fallback.validate(v, "fallback.", channels)
+	for i, notificationType := range m.Fallback.Channels {
+		field := fmt.Sprintf("fallback.channels[%d]", i)
+		switch {
+		case notificationType == m.Type:
+			v.add(field, ValidationCodeInvalid, "must differ from the notification type")
+		case m.Contacts[notificationType] == "":
+			v.add(field, ValidationCodeRequired, "has no %s address in contacts", notificationType)
+		default:
+			m.validateContentLength(v, channels, notificationType)
+		}
+	}
+}
+
+// validateRecipient checks the type and channel of a recipient, reporting
+// them as the prefixed type and channel fields. It returns whether the type
+// can be sent.
+func (m *KafkaNotificationMessage) validateRecipient(v *ValidationError, channels Channels, prefix string, notificationType NotificationType, channel string) bool {
+	switch {
+	case notificationType == "":
+		v.add(prefix+"type", ValidationCodeRequired, "is required")
+		return false
+	case !channels.Supports(notificationType):
+		v.add(prefix+"type", ValidationCodeUnsupported, "no notifier is registered for notification type %q", notificationType)
+		return false
+	}
+	validateChannel(v, prefix+"channel", notificationType, channel)
+	return true
+}
+
+// headingLength is the formatting around a subject sent as a heading of the
+// content: it is set in bold and followed by a blank line
+const headingLength = 4
+
+// validateContentLength checks the subject and content against the content
+// limit of the channel of a notification type
+func (m *KafkaNotificationMessage) validateContentLength(v *ValidationError, channels Channels, notificationType NotificationType) {
+	capabilities := channels[notificationType]
+	if capabilities.MaxContentLength <= 0 {
+		return
+	}
+
+	length := utf8.RuneCountInString(m.Content)
+	if !capabilities.SubjectInContent {
+		if length > capabilities.MaxContentLength {
+			v.add("content", ValidationCodeTooLong, "must be at most %d characters", capabilities.MaxContentLength)
+		}
+		return
+	}
+
+	if m.Subject != "" {
+		length += utf8.RuneCountInString(m.Subject) + headingLength
+	}
+	if length > capabilities.MaxContentLength {
+		v.add("content", ValidationCodeTooLong, "subject and content must be at most %d characters", capabilities.MaxContentLength)
+	}
+}
+
+// channelValidators check the channels of the notification types with a
+// known format
+var channelValidators = map[NotificationType]func(v *ValidationError, field, channel string){
+	NotificationTypeEmail:    validateEmailAddress,
+	NotificationTypeTelegram: validateTelegramChat,
+}
+
+// validateChannel checks the channel of a notification type, reported as
+// field. Types without a known format only require one.
+func validateChannel(v *ValidationError, field string, notificationType NotificationType, channel string) {
+	if validator, ok := channelValidators[notificationType]; ok {
+		validator(v, field, channel)
+		return
+	}
+	if channel == "" {
+		v.add(field, ValidationCodeRequired, "%s channel is required", notificationType)
+	}
+}
+
+// validateEmailAddress checks that channel, reported as field, is a bare
+// RFC 5322 address
+func validateEmailAddress(v *ValidationError, field, channel string) {
+	if channel == "" {
+		v.add(field, ValidationCodeRequired, "email address is required")
+		return
+	}
+	if len(channel) > MaxEmailAddressLength {
+		v.add(field, ValidationCodeTooLong, "email address must be at most %d bytes", MaxEmailAddressLength)
+		return
+	}
+
+	addr, err := mail.ParseAddress(channel)
+	if err != nil || addr.Address != channel {
+		v.add(field, ValidationCodeInvalid, "%q is not a valid email address", channel)
+	}
+}
+
+// validateTelegramChat checks that channel, reported as field, is a numeric
+// chat ID or an @username
+func validateTelegramChat(v *ValidationError, field, channel string) {
+	if channel == "" {
+		v.add(field, ValidationCodeRequired, "telegram chat ID is required")
+		return
+	}
+
+	if strings.HasPrefix(channel, "@") {
+		if !telegramUsernamePattern.MatchString(channel) {
+			v.add(field, ValidationCodeInvalid, "%q is not a valid telegram username", channel)
+		}
+		return
+	}
+
+	if _, err := strconv.ParseInt(channel, 10, 64); err != nil {
+		v.add(field, ValidationCodeInvalid, "%q is not a numeric telegram chat ID or @username", channel)
+	}
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testChannels are the default notifiers and an SMS notifier limited to 160
+// characters
+var testChannels = Channels{
+	NotificationTypeEmail:    {Subject: true, MaxContentLength: MaxEmailContentLength},
+	NotificationTypeTelegram: {Subject: true, Markdown: true, SubjectInContent: true, MaxContentLength: MaxTelegramMessageLength},
+	"sms":                    {MaxContentLength: 160},
+}
+
+// fieldErrors returns the field errors of a validation error by field
+func fieldErrors(t *testing.T, err error) map[string]FieldError {
+	t.Helper()
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("err = %v, want a *ValidationError", err)
+	}
+	fields := make(map[string]FieldError, len(validationErr.Errors))
+	for _, fe := range validationErr.Errors {
+		fields[fe.Field] = fe
+	}
+	return fields
+}
+
+func TestValidateAcceptsRegisteredTypes(t *testing.T) {
+	msg := &KafkaNotificationMessage{
+		UserID:   "user-1",
+		Type:     "sms",
+		Channel:  "+15550100",
+		Content:  "Your code is 1234",
+		Contacts: map[NotificationType]string{NotificationTypeEmail: "user@example.com"},
+		Fallback: &FallbackPolicy{Channels: []NotificationType{NotificationTypeEmail}},
+	}
+	if err := msg.Validate(testChannels); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	msg.Channel = ""
+	fields := fieldErrors(t, msg.Validate(testChannels))
+	if fields["channel"].Code != ValidationCodeRequired {
+		t.Errorf("errors = %v, want the channel required", fields)
+	}
+}
+
+func TestValidateRejectsTypesWithoutNotifier(t *testing.T) {
+	// Only Telegram is configured
+	channels := Channels{NotificationTypeTelegram: testChannels[NotificationTypeTelegram]}
+
+	msg := &KafkaNotificationMessage{
+		UserID:   "user-1",
+		Type:     NotificationTypeEmail,
+		Channel:  "user@example.com",
+		Content:  "Hello",
+		Contacts: map[NotificationType]string{"sms": "+15550100"},
+		Fallback: &FallbackPolicy{Channels: []NotificationType{"sms"}},
+	}
+	fields := fieldErrors(t, msg.Validate(channels))
+	for _, field := range []string{"type", "contacts.sms", "fallback.channels[0]"} {
+		if fe := fields[field]; fe.Code != ValidationCodeUnsupported || !strings.Contains(fe.Message, "no notifier") {
+			t.Errorf("%s: error = %+v, want it unsupported for lack of a notifier", field, fe)
+		}
+	}
+
+	msg = &KafkaNotificationMessage{
+		UserID:     "user-1",
+		Content:    "Hello",
+		Recipients: []Recipient{{Type: NotificationTypeTelegram, Channel: "12345"}, {Type: NotificationTypeEmail, Channel: "user@example.com"}},
+	}
+	fields = fieldErrors(t, msg.Validate(channels))
+	if len(fields) != 1 || fields["recipients[1].type"].Code != ValidationCodeUnsupported {
+		t.Errorf("errors = %v, want the email recipient unsupported", fields)
+	}
+}
+
+func TestValidateContentLengthByCapabilities(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     KafkaNotificationMessage
+		invalid bool
+	}{
+		{
+			name: "within the limit",
+			msg:  KafkaNotificationMessage{Type: "sms", Channel: "+15550100", Content: strings.Repeat("a", 160)},
+		},
+		{
+			name:    "over the limit",
+			msg:     KafkaNotificationMessage{Type: "sms", Channel: "+15550100", Content: strings.Repeat("a", 161)},
+			invalid: true,
+		},
+		{
+			name: "subject sent separately",
+			msg:  KafkaNotificationMessage{Type: "sms", Channel: "+15550100", Subject: "Code", Content: strings.Repeat("a", 160)},
+		},
+		{
+			name: "subject and heading within the limit",
+			msg: KafkaNotificationMessage{Type: NotificationTypeTelegram, Channel: "12345", Subject: "Hi",
+				Content: strings.Repeat("a", MaxTelegramMessageLength-2-headingLength)},
+		},
+		{
+			name: "subject pushing the content over the limit",
+			msg: KafkaNotificationMessage{Type: NotificationTypeTelegram, Channel: "12345", Subject: "Hi",
+				Content: strings.Repeat("a", MaxTelegramMessageLength-1-headingLength)},
+			invalid: true,
+		},
+		{
+			name: "fallback limit",
+			msg: KafkaNotificationMessage{Type: NotificationTypeEmail, Channel: "user@example.com", Content: strings.Repeat("a", 161),
+				Contacts: map[NotificationType]string{"sms": "+15550100"},
+				Fallback: &FallbackPolicy{Channels: []NotificationType{"sms"}}},
+			invalid: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.msg.UserID = "user-1"
+			err := tt.msg.Validate(testChannels)
+			if !tt.invalid {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if fields := fieldErrors(t, err); fields["content"].Code != ValidationCodeTooLong {
+				t.Errorf("errors = %v, want the content too long", fields)
+			}
+		})
+	}
+}
+
+func TestFallbackPolicyValidateWithoutChannels(t *testing.T) {
+	policy := &FallbackPolicy{Channels: []NotificationType{"sms"}}
+	if err := policy.Validate(nil); err != nil {
+		t.Errorf("Validate(nil): %v", err)
+	}
+	if err := policy.Validate(Channels{NotificationTypeEmail: {}}); err == nil {
+		t.Error("Validate succeeded without an sms notifier")
+	}
+}
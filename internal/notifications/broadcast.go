@@ -0,0 +1,78 @@
+package notifications
+
+import (
+	"sync"
+
+	"github.com/notification_service/internal/models"
+)
+
+// subscriptionBuffer is the number of events a subscriber may fall behind
+// before further events are dropped for it
+const subscriptionBuffer = 64
+
+// StatusPublishers publishes status events to several publishers
+type StatusPublishers []StatusPublisher
+
+// PublishStatus publishes event to every publisher
+func (p StatusPublishers) PublishStatus(event *models.StatusEvent) {
+	for _, publisher := range p {
+		publisher.PublishStatus(event)
+	}
+}
+
+// StatusBroadcaster passes the status events of this instance to in-process
+// subscribers, such as gRPC status watchers
+type StatusBroadcaster struct {
+	mu          sync.Mutex
+	subscribers map[*subscription]struct{}
+}
+
+// subscription receives the events of a set of notifications
+type subscription struct {
+	ids    map[string]bool
+	events chan *models.StatusEvent
+}
+
+// NewStatusBroadcaster creates a status broadcaster without subscribers
+func NewStatusBroadcaster() *StatusBroadcaster {
+	return &StatusBroadcaster{subscribers: make(map[*subscription]struct{})}
+}
+
+// PublishStatus passes event to the subscribers of its notification. It never
+// blocks: subscribers that fell behind miss the event.
+func (b *StatusBroadcaster) PublishStatus(event *models.StatusEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers {
+		if !sub.ids[event.NotificationID] {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving the events of the given notifications
+// and a function ending the subscription
+func (b *StatusBroadcaster) Subscribe(ids []string) (<-chan *models.StatusEvent, func()) {
+	sub := &subscription{
+		ids:    make(map[string]bool, len(ids)),
+		events: make(chan *models.StatusEvent, subscriptionBuffer),
+	}
+	for _, id := range ids {
+		sub.ids[id] = true
+	}
+
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub.events, func() {
+		b.mu.Lock()
+		delete(b.subscribers, sub)
+		b.mu.Unlock()
+	}
+}
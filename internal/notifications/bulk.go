@@ -0,0 +1,447 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/models"
+	"github.com/notification_service/internal/supabase"
+)
+
+var (
+	// ErrNotPausable is returned when pausing a bulk job that is not running
+	ErrNotPausable = errors.New("bulk job cannot be paused")
+	// ErrNotResumable is returned when resuming a bulk job that is neither
+	// paused nor failed
+	ErrNotResumable = errors.New("bulk job cannot be resumed")
+)
+
+// bulkJobListLimit is the number of jobs listed, newest first
+const bulkJobListLimit = 50
+
+// BulkResender resends the failed notifications matching a filter, e.g.
+// after a provider outage. Each job runs in the background at its rate,
+// through Submitter.Resend, and stores its progress after every page of
+// notifications, so that it can be paused and resumed from any instance.
+// Running jobs that stop making progress, because the instance running them
+// stopped, are taken over by another instance. The instance running a job is
+// recorded as its owner, and stops running it once it is no longer the owner.
+type BulkResender struct {
+	store       BulkJobStore
+	submitter   *Submitter
+	owner       string
+	defaultRate int
+	maxRate     int
+	staleAfter  time.Duration
+
+	mu sync.Mutex
+	// running cancels the jobs run by this instance, by ID
+	running map[string]context.CancelFunc
+	stopped bool
+	wg      sync.WaitGroup
+	quit    chan struct{}
+}
+
+// NewBulkResender creates a bulk resender storing its jobs in store and
+// submitting through submitter
+func NewBulkResender(cfg *config.Config, store BulkJobStore, submitter *Submitter) *BulkResender {
+	return &BulkResender{
+		store:       store,
+		submitter:   submitter,
+		owner:       newOwner(),
+		defaultRate: cfg.BulkResend.DefaultRate,
+		maxRate:     cfg.BulkResend.MaxRate,
+		staleAfter:  cfg.BulkResend.StaleAfter,
+		running:     make(map[string]context.CancelFunc),
+		quit:        make(chan struct{}),
+	}
+}
+
+// newOwner returns a name identifying this instance as the owner of jobs,
+// unique to the process so that a restarted instance takes its jobs over
+func newOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "notification-service"
+	}
+	return fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())
+}
+
+// Start takes over stale running jobs in the background, now and
+// periodically
+func (b *BulkResender) Start() {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+
+		ticker := time.NewTicker(b.staleAfter / 2)
+		defer ticker.Stop()
+		for {
+			b.adoptStale()
+			select {
+			case <-b.quit:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop interrupts the jobs run by this instance and waits until ctx is done
+// for them to store their progress. They stay running, so that another
+// instance, or this one once restarted, takes them over.
+func (b *BulkResender) Stop(ctx context.Context) {
+	b.mu.Lock()
+	b.stopped = true
+	for _, cancel := range b.running {
+		cancel()
+	}
+	b.mu.Unlock()
+	close(b.quit)
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Bulk resends did not store their progress before the shutdown deadline")
+	}
+}
+
+// Preview returns the number of failed notifications a bulk resend with the
+// filter would resend. An invalid filter is reported in a
+// *models.ValidationError.
+func (b *BulkResender) Preview(filter *models.BulkResendFilter) (int, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+
+	bounded := boundFilter(*filter, time.Now())
+	notificationFilter := bounded.NotificationFilter()
+	return b.store.CountNotifications(&notificationFilter)
+}
+
+// Create starts a job resending the failed notifications matching the
+// filter, rate notifications per second, or the default rate if rate is 0.
+// The actor and reason are recorded in the audit log of every resend. An
+// invalid filter or rate is reported in a *models.ValidationError.
+func (b *BulkResender) Create(filter *models.BulkResendFilter, rate int, actor, reason string) (*models.BulkResendJob, error) {
+	if rate == 0 {
+		rate = b.defaultRate
+	}
+
+	v := &models.ValidationError{}
+	if err := filter.Validate(); err != nil {
+		errors.As(err, &v)
+	}
+	if rate < 0 || rate > b.maxRate {
+		v.Errors = append(v.Errors, models.FieldError{
+			Field:   "rate",
+			Code:    models.ValidationCodeInvalid,
+			Message: fmt.Sprintf("must be between 1 and %d", b.maxRate),
+		})
+	}
+	if len(v.Errors) > 0 {
+		return nil, v
+	}
+
+	job := &models.BulkResendJob{
+		Filter: boundFilter(*filter, time.Now()),
+		Rate:   rate,
+		Actor:  actor,
+		Reason: reason,
+		Status: models.BulkJobStatusRunning,
+		Owner:  b.owner,
+	}
+
+	notificationFilter := job.Filter.NotificationFilter()
+	total, err := b.store.CountNotifications(&notificationFilter)
+	if err != nil {
+		return nil, err
+	}
+	job.Total = total
+
+	job.ID, err = b.store.InsertBulkJob(job)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Bulk resend %s of %d notifications created by %s", job.ID, job.Total, actor)
+	b.launch(job)
+	return job, nil
+}
+
+// Get returns a bulk job. It returns an error wrapping
+// supabase.ErrJobNotFound if there is none with the ID.
+func (b *BulkResender) Get(id string) (*models.BulkResendJob, error) {
+	return b.store.GetBulkJob(id)
+}
+
+// List returns the newest bulk jobs
+func (b *BulkResender) List() ([]models.BulkResendJob, error) {
+	return b.store.ListBulkJobs(nil, bulkJobListLimit)
+}
+
+// Pause stops a running job after the notification being resent. It returns
+// ErrNotPausable if the job is not running.
+func (b *BulkResender) Pause(id, actor, reason string) (*models.BulkResendJob, error) {
+	job, err := b.transition(id, models.BulkJobStatusPaused, "", ErrNotPausable, models.BulkJobStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+
+	// This instance stops the job right away; another instance running it
+	// stops when it next stores its progress
+	b.mu.Lock()
+	if cancel, ok := b.running[id]; ok {
+		cancel()
+	}
+	b.mu.Unlock()
+
+	log.Printf("Bulk resend %s paused by %s: %s", id, actor, reason)
+	return job, nil
+}
+
+// Resume continues a paused or failed job where it stopped, on this
+// instance. It returns ErrNotResumable if the job is in another status.
+func (b *BulkResender) Resume(id, actor, reason string) (*models.BulkResendJob, error) {
+	job, err := b.transition(id, models.BulkJobStatusRunning, b.owner, ErrNotResumable,
+		models.BulkJobStatusPaused, models.BulkJobStatusFailed)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Bulk resend %s resumed by %s: %s", id, actor, reason)
+	b.launch(job)
+	return job, nil
+}
+
+// transition moves a job from one of the from statuses to status, making
+// owner its owner if it is not empty. If the job has another status, an error
+// wrapping notAllowed is returned.
+func (b *BulkResender) transition(id string, status models.BulkJobStatus, owner string, notAllowed error, from ...models.BulkJobStatus) (*models.BulkResendJob, error) {
+	job, err := b.store.TransitionBulkJob(id, from, status, "", owner)
+	if err != nil {
+		return nil, err
+	}
+
+	if job == nil {
+		current, err := b.store.GetBulkJob(id)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: bulk job %s is %s", notAllowed, id, current.Status)
+	}
+	return job, nil
+}
+
+// adoptStale takes over the running jobs that have not progressed for
+// staleAfter
+func (b *BulkResender) adoptStale() {
+	jobs, err := b.store.ListBulkJobs([]models.BulkJobStatus{models.BulkJobStatusRunning}, bulkJobListLimit)
+	if err != nil {
+		log.Printf("Failed to list running bulk resends: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if b.isRunning(job.ID) || time.Since(job.UpdatedAt) < b.staleAfter {
+			continue
+		}
+
+		claimed, err := b.store.ClaimBulkJob(job.ID, job.UpdatedAt, b.owner)
+		if err != nil {
+			log.Printf("Failed to take over bulk resend %s: %v", job.ID, err)
+			continue
+		}
+		if claimed == nil {
+			continue
+		}
+
+		log.Printf("Taking over bulk resend %s, which made no progress since %s", job.ID, job.UpdatedAt)
+		b.launch(claimed)
+	}
+}
+
+// isRunning reports whether this instance runs a job
+func (b *BulkResender) isRunning(id string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.running[id]
+	return ok
+}
+
+// launch runs a job in the background, unless this instance already runs it
+func (b *BulkResender) launch(job *models.BulkResendJob) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.running[job.ID]; ok || b.stopped {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b.running[job.ID] = cancel
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		defer cancel()
+
+		b.run(ctx, job)
+
+		b.mu.Lock()
+		delete(b.running, job.ID)
+		b.mu.Unlock()
+	}()
+}
+
+// run resends the notifications of a job, from its cursor, until they are
+// all handled, the job is paused or ctx is cancelled
+func (b *BulkResender) run(ctx context.Context, job *models.BulkResendJob) {
+	log.Printf("Running bulk resend %s at %d notifications per second", job.ID, job.Rate)
+
+	ticker := time.NewTicker(time.Second / time.Duration(job.Rate))
+	defer ticker.Stop()
+
+	reason := fmt.Sprintf("bulk resend %s", job.ID)
+	if job.Reason != "" {
+		reason = fmt.Sprintf("%s (%s)", job.Reason, reason)
+	}
+	query := &models.NotificationQuery{
+		Filter: job.Filter.NotificationFilter(),
+		Order:  models.SortAscending,
+		Limit:  b.pageSize(job.Rate),
+	}
+
+	for {
+		query.Cursor = job.Cursor
+		page, err := b.store.ListNotifications(query)
+		if err != nil {
+			b.fail(job, err)
+			return
+		}
+
+		for i := range page.Notifications {
+			select {
+			case <-ctx.Done():
+				b.saveProgress(job)
+				return
+			case <-ticker.C:
+			}
+
+			if err := b.resend(job, page.Notifications[i].ID, reason); err != nil {
+				b.fail(job, err)
+				return
+			}
+			job.Cursor = supabase.CursorAfter(&page.Notifications[i], query.Order)
+		}
+
+		if page.NextCursor == "" {
+			b.complete(job)
+			return
+		}
+		if !b.saveProgress(job) {
+			return
+		}
+	}
+}
+
+// resend resends one notification of a job and counts the outcome. It
+// returns an error if the job must stop, because resends cannot be stored or
+// enqueued.
+func (b *BulkResender) resend(job *models.BulkResendJob, id, reason string) error {
+	newID, _, err := b.submitter.Resend(id, job.Actor, reason)
+	job.Processed++
+
+	var validationErr *models.ValidationError
+	switch {
+	case err == nil:
+		job.Resent++
+	case errors.Is(err, ErrNotResendable), errors.Is(err, supabase.ErrNotFound):
+		// Resent or removed since the page was read
+		job.Skipped++
+	case errors.As(err, &validationErr), newID != "" && !errors.Is(err, ErrEnqueue):
+		// The notification itself cannot be sent
+		job.Failed++
+		job.Error = fmt.Sprintf("notification %s: %v", id, err)
+	default:
+		job.Failed++
+		return fmt.Errorf("notification %s: %w", id, err)
+	}
+	return nil
+}
+
+// saveProgress stores the progress of a job, returning whether it is still
+// running on this instance
+func (b *BulkResender) saveProgress(job *models.BulkResendJob) bool {
+	stored, err := b.store.SaveBulkJobProgress(job)
+	if err != nil {
+		// Keep going; the progress is stored with the next page
+		log.Printf("Failed to store progress of bulk resend %s: %v", job.ID, err)
+		return true
+	}
+	if stored == nil || stored.Status != models.BulkJobStatusRunning {
+		log.Printf("Bulk resend %s stopped after %d of %d notifications", job.ID, job.Processed, job.Total)
+		return false
+	}
+	return true
+}
+
+// complete stores the final progress of a job and marks it completed
+func (b *BulkResender) complete(job *models.BulkResendJob) {
+	if !b.saveProgress(job) {
+		return
+	}
+	if _, err := b.store.TransitionBulkJob(job.ID, []models.BulkJobStatus{models.BulkJobStatusRunning}, models.BulkJobStatusCompleted, "", ""); err != nil {
+		log.Printf("Failed to complete bulk resend %s: %v", job.ID, err)
+		return
+	}
+
+	log.Printf("Bulk resend %s completed: %d resent, %d skipped, %d failed",
+		job.ID, job.Resent, job.Skipped, job.Failed)
+}
+
+// fail stores the progress of a job and marks it failed with err, so that it
+// can be resumed once the cause is fixed
+func (b *BulkResender) fail(job *models.BulkResendJob, err error) {
+	log.Printf("Bulk resend %s failed: %v", job.ID, err)
+
+	job.Error = err.Error()
+	if !b.saveProgress(job) {
+		return
+	}
+	if _, err := b.store.TransitionBulkJob(job.ID, []models.BulkJobStatus{models.BulkJobStatusRunning}, models.BulkJobStatusFailed, job.Error, ""); err != nil {
+		log.Printf("Failed to mark bulk resend %s failed: %v", job.ID, err)
+	}
+}
+
+// pageSize returns the number of notifications read at once by a job with
+// the rate, so that it stores its progress well within staleAfter
+func (b *BulkResender) pageSize(rate int) int {
+	size := int(b.staleAfter/4/time.Second) * rate
+	switch {
+	case size < 1:
+		return 1
+	case size > models.MaxQueryLimit:
+		return models.MaxQueryLimit
+	}
+	return size
+}
+
+// boundFilter returns the filter with CreatedBefore at most now, so that a
+// job does not select the notifications it resends
+func boundFilter(filter models.BulkResendFilter, now time.Time) models.BulkResendFilter {
+	if filter.CreatedBefore.IsZero() || filter.CreatedBefore.After(now) {
+		filter.CreatedBefore = now
+	}
+	return filter
+}
@@ -0,0 +1,427 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/models"
+	"github.com/notification_service/internal/supabase"
+)
+
+// memoryBulkStore keeps bulk jobs in memory next to the notifications of a
+// MemoryStore, updating them under the same conditions as the Supabase store
+type memoryBulkStore struct {
+	*MemoryStore
+
+	mu     sync.Mutex
+	jobs   map[string]*models.BulkResendJob
+	nextID int
+	// queries are the notification queries made, and saves the progress
+	// saves that were stored
+	queries []models.NotificationQuery
+	saves   int
+}
+
+func newMemoryBulkStore(store *MemoryStore) *memoryBulkStore {
+	return &memoryBulkStore{MemoryStore: store, jobs: make(map[string]*models.BulkResendJob)}
+}
+
+func (s *memoryBulkStore) ListNotifications(query *models.NotificationQuery) (*models.NotificationPage, error) {
+	s.mu.Lock()
+	s.queries = append(s.queries, *query)
+	s.mu.Unlock()
+	return s.MemoryStore.ListNotifications(query)
+}
+
+func (s *memoryBulkStore) CountNotifications(filter *models.NotificationFilter) (int, error) {
+	page, err := s.MemoryStore.ListNotifications(&models.NotificationQuery{Filter: *filter, Limit: -1})
+	if err != nil {
+		return 0, err
+	}
+	return len(page.Notifications), nil
+}
+
+func (s *memoryBulkStore) InsertBulkJob(job *models.BulkResendJob) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	s.nextID++
+	stored := *job
+	stored.ID = "job-" + strconv.Itoa(s.nextID)
+	s.jobs[stored.ID] = &stored
+	return stored.ID, nil
+}
+
+func (s *memoryBulkStore) GetBulkJob(id string) (*models.BulkResendJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", supabase.ErrJobNotFound, id)
+	}
+	stored := *job
+	return &stored, nil
+}
+
+func (s *memoryBulkStore) ListBulkJobs(statuses []models.BulkJobStatus, limit int) ([]models.BulkResendJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := []models.BulkResendJob{}
+	for _, job := range s.jobs {
+		if len(statuses) == 0 || contains(statuses, job.Status) {
+			jobs = append(jobs, *job)
+		}
+	}
+	return jobs, nil
+}
+
+func (s *memoryBulkStore) TransitionBulkJob(id string, from []models.BulkJobStatus, to models.BulkJobStatus, errMsg, owner string) (*models.BulkResendJob, error) {
+	return s.update(id, func(job *models.BulkResendJob) bool {
+		if !contains(from, job.Status) {
+			return false
+		}
+		job.Status = to
+		if errMsg != "" {
+			job.Error = errMsg
+		}
+		if owner != "" {
+			job.Owner = owner
+		}
+		return true
+	})
+}
+
+func (s *memoryBulkStore) SaveBulkJobProgress(progress *models.BulkResendJob) (*models.BulkResendJob, error) {
+	return s.update(progress.ID, func(job *models.BulkResendJob) bool {
+		if job.Status != models.BulkJobStatusRunning && job.Status != models.BulkJobStatusPaused || job.Owner != progress.Owner {
+			return false
+		}
+		job.Processed, job.Resent, job.Skipped, job.Failed = progress.Processed, progress.Resent, progress.Skipped, progress.Failed
+		job.Cursor, job.Error = progress.Cursor, progress.Error
+		s.saves++
+		return true
+	})
+}
+
+func (s *memoryBulkStore) ClaimBulkJob(id string, updatedAt time.Time, owner string) (*models.BulkResendJob, error) {
+	return s.update(id, func(job *models.BulkResendJob) bool {
+		if job.Status != models.BulkJobStatusRunning || !job.UpdatedAt.Equal(updatedAt) {
+			return false
+		}
+		job.Owner = owner
+		return true
+	})
+}
+
+// update applies fn to a job, returning the updated job, or nil if fn
+// reports that the job does not match
+func (s *memoryBulkStore) update(id string, fn func(job *models.BulkResendJob) bool) (*models.BulkResendJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok || !fn(job) {
+		return nil, nil
+	}
+	job.UpdatedAt = time.Now()
+	updated := *job
+	return &updated, nil
+}
+
+// job returns the stored job with the ID
+func (s *memoryBulkStore) job(t *testing.T, id string) *models.BulkResendJob {
+	t.Helper()
+	job, err := s.GetBulkJob(id)
+	if err != nil {
+		t.Fatalf("GetBulkJob: %v", err)
+	}
+	return job
+}
+
+// newTestBulkResender returns a bulk resender of store, resending in enqueue
+// mode, which is stopped at the end of the test
+func newTestBulkResender(t *testing.T, store *memoryBulkStore, staleAfter time.Duration) *BulkResender {
+	t.Helper()
+
+	cfg := &config.Config{
+		Service:    config.ServiceConfig{SubmitMode: config.SubmitModeEnqueue},
+		BulkResend: config.BulkResendConfig{DefaultRate: 100, MaxRate: 1000, StaleAfter: staleAfter},
+	}
+	notifiers := NewRegistry()
+	notifiers.Register(models.NotificationTypeEmail, newFakeNotifier())
+	submitter, err := NewSubmitter(cfg, NewService(cfg, store.MemoryStore, notifiers, nil, nil, nil), &fakeEnqueuer{})
+	if err != nil {
+		t.Fatalf("NewSubmitter: %v", err)
+	}
+
+	b := NewBulkResender(cfg, store, submitter)
+	t.Cleanup(func() { b.Stop(context.Background()) })
+	return b
+}
+
+// insertFailed stores n failed email notifications and returns their IDs
+func insertFailed(t *testing.T, store *MemoryStore, n int) []string {
+	t.Helper()
+
+	ids := make([]string, n)
+	for i := range ids {
+		id, err := store.InsertNotification(&models.Notification{
+			UserID:  "user-1",
+			Type:    models.NotificationTypeEmail,
+			Channel: "user@example.com",
+			Content: fmt.Sprintf("Hello %d", i),
+			Status:  models.NotificationStatusFailed,
+		})
+		if err != nil {
+			t.Fatalf("InsertNotification: %v", err)
+		}
+		ids[i] = id
+	}
+	return ids
+}
+
+// resends returns the number of times a notification was resent
+func resends(store *MemoryStore, id string) int {
+	count := 0
+	for _, entry := range store.AuditEntries(id) {
+		if entry.Action == models.AuditActionResend {
+			count++
+		}
+	}
+	return count
+}
+
+// waitForStatus waits until the stored job has the status
+func waitForStatus(t *testing.T, store *memoryBulkStore, id string, status models.BulkJobStatus) {
+	t.Helper()
+	eventually(t, fmt.Sprintf("bulk resend %s to be %s", id, status), func() bool {
+		job, err := store.GetBulkJob(id)
+		return err == nil && job.Status == status
+	})
+}
+
+// sinceHourAgo selects the failed notifications of the last hour
+func sinceHourAgo() *models.BulkResendFilter {
+	return &models.BulkResendFilter{CreatedAfter: time.Now().Add(-time.Hour)}
+}
+
+func TestBulkResendPages(t *testing.T) {
+	store := newMemoryBulkStore(NewMemoryStore())
+	ids := insertFailed(t, store.MemoryStore, 5)
+	// A StaleAfter under 4s makes the jobs read one notification at a time
+	b := newTestBulkResender(t, store, time.Second)
+
+	// Neither a sent notification nor a resend of the job is selected
+	if _, err := store.InsertNotification(&models.Notification{
+		UserID: "user-1", Type: models.NotificationTypeEmail, Content: "Sent", Status: models.NotificationStatusSent,
+	}); err != nil {
+		t.Fatalf("InsertNotification: %v", err)
+	}
+
+	job, err := b.Create(sinceHourAgo(), 0, "ops", "provider outage")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if job.Total != 5 || job.Rate != 100 || job.Owner != b.owner {
+		t.Errorf("job = %+v, want 5 notifications at the default rate, owned by the resender", job)
+	}
+	waitForStatus(t, store, job.ID, models.BulkJobStatusCompleted)
+
+	stored := store.job(t, job.ID)
+	if stored.Processed != 5 || stored.Resent != 5 || stored.Skipped != 0 || stored.Failed != 0 {
+		t.Errorf("job = %+v, want 5 notifications resent", stored)
+	}
+	for _, id := range ids {
+		if n := resends(store.MemoryStore, id); n != 1 {
+			t.Errorf("notification %s resent %d times, want once", id, n)
+		}
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	// One page per notification
+	if len(store.queries) != 5 {
+		t.Fatalf("%d pages read, want 5", len(store.queries))
+	}
+	for i, query := range store.queries {
+		if query.Limit != 1 || (i == 0) != (query.Cursor == "") {
+			t.Errorf("page %d read with limit %d and cursor %q, want limit 1 continuing the previous page", i, query.Limit, query.Cursor)
+		}
+	}
+	if store.saves < 5 {
+		t.Errorf("progress stored %d times, want after every page", store.saves)
+	}
+}
+
+func TestBulkResendRate(t *testing.T) {
+	store := newMemoryBulkStore(NewMemoryStore())
+	insertFailed(t, store.MemoryStore, 5)
+	b := newTestBulkResender(t, store, time.Second)
+
+	start := time.Now()
+	job, err := b.Create(sinceHourAgo(), 20, "ops", "")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	waitForStatus(t, store, job.ID, models.BulkJobStatusCompleted)
+
+	// 5 notifications at 20 per second take 250ms
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("5 notifications resent in %s, want at most 20 per second", elapsed)
+	}
+}
+
+func TestBulkResendRejectsRates(t *testing.T) {
+	store := newMemoryBulkStore(NewMemoryStore())
+	b := newTestBulkResender(t, store, time.Second)
+
+	for _, rate := range []int{-1, 1001} {
+		if _, err := b.Create(sinceHourAgo(), rate, "ops", ""); !isValidationError(err, "rate") {
+			t.Errorf("Create at rate %d = %v, want a validation error on rate", rate, err)
+		}
+	}
+}
+
+// isValidationError reports whether err is a validation error of field
+func isValidationError(err error, field string) bool {
+	var v *models.ValidationError
+	if !errors.As(err, &v) {
+		return false
+	}
+	for _, e := range v.Errors {
+		if e.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBulkResendPauseAndResume(t *testing.T) {
+	store := newMemoryBulkStore(NewMemoryStore())
+	ids := insertFailed(t, store.MemoryStore, 10)
+	b := newTestBulkResender(t, store, time.Second)
+
+	job, err := b.Create(sinceHourAgo(), 50, "ops", "")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	eventually(t, "a notification to be resent", func() bool {
+		return store.job(t, job.ID).Processed > 0
+	})
+
+	paused, err := b.Pause(job.ID, "ops", "checking the provider")
+	if err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if paused.Status != models.BulkJobStatusPaused {
+		t.Errorf("status = %s, want paused", paused.Status)
+	}
+	eventually(t, "the job to stop", func() bool { return !b.isRunning(job.ID) })
+
+	processed := store.job(t, job.ID).Processed
+	time.Sleep(50 * time.Millisecond)
+	if stored := store.job(t, job.ID); stored.Processed != processed || stored.Processed == len(ids) {
+		t.Fatalf("paused job processed %d, then %d of %d notifications", processed, stored.Processed, len(ids))
+	}
+	if _, err := b.Pause(job.ID, "ops", ""); err == nil {
+		t.Error("paused a paused job")
+	}
+
+	if _, err := b.Resume(job.ID, "ops", "provider is back"); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	waitForStatus(t, store, job.ID, models.BulkJobStatusCompleted)
+
+	if stored := store.job(t, job.ID); stored.Resent != len(ids) || stored.Skipped != 0 {
+		t.Errorf("job = %+v, want every notification resent once", stored)
+	}
+	for _, id := range ids {
+		if n := resends(store.MemoryStore, id); n != 1 {
+			t.Errorf("notification %s resent %d times, want once", id, n)
+		}
+	}
+	if _, err := b.Resume(job.ID, "ops", ""); err == nil {
+		t.Error("resumed a completed job")
+	}
+}
+
+func TestBulkResendResumedElsewhereStopsHere(t *testing.T) {
+	store := newMemoryBulkStore(NewMemoryStore())
+	ids := insertFailed(t, store.MemoryStore, 30)
+	first := newTestBulkResender(t, store, time.Second)
+	second := newTestBulkResender(t, store, time.Second)
+
+	job, err := first.Create(sinceHourAgo(), 20, "ops", "")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	eventually(t, "a notification to be resent", func() bool {
+		return store.job(t, job.ID).Processed > 0
+	})
+
+	// Pausing on the second instance leaves the first one running until it
+	// stores its progress; resuming right away makes the second the owner
+	if _, err := second.Pause(job.ID, "ops", ""); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	resumed, err := second.Resume(job.ID, "ops", "")
+	if err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if resumed.Owner != second.owner {
+		t.Errorf("owner = %q, want the resuming instance", resumed.Owner)
+	}
+
+	eventually(t, "the first instance to stop", func() bool { return !first.isRunning(job.ID) })
+	if stored := store.job(t, job.ID); stored.Status != models.BulkJobStatusRunning || stored.Processed == len(ids) {
+		t.Fatalf("job = %+v, want it still running on the second instance", stored)
+	}
+	if !second.isRunning(job.ID) {
+		t.Error("second instance does not run the resumed job")
+	}
+}
+
+func TestBulkResendAdoptsStaleJobs(t *testing.T) {
+	store := newMemoryBulkStore(NewMemoryStore())
+	insertFailed(t, store.MemoryStore, 3)
+	b := newTestBulkResender(t, store, time.Second)
+
+	filter := boundFilter(*sinceHourAgo(), time.Now())
+	stale, _ := store.InsertBulkJob(&models.BulkResendJob{
+		Filter: filter, Rate: 100, Actor: "ops", Status: models.BulkJobStatusRunning, Total: 3, Owner: "crashed",
+	})
+	fresh, _ := store.InsertBulkJob(&models.BulkResendJob{
+		Filter: filter, Rate: 100, Actor: "ops", Status: models.BulkJobStatusRunning, Owner: "alive",
+	})
+	paused, _ := store.InsertBulkJob(&models.BulkResendJob{
+		Filter: filter, Rate: 100, Actor: "ops", Status: models.BulkJobStatusPaused, Owner: "crashed",
+	})
+	store.mu.Lock()
+	store.jobs[stale].UpdatedAt = time.Now().Add(-2 * time.Second)
+	store.jobs[paused].UpdatedAt = time.Now().Add(-2 * time.Second)
+	store.mu.Unlock()
+
+	b.adoptStale()
+	waitForStatus(t, store, stale, models.BulkJobStatusCompleted)
+
+	if job := store.job(t, stale); job.Owner != b.owner || job.Resent != 3 {
+		t.Errorf("stale job = %+v, want it taken over and completed", job)
+	}
+	if job := store.job(t, fresh); job.Owner != "alive" || b.isRunning(fresh) {
+		t.Errorf("job that made progress taken over: %+v", job)
+	}
+	if job := store.job(t, paused); job.Status != models.BulkJobStatusPaused || b.isRunning(paused) {
+		t.Errorf("paused job taken over: %+v", job)
+	}
+}
@@ -0,0 +1,472 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	ckafka "github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/ingest"
+	"github.com/notification_service/internal/kafka"
+	"github.com/notification_service/internal/models"
+)
+
+const (
+	testTopic           = "notifications"
+	testDeadLetterTopic = "notifications.dlq"
+)
+
+// fakeNotifier sends email notifications by failing with the errors queued
+// for their content, in order, and succeeding once none are left
+type fakeNotifier struct {
+	mu     sync.Mutex
+	errs   map[string][]error
+	called int
+	// onSend, if set, is called at the start of every send
+	onSend func(notification *models.Notification)
+}
+
+func newFakeNotifier() *fakeNotifier {
+	return &fakeNotifier{errs: make(map[string][]error)}
+}
+
+// fail makes the sends of content fail with errs before succeeding
+func (n *fakeNotifier) fail(content string, errs ...error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.errs[content] = append(n.errs[content], errs...)
+}
+
+func (n *fakeNotifier) Name() string { return "fake" }
+
+func (n *fakeNotifier) Capabilities() models.Capabilities {
+	return models.Capabilities{Subject: true}
+}
+
+func (n *fakeNotifier) Send(ctx context.Context, notification *models.Notification) (models.Receipt, error) {
+	if n.onSend != nil {
+		n.onSend(notification)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.called++
+	if errs := n.errs[notification.Content]; len(errs) > 0 {
+		n.errs[notification.Content] = errs[1:]
+		return models.Receipt{}, errs[0]
+	}
+	return models.Receipt{Notifier: n.Name(), MessageID: fmt.Sprintf("msg-%d", n.called)}, nil
+}
+
+// calls returns how many times Send was called
+func (n *fakeNotifier) calls() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.called
+}
+
+// statusHook is a StatusPublisher calling a function with every status event
+type statusHook func(event *models.StatusEvent)
+
+func (h statusHook) PublishStatus(event *models.StatusEvent) { h(event) }
+
+// pipeline runs the service behind the Kafka consumer on the in-memory
+// broker and store
+type pipeline struct {
+	cfg      *config.Config
+	broker   *kafka.Broker
+	store    *MemoryStore
+	notifier *fakeNotifier
+	service  *Service
+}
+
+// newPipeline starts a consumer of testTopic handing messages to a service
+// sending email through a fake notifier, with two retry tiers. hook, if set,
+// receives every status event.
+func newPipeline(t *testing.T, hook statusHook) *pipeline {
+	t.Helper()
+
+	cfg := &config.Config{Kafka: config.KafkaConfig{
+		Topic:             testTopic,
+		GroupID:           "e2e",
+		CommitMode:        config.CommitModeManual,
+		CommitBatchSize:   1,
+		WorkerConcurrency: 2,
+		WorkerQueueDepth:  8,
+		RetryDelays:       []time.Duration{10 * time.Millisecond, 20 * time.Millisecond},
+		DeadLetterTopic:   testDeadLetterTopic,
+		Routes:            []config.RouteConfig{{Topic: testTopic, Handler: config.DefaultHandler}},
+	}}
+
+	p := &pipeline{
+		cfg:      cfg,
+		broker:   kafka.NewBroker(1),
+		store:    NewMemoryStore(),
+		notifier: newFakeNotifier(),
+	}
+	notifiers := NewRegistry()
+	notifiers.Register(models.NotificationTypeEmail, p.notifier)
+
+	var publisher StatusPublisher
+	if hook != nil {
+		publisher = hook
+	}
+	p.service = NewService(cfg, p.store, notifiers, nil, nil, publisher)
+
+	consumer, err := kafka.NewMemoryConsumer(cfg, map[string]ingest.Handler{
+		config.DefaultHandler: p.service.ProcessNotification,
+	}, p.broker)
+	if err != nil {
+		t.Fatalf("NewMemoryConsumer: %v", err)
+	}
+	if err := consumer.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		consumer.Stop(ctx)
+	})
+	return p
+}
+
+// publish publishes an email notification to user-1 with content
+func (p *pipeline) publish(content string) {
+	payload := fmt.Sprintf(`{"user_id":"user-1","type":"email","channel":"user@example.com","subject":"Hi","content":%q}`, content)
+	p.broker.Publish(testTopic, []byte("user-1"), []byte(payload), nil)
+}
+
+// retryTopic returns the topic of the retry tier scheduling the given attempt
+func (p *pipeline) retryTopic(attempt int) string {
+	return config.RetryTopic(testTopic, p.cfg.Kafka.RetryDelays[attempt-2])
+}
+
+// retries returns the records published to the retry tiers, in attempt order
+func (p *pipeline) retries() []kafka.Record {
+	var records []kafka.Record
+	for _, delay := range p.cfg.Kafka.RetryDelays {
+		records = append(records, p.broker.Records(config.RetryTopic(testTopic, delay))...)
+	}
+	return records
+}
+
+// consumed reports whether every record published to testTopic and the retry
+// tiers was handled and its offset committed
+func (p *pipeline) consumed() bool {
+	groups := map[string]string{testTopic: p.cfg.Kafka.GroupID}
+	for _, delay := range p.cfg.Kafka.RetryDelays {
+		groups[config.RetryTopic(testTopic, delay)] = config.RetryGroupID(p.cfg.Kafka.GroupID, delay)
+	}
+
+	for topic, group := range groups {
+		if p.broker.Committed(group, topic, 0) != int64(len(p.broker.Records(topic))) {
+			return false
+		}
+	}
+	return true
+}
+
+// notification returns the only stored notification
+func (p *pipeline) notification(t *testing.T) *models.Notification {
+	t.Helper()
+
+	page, err := p.store.ListNotifications(&models.NotificationQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("ListNotifications: %v", err)
+	}
+	if len(page.Notifications) != 1 {
+		t.Fatalf("%d notifications stored, want 1", len(page.Notifications))
+	}
+	return &page.Notifications[0]
+}
+
+// deadLettered returns the records published to the dead-letter topic
+func (p *pipeline) deadLettered() []kafka.Record {
+	return p.broker.Records(testDeadLetterTopic)
+}
+
+// eventually fails the test if cond does not become true within a second
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPipelineSends(t *testing.T) {
+	p := newPipeline(t, nil)
+
+	p.publish("Hello")
+	eventually(t, "the message to be consumed", p.consumed)
+
+	n := p.notification(t)
+	if n.Status != models.NotificationStatusSent || n.Attempts != 1 || n.SentAt == nil {
+		t.Errorf("notification = %+v, want sent on the first attempt", n)
+	}
+	if n.UserID != "user-1" || n.Channel != "user@example.com" || n.Subject != "Hi" || n.Content != "Hello" {
+		t.Errorf("notification = %+v", n)
+	}
+	if calls := p.notifier.calls(); calls != 1 {
+		t.Errorf("%d sends, want 1", calls)
+	}
+	if records := p.deadLettered(); len(records) != 0 {
+		t.Errorf("%d dead-lettered records, want none", len(records))
+	}
+}
+
+func TestPipelineRetriesTransientFailures(t *testing.T) {
+	p := newPipeline(t, nil)
+	p.notifier.fail("Hello", errors.New("provider unavailable"))
+
+	p.publish("Hello")
+	eventually(t, "the retry to be consumed", func() bool {
+		return len(p.retries()) == 1 && p.consumed()
+	})
+
+	// The retry updates the notification the first attempt stored
+	n := p.notification(t)
+	if n.Status != models.NotificationStatusSent || n.Attempts != 2 {
+		t.Errorf("notification = %+v, want sent on the second attempt", n)
+	}
+	if n.Error != "" || n.ErrorClass != "" {
+		t.Errorf("error = %q (%s), want it cleared", n.Error, n.ErrorClass)
+	}
+
+	retries := p.broker.Records(p.retryTopic(2))
+	if len(retries) != 1 {
+		t.Fatalf("%d records on the first retry tier, want 1", len(retries))
+	}
+	retry := retries[0]
+	if retry.Header(kafka.HeaderAttempt) != "2" || retry.Header(kafka.HeaderNotificationID) != n.ID {
+		t.Errorf("retry headers = %v", retry.Headers)
+	}
+	if retry.Header(kafka.HeaderOriginalTopic) != testTopic || retry.Header(kafka.HeaderNotBefore) == "" {
+		t.Errorf("retry headers = %v, want the original topic and a not-before time", retry.Headers)
+	}
+	if calls := p.notifier.calls(); calls != 2 {
+		t.Errorf("%d sends, want 2", calls)
+	}
+	if records := p.deadLettered(); len(records) != 0 {
+		t.Errorf("%d dead-lettered records, want none", len(records))
+	}
+}
+
+func TestPipelineDeadLetters(t *testing.T) {
+	unavailable := errors.New("provider unavailable")
+
+	tests := []struct {
+		name     string
+		content  string
+		errs     []error
+		attempts int
+		class    string
+	}{
+		{
+			name:     "permanent failure",
+			content:  "Bounced",
+			errs:     []error{models.NewPermanentError(errors.New("address rejected"))},
+			attempts: 1,
+			class:    ingest.ErrorClassPermanent,
+		},
+		{
+			name:     "retries exhausted",
+			content:  "Unavailable",
+			errs:     []error{unavailable, unavailable, unavailable},
+			attempts: 3,
+			class:    ingest.ErrorClassRetriesExhausted,
+		},
+		{
+			name:     "invalid message",
+			content:  "",
+			attempts: 1,
+			class:    ingest.ErrorClassValidation,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPipeline(t, nil)
+			p.notifier.fail(tt.content, tt.errs...)
+
+			p.publish(tt.content)
+			eventually(t, "the message to be dead-lettered", func() bool {
+				return len(p.deadLettered()) == 1 && p.consumed()
+			})
+
+			n := p.notification(t)
+			if n.Status != models.NotificationStatusFailed || n.Attempts != tt.attempts {
+				t.Errorf("notification = %+v, want failed after %d attempts", n, tt.attempts)
+			}
+			if calls := p.notifier.calls(); calls != len(tt.errs) {
+				t.Errorf("%d sends, want %d", calls, len(tt.errs))
+			}
+
+			record := p.deadLettered()[0]
+			if class := record.Header(kafka.HeaderErrorClass); class != tt.class {
+				t.Errorf("error class = %q, want %q", class, tt.class)
+			}
+			// The last attempt was consumed from its retry tier
+			source := testTopic
+			if tt.attempts > 1 {
+				source = p.retryTopic(tt.attempts)
+			}
+			if topic := record.Header(kafka.HeaderSourceTopic); topic != source {
+				t.Errorf("source topic = %q, want %q", topic, source)
+			}
+			if record.Header(kafka.HeaderNotificationID) != n.ID {
+				t.Errorf("notification ID = %q, want %q", record.Header(kafka.HeaderNotificationID), n.ID)
+			}
+			if retries := p.retries(); len(retries) != tt.attempts-1 {
+				t.Errorf("%d retries scheduled, want %d", len(retries), tt.attempts-1)
+			}
+		})
+	}
+}
+
+func TestPipelineSkipsCancelledRetries(t *testing.T) {
+	// The notification is cancelled as soon as it is marked for a retry,
+	// before the retry is consumed
+	var p *pipeline
+	p = newPipeline(t, func(event *models.StatusEvent) {
+		if event.Status != models.NotificationStatusRetrying {
+			return
+		}
+		if _, err := p.service.CancelNotification(event.NotificationID, "ops", "duplicate"); err != nil {
+			t.Errorf("CancelNotification: %v", err)
+		}
+	})
+	p.notifier.fail("Hello", errors.New("provider unavailable"))
+
+	p.publish("Hello")
+	eventually(t, "the retry to be consumed", func() bool {
+		return len(p.retries()) == 1 && p.consumed()
+	})
+
+	n := p.notification(t)
+	if n.Status != models.NotificationStatusCancelled {
+		t.Errorf("status = %s, want cancelled", n.Status)
+	}
+	if calls := p.notifier.calls(); calls != 1 {
+		t.Errorf("%d sends, want only the failed first attempt", calls)
+	}
+	if records := p.deadLettered(); len(records) != 0 {
+		t.Errorf("%d dead-lettered records, want none", len(records))
+	}
+
+	entries := p.store.AuditEntries(n.ID)
+	if len(entries) != 1 || entries[0].Action != models.AuditActionCancel || entries[0].Actor != "ops" {
+		t.Errorf("audit entries = %+v, want the cancellation", entries)
+	}
+}
+
+func TestPipelineKeepsCancellationsMadeDuringSends(t *testing.T) {
+	tests := []struct {
+		name string
+		errs []error
+	}{
+		{name: "send failed", errs: []error{errors.New("provider unavailable")}},
+		{name: "send succeeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPipeline(t, nil)
+			p.notifier.fail("Hello", tt.errs...)
+			p.notifier.onSend = func(n *models.Notification) {
+				if _, err := p.service.CancelNotification(n.ID, "ops", "duplicate"); err != nil {
+					t.Errorf("CancelNotification: %v", err)
+				}
+			}
+
+			p.publish("Hello")
+			eventually(t, "the message to be consumed", p.consumed)
+
+			if n := p.notification(t); n.Status != models.NotificationStatusCancelled {
+				t.Errorf("status = %s, want cancelled", n.Status)
+			}
+			if records := p.retries(); len(records) != 0 {
+				t.Errorf("%d retries scheduled, want none", len(records))
+			}
+			if records := p.deadLettered(); len(records) != 0 {
+				t.Errorf("%d dead-lettered records, want none", len(records))
+			}
+		})
+	}
+}
+
+func TestPipelineRedrivesDeadLetters(t *testing.T) {
+	p := newPipeline(t, nil)
+	p.notifier.fail("Bounced", models.NewPermanentError(errors.New("address rejected")))
+
+	p.publish("Bounced")
+	eventually(t, "the message to be dead-lettered", func() bool {
+		return len(p.deadLettered()) == 1 && p.consumed()
+	})
+
+	record := p.deadLettered()[0]
+	dl := &kafka.DeadLetter{
+		Partition: record.Partition,
+		Offset:    record.Offset,
+		Key:       record.Key,
+		Value:     record.Value,
+		Headers:   record.Headers,
+	}
+	if err := kafka.Redrive(p.broker, p.store, dl, testTopic); err != nil {
+		t.Fatalf("Redrive: %v", err)
+	}
+	eventually(t, "the redriven message to be consumed", func() bool {
+		return len(p.broker.Records(testTopic)) == 2 && p.consumed()
+	})
+
+	// The redriven message is sent as the notification it failed as
+	n := p.notification(t)
+	if n.Status != models.NotificationStatusSent || n.SentAt == nil {
+		t.Errorf("notification = %+v, want sent", n)
+	}
+	if calls := p.notifier.calls(); calls != 2 {
+		t.Errorf("%d sends, want 2", calls)
+	}
+	if records := p.deadLettered(); len(records) != 1 {
+		t.Errorf("%d dead-lettered records, want only the redriven one", len(records))
+	}
+
+	if err := kafka.Redrive(p.broker, p.store, dl, testTopic); !errors.Is(err, kafka.ErrNotRedrivable) {
+		t.Errorf("second Redrive = %v, want ErrNotRedrivable", err)
+	}
+}
+
+func TestPipelineSkipsRedeliveredSentNotifications(t *testing.T) {
+	p := newPipeline(t, nil)
+
+	p.publish("Hello")
+	eventually(t, "the message to be consumed", p.consumed)
+	n := p.notification(t)
+	if n.Status != models.NotificationStatusSent {
+		t.Fatalf("status = %s, want sent", n.Status)
+	}
+
+	// The record is delivered again, as it may be when its offset was not
+	// committed before a crash or rebalance
+	record := p.broker.Records(testTopic)[0]
+	headers := append(record.Headers, ckafka.Header{Key: kafka.HeaderNotificationID, Value: []byte(n.ID)})
+	p.broker.Publish(testTopic, record.Key, record.Value, headers)
+	eventually(t, "the redelivered message to be consumed", p.consumed)
+
+	if calls := p.notifier.calls(); calls != 1 {
+		t.Errorf("%d sends, want the notification sent only once", calls)
+	}
+	if got := p.notification(t); got.Status != models.NotificationStatusSent || got.Attempts != 1 {
+		t.Errorf("notification = %+v, want it left sent on the first attempt", got)
+	}
+	if records := p.deadLettered(); len(records) != 0 {
+		t.Errorf("%d dead-lettered records, want none", len(records))
+	}
+}
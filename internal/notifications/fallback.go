@@ -0,0 +1,165 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/notification_service/internal/models"
+)
+
+// ErrSendTimeout is returned when sending through a channel takes longer
+// than the timeout of the notification's fallback policy. It is transient.
+var ErrSendTimeout = errors.New("send timed out")
+
+// fallbackPolicy returns the fallback policy of a notification: its own, or
+// else that of its type. It returns nil if the notification does not fall
+// back.
+func (s *Service) fallbackPolicy(notification *models.Notification) *models.FallbackPolicy {
+	if notification.Fallback != nil {
+		return notification.Fallback
+	}
+	return s.fallbacks[notification.Type]
+}
+
+// sendWithFallback sends a notification through its own channel and, while
+// sending fails under one of the policy's conditions, through the next
+// channel of the policy. A retried notification continues from the channel
+// its previous attempt reached. Every channel tried is recorded in the
+// notification's channel attempts, along with the channel it was sent to.
+// The error of the last channel tried is returned.
+func (s *Service) sendWithFallback(notification *models.Notification, policy *models.FallbackPolicy, preferences models.Preferences) (models.Receipt, error) {
+	chain := s.fallbackChain(notification, policy, preferences)
+	timeout := policy.TimeoutDuration()
+
+	var receipt models.Receipt
+	var sendErr error
+	for i := resumeIndex(chain, notification.ChannelAttempts); i < len(chain); i++ {
+		single := *notification
+		single.Type, single.Channel = chain[i].Type, chain[i].Channel
+
+		attempt := models.ChannelAttempt{
+			Attempt:   notification.Attempts,
+			Type:      single.Type,
+			Channel:   single.Channel,
+			StartedAt: time.Now().UTC(),
+		}
+		receipt, sendErr = s.sendWithTimeout(&single, timeout)
+		attempt.Notifier, attempt.MessageID = receipt.Notifier, receipt.MessageID
+
+		if sendErr == nil {
+			notification.ChannelAttempts = append(notification.ChannelAttempts, attempt)
+			notification.SentType, notification.SentChannel = single.Type, single.Channel
+			break
+		}
+
+		attempt.Error = sendErr.Error()
+		attempt.ErrorClass = errorClass(sendErr)
+		condition := fallbackCondition(sendErr)
+		if i+1 < len(chain) && policy.Falls(condition) {
+			log.Printf("Sending notification %s to %s %s failed (%s), falling back to %s: %v",
+				notification.ID, single.Type, single.Channel, condition, chain[i+1].Type, sendErr)
+			attempt.Condition = condition
+		}
+		notification.ChannelAttempts = append(notification.ChannelAttempts, attempt)
+
+		if attempt.Condition == "" {
+			break
+		}
+	}
+
+	if err := s.store.UpdateNotificationChannels(notification.ID, notification.ChannelAttempts,
+		notification.SentType, notification.SentChannel); err != nil {
+		log.Printf("Failed to record channels of notification %s: %v", notification.ID, err)
+	}
+
+	return receipt, sendErr
+}
+
+// fallbackChain returns the channels a notification is sent through in
+// order: its own, then each channel of the policy the user has a contact
+// for and did not opt out of
+func (s *Service) fallbackChain(notification *models.Notification, policy *models.FallbackPolicy, preferences models.Preferences) []models.Recipient {
+	chain := []models.Recipient{{Type: notification.Type, Channel: notification.Channel}}
+	for _, notificationType := range policy.Channels {
+		channel := notification.Contacts[notificationType]
+		switch {
+		case notificationType == notification.Type:
+		case channel == "":
+			log.Printf("Notification %s cannot fall back to %s: no %s contact", notification.ID, notificationType, notificationType)
+		case !preferences.Allows(notification.Category, notificationType):
+			log.Printf("Notification %s cannot fall back to %s: the user opted out of %s notifications by %s",
+				notification.ID, notificationType, notification.Category, notificationType)
+		default:
+			chain = append(chain, models.Recipient{Type: notificationType, Channel: channel})
+		}
+	}
+	return chain
+}
+
+// resumeIndex returns the index of the channel of chain a notification is
+// sent through first: the one after the last channel it fell back from in
+// earlier attempts
+func resumeIndex(chain []models.Recipient, attempts []models.ChannelAttempt) int {
+	start := 0
+	for _, attempt := range attempts {
+		if attempt.Condition == "" {
+			continue
+		}
+		for i, recipient := range chain {
+			if recipient.Type == attempt.Type && recipient.Channel == attempt.Channel && i+1 > start {
+				start = i + 1
+			}
+		}
+	}
+	if start >= len(chain) {
+		start = len(chain) - 1
+	}
+	return start
+}
+
+// sendWithTimeout sends a notification, failing with ErrSendTimeout if it
+// takes longer than timeout. The send is cancelled through its context, but
+// a notifier that does not observe it may still deliver the notification
+// late. A timeout of 0 waits for the send.
+func (s *Service) sendWithTimeout(notification *models.Notification, timeout time.Duration) (models.Receipt, error) {
+	if timeout <= 0 {
+		return s.send(context.Background(), notification)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	type result struct {
+		receipt models.Receipt
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		receipt, err := s.send(ctx, notification)
+		done <- result{receipt, err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil && ctx.Err() != nil {
+			return res.receipt, fmt.Errorf("%w after %s: %v", ErrSendTimeout, timeout, res.err)
+		}
+		return res.receipt, res.err
+	case <-ctx.Done():
+		return models.Receipt{}, fmt.Errorf("%w after %s", ErrSendTimeout, timeout)
+	}
+}
+
+// fallbackCondition returns the fallback condition a send failure meets
+func fallbackCondition(err error) string {
+	if errors.Is(err, ErrSendTimeout) {
+		return models.FallbackOnTimeout
+	}
+	if models.IsPermanent(err) {
+		return models.FallbackOnPermanent
+	}
+	return models.FallbackOnTransient
+}
@@ -0,0 +1,190 @@
+package notifications
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/models"
+)
+
+func TestResumeIndex(t *testing.T) {
+	email := models.Recipient{Type: models.NotificationTypeEmail, Channel: "user@example.com"}
+	telegram := models.Recipient{Type: models.NotificationTypeTelegram, Channel: "12345"}
+	sms := models.Recipient{Type: "sms", Channel: "+15550100"}
+	chain := []models.Recipient{email, telegram, sms}
+
+	fellBack := func(r models.Recipient) models.ChannelAttempt {
+		return models.ChannelAttempt{Type: r.Type, Channel: r.Channel, Condition: models.FallbackOnPermanent}
+	}
+	stopped := func(r models.Recipient) models.ChannelAttempt {
+		return models.ChannelAttempt{Type: r.Type, Channel: r.Channel, Error: "provider unavailable"}
+	}
+
+	tests := []struct {
+		name     string
+		chain    []models.Recipient
+		attempts []models.ChannelAttempt
+		want     int
+	}{
+		{name: "first attempt", chain: chain, want: 0},
+		{name: "stopped at the first channel", chain: chain, attempts: []models.ChannelAttempt{stopped(email)}, want: 0},
+		{name: "stopped partway", chain: chain, attempts: []models.ChannelAttempt{fellBack(email), stopped(telegram)}, want: 1},
+		{name: "over several attempts", chain: chain, attempts: []models.ChannelAttempt{fellBack(email), stopped(telegram), fellBack(telegram), stopped(sms)}, want: 2},
+		{
+			name:     "channel no longer in the chain",
+			chain:    []models.Recipient{email, sms},
+			attempts: []models.ChannelAttempt{fellBack(email), fellBack(telegram)},
+			want:     1,
+		},
+		{
+			name:     "past the end of a shorter chain",
+			chain:    []models.Recipient{email, telegram},
+			attempts: []models.ChannelAttempt{fellBack(email), fellBack(telegram)},
+			want:     1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resumeIndex(tt.chain, tt.attempts); got != tt.want {
+				t.Errorf("resumeIndex = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// fallbackService is a service sending email and Telegram through fake
+// notifiers, where email falls back to Telegram
+type fallbackService struct {
+	service  *Service
+	store    *MemoryStore
+	email    *fakeNotifier
+	telegram *fakeNotifier
+}
+
+func newFallbackService() *fallbackService {
+	f := &fallbackService{store: NewMemoryStore(), email: newFakeNotifier(), telegram: newFakeNotifier()}
+	notifiers := NewRegistry()
+	notifiers.Register(models.NotificationTypeEmail, f.email)
+	notifiers.Register(models.NotificationTypeTelegram, f.telegram)
+	f.service = NewService(&config.Config{}, f.store, notifiers, nil, nil, nil)
+	return f
+}
+
+// attempt processes the given attempt of an email message falling back to
+// Telegram under policy, retrying notificationID unless it is empty
+func (f *fallbackService) attempt(t *testing.T, policy *models.FallbackPolicy, notificationID string, attempt int) (*models.Notification, models.NotificationStatus, error) {
+	t.Helper()
+
+	env := &models.Envelope{
+		Message: &models.KafkaNotificationMessage{
+			UserID:   "user-1",
+			Type:     models.NotificationTypeEmail,
+			Channel:  "user@example.com",
+			Content:  "Hello",
+			Contacts: map[models.NotificationType]string{models.NotificationTypeTelegram: "12345"},
+			Fallback: policy,
+		},
+		NotificationID: notificationID,
+		Attempt:        attempt,
+		MaxAttempts:    3,
+	}
+	status, err := f.service.process(env)
+
+	n, getErr := f.store.GetNotification(env.NotificationID)
+	if getErr != nil {
+		t.Fatalf("GetNotification: %v", getErr)
+	}
+	return n, status, err
+}
+
+func TestFallbackStopsOnTransientErrors(t *testing.T) {
+	f := newFallbackService()
+	f.email.fail("Hello", errors.New("provider unavailable"))
+	policy := &models.FallbackPolicy{Channels: []models.NotificationType{models.NotificationTypeTelegram}}
+
+	// Transient errors do not fall back by default, the notification is
+	// retried on the same channel instead
+	n, status, err := f.attempt(t, policy, "", 1)
+	if status != models.NotificationStatusRetrying || err == nil {
+		t.Fatalf("first attempt = %s, %v, want retrying", status, err)
+	}
+	if len(n.ChannelAttempts) != 1 || n.ChannelAttempts[0].Condition != "" {
+		t.Errorf("channel attempts = %+v, want email without falling back", n.ChannelAttempts)
+	}
+	if f.telegram.calls() != 0 {
+		t.Errorf("%d Telegram sends, want none", f.telegram.calls())
+	}
+
+	n, status, err = f.attempt(t, policy, n.ID, 2)
+	if status != models.NotificationStatusSent || err != nil {
+		t.Fatalf("second attempt = %s, %v, want sent", status, err)
+	}
+	if n.SentType != models.NotificationTypeEmail || len(n.ChannelAttempts) != 2 {
+		t.Errorf("notification sent by %s after %+v, want email on the second attempt", n.SentType, n.ChannelAttempts)
+	}
+}
+
+func TestFallbackOnPermanentErrors(t *testing.T) {
+	f := newFallbackService()
+	f.email.fail("Hello", models.NewPermanentError(errors.New("mailbox does not exist")))
+	policy := &models.FallbackPolicy{Channels: []models.NotificationType{models.NotificationTypeTelegram}}
+
+	n, status, err := f.attempt(t, policy, "", 1)
+	if status != models.NotificationStatusSent || err != nil {
+		t.Fatalf("attempt = %s, %v, want sent", status, err)
+	}
+	if len(n.ChannelAttempts) != 2 || n.ChannelAttempts[0].Condition != models.FallbackOnPermanent {
+		t.Errorf("channel attempts = %+v, want email falling back on a permanent error", n.ChannelAttempts)
+	}
+	if n.SentType != models.NotificationTypeTelegram || n.SentChannel != "12345" {
+		t.Errorf("sent to %s %s, want Telegram 12345", n.SentType, n.SentChannel)
+	}
+}
+
+func TestFallbackOnTimeout(t *testing.T) {
+	f := newFallbackService()
+	f.email.onSend = func(notification *models.Notification) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	policy := &models.FallbackPolicy{Channels: []models.NotificationType{models.NotificationTypeTelegram}, Timeout: "10ms"}
+
+	n, status, err := f.attempt(t, policy, "", 1)
+	if status != models.NotificationStatusSent || err != nil {
+		t.Fatalf("attempt = %s, %v, want sent", status, err)
+	}
+	if len(n.ChannelAttempts) != 2 || n.ChannelAttempts[0].Condition != models.FallbackOnTimeout {
+		t.Fatalf("channel attempts = %+v, want email falling back on a timeout", n.ChannelAttempts)
+	}
+	if n.SentType != models.NotificationTypeTelegram {
+		t.Errorf("sent by %s, want Telegram", n.SentType)
+	}
+}
+
+func TestFallbackRetryResumesPartway(t *testing.T) {
+	f := newFallbackService()
+	f.email.fail("Hello", models.NewPermanentError(errors.New("mailbox does not exist")))
+	f.telegram.fail("Hello", errors.New("provider unavailable"))
+	policy := &models.FallbackPolicy{Channels: []models.NotificationType{models.NotificationTypeTelegram}}
+
+	n, status, _ := f.attempt(t, policy, "", 1)
+	if status != models.NotificationStatusRetrying {
+		t.Fatalf("first attempt = %s, want retrying", status)
+	}
+
+	// The retry goes on from Telegram rather than sending email again
+	n, status, err := f.attempt(t, policy, n.ID, 2)
+	if status != models.NotificationStatusSent || err != nil {
+		t.Fatalf("second attempt = %s, %v, want sent", status, err)
+	}
+	if f.email.calls() != 1 || f.telegram.calls() != 2 {
+		t.Errorf("%d email and %d Telegram sends, want 1 and 2", f.email.calls(), f.telegram.calls())
+	}
+	if len(n.ChannelAttempts) != 3 || n.ChannelAttempts[2].Type != models.NotificationTypeTelegram || n.ChannelAttempts[2].Attempt != 2 {
+		t.Errorf("channel attempts = %+v, want Telegram on the second attempt", n.ChannelAttempts)
+	}
+	if n.SentType != models.NotificationTypeTelegram {
+		t.Errorf("sent by %s, want Telegram", n.SentType)
+	}
+}
@@ -0,0 +1,148 @@
+package notifications
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/notification_service/internal/models"
+)
+
+// fanOut sends a multi-channel notification to all of its recipients
+// concurrently, through a delivery per recipient created on the first
+// attempt. Later attempts only send the deliveries that are still pending or
+// retrying. Deliveries through types the user opted out of are suppressed.
+// The notification's status aggregates those of its deliveries, and is
+// returned along with a *models.DeliveryError unless all of the deliveries
+// that were not suppressed were sent. The error is permanent once none of
+// them will be retried.
+func (s *Service) fanOut(env *models.Envelope, notification *models.Notification, preferences models.Preferences) (models.NotificationStatus, error) {
+	attempt := notification.Attempts
+
+	deliveries, err := s.deliveries(notification)
+	if err != nil {
+		log.Printf("Failed to prepare deliveries of notification %s: %v", notification.ID, err)
+		return s.finish(notification, sendStatus(err, attempt, env.MaxAttempts), err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		if delivery.Status != models.NotificationStatusPending && delivery.Status != models.NotificationStatusRetrying {
+			continue
+		}
+		if reason := suppressionReason(preferences, notification.Category, delivery.Type); reason != "" {
+			s.suppressDelivery(notification, delivery, reason)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.deliver(notification, delivery, attempt, env.MaxAttempts)
+		}()
+	}
+	wg.Wait()
+
+	notification.Deliveries = deliveries
+	status := models.AggregateStatus(deliveries)
+	switch status {
+	case models.NotificationStatusSent:
+		sent := 0
+		for _, delivery := range deliveries {
+			if delivery.Status == models.NotificationStatusSent {
+				sent++
+			}
+		}
+		log.Printf("Notification %s sent to all %d recipients the user did not opt out of", notification.ID, sent)
+		return s.finish(notification, status, nil)
+	case models.NotificationStatusSuppressed:
+		types := make([]models.NotificationType, len(deliveries))
+		for i, delivery := range deliveries {
+			types[i] = delivery.Type
+		}
+		return s.suppress(notification, suppressionReason(preferences, notification.Category, types...)), nil
+	}
+
+	deliveryErr := &models.DeliveryError{}
+	for _, delivery := range deliveries {
+		switch delivery.Status {
+		case models.NotificationStatusSent:
+			deliveryErr.Sent++
+		case models.NotificationStatusSuppressed:
+		default:
+			deliveryErr.Unsent = append(deliveryErr.Unsent, delivery)
+		}
+	}
+
+	var sendErr error = deliveryErr
+	if status == models.NotificationStatusRetrying {
+		log.Printf("Failed to send notification %s, will retry: %v", notification.ID, sendErr)
+	} else {
+		log.Printf("Failed to send notification %s: %v", notification.ID, sendErr)
+		sendErr = models.NewPermanentError(sendErr)
+	}
+
+	return s.finish(notification, status, sendErr)
+}
+
+// suppressDelivery records that a delivery of a multi-channel notification
+// was not sent because the user opted out of its type
+func (s *Service) suppressDelivery(notification *models.Notification, delivery *models.Delivery, reason string) {
+	log.Printf("Delivery of notification %s to %s %s suppressed: %s", notification.ID, delivery.Type, delivery.Channel, reason)
+
+	delivery.Status = models.NotificationStatusSuppressed
+	delivery.Error, delivery.ErrorClass = "", ""
+	delivery.SuppressionReason = reason
+	if err := s.store.UpdateDelivery(delivery); err != nil {
+		log.Printf("Failed to update delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// deliveries returns the deliveries of a multi-channel notification,
+// creating a pending one per recipient if there are none yet
+func (s *Service) deliveries(notification *models.Notification) ([]models.Delivery, error) {
+	deliveries, err := s.store.ListDeliveries(notification.ID)
+	if err != nil || len(deliveries) > 0 {
+		return deliveries, err
+	}
+
+	deliveries = make([]models.Delivery, len(notification.Recipients))
+	for i, recipient := range notification.Recipients {
+		deliveries[i] = models.Delivery{
+			NotificationID: notification.ID,
+			Type:           recipient.Type,
+			Channel:        recipient.Channel,
+			Status:         models.NotificationStatusPending,
+		}
+	}
+	return s.store.InsertDeliveries(deliveries)
+}
+
+// deliver sends a multi-channel notification to the recipient of one of its
+// deliveries, and records the outcome on the delivery. Transient failures are
+// retried with the notification, until its last attempt.
+func (s *Service) deliver(notification *models.Notification, delivery *models.Delivery, attempt, maxAttempts int) {
+	single := *notification
+	single.Type, single.Channel = delivery.Type, delivery.Channel
+	single.Recipients, single.Deliveries = nil, nil
+
+	receipt, err := s.send(context.Background(), &single)
+
+	delivery.Attempts++
+	delivery.Status = sendStatus(err, attempt, maxAttempts)
+	delivery.Notifier, delivery.MessageID = receipt.Notifier, receipt.MessageID
+	delivery.Error, delivery.ErrorClass = "", ""
+	if err != nil {
+		log.Printf("Failed to send notification %s to %s %s: %v", notification.ID, delivery.Type, delivery.Channel, err)
+		delivery.Error = err.Error()
+		delivery.ErrorClass = errorClass(err)
+	} else {
+		log.Printf("Notification %s sent to %s %s via %s (message ID %q)",
+			notification.ID, delivery.Type, delivery.Channel, receipt.Notifier, receipt.MessageID)
+	}
+
+	if err := s.store.UpdateDelivery(delivery); err != nil {
+		log.Printf("Failed to update delivery %s: %v", delivery.ID, err)
+	}
+}
@@ -0,0 +1,128 @@
+package notifications
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/models"
+)
+
+// fanOutService is a service sending email and Telegram through fake notifiers
+type fanOutService struct {
+	service  *Service
+	store    *MemoryStore
+	email    *fakeNotifier
+	telegram *fakeNotifier
+}
+
+func newFanOutService() *fanOutService {
+	f := &fanOutService{store: NewMemoryStore(), email: newFakeNotifier(), telegram: newFakeNotifier()}
+	notifiers := NewRegistry()
+	notifiers.Register(models.NotificationTypeEmail, f.email)
+	notifiers.Register(models.NotificationTypeTelegram, f.telegram)
+	f.service = NewService(&config.Config{}, f.store, notifiers, nil, nil, nil)
+	return f
+}
+
+// attempt processes the given attempt of a message to an email and a
+// Telegram recipient, retrying notificationID unless it is empty
+func (f *fanOutService) attempt(notificationID string, attempt, maxAttempts int) (*models.Envelope, models.NotificationStatus, error) {
+	env := &models.Envelope{
+		Message: &models.KafkaNotificationMessage{
+			UserID:  "user-1",
+			Content: "Hello",
+			Recipients: []models.Recipient{
+				{Type: models.NotificationTypeEmail, Channel: "user@example.com"},
+				{Type: models.NotificationTypeTelegram, Channel: "12345"},
+			},
+		},
+		NotificationID: notificationID,
+		Attempt:        attempt,
+		MaxAttempts:    maxAttempts,
+	}
+	status, err := f.service.process(env)
+	return env, status, err
+}
+
+// deliveries returns the deliveries of a notification by type
+func (f *fanOutService) deliveries(t *testing.T, notificationID string) map[models.NotificationType]models.Delivery {
+	t.Helper()
+
+	deliveries, err := f.store.ListDeliveries(notificationID)
+	if err != nil {
+		t.Fatalf("ListDeliveries: %v", err)
+	}
+	byType := make(map[models.NotificationType]models.Delivery, len(deliveries))
+	for _, delivery := range deliveries {
+		byType[delivery.Type] = delivery
+	}
+	return byType
+}
+
+func TestFanOutRetriesOnlyUnsentDeliveries(t *testing.T) {
+	f := newFanOutService()
+	f.telegram.fail("Hello", errors.New("provider unavailable"))
+
+	env, status, err := f.attempt("", 1, 3)
+	if status != models.NotificationStatusRetrying || err == nil || models.IsPermanent(err) {
+		t.Fatalf("first attempt = %s, %v, want retrying with a transient error", status, err)
+	}
+	var deliveryErr *models.DeliveryError
+	if !errors.As(err, &deliveryErr) || deliveryErr.Sent != 1 || len(deliveryErr.Unsent) != 1 {
+		t.Errorf("error = %v, want one delivery sent and one unsent", err)
+	}
+	deliveries := f.deliveries(t, env.NotificationID)
+	if d := deliveries[models.NotificationTypeEmail]; d.Status != models.NotificationStatusSent || d.Attempts != 1 {
+		t.Errorf("email delivery = %+v, want sent on the first attempt", d)
+	}
+	if d := deliveries[models.NotificationTypeTelegram]; d.Status != models.NotificationStatusRetrying || d.Attempts != 1 || d.Error == "" {
+		t.Errorf("telegram delivery = %+v, want retrying with the error", d)
+	}
+
+	// The retry only sends the delivery that failed
+	_, status, err = f.attempt(env.NotificationID, 2, 3)
+	if status != models.NotificationStatusSent || err != nil {
+		t.Fatalf("second attempt = %s, %v, want sent", status, err)
+	}
+	deliveries = f.deliveries(t, env.NotificationID)
+	if d := deliveries[models.NotificationTypeEmail]; d.Attempts != 1 {
+		t.Errorf("email delivery sent %d times, want once", d.Attempts)
+	}
+	if d := deliveries[models.NotificationTypeTelegram]; d.Status != models.NotificationStatusSent || d.Attempts != 2 || d.Error != "" {
+		t.Errorf("telegram delivery = %+v, want sent on the second attempt", d)
+	}
+	if f.email.calls() != 1 || f.telegram.calls() != 2 {
+		t.Errorf("%d email and %d Telegram sends, want 1 and 2", f.email.calls(), f.telegram.calls())
+	}
+
+	n, err := f.service.GetNotification(env.NotificationID)
+	if err != nil {
+		t.Fatalf("GetNotification: %v", err)
+	}
+	if n.Status != models.NotificationStatusSent || len(n.Deliveries) != 2 {
+		t.Errorf("notification = %+v, want sent with both deliveries", n)
+	}
+}
+
+func TestFanOutPartiallySentOnTheLastAttempt(t *testing.T) {
+	f := newFanOutService()
+	unavailable := errors.New("provider unavailable")
+	f.telegram.fail("Hello", unavailable, unavailable)
+
+	env, status, _ := f.attempt("", 1, 2)
+	if status != models.NotificationStatusRetrying {
+		t.Fatalf("first attempt = %s, want retrying", status)
+	}
+
+	_, status, err := f.attempt(env.NotificationID, 2, 2)
+	if status != models.NotificationStatusPartiallySent || !models.IsPermanent(err) {
+		t.Errorf("last attempt = %s, %v, want partially sent with a permanent error", status, err)
+	}
+	if d := f.deliveries(t, env.NotificationID)[models.NotificationTypeTelegram]; d.Status != models.NotificationStatusFailed || d.Attempts != 2 {
+		t.Errorf("telegram delivery = %+v, want failed after 2 attempts", d)
+	}
+	if f.email.calls() != 1 {
+		t.Errorf("%d email sends, want 1", f.email.calls())
+	}
+}
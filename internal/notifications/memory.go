@@ -0,0 +1,346 @@
+package notifications
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/notification_service/internal/models"
+	"github.com/notification_service/internal/supabase"
+)
+
+// MemoryStore is a Store that keeps notifications in memory, so that the
+// pipeline can run without Supabase, e.g. in tests. Stored rows are copied in
+// and out, so callers cannot change them without going through the store.
+type MemoryStore struct {
+	mu            sync.Mutex
+	nextID        int
+	notifications map[string]*models.Notification
+	deliveries    map[string][]models.Delivery
+	audit         []models.AuditEntry
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		notifications: make(map[string]*models.Notification),
+		deliveries:    make(map[string][]models.Delivery),
+	}
+}
+
+// newID returns a new row ID. m.mu must be held.
+func (m *MemoryStore) newID() string {
+	m.nextID++
+	return strconv.Itoa(m.nextID)
+}
+
+// InsertNotification stores a notification and returns its ID
+func (m *MemoryStore) InsertNotification(notification *models.Notification) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if notification.Status == "" {
+		notification.Status = models.NotificationStatusPending
+	}
+	now := time.Now()
+	notification.CreatedAt = now
+	notification.UpdatedAt = now
+
+	stored := cloneNotification(notification)
+	stored.ID = m.newID()
+	stored.Deliveries = nil
+	m.notifications[stored.ID] = stored
+	return stored.ID, nil
+}
+
+// GetNotification returns a notification by ID
+func (m *MemoryStore) GetNotification(id string) (*models.Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	notification, ok := m.notifications[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", supabase.ErrNotFound, id)
+	}
+	return cloneNotification(notification), nil
+}
+
+// ListNotifications returns a page of the notifications matching a query,
+// ordered by creation time and then by ID
+func (m *MemoryStore) ListNotifications(query *models.NotificationQuery) (*models.NotificationPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ascending := query.Order == models.SortAscending
+	var matching []*models.Notification
+	for _, notification := range m.notifications {
+		if matchesFilter(notification, &query.Filter) {
+			matching = append(matching, notification)
+		}
+	}
+	// listedBefore reports whether a comes before b in the listing
+	listedBefore := func(a, b *models.Notification) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt) == ascending
+		}
+		return (a.ID < b.ID) == ascending
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		return listedBefore(matching[i], matching[j])
+	})
+
+	// Cursors are those of the Supabase store, so the page continues after
+	// the notification the cursor was made from, even if it no longer
+	// matches the filter
+	start := 0
+	if query.Cursor != "" {
+		var after *models.Notification
+		for _, notification := range m.notifications {
+			if supabase.CursorAfter(notification, query.Order) == query.Cursor {
+				after = notification
+				break
+			}
+		}
+		if after == nil {
+			return nil, supabase.ErrInvalidCursor
+		}
+		start = sort.Search(len(matching), func(i int) bool {
+			return listedBefore(after, matching[i])
+		})
+	}
+
+	page := &models.NotificationPage{Notifications: []models.Notification{}}
+	for _, notification := range matching[start:] {
+		if len(page.Notifications) == query.Limit {
+			last := &page.Notifications[len(page.Notifications)-1]
+			page.NextCursor = supabase.CursorAfter(last, query.Order)
+			break
+		}
+		page.Notifications = append(page.Notifications, *cloneNotification(notification))
+	}
+	return page, nil
+}
+
+// matchesFilter reports whether a notification matches a filter
+func matchesFilter(n *models.Notification, f *models.NotificationFilter) bool {
+	if len(f.UserIDs) > 0 && !contains(f.UserIDs, n.UserID) {
+		return false
+	}
+	if f.Type != "" && n.Type != f.Type {
+		return false
+	}
+	if len(f.Statuses) > 0 && !contains(f.Statuses, n.Status) {
+		return false
+	}
+	if len(f.ErrorClasses) > 0 && !contains(f.ErrorClasses, n.ErrorClass) {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && n.CreatedAt.Before(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !n.CreatedAt.Before(f.CreatedBefore) {
+		return false
+	}
+	for key, value := range f.Metadata {
+		v, ok := n.Metadata[key]
+		if !ok || fmt.Sprint(v) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// contains reports whether values contains value
+func contains[T comparable](values []T, value T) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateNotificationStatus sets the status of a pending or retrying
+// notification and the error that caused it, and reports whether it was
+// pending or retrying
+func (m *MemoryStore) UpdateNotificationStatus(id string, status models.NotificationStatus, errMsg, errClass string) (bool, error) {
+	return m.updateSending(id, func(n *models.Notification) {
+		n.Status = status
+		n.Error, n.ErrorClass = errMsg, ""
+		if errMsg != "" {
+			n.ErrorClass = errClass
+		}
+		if status == models.NotificationStatusSent {
+			sentAt := time.Now()
+			n.SentAt = &sentAt
+		}
+	})
+}
+
+// UpdateNotificationAttempts records the delivery attempt a notification is on
+func (m *MemoryStore) UpdateNotificationAttempts(id string, attempts int) error {
+	return m.update(id, func(n *models.Notification) {
+		n.Attempts = attempts
+	})
+}
+
+// UpdateNotificationChannels records the channels a notification was sent
+// through, and the one it reached
+func (m *MemoryStore) UpdateNotificationChannels(id string, attempts []models.ChannelAttempt, sentType models.NotificationType, sentChannel string) error {
+	return m.update(id, func(n *models.Notification) {
+		n.ChannelAttempts = append([]models.ChannelAttempt(nil), attempts...)
+		n.SentType, n.SentChannel = "", ""
+		if sentChannel != "" {
+			n.SentType, n.SentChannel = sentType, sentChannel
+		}
+	})
+}
+
+// SuppressNotification marks a pending or retrying notification suppressed,
+// and reports whether it was pending or retrying
+func (m *MemoryStore) SuppressNotification(id, reason string) (bool, error) {
+	return m.updateSending(id, func(n *models.Notification) {
+		n.Status = models.NotificationStatusSuppressed
+		n.SuppressionReason = reason
+		n.Error, n.ErrorClass = "", ""
+	})
+}
+
+// updateSending applies fn to a stored notification if it is pending or
+// retrying, and reports whether it was
+func (m *MemoryStore) updateSending(id string, fn func(n *models.Notification)) (bool, error) {
+	updated := false
+	err := m.update(id, func(n *models.Notification) {
+		if n.Status == models.NotificationStatusPending || n.Status == models.NotificationStatusRetrying {
+			fn(n)
+			updated = true
+		}
+	})
+	return updated, err
+}
+
+// TransitionNotificationStatus sets the status of a notification only if it
+// has one of the from statuses. It returns the updated notification, or nil
+// if the notification does not exist or has another status.
+func (m *MemoryStore) TransitionNotificationStatus(id string, from []models.NotificationStatus, to models.NotificationStatus) (*models.Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.notifications[id]
+	if !ok || !contains(from, n.Status) {
+		return nil, nil
+	}
+	n.Status = to
+	n.UpdatedAt = time.Now()
+	return cloneNotification(n), nil
+}
+
+// update applies fn to a stored notification
+func (m *MemoryStore) update(id string, fn func(n *models.Notification)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.notifications[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", supabase.ErrNotFound, id)
+	}
+	fn(n)
+	n.UpdatedAt = time.Now()
+	return nil
+}
+
+// InsertAuditEntry records an operation performed on a notification
+func (m *MemoryStore) InsertAuditEntry(entry *models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry.CreatedAt = time.Now()
+	stored := *entry
+	stored.ID = m.newID()
+	m.audit = append(m.audit, stored)
+	return nil
+}
+
+// AuditEntries returns the audit entries of a notification, oldest first
+func (m *MemoryStore) AuditEntries(notificationID string) []models.AuditEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var entries []models.AuditEntry
+	for _, entry := range m.audit {
+		if entry.NotificationID == notificationID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// InsertDeliveries stores the deliveries of a multi-channel notification and
+// returns them with their IDs
+func (m *MemoryStore) InsertDeliveries(deliveries []models.Delivery) ([]models.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	inserted := make([]models.Delivery, len(deliveries))
+	for i, delivery := range deliveries {
+		delivery.ID = m.newID()
+		delivery.CreatedAt, delivery.UpdatedAt = now, now
+		inserted[i] = delivery
+		m.deliveries[delivery.NotificationID] = append(m.deliveries[delivery.NotificationID], delivery)
+	}
+	return inserted, nil
+}
+
+// ListDeliveries returns the deliveries of a multi-channel notification
+func (m *MemoryStore) ListDeliveries(notificationID string) ([]models.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.Delivery(nil), m.deliveries[notificationID]...), nil
+}
+
+// UpdateDelivery records the outcome of an attempt to send a delivery
+func (m *MemoryStore) UpdateDelivery(delivery *models.Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deliveries := m.deliveries[delivery.NotificationID]
+	for i := range deliveries {
+		if deliveries[i].ID != delivery.ID {
+			continue
+		}
+
+		updated := *delivery
+		updated.UpdatedAt = time.Now()
+		if updated.Status == models.NotificationStatusSent {
+			updated.SentAt = &updated.UpdatedAt
+		}
+		deliveries[i] = updated
+		return nil
+	}
+	return fmt.Errorf("delivery %s not found", delivery.ID)
+}
+
+// cloneNotification copies a notification along with the slices and maps
+// that callers append to or modify
+func cloneNotification(n *models.Notification) *models.Notification {
+	clone := *n
+	clone.Recipients = append([]models.Recipient(nil), n.Recipients...)
+	clone.ChannelAttempts = append([]models.ChannelAttempt(nil), n.ChannelAttempts...)
+	clone.Deliveries = append([]models.Delivery(nil), n.Deliveries...)
+	if n.Metadata != nil {
+		clone.Metadata = make(map[string]interface{}, len(n.Metadata))
+		for k, v := range n.Metadata {
+			clone.Metadata[k] = v
+		}
+	}
+	if n.Contacts != nil {
+		clone.Contacts = make(map[models.NotificationType]string, len(n.Contacts))
+		for k, v := range n.Contacts {
+			clone.Contacts[k] = v
+		}
+	}
+	return &clone
+}
@@ -0,0 +1,91 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/notification_service/internal/models"
+)
+
+// Notifier sends notifications through one channel, such as email or
+// Telegram. Send returns a *models.PermanentError for failures that will not
+// succeed if retried.
+type Notifier interface {
+	// Name identifies the notifier, e.g. "sendgrid"
+	Name() string
+	// Capabilities describes what the notifier can deliver
+	Capabilities() models.Capabilities
+	// Send delivers a notification to its channel
+	Send(ctx context.Context, notification *models.Notification) (models.Receipt, error)
+}
+
+// NoNotifierError is returned when sending a notification of a type no
+// notifier is registered for
+type NoNotifierError struct {
+	Type models.NotificationType
+}
+
+// Error implements the error interface
+func (e *NoNotifierError) Error() string {
+	return fmt.Sprintf("no notifier registered for notification type %q", e.Type)
+}
+
+// Registry maps notification types to the notifiers sending them
+type Registry struct {
+	mu        sync.RWMutex
+	notifiers map[models.NotificationType]Notifier
+}
+
+// NewRegistry creates an empty notifier registry
+func NewRegistry() *Registry {
+	return &Registry{notifiers: make(map[models.NotificationType]Notifier)}
+}
+
+// Register makes notifier send the notifications of a type, replacing the
+// notifier registered for it before
+func (r *Registry) Register(notificationType models.NotificationType, notifier Notifier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifiers[notificationType] = notifier
+}
+
+// Lookup returns the notifier of a type, or a *NoNotifierError if none is
+// registered
+func (r *Registry) Lookup(notificationType models.NotificationType) (Notifier, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	notifier, ok := r.notifiers[notificationType]
+	if !ok {
+		return nil, &NoNotifierError{Type: notificationType}
+	}
+	return notifier, nil
+}
+
+// Types returns the notification types with a registered notifier, sorted
+func (r *Registry) Types() []models.NotificationType {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]models.NotificationType, 0, len(r.notifiers))
+	for notificationType := range r.notifiers {
+		types = append(types, notificationType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// Channels returns the notification types with a registered notifier, with
+// the capabilities of each
+func (r *Registry) Channels() models.Channels {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	channels := make(models.Channels, len(r.notifiers))
+	for notificationType, notifier := range r.notifiers {
+		channels[notificationType] = notifier.Capabilities()
+	}
+	return channels
+}
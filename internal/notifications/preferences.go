@@ -0,0 +1,67 @@
+package notifications
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/notification_service/internal/models"
+)
+
+// PreferenceStore reads the users' notification preferences
+type PreferenceStore interface {
+	ListPreferences(userID, category string) (models.Preferences, error)
+}
+
+// userPreferences returns the preferences of a notification's user for its
+// category. It returns nil, allowing every type, if preferences are
+// disabled or the category cannot be suppressed.
+func (s *Service) userPreferences(notification *models.Notification) (models.Preferences, error) {
+	if s.preferences == nil || s.requiredCategories[notification.Category] {
+		return nil, nil
+	}
+
+	preferences, err := s.preferences.ListPreferences(notification.UserID, notification.Category)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read preferences of user %s: %w", notification.UserID, err)
+	}
+	return preferences, nil
+}
+
+// suppressionReason returns why the preferences suppress a notification of
+// a category sent through a type, or an empty string if they allow it
+func suppressionReason(preferences models.Preferences, category string, types ...models.NotificationType) string {
+	for _, notificationType := range types {
+		if preferences.Allows(category, notificationType) {
+			return ""
+		}
+	}
+
+	names := make([]string, len(types))
+	for i, notificationType := range types {
+		names[i] = string(notificationType)
+	}
+	return fmt.Sprintf("user opted out of %s notifications by %s", category, strings.Join(names, ", "))
+}
+
+// suppress records that a notification was not sent because its user opted
+// out of it, publishes the status and returns it. A notification cancelled
+// meanwhile stays cancelled.
+func (s *Service) suppress(notification *models.Notification, reason string) models.NotificationStatus {
+	log.Printf("Notification %s suppressed: %s", notification.ID, reason)
+
+	updated, err := s.store.SuppressNotification(notification.ID, reason)
+	if err != nil {
+		log.Printf("Failed to update notification status: %v", err)
+	} else if !updated {
+		log.Printf("Notification %s was cancelled while being sent, not suppressing it", notification.ID)
+		notification.Status = models.NotificationStatusCancelled
+		return notification.Status
+	}
+
+	notification.Status = models.NotificationStatusSuppressed
+	notification.Error, notification.ErrorClass = "", ""
+	notification.SuppressionReason = reason
+	s.publishStatus(notification, nil)
+	return notification.Status
+}
@@ -0,0 +1,209 @@
+package notifications
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/models"
+)
+
+// fakePreferences serves the preferences of user-1 and counts lookups
+type fakePreferences struct {
+	preferences models.Preferences
+	lookups     int
+}
+
+func (p *fakePreferences) ListPreferences(userID, category string) (models.Preferences, error) {
+	p.lookups++
+	var matching models.Preferences
+	for _, preference := range p.preferences {
+		if preference.UserID == userID && preference.Category == category {
+			matching = append(matching, preference)
+		}
+	}
+	return matching, nil
+}
+
+// eventRecorder records the published status events
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []models.StatusEvent
+}
+
+func (r *eventRecorder) PublishStatus(event *models.StatusEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, *event)
+}
+
+// last returns the last published event
+func (r *eventRecorder) last(t *testing.T) models.StatusEvent {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.events) == 0 {
+		t.Fatal("no status event published")
+	}
+	return r.events[len(r.events)-1]
+}
+
+// preferencesService is a service sending email and Telegram through fake
+// notifiers, suppressing what the preferences opt out of
+type preferencesService struct {
+	service  *Service
+	store    *MemoryStore
+	email    *fakeNotifier
+	telegram *fakeNotifier
+	events   *eventRecorder
+}
+
+// newPreferencesService returns a service with preferences, never
+// suppressing the security category
+func newPreferencesService(preferences *fakePreferences) *preferencesService {
+	p := &preferencesService{
+		store:    NewMemoryStore(),
+		email:    newFakeNotifier(),
+		telegram: newFakeNotifier(),
+		events:   &eventRecorder{},
+	}
+	notifiers := NewRegistry()
+	notifiers.Register(models.NotificationTypeEmail, p.email)
+	notifiers.Register(models.NotificationTypeTelegram, p.telegram)
+
+	cfg := &config.Config{Preferences: config.PreferencesConfig{RequiredCategories: []string{models.CategorySecurity}}}
+	p.service = NewService(cfg, p.store, notifiers, nil, preferences, p.events)
+	return p
+}
+
+// process processes msg and returns the stored notification
+func (p *preferencesService) process(t *testing.T, msg *models.KafkaNotificationMessage) (*models.Notification, models.NotificationStatus, error) {
+	t.Helper()
+
+	env := &models.Envelope{Message: msg, MaxAttempts: 3}
+	status, err := p.service.process(env)
+	n, getErr := p.service.GetNotification(env.NotificationID)
+	if getErr != nil {
+		t.Fatalf("GetNotification: %v", getErr)
+	}
+	return n, status, err
+}
+
+// optedOut returns the preferences of user-1 opting out of category, through
+// notificationType only unless it is empty
+func optedOut(category string, notificationType models.NotificationType) *fakePreferences {
+	return &fakePreferences{preferences: models.Preferences{
+		{UserID: "user-1", Category: category, Type: notificationType, Enabled: false},
+	}}
+}
+
+// emailMessage returns an email message of category to user-1
+func emailMessage(category string) *models.KafkaNotificationMessage {
+	return &models.KafkaNotificationMessage{
+		UserID:   "user-1",
+		Type:     models.NotificationTypeEmail,
+		Channel:  "user@example.com",
+		Content:  "Hello",
+		Category: category,
+	}
+}
+
+func TestPreferencesSuppressOptedOutNotifications(t *testing.T) {
+	p := newPreferencesService(optedOut(models.CategoryMarketing, ""))
+
+	n, status, err := p.process(t, emailMessage(models.CategoryMarketing))
+	if status != models.NotificationStatusSuppressed || err != nil {
+		t.Fatalf("process = %s, %v, want suppressed without an error", status, err)
+	}
+	if p.email.calls() != 0 {
+		t.Errorf("%d email sends, want none", p.email.calls())
+	}
+
+	const reason = "user opted out of marketing notifications by email"
+	if n.Status != models.NotificationStatusSuppressed || n.SuppressionReason != reason {
+		t.Errorf("stored notification is %s for %q, want suppressed for %q", n.Status, n.SuppressionReason, reason)
+	}
+	event := p.events.last(t)
+	if event.NotificationID != n.ID || event.Status != models.NotificationStatusSuppressed || event.Reason != reason {
+		t.Errorf("published event = %+v, want %s suppressed for %q", event, n.ID, reason)
+	}
+}
+
+func TestPreferencesAllowOtherCategoriesAndTypes(t *testing.T) {
+	p := newPreferencesService(optedOut(models.CategoryMarketing, models.NotificationTypeTelegram))
+
+	for _, category := range []string{models.CategoryMarketing, models.CategoryTransactional} {
+		_, status, err := p.process(t, emailMessage(category))
+		if status != models.NotificationStatusSent || err != nil {
+			t.Errorf("%s email = %s, %v, want sent", category, status, err)
+		}
+	}
+	if p.email.calls() != 2 {
+		t.Errorf("%d email sends, want 2", p.email.calls())
+	}
+}
+
+func TestRequiredCategoriesBypassOptOut(t *testing.T) {
+	preferences := optedOut(models.CategorySecurity, "")
+	p := newPreferencesService(preferences)
+
+	n, status, err := p.process(t, emailMessage(models.CategorySecurity))
+	if status != models.NotificationStatusSent || err != nil {
+		t.Fatalf("process = %s, %v, want sent", status, err)
+	}
+	if n.SuppressionReason != "" || p.email.calls() != 1 {
+		t.Errorf("notification = %+v after %d sends, want sent once", n, p.email.calls())
+	}
+	if preferences.lookups != 0 {
+		t.Errorf("%d preference lookups for a required category, want none", preferences.lookups)
+	}
+}
+
+func TestPreferencesSuppressDeliveries(t *testing.T) {
+	msg := &models.KafkaNotificationMessage{
+		UserID:   "user-1",
+		Content:  "Hello",
+		Category: models.CategoryMarketing,
+		Recipients: []models.Recipient{
+			{Type: models.NotificationTypeEmail, Channel: "user@example.com"},
+			{Type: models.NotificationTypeTelegram, Channel: "12345"},
+		},
+	}
+
+	t.Run("some types", func(t *testing.T) {
+		p := newPreferencesService(optedOut(models.CategoryMarketing, models.NotificationTypeTelegram))
+
+		n, status, err := p.process(t, msg)
+		if status != models.NotificationStatusSent || err != nil {
+			t.Fatalf("process = %s, %v, want sent to the email recipient", status, err)
+		}
+		for _, d := range n.Deliveries {
+			want := models.NotificationStatusSent
+			if d.Type == models.NotificationTypeTelegram {
+				want = models.NotificationStatusSuppressed
+			}
+			if d.Status != want {
+				t.Errorf("%s delivery is %s, want %s", d.Type, d.Status, want)
+			}
+		}
+		if p.telegram.calls() != 0 {
+			t.Errorf("%d Telegram sends, want none", p.telegram.calls())
+		}
+	})
+
+	t.Run("all types", func(t *testing.T) {
+		p := newPreferencesService(optedOut(models.CategoryMarketing, ""))
+
+		n, status, err := p.process(t, msg)
+		if status != models.NotificationStatusSuppressed || err != nil {
+			t.Fatalf("process = %s, %v, want suppressed", status, err)
+		}
+		const reason = "user opted out of marketing notifications by email, telegram"
+		if n.SuppressionReason != reason {
+			t.Errorf("reason = %q, want %q", n.SuppressionReason, reason)
+		}
+		if event := p.events.last(t); event.Status != models.NotificationStatusSuppressed || event.Reason != reason {
+			t.Errorf("published event = %+v, want suppressed for %q", event, reason)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package notifications
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/notification_service/internal/models"
+)
+
+// ContactResolver looks up the verified addresses of users by notification
+// type
+type ContactResolver interface {
+	Contacts(userID string) (map[models.NotificationType]string, error)
+}
+
+// validate resolves the channels a message omits from the user's contacts,
+// recording them in env.Resolved, and validates the message. It returns a *models.ValidationError if the message is
+// invalid or a channel cannot be resolved, and another error if the contacts
+// cannot be looked up.
+func (s *Service) validate(env *models.Envelope) error {
+	msg := env.Message
+	unresolved, err := s.resolve(env)
+	if err != nil {
+		return err
+	}
+
+	err = msg.Validate(s.notifiers.Channels())
+	if len(unresolved) == 0 {
+		return err
+	}
+
+	// Report the unresolved channels instead of their being required
+	v := &models.ValidationError{Errors: unresolved}
+	reported := make(map[string]bool, len(unresolved))
+	for _, fe := range unresolved {
+		reported[fe.Field] = true
+	}
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		for _, fe := range validationErr.Errors {
+			if !reported[fe.Field] {
+				v.Errors = append(v.Errors, fe)
+			}
+		}
+	}
+	return v
+}
+
+// resolve fills in the channels a message omits, for its type or each of its
+// recipients, and the contacts of the channels it may fall back to, from the
+// user's contacts, and records the fields it filled in env.Resolved. It
+// returns an error per channel the user has no contact for. If the contacts
+// cannot be looked up, an error is returned unless they were only needed for
+// fallbacks.
+func (s *Service) resolve(env *models.Envelope) ([]models.FieldError, error) {
+	msg := env.Message
+	env.Resolved = nil
+	if s.contacts == nil || msg.UserID == "" {
+		return nil, nil
+	}
+
+	required := len(msg.Recipients) == 0 && msg.Type != "" && msg.Channel == ""
+	for _, recipient := range msg.Recipients {
+		required = required || (recipient.Type != "" && recipient.Channel == "")
+	}
+
+	var fallbacks []models.NotificationType
+	if len(msg.Recipients) == 0 {
+		policy := msg.Fallback
+		if policy == nil {
+			policy = s.fallbacks[msg.Type]
+		}
+		if policy != nil {
+			for _, notificationType := range policy.Channels {
+				if notificationType != msg.Type && msg.Contacts[notificationType] == "" {
+					fallbacks = append(fallbacks, notificationType)
+				}
+			}
+		}
+	}
+
+	if !required && len(fallbacks) == 0 {
+		return nil, nil
+	}
+
+	contacts, err := s.contacts.Contacts(msg.UserID)
+	if err != nil {
+		if required {
+			return nil, fmt.Errorf("failed to resolve recipients: %w", err)
+		}
+		log.Printf("Failed to resolve fallback contacts of user %s, sending without them: %v", msg.UserID, err)
+		return nil, nil
+	}
+
+	var unresolved []models.FieldError
+	resolveChannel := func(field string, notificationType models.NotificationType, channel *string) {
+		if *channel != "" || notificationType == "" {
+			return
+		}
+		if *channel = contacts[notificationType]; *channel != "" {
+			env.Resolved = append(env.Resolved, field)
+		} else {
+			unresolved = append(unresolved, models.FieldError{
+				Field:   field,
+				Code:    models.ValidationCodeUnresolved,
+				Message: fmt.Sprintf("user %s has no verified %s contact", msg.UserID, notificationType),
+			})
+		}
+	}
+
+	if len(msg.Recipients) == 0 {
+		resolveChannel("channel", msg.Type, &msg.Channel)
+	}
+	for i := range msg.Recipients {
+		resolveChannel(fmt.Sprintf("recipients[%d].channel", i), msg.Recipients[i].Type, &msg.Recipients[i].Channel)
+	}
+
+	for _, notificationType := range fallbacks {
+		if channel := contacts[notificationType]; channel != "" {
+			if msg.Contacts == nil {
+				msg.Contacts = make(map[models.NotificationType]string)
+			}
+			msg.Contacts[notificationType] = channel
+			env.Resolved = append(env.Resolved, "contacts."+string(notificationType))
+		}
+	}
+
+	return unresolved, nil
+}
@@ -0,0 +1,119 @@
+package notifications
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/contacts"
+	"github.com/notification_service/internal/models"
+)
+
+// failingContacts fails every lookup
+type failingContacts struct{}
+
+func (failingContacts) Contacts(userID string) (map[models.NotificationType]string, error) {
+	return nil, errors.New("contacts unavailable")
+}
+
+// newResolvingService returns a service sending email and Telegram that
+// resolves channels from resolver
+func newResolvingService(resolver ContactResolver) *Service {
+	notifiers := NewRegistry()
+	notifiers.Register(models.NotificationTypeEmail, newFakeNotifier())
+	notifiers.Register(models.NotificationTypeTelegram, newFakeNotifier())
+	return NewService(&config.Config{}, NewMemoryStore(), notifiers, resolver, nil, nil)
+}
+
+func TestValidateResolvesChannels(t *testing.T) {
+	directory := contacts.NewMemory()
+	directory.Set("user-1", models.NotificationTypeEmail, "user@example.com")
+	directory.Set("user-1", models.NotificationTypeTelegram, "12345")
+	service := newResolvingService(directory)
+
+	env := &models.Envelope{Message: &models.KafkaNotificationMessage{
+		UserID:     "user-1",
+		Content:    "Hello",
+		Recipients: []models.Recipient{{Type: models.NotificationTypeEmail, Channel: "other@example.com"}, {Type: models.NotificationTypeTelegram}},
+	}}
+	if err := service.validate(env); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if got := env.Message.Recipients[1].Channel; got != "12345" {
+		t.Errorf("telegram channel = %q, want 12345", got)
+	}
+	if got := env.Message.Recipients[0].Channel; got != "other@example.com" {
+		t.Errorf("email channel = %q, want the given other@example.com", got)
+	}
+	if want := []string{"recipients[1].channel"}; !reflect.DeepEqual(env.Resolved, want) {
+		t.Errorf("resolved = %v, want %v", env.Resolved, want)
+	}
+
+	unresolved := env.Message.WithoutChannels(env.Resolved)
+	if unresolved.Recipients[1].Channel != "" || unresolved.Recipients[0].Channel != "other@example.com" {
+		t.Errorf("recipients without resolved channels = %+v", unresolved.Recipients)
+	}
+	if env.Message.Recipients[1].Channel != "12345" {
+		t.Error("WithoutChannels modified the message")
+	}
+}
+
+func TestValidateReportsUnresolvedChannels(t *testing.T) {
+	directory := contacts.NewMemory()
+	directory.Set("user-1", models.NotificationTypeEmail, "user@example.com")
+	service := newResolvingService(directory)
+
+	env := &models.Envelope{Message: &models.KafkaNotificationMessage{
+		UserID:  "unknown",
+		Type:    models.NotificationTypeEmail,
+		Content: "Hello",
+	}}
+	err := service.validate(env)
+	var validationErr *models.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("err = %v, want a validation error", err)
+	}
+	if len(validationErr.Errors) != 1 || validationErr.Errors[0].Code != models.ValidationCodeUnresolved {
+		t.Errorf("errors = %+v, want the channel unresolved", validationErr.Errors)
+	}
+	if len(env.Resolved) != 0 {
+		t.Errorf("resolved = %v, want none", env.Resolved)
+	}
+}
+
+func TestValidateResolvesFallbackContacts(t *testing.T) {
+	directory := contacts.NewMemory()
+	directory.Set("user-1", models.NotificationTypeTelegram, "12345")
+
+	msg := func() *models.KafkaNotificationMessage {
+		return &models.KafkaNotificationMessage{
+			UserID:   "user-1",
+			Type:     models.NotificationTypeEmail,
+			Channel:  "user@example.com",
+			Content:  "Hello",
+			Fallback: &models.FallbackPolicy{Channels: []models.NotificationType{models.NotificationTypeTelegram}},
+		}
+	}
+
+	env := &models.Envelope{Message: msg()}
+	if err := newResolvingService(directory).validate(env); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if got := env.Message.Contacts[models.NotificationTypeTelegram]; got != "12345" {
+		t.Errorf("telegram contact = %q, want 12345", got)
+	}
+	if want := []string{"contacts.telegram"}; !reflect.DeepEqual(env.Resolved, want) {
+		t.Errorf("resolved = %v, want %v", env.Resolved, want)
+	}
+
+	// A failed lookup of a required channel is not a validation error, so
+	// the message is retried
+	env = &models.Envelope{Message: msg()}
+	env.Message.Channel = ""
+	err := newResolvingService(failingContacts{}).validate(env)
+	var validationErr *models.ValidationError
+	if err == nil || errors.As(err, &validationErr) {
+		t.Errorf("validate with failing contacts: err = %v, want a lookup error", err)
+	}
+}
@@ -1,103 +1,522 @@
 package notifications
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
-	"github.com/notification_service/internal/email"
+	"github.com/notification_service/internal/config"
 	"github.com/notification_service/internal/models"
-	"github.com/notification_service/internal/supabase"
-	"github.com/notification_service/internal/telegram"
 )
 
+var (
+	// ErrNotCancellable is returned when cancelling a notification that is
+	// neither pending nor retrying
+	ErrNotCancellable = errors.New("notification cannot be cancelled")
+	// ErrNotResendable is returned when resending a notification that has
+	// not failed
+	ErrNotResendable = errors.New("notification cannot be resent")
+)
+
+// StatusPublisher is notified of every notification status transition. It
+// must not block the send path.
+type StatusPublisher interface {
+	PublishStatus(event *models.StatusEvent)
+}
+
 // Service handles notification processing
 type Service struct {
-	supabaseClient *supabase.Client
-	emailClient    *email.SendGridClient
-	telegramClient *telegram.TelegramClient
+	store Store
+	// notifiers send the notifications of each type
+	notifiers *Registry
+	// fallbacks are the fallback policies of the notification types
+	fallbacks map[models.NotificationType]*models.FallbackPolicy
+	// contacts, if set, resolves the channels messages omit
+	contacts ContactResolver
+	// preferences, if set, suppresses notifications users opted out of,
+	// except those of the required categories
+	preferences        PreferenceStore
+	requiredCategories map[string]bool
+	// statusPublisher, if set, receives an event for every status transition
+	statusPublisher StatusPublisher
+	// persistedHeaders are the message headers recorded in the notification metadata
+	persistedHeaders []string
 }
 
 // NewService creates a new notification service
 func NewService(
-	supabaseClient *supabase.Client,
-	emailClient *email.SendGridClient,
-	telegramClient *telegram.TelegramClient,
+	cfg *config.Config,
+	store Store,
+	notifiers *Registry,
+	contacts ContactResolver,
+	preferences PreferenceStore,
+	statusPublisher StatusPublisher,
 ) *Service {
-	return &Service{
-		supabaseClient: supabaseClient,
-		emailClient:    emailClient,
-		telegramClient: telegramClient,
+	s := &Service{
+		store:              store,
+		notifiers:          notifiers,
+		fallbacks:          cfg.Fallback.Policies,
+		contacts:           contacts,
+		preferences:        preferences,
+		requiredCategories: make(map[string]bool, len(cfg.Preferences.RequiredCategories)),
+		statusPublisher:    statusPublisher,
+		persistedHeaders:   cfg.Service.PersistedHeaders,
+	}
+	for _, category := range cfg.Preferences.RequiredCategories {
+		s.requiredCategories[category] = true
+	}
+	s.checkFallbacks()
+	return s
+}
+
+// checkFallbacks warns about the fallback policies naming notification types
+// without a notifier. Notifications of those types are rejected, and
+// fallbacks to them fail.
+func (s *Service) checkFallbacks() {
+	log.Printf("Notifiers registered for notification types %v", s.notifiers.Types())
+
+	channels := s.notifiers.Channels()
+	for notificationType, policy := range s.fallbacks {
+		if !channels.Supports(notificationType) {
+			log.Printf("Warning: fallback policy of %s applies to no notifications, no notifier is registered for the type", notificationType)
+		}
+		if err := policy.Validate(channels); err != nil {
+			log.Printf("Warning: fallback policy of %s: %v", notificationType, err)
+		}
+	}
+}
+
+// ProcessNotification processes a notification message from Kafka. Retried
+// messages carry the ID of the notification row created by the first attempt,
+// which is updated instead of inserting a new one.
+func (s *Service) ProcessNotification(env *models.Envelope) error {
+	_, err := s.process(env)
+	return err
+}
+
+// process sends the notification of a message, and returns the status it
+// ended in. The status is empty if the notification could not be stored.
+// Notifications the user opted out of are suppressed without an error.
+func (s *Service) process(env *models.Envelope) (models.NotificationStatus, error) {
+	log.Printf("Processing notification for user %s of type %s", env.Message.UserID, env.Message.Type)
+	return s.processValidated(env, s.validate(env))
+}
+
+// processValidated is process for a message that was already validated,
+// with validateErr the result
+func (s *Service) processValidated(env *models.Envelope, validateErr error) (models.NotificationStatus, error) {
+	msg := env.Message
+
+	attempt := env.Attempt
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	notification := s.newNotification(env)
+	notification.Attempts = attempt
+
+	var validationErr *models.ValidationError
+	switch {
+	case errors.As(validateErr, &validationErr):
+		return models.NotificationStatusFailed, s.reject(env, notification, validateErr)
+	case validateErr != nil:
+		// The contacts could not be looked up, so the message is retried
+		log.Printf("Failed to process notification for user %s: %v", msg.UserID, validateErr)
+		if notification.ID == "" {
+			return "", validateErr
+		}
+		return s.finish(notification, sendStatus(validateErr, attempt, env.MaxAttempts), validateErr)
+	}
+
+	if notification.ID == "" {
+		if err := s.insert(env, notification); err != nil {
+			return "", err
+		}
+	} else {
+		// Redelivered messages of notifications that were already sent,
+		// cancelled or otherwise finished are not sent again
+		stored := s.stored(notification.ID)
+		if stored != nil && stored.Status.IsFinal() {
+			log.Printf("Skipping %s notification %s", stored.Status, notification.ID)
+			return stored.Status, nil
+		}
+		if stored != nil {
+			// Fallbacks continue from the channel they reached
+			notification.ChannelAttempts = stored.ChannelAttempts
+		}
+
+		log.Printf("Retrying notification %s, attempt %d", notification.ID, attempt)
+		if err := s.store.UpdateNotificationAttempts(notification.ID, attempt); err != nil {
+			log.Printf("Failed to update notification attempts: %v", err)
+		}
+	}
+
+	// Preferences are read on every attempt, as users may opt out meanwhile
+	preferences, err := s.userPreferences(notification)
+	if err != nil {
+		log.Printf("Failed to process notification %s: %v", notification.ID, err)
+		return s.finish(notification, sendStatus(err, attempt, env.MaxAttempts), err)
+	}
+
+	if len(notification.Recipients) > 0 {
+		return s.fanOut(env, notification, preferences)
+	}
+
+	if reason := suppressionReason(preferences, notification.Category, notification.Type); reason != "" {
+		return s.suppress(notification, reason), nil
 	}
+
+	var receipt models.Receipt
+	var sendErr error
+	if policy := s.fallbackPolicy(notification); policy != nil {
+		receipt, sendErr = s.sendWithFallback(notification, policy, preferences)
+	} else {
+		receipt, sendErr = s.send(context.Background(), notification)
+	}
+
+	// Update notification status
+	status := sendStatus(sendErr, attempt, env.MaxAttempts)
+	switch status {
+	case models.NotificationStatusSent:
+		log.Printf("Notification %s sent via %s (message ID %q)", notification.ID, receipt.Notifier, receipt.MessageID)
+	case models.NotificationStatusRetrying:
+		log.Printf("Failed to send notification, will retry: %v", sendErr)
+	default:
+		log.Printf("Failed to send notification: %v", sendErr)
+	}
+
+	return s.finish(notification, status, sendErr)
+}
+
+// CreateNotification validates a message and stores it as a pending
+// notification without sending it, setting env.NotificationID. The message
+// can then be enqueued with the ID so the consumer sends the stored
+// notification instead of inserting another. Invalid messages are stored as
+// failed and a permanent error wrapping the *models.ValidationError is
+// returned.
+func (s *Service) CreateNotification(env *models.Envelope) error {
+	return s.createValidated(env, s.validate(env))
 }
 
-// ProcessNotification processes a notification message from Kafka
-func (s *Service) ProcessNotification(msg *models.KafkaNotificationMessage) error {
-	log.Printf("Processing notification for user %s of type %s", msg.UserID, msg.Type)
+// createValidated is CreateNotification for a message that was already
+// validated, with err the result
+func (s *Service) createValidated(env *models.Envelope, err error) error {
+	var validationErr *models.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return s.reject(env, s.newNotification(env), err)
+	case err != nil:
+		return err
+	}
+	return s.insert(env, s.newNotification(env))
+}
+
+// GetNotification returns a stored notification, with its deliveries if it
+// is a multi-channel notification. It returns an error wrapping
+// supabase.ErrNotFound if there is none with the ID.
+func (s *Service) GetNotification(id string) (*models.Notification, error) {
+	notification, err := s.store.GetNotification(id)
+	if err != nil || len(notification.Recipients) == 0 {
+		return notification, err
+	}
 
-	// Create notification record
-	notification := &models.Notification{
+	notification.Deliveries, err = s.store.ListDeliveries(id)
+	if err != nil {
+		return nil, err
+	}
+	return notification, nil
+}
+
+// ListNotifications returns a page of the stored notifications matching a
+// query. It returns an error wrapping supabase.ErrInvalidCursor if the
+// query's cursor is invalid.
+func (s *Service) ListNotifications(query *models.NotificationQuery) (*models.NotificationPage, error) {
+	return s.store.ListNotifications(query)
+}
+
+// CancelNotification cancels a notification that has not been sent yet, so
+// the consumer skips it, and records who cancelled it and why. It returns
+// ErrNotCancellable if the notification is neither pending nor retrying.
+func (s *Service) CancelNotification(id, actor, reason string) (*models.Notification, error) {
+	notification, err := s.transition(id, models.NotificationStatusCancelled, ErrNotCancellable,
+		models.NotificationStatusPending, models.NotificationStatusRetrying)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Notification %s cancelled by %s", id, actor)
+	s.audit(&models.AuditEntry{
+		NotificationID: id,
+		Action:         models.AuditActionCancel,
+		Actor:          actor,
+		Reason:         reason,
+	})
+	return notification, nil
+}
+
+// transition moves a notification from one of the from statuses to status
+// and publishes the change. If the notification has another status, an error
+// wrapping notAllowed is returned.
+func (s *Service) transition(id string, status models.NotificationStatus, notAllowed error, from ...models.NotificationStatus) (*models.Notification, error) {
+	notification, err := s.store.TransitionNotificationStatus(id, from, status)
+	if err != nil {
+		return nil, err
+	}
+
+	if notification == nil {
+		current, err := s.store.GetNotification(id)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: notification %s is %s", notAllowed, id, current.Status)
+	}
+
+	s.publishStatus(notification, nil)
+	return notification, nil
+}
+
+// audit records an operation performed on a notification. Failures are
+// logged; the operation has already happened.
+func (s *Service) audit(entry *models.AuditEntry) {
+	if err := s.store.InsertAuditEntry(entry); err != nil {
+		log.Printf("Failed to record %s of notification %s by %s: %v", entry.Action, entry.NotificationID, entry.Actor, err)
+	}
+}
+
+// stored returns the stored row of a notification being retried, to check
+// whether it is already final. It returns nil if the row cannot be read, and
+// the notification is sent anyway.
+func (s *Service) stored(id string) *models.Notification {
+	stored, err := s.store.GetNotification(id)
+	if err != nil {
+		log.Printf("Failed to check the status of notification %s: %v", id, err)
+		return nil
+	}
+	return stored
+}
+
+// newNotification builds the notification row for a message
+func (s *Service) newNotification(env *models.Envelope) *models.Notification {
+	msg := env.Message
+
+	priority := msg.Priority
+	if priority == "" {
+		priority = models.NotificationPriorityNormal
+	}
+	category := msg.Category
+	if category == "" {
+		category = models.DefaultCategory
+	}
+
+	return &models.Notification{
+		ID:       env.NotificationID,
 		UserID:   msg.UserID,
 		Type:     msg.Type,
 		Channel:  msg.Channel,
 		Subject:  msg.Subject,
 		Content:  msg.Content,
+		Priority: priority,
+		Category: category,
 		Status:   models.NotificationStatusPending,
-		Metadata: msg.Metadata,
+		Attempts: 1,
+		Metadata: s.metadata(env),
+
+		Recipients:    msg.Recipients,
+		Contacts:      msg.Contacts,
+		Fallback:      msg.Fallback,
+		CorrelationID: env.Headers[models.HeaderCorrelationID],
+		ResendOf:      env.ResendOf,
 	}
+}
 
-	// Insert notification into Supabase
-	id, err := s.supabaseClient.InsertNotification(notification)
+// insert stores a new pending notification and publishes its status
+func (s *Service) insert(env *models.Envelope, notification *models.Notification) error {
+	id, err := s.store.InsertNotification(notification)
 	if err != nil {
 		return fmt.Errorf("failed to insert notification: %w", err)
 	}
 
 	notification.ID = id
+	env.NotificationID = id
 	log.Printf("Notification inserted with ID: %s", id)
+	s.publishStatus(notification, nil)
+	return nil
+}
 
-	// Send notification based on type
-	var sendErr error
-	switch notification.Type {
-	case models.NotificationTypeEmail:
-		sendErr = s.sendEmailNotification(notification)
-	case models.NotificationTypeTelegram:
-		sendErr = s.sendTelegramNotification(notification)
-	default:
-		sendErr = fmt.Errorf("unsupported notification type: %s", notification.Type)
+// reject records an invalid message as a failed notification carrying the
+// validation error, without sending it. The returned error is permanent so
+// the message is dead-lettered rather than retried.
+func (s *Service) reject(env *models.Envelope, notification *models.Notification, cause error) error {
+	log.Printf("Rejecting invalid notification: %v", cause)
+
+	if notification.ID != "" {
+		s.setStatus(notification, models.NotificationStatusFailed, cause)
+		return models.NewPermanentError(cause)
 	}
 
-	// Update notification status
-	var status models.NotificationStatus
-	if sendErr != nil {
-		log.Printf("Failed to send notification: %v", sendErr)
-		status = models.NotificationStatusFailed
-	} else {
-		log.Printf("Notification sent successfully")
-		status = models.NotificationStatusSent
+	notification.Status = models.NotificationStatusFailed
+	notification.Error = cause.Error()
+	notification.ErrorClass = errorClass(cause)
+	var validationErr *models.ValidationError
+	if errors.As(cause, &validationErr) {
+		notification.Metadata["validation_errors"] = validationErr.Errors
 	}
 
-	if err := s.supabaseClient.UpdateNotificationStatus(id, status); err != nil {
+	id, err := s.store.InsertNotification(notification)
+	if err != nil {
+		return fmt.Errorf("failed to insert notification: %w", err)
+	}
+
+	notification.ID = id
+	env.NotificationID = id
+	s.publishStatus(notification, cause)
+	return models.NewPermanentError(cause)
+}
+
+// setStatus records a status transition in the store, along with the error
+// that caused it, and publishes it. It reports false, leaving the
+// notification alone, if the notification is no longer pending or retrying
+// because it was cancelled meanwhile.
+func (s *Service) setStatus(notification *models.Notification, status models.NotificationStatus, cause error) bool {
+	notification.Error, notification.ErrorClass = "", ""
+	if cause != nil {
+		notification.Error = cause.Error()
+		notification.ErrorClass = errorClass(cause)
+	}
+
+	updated, err := s.store.UpdateNotificationStatus(notification.ID, status, notification.Error, notification.ErrorClass)
+	if err != nil {
+		// The status is published anyway, as the notification was not
+		// found to be cancelled
 		log.Printf("Failed to update notification status: %v", err)
+	} else if !updated {
+		log.Printf("Notification %s was cancelled while being sent, not marking it %s", notification.ID, status)
+		notification.Status = models.NotificationStatusCancelled
+		return false
+	}
+
+	notification.Status = status
+	s.publishStatus(notification, cause)
+	return true
+}
+
+// finish records the status a notification ended an attempt in, and returns
+// it with the error that caused it. If the notification was cancelled during
+// the attempt, the cancellation stands and no error is returned, so that the
+// message is not retried.
+func (s *Service) finish(notification *models.Notification, status models.NotificationStatus, cause error) (models.NotificationStatus, error) {
+	if !s.setStatus(notification, status, cause) {
+		return models.NotificationStatusCancelled, nil
+	}
+	return status, cause
+}
+
+// sendStatus returns the status of a notification after an attempt to send
+// it failed with err, or succeeded if err is nil. Transient failures are
+// retried until the last attempt.
+func sendStatus(err error, attempt, maxAttempts int) models.NotificationStatus {
+	switch {
+	case err == nil:
+		return models.NotificationStatusSent
+	case !models.IsPermanent(err) && attempt < maxAttempts:
+		return models.NotificationStatusRetrying
+	}
+	return models.NotificationStatusFailed
+}
+
+// errorClass returns the class of the error a notification failed with, one
+// of the models.ErrorClass constants
+func errorClass(err error) string {
+	var validationErr *models.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return models.ErrorClassValidation
+	case errors.Is(err, ErrEnqueue):
+		return models.ErrorClassEnqueue
+	case models.IsPermanent(err):
+		return models.ErrorClassPermanent
+	default:
+		return models.ErrorClassTransient
+	}
+}
+
+// publishStatus publishes the current status of a notification, if a status
+// publisher is configured
+func (s *Service) publishStatus(notification *models.Notification, cause error) {
+	if s.statusPublisher == nil {
+		return
+	}
+
+	event := &models.StatusEvent{
+		NotificationID: notification.ID,
+		Status:         notification.Status,
+		UserID:         notification.UserID,
+		Type:           notification.Type,
+		Attempt:        notification.Attempts,
+		CorrelationID:  notification.CorrelationID,
+		Reason:         notification.SuppressionReason,
+		OccurredAt:     time.Now().UTC(),
+	}
+	if cause != nil {
+		event.Error = cause.Error()
 	}
 
-	return sendErr
+	s.statusPublisher.PublishStatus(event)
 }
 
-// sendEmailNotification sends an email notification
-func (s *Service) sendEmailNotification(notification *models.Notification) error {
-	if s.emailClient == nil {
-		return fmt.Errorf("email client not configured")
+// metadata returns the message metadata extended with an "origin" entry
+// describing the record the notification came from and its persisted headers
+func (s *Service) metadata(env *models.Envelope) map[string]interface{} {
+	metadata := make(map[string]interface{}, len(env.Message.Metadata)+1)
+	for k, v := range env.Message.Metadata {
+		metadata[k] = v
 	}
 
-	log.Printf("Sending email notification to %s", notification.Channel)
-	return s.emailClient.SendEmail(notification)
+	headers := make(map[string]string)
+	for _, name := range s.persistedHeaders {
+		if value, ok := env.Headers[name]; ok {
+			headers[name] = value
+		}
+	}
+
+	// Messages from sources without offsets are identified by message ID
+	origin := make(map[string]interface{})
+	if env.Topic != "" {
+		origin["topic"] = env.Topic
+	}
+	if env.MessageID != "" {
+		origin["message_id"] = env.MessageID
+	} else if env.Topic != "" {
+		origin["partition"] = env.Partition
+		origin["offset"] = env.Offset
+	}
+	if env.Key != "" {
+		origin["key"] = env.Key
+	}
+	if !env.Timestamp.IsZero() {
+		origin["timestamp"] = env.Timestamp.UTC().Format(time.RFC3339Nano)
+	}
+	if len(headers) > 0 {
+		origin["headers"] = headers
+	}
+	metadata["origin"] = origin
+	if len(env.Resolved) > 0 {
+		metadata["resolved_channels"] = env.Resolved
+	}
+
+	return metadata
 }
 
-// sendTelegramNotification sends a Telegram notification
-func (s *Service) sendTelegramNotification(notification *models.Notification) error {
-	if s.telegramClient == nil {
-		return fmt.Errorf("telegram client not configured")
+// send delivers a notification through the notifier registered for its
+// type. A type without a notifier fails permanently with a *NoNotifierError.
+func (s *Service) send(ctx context.Context, notification *models.Notification) (models.Receipt, error) {
+	notifier, err := s.notifiers.Lookup(notification.Type)
+	if err != nil {
+		return models.Receipt{}, models.NewPermanentError(err)
 	}
 
-	log.Printf("Sending telegram notification to %s", notification.Channel)
-	return s.telegramClient.SendNotification(notification)
-} 
\ No newline at end of file
+	log.Printf("Sending %s notification to %s via %s", notification.Type, notification.Channel, notifier.Name())
+	return notifier.Send(ctx, notification)
+}
@@ -0,0 +1,44 @@
+package notifications
+
+import (
+	"time"
+
+	"github.com/notification_service/internal/models"
+)
+
+// Store persists notifications, their deliveries and the audit trail.
+// *supabase.Client implements it, and MemoryStore keeps everything in
+// memory. Lookups of unknown notifications return an error wrapping
+// supabase.ErrNotFound. UpdateNotificationStatus and SuppressNotification
+// only update notifications that are pending or retrying, and report whether
+// they did, so that a cancellation made while a notification is being sent
+// is not overwritten.
+type Store interface {
+	InsertNotification(notification *models.Notification) (string, error)
+	GetNotification(id string) (*models.Notification, error)
+	ListNotifications(query *models.NotificationQuery) (*models.NotificationPage, error)
+	UpdateNotificationStatus(id string, status models.NotificationStatus, errMsg, errClass string) (bool, error)
+	UpdateNotificationAttempts(id string, attempts int) error
+	UpdateNotificationChannels(id string, attempts []models.ChannelAttempt, sentType models.NotificationType, sentChannel string) error
+	SuppressNotification(id, reason string) (bool, error)
+	TransitionNotificationStatus(id string, from []models.NotificationStatus, to models.NotificationStatus) (*models.Notification, error)
+	InsertAuditEntry(entry *models.AuditEntry) error
+
+	InsertDeliveries(deliveries []models.Delivery) ([]models.Delivery, error)
+	ListDeliveries(notificationID string) ([]models.Delivery, error)
+	UpdateDelivery(delivery *models.Delivery) error
+}
+
+// BulkJobStore persists bulk resend jobs and counts the notifications they
+// resend. *supabase.Client implements it.
+type BulkJobStore interface {
+	ListNotifications(query *models.NotificationQuery) (*models.NotificationPage, error)
+	CountNotifications(filter *models.NotificationFilter) (int, error)
+
+	InsertBulkJob(job *models.BulkResendJob) (string, error)
+	GetBulkJob(id string) (*models.BulkResendJob, error)
+	ListBulkJobs(statuses []models.BulkJobStatus, limit int) ([]models.BulkResendJob, error)
+	TransitionBulkJob(id string, from []models.BulkJobStatus, to models.BulkJobStatus, errMsg, owner string) (*models.BulkResendJob, error)
+	SaveBulkJobProgress(job *models.BulkResendJob) (*models.BulkResendJob, error)
+	ClaimBulkJob(id string, updatedAt time.Time, owner string) (*models.BulkResendJob, error)
+}
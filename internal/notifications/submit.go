@@ -0,0 +1,182 @@
+package notifications
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/models"
+)
+
+// ErrEnqueue is returned by Submit when a stored notification could not be
+// enqueued
+var ErrEnqueue = errors.New("failed to enqueue notification")
+
+// Enqueuer publishes stored notifications for the consumer to send
+type Enqueuer interface {
+	Enqueue(msg *models.KafkaNotificationMessage, notificationID string, headers map[string]string) error
+}
+
+// Submitter accepts notifications from the HTTP and gRPC APIs. In inline mode
+// they are sent right away; in enqueue mode they are stored as pending and
+// enqueued, and the consumer sends them.
+type Submitter struct {
+	service  *Service
+	enqueuer Enqueuer
+	mode     string
+}
+
+// NewSubmitter creates a submitter in the configured submit mode. enqueuer is
+// only used, and required, in enqueue mode.
+func NewSubmitter(cfg *config.Config, service *Service, enqueuer Enqueuer) (*Submitter, error) {
+	if cfg.Service.SubmitMode == config.SubmitModeEnqueue && enqueuer == nil {
+		return nil, errors.New("enqueue mode requires an enqueuer")
+	}
+
+	return &Submitter{
+		service:  service,
+		enqueuer: enqueuer,
+		mode:     cfg.Service.SubmitMode,
+	}, nil
+}
+
+// Mode returns the submit mode
+func (s *Submitter) Mode() string {
+	return s.mode
+}
+
+// Submit validates and submits a notification, setting env.NotificationID
+// once it is stored, and returns its status. Channels the message omits are
+// resolved from the user's contacts first. Invalid messages are not stored
+// and their *models.ValidationError is returned. A notification that was
+// stored but could not be sent, or enqueued (ErrEnqueue), is failed and the
+// error is returned along with the failed status, or the partially sent
+// status if a multi-channel notification reached some of its recipients.
+// Sends are not retried in inline mode. A notification the user opted out
+// of is suppressed without an error.
+func (s *Submitter) Submit(env *models.Envelope) (models.NotificationStatus, error) {
+	if err := s.service.validate(env); err != nil {
+		return "", err
+	}
+
+	// The message is validated once; resolving its channels looks up the
+	// user's contacts
+	if s.mode == config.SubmitModeInline {
+		env.Attempt, env.MaxAttempts = 1, 1
+		status, err := s.service.processValidated(env, nil)
+		if env.NotificationID == "" {
+			return "", err
+		}
+		return status, err
+	}
+
+	if err := s.service.createValidated(env, nil); err != nil {
+		return "", err
+	}
+
+	// The channels resolved from the user's contacts are stored but not
+	// published; the consumer resolves them again
+	msg := env.Message.WithoutChannels(env.Resolved)
+	if err := s.enqueuer.Enqueue(msg, env.NotificationID, env.Headers); err != nil {
+		err = fmt.Errorf("%w: %v", ErrEnqueue, err)
+		s.service.setStatus(s.service.newNotification(env), models.NotificationStatusFailed, err)
+		return models.NotificationStatusFailed, err
+	}
+
+	return models.NotificationStatusPending, nil
+}
+
+// Resend submits a copy of a failed notification like Submit, and marks the
+// original as resent. The copy refers to the original by its ResendOf field;
+// the original keeps its content and error. Who resent it and why is
+// recorded in the audit log. It returns the ID of the copy, which is empty if
+// the copy was not stored, with the copy's status. It returns
+// ErrNotResendable if the notification has not failed.
+func (s *Submitter) Resend(id, actor, reason string) (string, models.NotificationStatus, error) {
+	// Claim the original first, so that it cannot be resent twice
+	original, err := s.service.transition(id, models.NotificationStatusResent, ErrNotResendable, models.NotificationStatusFailed)
+	if err != nil {
+		return "", "", err
+	}
+
+	env := resendEnvelope(original)
+	status, err := s.Submit(env)
+	if env.NotificationID == "" {
+		// Nothing was stored, so let the original be resent again
+		if _, revertErr := s.service.transition(id, models.NotificationStatusFailed, ErrNotResendable, models.NotificationStatusResent); revertErr != nil {
+			log.Printf("Failed to revert resent notification %s: %v", id, revertErr)
+		}
+		return "", "", err
+	}
+
+	log.Printf("Notification %s resent by %s as %s", id, actor, env.NotificationID)
+	s.service.audit(&models.AuditEntry{
+		NotificationID: id,
+		Action:         models.AuditActionResend,
+		Actor:          actor,
+		Reason:         reason,
+		Details:        map[string]interface{}{"resent_as": env.NotificationID},
+	})
+
+	return env.NotificationID, status, err
+}
+
+// resendEnvelope builds the message resending a stored notification. Its
+// metadata gets a new origin, and the channels that were resolved from the
+// user's contacts are left out so they are resolved again.
+func resendEnvelope(original *models.Notification) *models.Envelope {
+	metadata := make(map[string]interface{}, len(original.Metadata))
+	for k, v := range original.Metadata {
+		if k != "origin" && k != "validation_errors" && k != "resolved_channels" {
+			metadata[k] = v
+		}
+	}
+
+	headers := make(map[string]string)
+	if original.CorrelationID != "" {
+		headers[models.HeaderCorrelationID] = original.CorrelationID
+	}
+
+	msg := &models.KafkaNotificationMessage{
+		UserID:     original.UserID,
+		Type:       original.Type,
+		Channel:    original.Channel,
+		Recipients: original.Recipients,
+		Subject:    original.Subject,
+		Content:    original.Content,
+		Priority:   original.Priority,
+		Category:   original.Category,
+		Metadata:   metadata,
+		Contacts:   original.Contacts,
+		Fallback:   original.Fallback,
+	}
+	msg = msg.WithoutChannels(resolvedChannels(original.Metadata["resolved_channels"]))
+
+	return &models.Envelope{
+		Message:   msg,
+		Key:       msg.UserID,
+		Headers:   headers,
+		Timestamp: time.Now(),
+		ResendOf:  original.ID,
+	}
+}
+
+// resolvedChannels returns the resolved channel fields recorded in the
+// metadata of a notification, which are strings once read back from the store
+func resolvedChannels(value interface{}) []string {
+	switch fields := value.(type) {
+	case []string:
+		return fields
+	case []interface{}:
+		resolved := make([]string, 0, len(fields))
+		for _, field := range fields {
+			if s, ok := field.(string); ok {
+				resolved = append(resolved, s)
+			}
+		}
+		return resolved
+	}
+	return nil
+}
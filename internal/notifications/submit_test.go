@@ -0,0 +1,196 @@
+package notifications
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/contacts"
+	"github.com/notification_service/internal/models"
+)
+
+// countingContacts resolves the contacts of every user to contacts and
+// counts the lookups
+type countingContacts struct {
+	mu       sync.Mutex
+	contacts map[models.NotificationType]string
+	lookups  int
+}
+
+func (c *countingContacts) Contacts(userID string) (map[models.NotificationType]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lookups++
+	return c.contacts, nil
+}
+
+// fakeEnqueuer records the enqueued messages
+type fakeEnqueuer struct {
+	mu   sync.Mutex
+	msgs []models.KafkaNotificationMessage
+}
+
+func (e *fakeEnqueuer) Enqueue(msg *models.KafkaNotificationMessage, notificationID string, headers map[string]string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.msgs = append(e.msgs, *msg)
+	return nil
+}
+
+// newTestSubmitter returns a submitter in mode sending email and Telegram
+// through fake notifiers, resolving channels from contacts
+func newTestSubmitter(t *testing.T, mode string, contacts ContactResolver) (*Submitter, *MemoryStore, *fakeEnqueuer) {
+	t.Helper()
+
+	cfg := &config.Config{Service: config.ServiceConfig{SubmitMode: mode}}
+	store := NewMemoryStore()
+	notifiers := NewRegistry()
+	notifiers.Register(models.NotificationTypeEmail, newFakeNotifier())
+	notifiers.Register(models.NotificationTypeTelegram, newFakeNotifier())
+	enqueuer := &fakeEnqueuer{}
+
+	submitter, err := NewSubmitter(cfg, NewService(cfg, store, notifiers, contacts, nil, nil), enqueuer)
+	if err != nil {
+		t.Fatalf("NewSubmitter: %v", err)
+	}
+	return submitter, store, enqueuer
+}
+
+// unaddressedEnvelope is an email to user-1 without a channel
+func unaddressedEnvelope() *models.Envelope {
+	return &models.Envelope{Message: &models.KafkaNotificationMessage{
+		UserID:  "user-1",
+		Type:    models.NotificationTypeEmail,
+		Content: "Hello",
+	}}
+}
+
+func TestSubmitResolvesContactsOnce(t *testing.T) {
+	tests := []struct {
+		mode   string
+		status models.NotificationStatus
+	}{
+		{mode: config.SubmitModeInline, status: models.NotificationStatusSent},
+		{mode: config.SubmitModeEnqueue, status: models.NotificationStatusPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			contacts := &countingContacts{contacts: map[models.NotificationType]string{
+				models.NotificationTypeEmail: "user@example.com",
+			}}
+			submitter, store, _ := newTestSubmitter(t, tt.mode, contacts)
+
+			env := unaddressedEnvelope()
+			status, err := submitter.Submit(env)
+			if err != nil {
+				t.Fatalf("Submit: %v", err)
+			}
+			if status != tt.status {
+				t.Errorf("status = %s, want %s", status, tt.status)
+			}
+			if contacts.lookups != 1 {
+				t.Errorf("%d contact lookups, want 1", contacts.lookups)
+			}
+
+			stored, err := store.GetNotification(env.NotificationID)
+			if err != nil {
+				t.Fatalf("GetNotification: %v", err)
+			}
+			if stored.Status != tt.status || stored.Channel != "user@example.com" {
+				t.Errorf("stored %s notification to %q", stored.Status, stored.Channel)
+			}
+		})
+	}
+}
+
+func TestSubmitDoesNotStoreInvalidMessages(t *testing.T) {
+	for _, mode := range []string{config.SubmitModeInline, config.SubmitModeEnqueue} {
+		t.Run(mode, func(t *testing.T) {
+			contacts := &countingContacts{}
+			submitter, store, enqueuer := newTestSubmitter(t, mode, contacts)
+
+			env := unaddressedEnvelope()
+			status, err := submitter.Submit(env)
+			var validationErr *models.ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("err = %v, want a validation error", err)
+			}
+			if status != "" || env.NotificationID != "" {
+				t.Errorf("status = %q, notification ID = %q, want neither", status, env.NotificationID)
+			}
+			if contacts.lookups != 1 {
+				t.Errorf("%d contact lookups, want 1", contacts.lookups)
+			}
+
+			page, err := store.ListNotifications(&models.NotificationQuery{Limit: 10})
+			if err != nil {
+				t.Fatalf("ListNotifications: %v", err)
+			}
+			if len(page.Notifications) != 0 || len(enqueuer.msgs) != 0 {
+				t.Errorf("%d notifications stored and %d enqueued, want none", len(page.Notifications), len(enqueuer.msgs))
+			}
+		})
+	}
+}
+
+func TestSubmitEnqueuesWithoutResolvedChannels(t *testing.T) {
+	directory := contacts.NewMemory()
+	directory.Set("user-1", models.NotificationTypeEmail, "user@example.com")
+	directory.Set("user-1", models.NotificationTypeTelegram, "12345")
+	submitter, store, enqueuer := newTestSubmitter(t, config.SubmitModeEnqueue, directory)
+
+	env := unaddressedEnvelope()
+	env.Message.Fallback = &models.FallbackPolicy{Channels: []models.NotificationType{models.NotificationTypeTelegram}}
+	if _, err := submitter.Submit(env); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	if len(enqueuer.msgs) != 1 {
+		t.Fatalf("%d messages enqueued, want 1", len(enqueuer.msgs))
+	}
+	if msg := enqueuer.msgs[0]; msg.Channel != "" || len(msg.Contacts) != 0 {
+		t.Errorf("enqueued channel %q and contacts %v, want neither", msg.Channel, msg.Contacts)
+	}
+
+	stored, err := store.GetNotification(env.NotificationID)
+	if err != nil {
+		t.Fatalf("GetNotification: %v", err)
+	}
+	if stored.Channel != "user@example.com" || stored.Contacts[models.NotificationTypeTelegram] != "12345" {
+		t.Errorf("stored channel %q and contacts %v, want the resolved ones", stored.Channel, stored.Contacts)
+	}
+}
+
+func TestResendResolvesChannelsAgain(t *testing.T) {
+	directory := contacts.NewMemory()
+	directory.Set("user-1", models.NotificationTypeEmail, "new@example.com")
+	submitter, store, enqueuer := newTestSubmitter(t, config.SubmitModeEnqueue, directory)
+
+	id, err := store.InsertNotification(&models.Notification{
+		UserID:   "user-1",
+		Type:     models.NotificationTypeEmail,
+		Channel:  "old@example.com",
+		Content:  "Hello",
+		Status:   models.NotificationStatusFailed,
+		Metadata: map[string]interface{}{"resolved_channels": []interface{}{"channel"}},
+	})
+	if err != nil {
+		t.Fatalf("InsertNotification: %v", err)
+	}
+
+	resentID, _, err := submitter.Resend(id, "operator", "contact changed")
+	if err != nil {
+		t.Fatalf("Resend: %v", err)
+	}
+	if len(enqueuer.msgs) != 1 || enqueuer.msgs[0].Channel != "" {
+		t.Errorf("enqueued %+v, want one message without a channel", enqueuer.msgs)
+	}
+	resent, err := store.GetNotification(resentID)
+	if err != nil {
+		t.Fatalf("GetNotification: %v", err)
+	}
+	if resent.Channel != "new@example.com" {
+		t.Errorf("resent to %q, want the current contact new@example.com", resent.Channel)
+	}
+}
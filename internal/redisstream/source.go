@@ -0,0 +1,462 @@
+package redisstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/ingest"
+	"github.com/notification_service/internal/models"
+	"github.com/notification_service/internal/schemaregistry"
+	"github.com/redis/go-redis/v9"
+)
+
+// Stream entry fields with a special meaning. Every other field of an entry
+// is passed to the handler as a header.
+const (
+	// FieldValue holds the message payload
+	FieldValue = "value"
+	// FieldKey holds the optional message key
+	FieldKey = "key"
+)
+
+// fieldSourceID is the dead-letter field holding the ID of the failed entry
+const fieldSourceID = "x-source-id"
+
+// Source consumes Redis streams as a member of a consumer group. Each stream
+// is read in order by its own goroutine. Entries are acknowledged once
+// handled; entries that failed transiently stay pending and are claimed
+// again, by this or another consumer, once they have been idle for
+// ClaimMinIdle.
+type Source struct {
+	client           redis.UniversalClient
+	cfg              config.RedisConfig
+	routes           *ingest.Router
+	streams          []string
+	deadLetterStream string
+
+	mu       sync.Mutex
+	started  bool
+	stopped  bool
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	inFlight map[string]redis.XMessage
+}
+
+// NewSource creates a source reading the streams named by the configured
+// routes from the configured Redis server. Payloads framed with a schema ID
+// are decoded with schemas from registry, which may be nil.
+func NewSource(cfg *config.Config, handlers map[string]ingest.Handler, registry *schemaregistry.Client) (*Source, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Addr,
+		Username: cfg.Redis.Username,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	source, err := NewSourceWithClient(cfg, client, handlers, registry)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return source, nil
+}
+
+// NewSourceWithClient creates a source reading the streams named by the
+// configured routes through client, e.g. a cluster or sentinel client. The
+// source closes client when it stops.
+func NewSourceWithClient(cfg *config.Config, client redis.UniversalClient, handlers map[string]ingest.Handler, registry *schemaregistry.Client) (*Source, error) {
+	routes, err := ingest.NewRouter(cfg.Kafka.Routes, handlers, ingest.NewSchemaDecoder(registry))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Source{
+		client:           client,
+		cfg:              cfg.Redis,
+		routes:           routes,
+		streams:          routes.Subscriptions(),
+		deadLetterStream: cfg.Kafka.DeadLetterTopic,
+		inFlight:         make(map[string]redis.XMessage),
+	}, nil
+}
+
+// Start creates the consumer group on every stream, if needed, and begins
+// consuming
+func (s *Source) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return errors.New("redis source already started")
+	}
+
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	for _, stream := range s.streams {
+		err := s.client.XGroupCreateMkStream(ctx, stream, s.cfg.Group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return fmt.Errorf("failed to create consumer group on stream %s: %w", stream, err)
+		}
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	s.started = true
+
+	for _, stream := range s.streams {
+		s.wg.Add(1)
+		go s.consume(runCtx, stream)
+	}
+
+	log.Printf("Consuming Redis streams %v as %s in group %s", s.streams, s.cfg.Consumer, s.cfg.Group)
+	return nil
+}
+
+// consume reads one stream until ctx is cancelled: first the entries this
+// consumer read before a restart but never acknowledged, then new entries,
+// claiming stale entries of other consumers every ClaimInterval
+func (s *Source) consume(ctx context.Context, stream string) {
+	defer s.wg.Done()
+
+	s.readPending(ctx, stream)
+
+	var lastClaim time.Time
+	for ctx.Err() == nil {
+		if time.Since(lastClaim) >= s.cfg.ClaimInterval {
+			s.claim(ctx, stream)
+			lastClaim = time.Now()
+		}
+
+		streams, err := s.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    s.cfg.Group,
+			Consumer: s.cfg.Consumer,
+			Streams:  []string{stream, ">"},
+			Count:    int64(s.cfg.BatchSize),
+			Block:    s.cfg.BlockTimeout,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Error reading stream %s: %v", stream, err)
+			s.backoff(ctx)
+			continue
+		}
+
+		for _, xs := range streams {
+			for _, msg := range xs.Messages {
+				if ctx.Err() != nil {
+					return
+				}
+				s.handle(stream, msg, 1)
+			}
+		}
+	}
+}
+
+// readPending handles the entries already delivered to this consumer
+func (s *Source) readPending(ctx context.Context, stream string) {
+	start := "0"
+	for ctx.Err() == nil {
+		streams, err := s.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    s.cfg.Group,
+			Consumer: s.cfg.Consumer,
+			Streams:  []string{stream, start},
+			Count:    int64(s.cfg.BatchSize),
+			Block:    -1,
+		}).Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				log.Printf("Error reading pending entries of stream %s: %v", stream, err)
+			}
+			return
+		}
+
+		var messages []redis.XMessage
+		for _, xs := range streams {
+			messages = append(messages, xs.Messages...)
+		}
+		if len(messages) == 0 {
+			return
+		}
+
+		for _, msg := range messages {
+			if ctx.Err() != nil {
+				return
+			}
+			s.handle(stream, msg, s.deliveries(stream, msg.ID))
+		}
+		// Entries that failed again stay pending, so continue after them
+		start = messages[len(messages)-1].ID
+	}
+}
+
+// claim takes over the entries of the stream that have been pending for at
+// least ClaimMinIdle, whichever consumer they were delivered to, and
+// handles them
+func (s *Source) claim(ctx context.Context, stream string) {
+	start := "0-0"
+	for ctx.Err() == nil {
+		messages, next, err := s.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   stream,
+			Group:    s.cfg.Group,
+			Consumer: s.cfg.Consumer,
+			MinIdle:  s.cfg.ClaimMinIdle,
+			Start:    start,
+			Count:    int64(s.cfg.BatchSize),
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Error claiming stale entries of stream %s: %v", stream, err)
+			}
+			return
+		}
+
+		for _, msg := range messages {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Claimed entry %s of stream %s", msg.ID, stream)
+			s.handle(stream, msg, s.deliveries(stream, msg.ID))
+		}
+
+		if next == "0-0" || next == "" {
+			return
+		}
+		start = next
+	}
+}
+
+// deliveries returns the number of times an entry has been delivered,
+// including the current delivery
+func (s *Source) deliveries(stream, id string) int {
+	pending, err := s.client.XPendingExt(context.Background(), &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  s.cfg.Group,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		if err != nil {
+			log.Printf("Error reading delivery count of entry %s: %v", id, err)
+		}
+		return 1
+	}
+	return int(pending[0].RetryCount)
+}
+
+// handle decodes an entry, hands it to its stream's handler and acknowledges
+// it unless it failed transiently and may be delivered again
+func (s *Source) handle(stream string, msg redis.XMessage, deliveries int) {
+	rt := s.routes.Match(stream)
+	if rt == nil {
+		s.deadLetter(stream, msg, ingest.ErrorClassNoRoute, fmt.Errorf("no route for stream %s", stream))
+		return
+	}
+
+	value, key, headers := entryFields(msg)
+	notification, err := rt.Decoder.Decode(value, headers)
+	if err != nil {
+		log.Printf("Error decoding entry %s of stream %s: %v", msg.ID, stream, err)
+		s.deadLetter(stream, msg, ingest.ErrorClassDecode, err)
+		return
+	}
+
+	if notification.Priority == "" {
+		notification.Priority = rt.Priority
+	}
+
+	env := &models.Envelope{
+		Message:     notification,
+		Key:         key,
+		Headers:     headers,
+		Topic:       stream,
+		Timestamp:   entryTime(msg.ID),
+		MessageID:   msg.ID,
+		Attempt:     deliveries,
+		MaxAttempts: s.cfg.MaxDeliveries,
+	}
+	if deliveries > 1 {
+		env.NotificationID = s.client.HGet(context.Background(), s.notificationIDsKey(stream), msg.ID).Val()
+	}
+
+	s.track(stream, msg)
+	err = rt.Handler(env)
+	s.untrack(stream)
+
+	if err == nil {
+		s.ack(stream, msg.ID)
+		return
+	}
+
+	log.Printf("Error handling entry %s of stream %s: %v", msg.ID, stream, err)
+
+	if class := ingest.ClassifyError(err); class != "" {
+		s.deadLetter(stream, msg, class, err)
+		return
+	}
+	if deliveries >= s.cfg.MaxDeliveries {
+		log.Printf("Giving up on entry %s of stream %s after %d deliveries", msg.ID, stream, deliveries)
+		s.deadLetter(stream, msg, ingest.ErrorClassRetriesExhausted, err)
+		return
+	}
+
+	// Leave the entry pending so it is claimed again, and remember its
+	// notification row so the retry updates it
+	if env.NotificationID != "" {
+		if err := s.client.HSet(context.Background(), s.notificationIDsKey(stream), msg.ID, env.NotificationID).Err(); err != nil {
+			log.Printf("Error recording notification ID of entry %s: %v", msg.ID, err)
+		}
+	}
+}
+
+// ack acknowledges an entry and forgets its notification ID
+func (s *Source) ack(stream, id string) {
+	ctx := context.Background()
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, stream, s.cfg.Group, id)
+		pipe.HDel(ctx, s.notificationIDsKey(stream), id)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error acknowledging entry %s of stream %s: %v", id, stream, err)
+	}
+}
+
+// deadLetter copies an entry to the dead-letter stream with the failure
+// fields, then acknowledges it. Without a dead-letter stream the entry is
+// only acknowledged.
+func (s *Source) deadLetter(stream string, msg redis.XMessage, class string, cause error) {
+	if s.deadLetterStream != "" {
+		values := make(map[string]interface{}, len(msg.Values)+4)
+		for k, v := range msg.Values {
+			values[k] = v
+		}
+		values[ingest.HeaderErrorClass] = class
+		values[ingest.HeaderErrorMessage] = cause.Error()
+		values[ingest.HeaderSourceTopic] = stream
+		values[fieldSourceID] = msg.ID
+
+		err := s.client.XAdd(context.Background(), &redis.XAddArgs{
+			Stream: s.deadLetterStream,
+			Values: values,
+		}).Err()
+		if err != nil {
+			// Leave the entry pending rather than lose it
+			log.Printf("Error dead-lettering entry %s of stream %s: %v", msg.ID, stream, err)
+			return
+		}
+	}
+
+	s.ack(stream, msg.ID)
+}
+
+// notificationIDsKey names the hash holding the notification IDs of the
+// entries of stream awaiting another delivery
+func (s *Source) notificationIDsKey(stream string) string {
+	return fmt.Sprintf("%s:%s:notification-ids", stream, s.cfg.Group)
+}
+
+// track records the entry being handled for a stream
+func (s *Source) track(stream string, msg redis.XMessage) {
+	s.mu.Lock()
+	s.inFlight[stream] = msg
+	s.mu.Unlock()
+}
+
+// untrack clears the entry being handled for a stream
+func (s *Source) untrack(stream string) {
+	s.mu.Lock()
+	delete(s.inFlight, stream)
+	s.mu.Unlock()
+}
+
+// backoff waits before retrying a failed read
+func (s *Source) backoff(ctx context.Context) {
+	select {
+	case <-time.After(time.Second):
+	case <-ctx.Done():
+	}
+}
+
+// Stop stops reading and waits until ctx is done for the entries being
+// handled. Entries still being handled after that are reported as
+// abandoned; they stay pending and are claimed again later.
+func (s *Source) Stop(ctx context.Context) ingest.ShutdownReport {
+	s.mu.Lock()
+	if !s.started || s.stopped {
+		s.mu.Unlock()
+		return ingest.ShutdownReport{}
+	}
+	s.stopped = true
+	s.cancel()
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	var report ingest.ShutdownReport
+	select {
+	case <-done:
+		if err := s.client.Close(); err != nil {
+			log.Printf("Error closing Redis client: %v", err)
+		}
+	case <-ctx.Done():
+		s.mu.Lock()
+		for stream, msg := range s.inFlight {
+			report.Abandoned = append(report.Abandoned, ingest.AbandonedMessage{
+				Topic:     stream,
+				MessageID: msg.ID,
+				InFlight:  true,
+			})
+		}
+		s.mu.Unlock()
+	}
+
+	return report
+}
+
+// entryFields splits an entry into its payload, key and headers
+func entryFields(msg redis.XMessage) ([]byte, string, map[string]string) {
+	var value []byte
+	var key string
+	headers := make(map[string]string, len(msg.Values))
+
+	for field, v := range msg.Values {
+		str := fmt.Sprint(v)
+		switch field {
+		case FieldValue:
+			value = []byte(str)
+		case FieldKey:
+			key = str
+		default:
+			headers[field] = str
+		}
+	}
+	return value, key, headers
+}
+
+// entryTime returns the time encoded in an entry ID ("<unix ms>-<seq>")
+func entryTime(id string) time.Time {
+	ms, _, _ := strings.Cut(id, "-")
+	parsed, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(parsed)
+}
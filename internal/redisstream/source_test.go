@@ -0,0 +1,335 @@
+package redisstream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/ingest"
+	"github.com/notification_service/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	testStream           = "notifications"
+	testDeadLetterStream = "notifications.dlq"
+	testGroup            = "notification-service"
+	testPayload          = `{"user_id":"user-1","type":"email","channel":"a@example.com","content":"Hello"}`
+)
+
+// recorder is a handler recording the envelopes it is called with and
+// returning the errors queued for it, in order
+type recorder struct {
+	mu   sync.Mutex
+	envs []models.Envelope
+	errs []error
+	// notificationID is set on the envelopes, as the service does when it
+	// stores the notification
+	notificationID string
+}
+
+func (r *recorder) handle(env *models.Envelope) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.envs = append(r.envs, *env)
+	if env.NotificationID == "" {
+		env.NotificationID = r.notificationID
+	}
+	if len(r.errs) > 0 {
+		err := r.errs[0]
+		r.errs = r.errs[1:]
+		return err
+	}
+	return nil
+}
+
+// handled returns the envelopes handled so far
+func (r *recorder) handled() []models.Envelope {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]models.Envelope(nil), r.envs...)
+}
+
+// testRedis is a miniredis server and a client inspecting it
+type testRedis struct {
+	server *miniredis.Miniredis
+	client *redis.Client
+}
+
+func newTestRedis(t *testing.T) *testRedis {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return &testRedis{server: server, client: client}
+}
+
+// add appends an entry to stream and returns its ID
+func (r *testRedis) add(t *testing.T, stream string, values map[string]interface{}) string {
+	t.Helper()
+
+	id, err := r.client.XAdd(context.Background(), &redis.XAddArgs{Stream: stream, Values: values}).Result()
+	if err != nil {
+		t.Fatalf("XAdd: %v", err)
+	}
+	return id
+}
+
+// pending returns the number of entries of testStream awaiting an ack
+func (r *testRedis) pending(t *testing.T) int64 {
+	t.Helper()
+
+	pending, err := r.client.XPending(context.Background(), testStream, testGroup).Result()
+	if err != nil {
+		t.Fatalf("XPending: %v", err)
+	}
+	return pending.Count
+}
+
+// deadLettered returns the entries of the dead-letter stream
+func (r *testRedis) deadLettered(t *testing.T) []redis.XMessage {
+	t.Helper()
+
+	messages, err := r.client.XRange(context.Background(), testDeadLetterStream, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("XRange: %v", err)
+	}
+	return messages
+}
+
+// testConfig returns a configuration reading testStream as consumer-1,
+// claiming entries idle for 20ms
+func testConfig() *config.Config {
+	return &config.Config{
+		Kafka: config.KafkaConfig{
+			DeadLetterTopic: testDeadLetterStream,
+			Routes:          []config.RouteConfig{{Topic: testStream, Handler: config.DefaultHandler}},
+		},
+		Redis: config.RedisConfig{
+			Group:         testGroup,
+			Consumer:      "consumer-1",
+			BatchSize:     10,
+			BlockTimeout:  10 * time.Millisecond,
+			ClaimMinIdle:  20 * time.Millisecond,
+			ClaimInterval: 10 * time.Millisecond,
+			MaxDeliveries: 3,
+		},
+	}
+}
+
+// startSource starts a source on the server of r, stopped when the test ends
+func startSource(t *testing.T, r *testRedis, cfg *config.Config, handler ingest.Handler) *Source {
+	t.Helper()
+
+	client := redis.NewClient(&redis.Options{Addr: r.server.Addr()})
+	source, err := NewSourceWithClient(cfg, client, map[string]ingest.Handler{config.DefaultHandler: handler}, nil)
+	if err != nil {
+		t.Fatalf("NewSourceWithClient: %v", err)
+	}
+	if err := source.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		source.Stop(ctx)
+	})
+	return source
+}
+
+// eventually fails the test if cond does not become true within a second
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSourceHandlesAndAcknowledges(t *testing.T) {
+	r := newTestRedis(t)
+	handler := &recorder{}
+	startSource(t, r, testConfig(), handler.handle)
+
+	id := r.add(t, testStream, map[string]interface{}{
+		FieldValue: testPayload,
+		FieldKey:   "user-1",
+		"trace-id": "abc",
+	})
+	eventually(t, "the entry to be handled", func() bool { return len(handler.handled()) == 1 })
+	eventually(t, "the entry to be acknowledged", func() bool { return r.pending(t) == 0 })
+
+	env := handler.handled()[0]
+	if env.Message.UserID != "user-1" || env.Message.Content != "Hello" {
+		t.Errorf("message = %+v", env.Message)
+	}
+	if env.Key != "user-1" || env.Topic != testStream || env.MessageID != id {
+		t.Errorf("key = %q, topic = %q, message ID = %q", env.Key, env.Topic, env.MessageID)
+	}
+	if env.Headers["trace-id"] != "abc" || len(env.Headers) != 1 {
+		t.Errorf("headers = %v, want only trace-id", env.Headers)
+	}
+	if env.Attempt != 1 || env.MaxAttempts != 3 || env.NotificationID != "" {
+		t.Errorf("attempt %d of %d, notification ID %q", env.Attempt, env.MaxAttempts, env.NotificationID)
+	}
+	if entries := r.deadLettered(t); len(entries) != 0 {
+		t.Errorf("%d dead-lettered entries, want none", len(entries))
+	}
+}
+
+func TestSourceReclaimsTransientFailures(t *testing.T) {
+	r := newTestRedis(t)
+	handler := &recorder{
+		errs:           []error{errors.New("provider unavailable")},
+		notificationID: "notification-1",
+	}
+	startSource(t, r, testConfig(), handler.handle)
+
+	r.add(t, testStream, map[string]interface{}{FieldValue: testPayload})
+	eventually(t, "the entry to be claimed again", func() bool { return len(handler.handled()) == 2 })
+	eventually(t, "the entry to be acknowledged", func() bool { return r.pending(t) == 0 })
+
+	retry := handler.handled()[1]
+	if retry.Attempt != 2 || retry.NotificationID != "notification-1" {
+		t.Errorf("retry is attempt %d of notification %q, want attempt 2 of notification-1", retry.Attempt, retry.NotificationID)
+	}
+
+	// The notification ID is forgotten once the entry is acknowledged
+	ids, err := r.client.HLen(context.Background(), testStream+":"+testGroup+":notification-ids").Result()
+	if err != nil {
+		t.Fatalf("HLen: %v", err)
+	}
+	if ids != 0 {
+		t.Errorf("%d notification IDs recorded, want none", ids)
+	}
+}
+
+func TestSourceClaimsEntriesOfOtherConsumers(t *testing.T) {
+	r := newTestRedis(t)
+	ctx := context.Background()
+
+	// Another consumer reads the entry and stops without acknowledging it
+	if err := r.client.XGroupCreateMkStream(ctx, testStream, testGroup, "0").Err(); err != nil {
+		t.Fatalf("XGroupCreateMkStream: %v", err)
+	}
+	id := r.add(t, testStream, map[string]interface{}{FieldValue: testPayload})
+	err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    testGroup,
+		Consumer: "consumer-2",
+		Streams:  []string{testStream, ">"},
+		Block:    -1,
+	}).Err()
+	if err != nil {
+		t.Fatalf("XReadGroup: %v", err)
+	}
+
+	handler := &recorder{}
+	startSource(t, r, testConfig(), handler.handle)
+	eventually(t, "the entry to be claimed", func() bool { return len(handler.handled()) == 1 })
+	eventually(t, "the entry to be acknowledged", func() bool { return r.pending(t) == 0 })
+
+	env := handler.handled()[0]
+	if env.MessageID != id || env.Attempt != 2 {
+		t.Errorf("handled entry %s as attempt %d, want %s as attempt 2", env.MessageID, env.Attempt, id)
+	}
+}
+
+func TestSourceReadsItsPendingEntriesOnStart(t *testing.T) {
+	r := newTestRedis(t)
+	ctx := context.Background()
+
+	// This consumer read the entry before it restarted
+	if err := r.client.XGroupCreateMkStream(ctx, testStream, testGroup, "0").Err(); err != nil {
+		t.Fatalf("XGroupCreateMkStream: %v", err)
+	}
+	id := r.add(t, testStream, map[string]interface{}{FieldValue: testPayload})
+	err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    testGroup,
+		Consumer: "consumer-1",
+		Streams:  []string{testStream, ">"},
+		Block:    -1,
+	}).Err()
+	if err != nil {
+		t.Fatalf("XReadGroup: %v", err)
+	}
+
+	cfg := testConfig()
+	// Claiming would also find the entry, so leave it to the pending read
+	cfg.Redis.ClaimMinIdle = time.Hour
+	handler := &recorder{}
+	startSource(t, r, cfg, handler.handle)
+	eventually(t, "the pending entry to be handled", func() bool { return len(handler.handled()) == 1 })
+	eventually(t, "the entry to be acknowledged", func() bool { return r.pending(t) == 0 })
+
+	if env := handler.handled()[0]; env.MessageID != id {
+		t.Errorf("handled entry %s, want %s", env.MessageID, id)
+	}
+}
+
+func TestSourceDeadLetters(t *testing.T) {
+	unavailable := errors.New("provider unavailable")
+
+	tests := []struct {
+		name    string
+		payload string
+		errs    []error
+		calls   int
+		class   string
+	}{
+		{
+			name:    "decode error",
+			payload: `{"user_id":`,
+			class:   ingest.ErrorClassDecode,
+		},
+		{
+			name:    "permanent failure",
+			payload: testPayload,
+			errs:    []error{models.NewPermanentError(errors.New("address rejected"))},
+			calls:   1,
+			class:   ingest.ErrorClassPermanent,
+		},
+		{
+			name:    "deliveries exhausted",
+			payload: testPayload,
+			errs:    []error{unavailable, unavailable, unavailable},
+			calls:   3,
+			class:   ingest.ErrorClassRetriesExhausted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRedis(t)
+			handler := &recorder{errs: tt.errs}
+			startSource(t, r, testConfig(), handler.handle)
+
+			id := r.add(t, testStream, map[string]interface{}{FieldValue: tt.payload, "trace-id": "abc"})
+			eventually(t, "the entry to be dead-lettered", func() bool { return len(r.deadLettered(t)) == 1 })
+			eventually(t, "the entry to be acknowledged", func() bool { return r.pending(t) == 0 })
+
+			if calls := len(handler.handled()); calls != tt.calls {
+				t.Errorf("handled %d times, want %d", calls, tt.calls)
+			}
+
+			values := r.deadLettered(t)[0].Values
+			if values[ingest.HeaderErrorClass] != tt.class {
+				t.Errorf("error class = %v, want %s", values[ingest.HeaderErrorClass], tt.class)
+			}
+			if values[ingest.HeaderSourceTopic] != testStream || values[fieldSourceID] != id {
+				t.Errorf("source = %v %v, want %s %s", values[ingest.HeaderSourceTopic], values[fieldSourceID], testStream, id)
+			}
+			if values[FieldValue] != tt.payload || values["trace-id"] != "abc" {
+				t.Errorf("values = %v, want the original fields", values)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package schemaregistry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/notification_service/internal/config"
+)
+
+// Schema types reported by the registry
+const (
+	SchemaTypeAvro     = "AVRO"
+	SchemaTypeProtobuf = "PROTOBUF"
+	SchemaTypeJSON     = "JSON"
+)
+
+// Schema is a schema registered under a global ID
+type Schema struct {
+	ID     int
+	Type   string
+	Schema string
+}
+
+// Client fetches schemas by ID from a Confluent-compatible schema registry.
+// Schemas are immutable once registered, so every schema is fetched once and
+// cached for the lifetime of the client.
+type Client struct {
+	url        string
+	username   string
+	password   string
+	httpClient *http.Client
+
+	mu      sync.RWMutex
+	schemas map[int]*Schema
+}
+
+// NewClient creates a new schema registry client
+func NewClient(cfg *config.Config) (*Client, error) {
+	if cfg.SchemaRegistry.URL == "" {
+		return nil, errors.New("schema registry URL must be provided")
+	}
+
+	return &Client{
+		url:        strings.TrimSuffix(cfg.SchemaRegistry.URL, "/"),
+		username:   cfg.SchemaRegistry.Username,
+		password:   cfg.SchemaRegistry.Password,
+		httpClient: &http.Client{Timeout: cfg.SchemaRegistry.Timeout},
+		schemas:    make(map[int]*Schema),
+	}, nil
+}
+
+// Schema returns the schema with the given ID
+func (c *Client) Schema(id int) (*Schema, error) {
+	c.mu.RLock()
+	schema, ok := c.schemas[id]
+	c.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+
+	schema, err := c.fetch(id)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.schemas[id] = schema
+	c.mu.Unlock()
+
+	return schema, nil
+}
+
+// fetch retrieves a schema from the registry
+func (c *Client) fetch(id int) (*Schema, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/schemas/ids/%d", c.url, id), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch schema %d: %w", id, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("failed to fetch schema %d, status code: %d, body: %s", id, resp.StatusCode, body)
+	}
+
+	var result struct {
+		Schema     string `json:"schema"`
+		SchemaType string `json:"schemaType"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode schema %d: %w", id, err)
+	}
+
+	// The registry omits the type of Avro schemas
+	schemaType := result.SchemaType
+	if schemaType == "" {
+		schemaType = SchemaTypeAvro
+	}
+
+	return &Schema{ID: id, Type: schemaType, Schema: result.Schema}, nil
+}
@@ -0,0 +1,137 @@
+package schemaregistry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/notification_service/internal/config"
+)
+
+// newTestClient returns a client of a registry served by handler
+func newTestClient(t *testing.T, username, password string, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(&config.Config{SchemaRegistry: config.SchemaRegistryConfig{
+		URL:      server.URL + "/",
+		Username: username,
+		Password: password,
+		Timeout:  time.Second,
+	}})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client
+}
+
+func TestSchemaAvroHasNoSchemaType(t *testing.T) {
+	client := newTestClient(t, "", "", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/schemas/ids/7" {
+			t.Errorf("path = %s, want /schemas/ids/7", r.URL.Path)
+		}
+		if got := r.Header.Get("Accept"); got != "application/vnd.schemaregistry.v1+json" {
+			t.Errorf("Accept = %q", got)
+		}
+		w.Write([]byte(`{"schema":"{\"type\":\"string\"}"}`))
+	})
+
+	schema, err := client.Schema(7)
+	if err != nil {
+		t.Fatalf("Schema: %v", err)
+	}
+	if schema.ID != 7 || schema.Type != SchemaTypeAvro || schema.Schema != `{"type":"string"}` {
+		t.Errorf("schema = %+v", schema)
+	}
+}
+
+func TestSchemaProtobuf(t *testing.T) {
+	client := newTestClient(t, "", "", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"schemaType":"PROTOBUF","schema":"syntax = \"proto3\";"}`))
+	})
+
+	schema, err := client.Schema(8)
+	if err != nil {
+		t.Fatalf("Schema: %v", err)
+	}
+	if schema.Type != SchemaTypeProtobuf || schema.Schema != `syntax = "proto3";` {
+		t.Errorf("schema = %+v", schema)
+	}
+}
+
+func TestSchemaErrorStatus(t *testing.T) {
+	client := newTestClient(t, "", "", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error_code":40403,"message":"Schema not found"}`))
+	})
+
+	_, err := client.Schema(9)
+	if err == nil {
+		t.Fatal("Schema succeeded on a 404")
+	}
+	if !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "Schema not found") {
+		t.Errorf("err = %v, want the status and body", err)
+	}
+
+	// Failures are not cached
+	if _, err := client.Schema(9); err == nil {
+		t.Error("second Schema succeeded on a 404")
+	}
+}
+
+func TestSchemaBasicAuth(t *testing.T) {
+	client := newTestClient(t, "registry-user", "secret", func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "registry-user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error_code":401,"message":"Unauthorized"}`))
+			return
+		}
+		w.Write([]byte(`{"schema":"\"string\""}`))
+	})
+
+	if _, err := client.Schema(1); err != nil {
+		t.Errorf("Schema: %v", err)
+	}
+}
+
+func TestSchemaWithoutCredentials(t *testing.T) {
+	client := newTestClient(t, "", "", func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("Authorization = %q, want none", auth)
+		}
+		w.Write([]byte(`{"schema":"\"string\""}`))
+	})
+
+	if _, err := client.Schema(1); err != nil {
+		t.Errorf("Schema: %v", err)
+	}
+}
+
+func TestSchemaFetchedOnce(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestClient(t, "", "", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(`{"schema":"\"string\""}`))
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.Schema(5); err != nil {
+			t.Fatalf("Schema: %v", err)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d requests for one schema, want 1", n)
+	}
+
+	if _, err := client.Schema(6); err != nil {
+		t.Fatalf("Schema: %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("%d requests for two schemas, want 2", n)
+	}
+}
@@ -0,0 +1,163 @@
+package supabase
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/notification_service/internal/models"
+)
+
+// InsertBulkJob stores a new bulk resend job and returns its ID
+func (c *Client) InsertBulkJob(job *models.BulkResendJob) (string, error) {
+	now := time.Now()
+	job.CreatedAt = now
+	job.UpdatedAt = now
+
+	var inserted []struct {
+		ID string `json:"id"`
+	}
+
+	err := c.client.DB.From(c.bulkJobsTable).Insert(job).Execute(&inserted)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert bulk job: %w", err)
+	}
+	if len(inserted) == 0 {
+		return "", errors.New("failed to insert bulk job: no row returned")
+	}
+
+	return inserted[0].ID, nil
+}
+
+// GetBulkJob retrieves a bulk resend job by ID
+func (c *Client) GetBulkJob(id string) (*models.BulkResendJob, error) {
+	var jobs []models.BulkResendJob
+
+	err := c.client.DB.From(c.bulkJobsTable).Select("*").
+		Filter("id", "eq", id).
+		Execute(&jobs)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bulk job: %w", err)
+	}
+
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+
+	return &jobs[0], nil
+}
+
+// ListBulkJobs returns the newest bulk resend jobs, at most limit, in any of
+// the statuses, or in any status if none is given
+func (c *Client) ListBulkJobs(statuses []models.BulkJobStatus, limit int) ([]models.BulkResendJob, error) {
+	sel := c.client.DB.From(c.bulkJobsTable).Select("*").Limit(limit)
+	if len(statuses) > 0 {
+		sel.Filter("status", "in", "("+joinStatuses(statuses)+")")
+	}
+	param(&sel.FilterRequestBuilder, "order", orderBy(false, "created_at"))
+
+	var jobs []models.BulkResendJob
+	err := sel.Execute(&jobs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bulk jobs: %w", err)
+	}
+
+	if jobs == nil {
+		jobs = []models.BulkResendJob{}
+	}
+	return jobs, nil
+}
+
+// TransitionBulkJob sets the status of a bulk resend job only if it currently
+// has one of the from statuses, recording errMsg and owner if they are not
+// empty. It returns the updated job, or nil if the job does not exist or has
+// another status.
+func (c *Client) TransitionBulkJob(id string, from []models.BulkJobStatus, to models.BulkJobStatus, errMsg, owner string) (*models.BulkResendJob, error) {
+	now := time.Now()
+	updateData := map[string]interface{}{
+		"status":     to,
+		"updated_at": now,
+	}
+	if errMsg != "" {
+		updateData["error"] = errMsg
+	}
+	if owner != "" {
+		updateData["owner"] = owner
+	}
+	if to == models.BulkJobStatusCompleted {
+		updateData["completed_at"] = now
+	}
+
+	return c.updateBulkJob(updateData, []condition{
+		{"id", "eq", id},
+		{"status", "in", "(" + joinStatuses(from) + ")"},
+	})
+}
+
+// SaveBulkJobProgress records the counters, cursor and error of a job that is
+// running or paused, and still owned by job.Owner. It returns the stored job,
+// whose status tells whether it was paused meanwhile, or nil if the job is in
+// neither status or another instance took it over.
+func (c *Client) SaveBulkJobProgress(job *models.BulkResendJob) (*models.BulkResendJob, error) {
+	updateData := map[string]interface{}{
+		"processed":  job.Processed,
+		"resent":     job.Resent,
+		"skipped":    job.Skipped,
+		"failed":     job.Failed,
+		"cursor":     job.Cursor,
+		"error":      job.Error,
+		"updated_at": time.Now(),
+	}
+
+	return c.updateBulkJob(updateData, []condition{
+		{"id", "eq", job.ID},
+		{"status", "in", fmt.Sprintf("(%s,%s)", models.BulkJobStatusRunning, models.BulkJobStatusPaused)},
+		{"owner", "eq", job.Owner},
+	})
+}
+
+// ClaimBulkJob makes owner take over a running job that has not progressed
+// since updatedAt, by updating it only if it still has not. It returns the
+// claimed job, or nil if another instance progressed or claimed it first.
+func (c *Client) ClaimBulkJob(id string, updatedAt time.Time, owner string) (*models.BulkResendJob, error) {
+	updateData := map[string]interface{}{
+		"owner":      owner,
+		"updated_at": time.Now(),
+	}
+
+	return c.updateBulkJob(updateData, []condition{
+		{"id", "eq", id},
+		{"status", "eq", string(models.BulkJobStatusRunning)},
+		{"updated_at", "eq", formatTime(updatedAt)},
+	})
+}
+
+// updateBulkJob updates the bulk job matching the conditions, returning it,
+// or nil if none matched
+func (c *Client) updateBulkJob(updateData map[string]interface{}, conds []condition) (*models.BulkResendJob, error) {
+	update := c.client.DB.From(c.bulkJobsTable).Update(updateData)
+	where(update, conds)
+
+	var updated []models.BulkResendJob
+	err := update.Execute(&updated)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to update bulk job: %w", err)
+	}
+
+	if len(updated) == 0 {
+		return nil, nil
+	}
+	return &updated[0], nil
+}
+
+// joinStatuses formats job statuses as a comma-separated list
+func joinStatuses(statuses []models.BulkJobStatus) string {
+	values := make([]string, len(statuses))
+	for i, status := range statuses {
+		values[i] = string(status)
+	}
+	return strings.Join(values, ",")
+}
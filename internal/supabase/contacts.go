@@ -0,0 +1,26 @@
+package supabase
+
+import (
+	"fmt"
+
+	"github.com/notification_service/internal/models"
+)
+
+// ListVerifiedContacts returns the verified contact points of a user, the
+// most recently updated first
+func (c *Client) ListVerifiedContacts(userID string) ([]models.Contact, error) {
+	var contacts []models.Contact
+
+	sel := c.client.DB.From(c.contactsTable).Select("*")
+	sel.Filter("user_id", "eq", userID).
+		Filter("verified", "eq", "true")
+	param(&sel.FilterRequestBuilder, "order", orderBy(false, "updated_at"))
+
+	err := sel.Execute(&contacts)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list contacts: %w", err)
+	}
+
+	return contacts, nil
+}
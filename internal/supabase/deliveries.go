@@ -0,0 +1,78 @@
+package supabase
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/notification_service/internal/models"
+)
+
+// InsertDeliveries stores the deliveries of a multi-channel notification and
+// returns them with their IDs
+func (c *Client) InsertDeliveries(deliveries []models.Delivery) ([]models.Delivery, error) {
+	now := time.Now()
+	for i := range deliveries {
+		deliveries[i].CreatedAt = now
+		deliveries[i].UpdatedAt = now
+	}
+
+	var inserted []models.Delivery
+	err := c.client.DB.From(c.deliveriesTable).Insert(deliveries).Execute(&inserted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert deliveries: %w", err)
+	}
+
+	return inserted, nil
+}
+
+// ListDeliveries returns the deliveries of a multi-channel notification
+func (c *Client) ListDeliveries(notificationID string) ([]models.Delivery, error) {
+	var deliveries []models.Delivery
+
+	sel := c.client.DB.From(c.deliveriesTable).Select("*")
+	sel.Filter("notification_id", "eq", notificationID)
+	param(&sel.FilterRequestBuilder, "order", orderBy(true, "created_at"))
+
+	err := sel.Execute(&deliveries)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// UpdateDelivery records the outcome of an attempt to send a delivery: its
+// status, attempts, receipt and error
+func (c *Client) UpdateDelivery(delivery *models.Delivery) error {
+	now := time.Now()
+	updateData := map[string]interface{}{
+		"status":      delivery.Status,
+		"attempts":    delivery.Attempts,
+		"notifier":    delivery.Notifier,
+		"message_id":  delivery.MessageID,
+		"error":       nil,
+		"error_class": nil,
+		"updated_at":  now,
+	}
+	if delivery.Error != "" {
+		updateData["error"] = delivery.Error
+		updateData["error_class"] = delivery.ErrorClass
+	}
+	if delivery.Status == models.NotificationStatusSent {
+		updateData["sent_at"] = now
+	}
+	if delivery.SuppressionReason != "" {
+		updateData["suppression_reason"] = delivery.SuppressionReason
+	}
+
+	err := c.client.DB.From(c.deliveriesTable).Update(updateData).
+		Filter("id", "eq", delivery.ID).
+		Execute(nil)
+
+	if err != nil {
+		return fmt.Errorf("failed to update delivery: %w", err)
+	}
+
+	return nil
+}
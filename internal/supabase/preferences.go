@@ -0,0 +1,23 @@
+package supabase
+
+import (
+	"fmt"
+
+	"github.com/notification_service/internal/models"
+)
+
+// ListPreferences returns a user's preferences for a category
+func (c *Client) ListPreferences(userID, category string) (models.Preferences, error) {
+	var preferences models.Preferences
+
+	err := c.client.DB.From(c.preferencesTable).Select("*").
+		Filter("user_id", "eq", userID).
+		Filter("category", "eq", category).
+		Execute(&preferences)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list preferences: %w", err)
+	}
+
+	return preferences, nil
+}
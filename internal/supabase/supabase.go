@@ -1,19 +1,42 @@
 package supabase
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	postgrest "github.com/nedpals/postgrest-go/pkg"
 	supabase "github.com/nedpals/supabase-go"
 	"github.com/notification_service/internal/config"
 	"github.com/notification_service/internal/models"
 )
 
+var (
+	// ErrNotFound is returned when a notification does not exist
+	ErrNotFound = errors.New("notification not found")
+	// ErrInvalidCursor is returned when listing with a malformed cursor, or
+	// one of a listing in the other order
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrJobNotFound is returned when a bulk job does not exist
+	ErrJobNotFound = errors.New("bulk job not found")
+)
+
+// countPageSize is the number of notifications read per request when
+// counting them
+const countPageSize = 1000
+
 // Client represents a Supabase client
 type Client struct {
-	client    *supabase.Client
-	tableName string
+	client           *supabase.Client
+	tableName        string
+	auditTable       string
+	bulkJobsTable    string
+	deliveriesTable  string
+	contactsTable    string
+	preferencesTable string
 }
 
 // NewClient creates a new Supabase client
@@ -25,8 +48,13 @@ func NewClient(cfg *config.Config) (*Client, error) {
 	client := supabase.CreateClient(cfg.Supabase.URL, cfg.Supabase.APIKey)
 
 	return &Client{
-		client:    client,
-		tableName: cfg.Supabase.NotificationsTable,
+		client:           client,
+		tableName:        cfg.Supabase.NotificationsTable,
+		auditTable:       cfg.Supabase.AuditTable,
+		bulkJobsTable:    cfg.Supabase.BulkJobsTable,
+		deliveriesTable:  cfg.Supabase.DeliveriesTable,
+		contactsTable:    cfg.Supabase.ContactsTable,
+		preferencesTable: cfg.Supabase.PreferencesTable,
 	}, nil
 }
 
@@ -36,29 +64,42 @@ func (c *Client) InsertNotification(notification *models.Notification) (string,
 	if notification.Status == "" {
 		notification.Status = models.NotificationStatusPending
 	}
-	
+
 	now := time.Now()
 	notification.CreatedAt = now
 	notification.UpdatedAt = now
 
-	// Insert the notification
-	var result struct {
+	// Insert the notification; the inserted rows are returned
+	var inserted []struct {
 		ID string `json:"id"`
 	}
-	
-	err := c.client.DB.From(c.tableName).Insert(notification, &result, false)
+
+	err := c.client.DB.From(c.tableName).Insert(notification).Execute(&inserted)
 	if err != nil {
 		return "", fmt.Errorf("failed to insert notification: %w", err)
 	}
+	if len(inserted) == 0 {
+		return "", errors.New("failed to insert notification: no row returned")
+	}
 
-	return result.ID, nil
+	return inserted[0].ID, nil
 }
 
-// UpdateNotificationStatus updates the status of a notification
-func (c *Client) UpdateNotificationStatus(id string, status models.NotificationStatus) error {
+// UpdateNotificationStatus updates the status of a notification and the
+// error that caused it, with its class. Both are cleared when errMsg is empty.
+// Only a notification that is still being sent, i.e. pending or retrying, is
+// updated, so that a cancellation made meanwhile stands; updated reports
+// whether it was.
+func (c *Client) UpdateNotificationStatus(id string, status models.NotificationStatus, errMsg, errClass string) (bool, error) {
 	updateData := map[string]interface{}{
-		"status":     status,
-		"updated_at": time.Now(),
+		"status":      status,
+		"updated_at":  time.Now(),
+		"error":       nil,
+		"error_class": nil,
+	}
+	if errMsg != "" {
+		updateData["error"] = errMsg
+		updateData["error_class"] = errClass
 	}
 
 	// If the notification was sent, update the sent_at field
@@ -67,12 +108,130 @@ func (c *Client) UpdateNotificationStatus(id string, status models.NotificationS
 		updateData["sent_at"] = sentAt
 	}
 
-	err := c.client.DB.From(c.tableName).Update(updateData, supabase.FilterOptions{
-		Filters: []string{fmt.Sprintf("id.eq.%s", id)},
-	}, nil)
+	updated, err := c.updateSending(id, updateData)
+	if err != nil {
+		return false, fmt.Errorf("failed to update notification status: %w", err)
+	}
+
+	return updated, nil
+}
+
+// SuppressNotification marks a notification suppressed, with the reason it
+// was not sent. Like UpdateNotificationStatus, it only updates a pending or
+// retrying notification and reports whether it did.
+func (c *Client) SuppressNotification(id, reason string) (bool, error) {
+	updateData := map[string]interface{}{
+		"status":             models.NotificationStatusSuppressed,
+		"suppression_reason": reason,
+		"updated_at":         time.Now(),
+		"error":              nil,
+		"error_class":        nil,
+	}
+
+	updated, err := c.updateSending(id, updateData)
+	if err != nil {
+		return false, fmt.Errorf("failed to suppress notification: %w", err)
+	}
+
+	return updated, nil
+}
 
+// updateSending applies updateData to a notification that is pending or
+// retrying, and reports whether there was one
+func (c *Client) updateSending(id string, updateData map[string]interface{}) (bool, error) {
+	var updated []models.Notification
+	err := c.client.DB.From(c.tableName).Update(updateData).
+		Filter("id", "eq", id).
+		Filter("status", "in", fmt.Sprintf("(%s,%s)", models.NotificationStatusPending, models.NotificationStatusRetrying)).
+		Execute(&updated)
 	if err != nil {
-		return fmt.Errorf("failed to update notification status: %w", err)
+		return false, err
+	}
+
+	return len(updated) > 0, nil
+}
+
+// TransitionNotificationStatus sets the status of a notification only if it
+// currently has one of the from statuses, so that concurrent transitions
+// cannot both succeed. It returns the updated notification, or nil if the
+// notification does not exist or has another status.
+func (c *Client) TransitionNotificationStatus(id string, from []models.NotificationStatus, to models.NotificationStatus) (*models.Notification, error) {
+	statuses := make([]string, len(from))
+	for i, status := range from {
+		statuses[i] = string(status)
+	}
+
+	updateData := map[string]interface{}{
+		"status":     to,
+		"updated_at": time.Now(),
+	}
+
+	var updated []models.Notification
+	err := c.client.DB.From(c.tableName).Update(updateData).
+		Filter("id", "eq", id).
+		Filter("status", "in", "("+strings.Join(statuses, ",")+")").
+		Execute(&updated)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to update notification status: %w", err)
+	}
+
+	if len(updated) == 0 {
+		return nil, nil
+	}
+	return &updated[0], nil
+}
+
+// InsertAuditEntry records an operation performed on a notification
+func (c *Client) InsertAuditEntry(entry *models.AuditEntry) error {
+	entry.CreatedAt = time.Now()
+
+	err := c.client.DB.From(c.auditTable).Insert(entry).Execute(nil)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateNotificationAttempts records the delivery attempt a notification is on
+func (c *Client) UpdateNotificationAttempts(id string, attempts int) error {
+	updateData := map[string]interface{}{
+		"attempts":   attempts,
+		"updated_at": time.Now(),
+	}
+
+	err := c.client.DB.From(c.tableName).Update(updateData).
+		Filter("id", "eq", id).
+		Execute(nil)
+
+	if err != nil {
+		return fmt.Errorf("failed to update notification attempts: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateNotificationChannels records the channels a notification was sent
+// through, and the one it reached, if any
+func (c *Client) UpdateNotificationChannels(id string, attempts []models.ChannelAttempt, sentType models.NotificationType, sentChannel string) error {
+	updateData := map[string]interface{}{
+		"channel_attempts": attempts,
+		"sent_type":        nil,
+		"sent_channel":     nil,
+		"updated_at":       time.Now(),
+	}
+	if sentChannel != "" {
+		updateData["sent_type"] = sentType
+		updateData["sent_channel"] = sentChannel
+	}
+
+	err := c.client.DB.From(c.tableName).Update(updateData).
+		Filter("id", "eq", id).
+		Execute(nil)
+
+	if err != nil {
+		return fmt.Errorf("failed to update notification channels: %w", err)
 	}
 
 	return nil
@@ -81,18 +240,216 @@ func (c *Client) UpdateNotificationStatus(id string, status models.NotificationS
 // GetNotification retrieves a notification by ID
 func (c *Client) GetNotification(id string) (*models.Notification, error) {
 	var notifications []models.Notification
-	
-	err := c.client.DB.From(c.tableName).Select("*", "", false).
+
+	err := c.client.DB.From(c.tableName).Select("*").
 		Filter("id", "eq", id).
 		Execute(&notifications)
-	
+
 	if err != nil {
 		return nil, fmt.Errorf("failed to get notification: %w", err)
 	}
 
 	if len(notifications) == 0 {
-		return nil, fmt.Errorf("notification not found: %s", id)
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
 	}
 
 	return &notifications[0], nil
-} 
\ No newline at end of file
+}
+
+// ListNotifications returns a page of the notifications matching a query,
+// ordered by creation time and then by ID so that pages are stable. Pages
+// continue after the last notification of the previous page, so
+// notifications created in the meantime do not shift them.
+func (c *Client) ListNotifications(query *models.NotificationQuery) (*models.NotificationPage, error) {
+	ascending := query.Order == models.SortAscending
+
+	// One more than the page tells whether there is a next page
+	sel := c.client.DB.From(c.tableName).Select("*").Limit(query.Limit + 1)
+	where(&sel.FilterRequestBuilder, filterConditions(&query.Filter))
+	if query.Cursor != "" {
+		cur, err := decodeCursor(query.Cursor)
+		if err != nil || cur.Order != query.Order {
+			return nil, ErrInvalidCursor
+		}
+		param(&sel.FilterRequestBuilder, "or", after(cur.CreatedAt, cur.ID, ascending))
+	}
+	param(&sel.FilterRequestBuilder, "order", orderBy(ascending, "created_at", "id"))
+
+	var notifications []models.Notification
+	err := sel.Execute(&notifications)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", err)
+	}
+
+	page := &models.NotificationPage{Notifications: notifications}
+	if len(notifications) > query.Limit {
+		page.Notifications = notifications[:query.Limit]
+		page.NextCursor = CursorAfter(&page.Notifications[query.Limit-1], query.Order)
+	}
+	if page.Notifications == nil {
+		page.Notifications = []models.Notification{}
+	}
+
+	return page, nil
+}
+
+// CountNotifications returns the number of notifications matching a filter.
+// They are read in pages of IDs, since the count is not returned.
+func (c *Client) CountNotifications(filter *models.NotificationFilter) (int, error) {
+	count := 0
+	var last *models.Notification
+	for {
+		sel := c.client.DB.From(c.tableName).Select("id", "created_at").Limit(countPageSize)
+		where(&sel.FilterRequestBuilder, filterConditions(filter))
+		if last != nil {
+			param(&sel.FilterRequestBuilder, "or", after(last.CreatedAt, last.ID, true))
+		}
+		param(&sel.FilterRequestBuilder, "order", orderBy(true, "created_at", "id"))
+
+		var notifications []models.Notification
+		err := sel.Execute(&notifications)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count notifications: %w", err)
+		}
+
+		count += len(notifications)
+		if len(notifications) < countPageSize {
+			return count, nil
+		}
+		last = &notifications[len(notifications)-1]
+	}
+}
+
+// condition is a filter on a column, as in column=operator.value
+type condition struct {
+	column   string
+	operator string
+	value    string
+}
+
+// filterConditions returns the conditions selecting the notifications that
+// match a filter
+func filterConditions(f *models.NotificationFilter) []condition {
+	var conds []condition
+	switch len(f.UserIDs) {
+	case 0:
+	case 1:
+		conds = append(conds, condition{"user_id", "eq", f.UserIDs[0]})
+	default:
+		conds = append(conds, condition{"user_id", "in", inList(f.UserIDs)})
+	}
+	if f.Type != "" {
+		conds = append(conds, condition{"type", "eq", string(f.Type)})
+	}
+	if len(f.Statuses) > 0 {
+		statuses := make([]string, len(f.Statuses))
+		for i, status := range f.Statuses {
+			statuses[i] = string(status)
+		}
+		conds = append(conds, condition{"status", "in", inList(statuses)})
+	}
+	if len(f.ErrorClasses) > 0 {
+		conds = append(conds, condition{"error_class", "in", inList(f.ErrorClasses)})
+	}
+	if !f.CreatedAfter.IsZero() {
+		conds = append(conds, condition{"created_at", "gte", formatTime(f.CreatedAfter)})
+	}
+	if !f.CreatedBefore.IsZero() {
+		conds = append(conds, condition{"created_at", "lt", formatTime(f.CreatedBefore)})
+	}
+	for key, value := range f.Metadata {
+		conds = append(conds, condition{"metadata->>" + key, "eq", value})
+	}
+	return conds
+}
+
+// where adds conditions to a query
+func where(b *postgrest.FilterRequestBuilder, conds []condition) {
+	for _, cond := range conds {
+		b.Filter(cond.column, cond.operator, cond.value)
+	}
+}
+
+// param adds a query parameter that postgrest-go has no builder method for,
+// such as order or or. Filter adds any parameter as key=operator.criteria,
+// so the value is split at its first dot.
+func param(b *postgrest.FilterRequestBuilder, key, value string) {
+	operator, criteria, _ := strings.Cut(value, ".")
+	b.Filter(key, operator, criteria)
+}
+
+// orderBy returns the value of the order parameter sorting rows by the
+// columns, in the same direction
+func orderBy(ascending bool, columns ...string) string {
+	direction := ".desc"
+	if ascending {
+		direction = ".asc"
+	}
+	for i, column := range columns {
+		columns[i] = column + direction
+	}
+	return strings.Join(columns, ",")
+}
+
+// after returns the value of the or parameter selecting the notifications
+// that come after the one created at createdAt with the ID in creation order
+func after(createdAt time.Time, id string, ascending bool) string {
+	op := "lt"
+	if ascending {
+		op = "gt"
+	}
+	t := formatTime(createdAt)
+	return fmt.Sprintf("(created_at.%s.%s,and(created_at.eq.%s,id.%s.%s))", op, t, t, op, id)
+}
+
+// inList formats values as the operand of an "in" filter, quoting them so
+// that commas and parentheses in values are not taken as delimiters
+func inList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		value = strings.ReplaceAll(value, `\`, `\\`)
+		quoted[i] = `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+	return "(" + strings.Join(quoted, ",") + ")"
+}
+
+// cursor is the position after which the next page of a listing starts
+type cursor struct {
+	CreatedAt time.Time        `json:"t"`
+	ID        string           `json:"id"`
+	Order     models.SortOrder `json:"o"`
+}
+
+// CursorAfter returns the cursor of the listing in the given order that
+// continues after a notification
+func CursorAfter(n *models.Notification, order models.SortOrder) string {
+	return encodeCursor(cursor{CreatedAt: n.CreatedAt, ID: n.ID, Order: order})
+}
+
+// encodeCursor returns the opaque form of a cursor
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses a cursor returned by encodeCursor
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, err
+	}
+	if c.ID == "" || c.CreatedAt.IsZero() {
+		return c, errors.New("incomplete cursor")
+	}
+	return c, nil
+}
+
+// formatTime formats t for a filter, with the microsecond precision of
+// Postgres timestamps
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000Z")
+}
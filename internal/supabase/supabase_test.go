@@ -0,0 +1,405 @@
+package supabase
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	postgrest "github.com/nedpals/postgrest-go/pkg"
+	"github.com/notification_service/internal/config"
+	"github.com/notification_service/internal/models"
+)
+
+// request is a request received by a fakePostgREST
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   string
+}
+
+// fakePostgREST records the requests it receives and answers each with the
+// next of its responses
+type fakePostgREST struct {
+	mu        sync.Mutex
+	requests  []request
+	responses []response
+}
+
+// response is a canned answer of a fakePostgREST
+type response struct {
+	status int
+	body   string
+}
+
+func (f *fakePostgREST) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	f.mu.Lock()
+	f.requests = append(f.requests, request{
+		method: r.Method,
+		path:   r.URL.Path,
+		query:  r.URL.Query(),
+		header: r.Header.Clone(),
+		body:   string(body),
+	})
+	resp := response{status: http.StatusOK, body: "[]"}
+	if len(f.responses) > 0 {
+		resp = f.responses[0]
+		f.responses = f.responses[1:]
+	}
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.status)
+	io.WriteString(w, resp.body)
+}
+
+// newTestClient returns a client of a fake PostgREST answering with the
+// responses in turn, then with empty arrays
+func newTestClient(t *testing.T, responses ...response) (*Client, *fakePostgREST) {
+	t.Helper()
+	fake := &fakePostgREST{responses: responses}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{Supabase: config.SupabaseConfig{
+		URL:                server.URL,
+		APIKey:             "service-key",
+		NotificationsTable: "notifications",
+		AuditTable:         "notification_audit",
+		BulkJobsTable:      "bulk_resend_jobs",
+		DeliveriesTable:    "notification_deliveries",
+		ContactsTable:      "user_contacts",
+		PreferencesTable:   "notification_preferences",
+	}}
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client, fake
+}
+
+func TestInsertNotification(t *testing.T) {
+	client, fake := newTestClient(t, response{http.StatusCreated, `[{"id":"n1"}]`})
+
+	id, err := client.InsertNotification(&models.Notification{UserID: "u1", Type: models.NotificationTypeEmail})
+	if err != nil {
+		t.Fatalf("InsertNotification: %v", err)
+	}
+	if id != "n1" {
+		t.Errorf("id = %q, want n1", id)
+	}
+
+	req := fake.requests[0]
+	if req.method != http.MethodPost || req.path != "/rest/v1/notifications" {
+		t.Errorf("request = %s %s, want POST /rest/v1/notifications", req.method, req.path)
+	}
+	if got := req.header.Get("Prefer"); got != "return=representation" {
+		t.Errorf("Prefer = %q, want return=representation", got)
+	}
+	if got := req.header.Get("apikey"); got != "service-key" {
+		t.Errorf("apikey = %q, want service-key", got)
+	}
+
+	var row map[string]interface{}
+	if err := json.Unmarshal([]byte(req.body), &row); err != nil {
+		t.Fatalf("body: %v", err)
+	}
+	if _, ok := row["id"]; ok {
+		t.Errorf("body sets id %v; the database generates it", row["id"])
+	}
+	if row["status"] != string(models.NotificationStatusPending) {
+		t.Errorf("status = %v, want pending", row["status"])
+	}
+}
+
+func TestTransitionNotificationStatus(t *testing.T) {
+	client, fake := newTestClient(t, response{http.StatusOK, `[{"id":"n1","status":"cancelled"}]`}, response{http.StatusOK, `[]`})
+
+	from := []models.NotificationStatus{models.NotificationStatusPending, models.NotificationStatusRetrying}
+	n, err := client.TransitionNotificationStatus("n1", from, models.NotificationStatusCancelled)
+	if err != nil {
+		t.Fatalf("TransitionNotificationStatus: %v", err)
+	}
+	if n == nil || n.Status != models.NotificationStatusCancelled {
+		t.Fatalf("notification = %+v, want it cancelled", n)
+	}
+
+	req := fake.requests[0]
+	if req.method != http.MethodPatch {
+		t.Errorf("method = %s, want PATCH", req.method)
+	}
+	if got := req.query.Get("id"); got != "eq.n1" {
+		t.Errorf("id = %q, want eq.n1", got)
+	}
+	if got := req.query.Get("status"); got != "in.(pending,retrying)" {
+		t.Errorf("status = %q, want in.(pending,retrying)", got)
+	}
+
+	n, err = client.TransitionNotificationStatus("n1", from, models.NotificationStatusCancelled)
+	if err != nil || n != nil {
+		t.Errorf("no matching row: got %+v, %v, want nil, nil", n, err)
+	}
+}
+
+func TestUpdateNotificationStatusOnlyWhileSending(t *testing.T) {
+	client, fake := newTestClient(t, response{http.StatusOK, `[{"id":"n1","status":"retrying"}]`}, response{http.StatusOK, `[]`})
+
+	updated, err := client.UpdateNotificationStatus("n1", models.NotificationStatusRetrying, "provider unavailable", models.ErrorClassTransient)
+	if err != nil || !updated {
+		t.Fatalf("UpdateNotificationStatus = %v, %v, want true, nil", updated, err)
+	}
+
+	req := fake.requests[0]
+	if got := req.query.Get("status"); got != "in.(pending,retrying)" {
+		t.Errorf("status = %q, want in.(pending,retrying)", got)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(req.body), &body); err != nil {
+		t.Fatalf("body: %v", err)
+	}
+	if body["status"] != "retrying" || body["error"] != "provider unavailable" || body["error_class"] != "transient" {
+		t.Errorf("body = %v", body)
+	}
+
+	// A cancelled notification matches no row
+	updated, err = client.SuppressNotification("n1", "opted out")
+	if err != nil || updated {
+		t.Errorf("SuppressNotification = %v, %v, want false, nil", updated, err)
+	}
+	if got := fake.requests[1].query.Get("status"); got != "in.(pending,retrying)" {
+		t.Errorf("status = %q, want in.(pending,retrying)", got)
+	}
+}
+
+func TestGetNotification(t *testing.T) {
+	client, fake := newTestClient(t, response{http.StatusOK, `[{"id":"n1","user_id":"u1"}]`}, response{http.StatusOK, `[]`})
+
+	n, err := client.GetNotification("n1")
+	if err != nil {
+		t.Fatalf("GetNotification: %v", err)
+	}
+	if n.ID != "n1" || n.UserID != "u1" {
+		t.Errorf("notification = %+v", n)
+	}
+	if got := fake.requests[0].query.Get("select"); got != "*" {
+		t.Errorf("select = %q, want *", got)
+	}
+
+	if _, err := client.GetNotification("n2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing notification: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRequestError(t *testing.T) {
+	client, _ := newTestClient(t, response{http.StatusNotFound, `{"code":"42P01","message":"relation does not exist"}`})
+
+	_, err := client.ListPreferences("u1", "marketing")
+	var reqErr *postgrest.RequestError
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("err = %v, want a *postgrest.RequestError", err)
+	}
+	if reqErr.Code != "42P01" || reqErr.HTTPStatusCode != http.StatusNotFound {
+		t.Errorf("error = %+v", reqErr)
+	}
+}
+
+func TestListNotifications(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	rows := `[
+		{"id":"a","created_at":"2024-05-01T12:00:00Z"},
+		{"id":"b","created_at":"2024-05-01T12:00:00Z"},
+		{"id":"c","created_at":"2024-05-01T12:00:01Z"}
+	]`
+	client, fake := newTestClient(t, response{http.StatusOK, rows}, response{http.StatusOK, `[]`})
+
+	query := &models.NotificationQuery{
+		Filter: models.NotificationFilter{
+			UserIDs:      []string{"u1", "u2"},
+			Type:         models.NotificationTypeEmail,
+			Statuses:     []models.NotificationStatus{models.NotificationStatusFailed},
+			CreatedAfter: created,
+			Metadata:     map[string]string{"tenant": "acme"},
+		},
+		Order: models.SortAscending,
+		Limit: 2,
+	}
+	page, err := client.ListNotifications(query)
+	if err != nil {
+		t.Fatalf("ListNotifications: %v", err)
+	}
+	if len(page.Notifications) != 2 || page.NextCursor == "" {
+		t.Fatalf("page = %+v, want 2 notifications and a next cursor", page)
+	}
+
+	req := fake.requests[0]
+	want := map[string]string{
+		"user_id":           `in.("u1","u2")`,
+		"type":              "eq.email",
+		"status":            `in.("failed")`,
+		"created_at":        "gte.2024-05-01T12:00:00.000000Z",
+		"metadata->>tenant": "eq.acme",
+		"order":             "created_at.asc,id.asc",
+	}
+	for key, value := range want {
+		if got := req.query.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	if got := req.header.Get("Range"); got != "0-2" {
+		t.Errorf("Range = %q, want 0-2", got)
+	}
+	if req.query.Has("or") {
+		t.Errorf("first page has or = %q", req.query.Get("or"))
+	}
+
+	query.Cursor = page.NextCursor
+	if _, err := client.ListNotifications(query); err != nil {
+		t.Fatalf("ListNotifications: %v", err)
+	}
+	wantOr := "(created_at.gt.2024-05-01T12:00:00.000000Z,and(created_at.eq.2024-05-01T12:00:00.000000Z,id.gt.b))"
+	if got := fake.requests[1].query.Get("or"); got != wantOr {
+		t.Errorf("or = %q, want %q", got, wantOr)
+	}
+
+	query.Order = models.SortDescending
+	if _, err := client.ListNotifications(query); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("cursor of the other order: err = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestCountNotifications(t *testing.T) {
+	page := make([]models.Notification, countPageSize)
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := range page {
+		page[i] = models.Notification{ID: "n", CreatedAt: created}
+	}
+	full, _ := json.Marshal(page)
+	client, fake := newTestClient(t, response{http.StatusOK, string(full)}, response{http.StatusOK, `[{"id":"m"}]`})
+
+	count, err := client.CountNotifications(&models.NotificationFilter{})
+	if err != nil {
+		t.Fatalf("CountNotifications: %v", err)
+	}
+	if count != countPageSize+1 {
+		t.Errorf("count = %d, want %d", count, countPageSize+1)
+	}
+	if len(fake.requests) != 2 {
+		t.Fatalf("%d requests, want 2", len(fake.requests))
+	}
+	if got := fake.requests[0].query.Get("select"); got != "id,created_at" {
+		t.Errorf("select = %q, want id,created_at", got)
+	}
+	if !fake.requests[1].query.Has("or") {
+		t.Error("second page does not continue after the first")
+	}
+}
+
+func TestListBulkJobs(t *testing.T) {
+	client, fake := newTestClient(t)
+
+	jobs, err := client.ListBulkJobs([]models.BulkJobStatus{models.BulkJobStatusRunning}, 10)
+	if err != nil {
+		t.Fatalf("ListBulkJobs: %v", err)
+	}
+	if jobs == nil {
+		t.Error("jobs is nil, want an empty slice")
+	}
+
+	req := fake.requests[0]
+	if got := req.query.Get("status"); got != "in.(running)" {
+		t.Errorf("status = %q, want in.(running)", got)
+	}
+	if got := req.query.Get("order"); got != "created_at.desc" {
+		t.Errorf("order = %q, want created_at.desc", got)
+	}
+	if got := req.header.Get("Range"); got != "0-9" {
+		t.Errorf("Range = %q, want 0-9", got)
+	}
+}
+
+func TestClaimBulkJob(t *testing.T) {
+	client, fake := newTestClient(t)
+
+	updatedAt := time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC)
+	job, err := client.ClaimBulkJob("j1", updatedAt, "api-2")
+	if err != nil || job != nil {
+		t.Fatalf("ClaimBulkJob = %+v, %v, want nil, nil", job, err)
+	}
+
+	req := fake.requests[0]
+	want := map[string]string{
+		"id":         "eq.j1",
+		"status":     "eq.running",
+		"updated_at": "eq.2024-05-01T12:00:00.123456Z",
+	}
+	for key, value := range want {
+		if got := req.query.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(req.body), &body); err != nil {
+		t.Fatalf("body %q: %v", req.body, err)
+	}
+	if body["owner"] != "api-2" {
+		t.Errorf("owner = %v, want api-2", body["owner"])
+	}
+}
+
+func TestSaveBulkJobProgressRequiresOwner(t *testing.T) {
+	client, fake := newTestClient(t)
+
+	job, err := client.SaveBulkJobProgress(&models.BulkResendJob{ID: "j1", Owner: "api-1", Processed: 3})
+	if err != nil || job != nil {
+		t.Fatalf("SaveBulkJobProgress = %+v, %v, want nil, nil", job, err)
+	}
+
+	req := fake.requests[0]
+	want := map[string]string{
+		"id":     "eq.j1",
+		"status": "in.(running,paused)",
+		"owner":  "eq.api-1",
+	}
+	for key, value := range want {
+		if got := req.query.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestListVerifiedContacts(t *testing.T) {
+	client, fake := newTestClient(t, response{http.StatusOK, `[{"user_id":"u1","type":"email","value":"a@example.com","verified":true}]`})
+
+	contacts, err := client.ListVerifiedContacts("u1")
+	if err != nil {
+		t.Fatalf("ListVerifiedContacts: %v", err)
+	}
+	if len(contacts) != 1 {
+		t.Fatalf("contacts = %+v, want 1", contacts)
+	}
+
+	req := fake.requests[0]
+	if req.path != "/rest/v1/user_contacts" {
+		t.Errorf("path = %s", req.path)
+	}
+	want := map[string]string{
+		"user_id":  "eq.u1",
+		"verified": "eq.true",
+		"order":    "updated_at.desc",
+	}
+	for key, value := range want {
+		if got := req.query.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package telegram
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/notification_service/internal/config"
@@ -44,15 +47,34 @@ func (t *TelegramClient) StopBot() {
 	t.bot.Stop()
 }
 
-// SendNotification sends a notification to a Telegram chat
-func (t *TelegramClient) SendNotification(notification *models.Notification) error {
+// Name implements notifications.Notifier
+func (t *TelegramClient) Name() string {
+	return "telegram"
+}
+
+// Capabilities implements notifications.Notifier
+func (t *TelegramClient) Capabilities() models.Capabilities {
+	return models.Capabilities{
+		Subject:          true,
+		Markdown:         true,
+		SubjectInContent: true,
+		MaxContentLength: models.MaxTelegramMessageLength,
+	}
+}
+
+// Send sends a notification to a Telegram chat. The bot API calls cannot be
+// cancelled, so ctx is not used.
+func (t *TelegramClient) Send(ctx context.Context, notification *models.Notification) (models.Receipt, error) {
 	// Check if channel is provided
 	if notification.Channel == "" {
-		return errors.New("telegram channel ID must be provided")
+		return models.Receipt{}, models.NewPermanentError(errors.New("telegram channel ID must be provided"))
 	}
 
-	// Create a recipient from the channel (chat ID)
-	recipient := &telebot.Chat{ID: parseChatID(notification.Channel)}
+	// Create a recipient from the channel (chat ID or @username)
+	var recipient telebot.Recipient = &telebot.Chat{ID: parseChatID(notification.Channel)}
+	if strings.HasPrefix(notification.Channel, "@") {
+		recipient = username(notification.Channel)
+	}
 
 	// Create a message
 	message := notification.Content
@@ -61,14 +83,42 @@ func (t *TelegramClient) SendNotification(notification *models.Notification) err
 	}
 
 	// Send the message
-	_, err := t.bot.Send(recipient, message, &telebot.SendOptions{
+	sent, err := t.bot.Send(recipient, message, &telebot.SendOptions{
 		ParseMode: telebot.ModeMarkdown,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to send telegram message: %w", err)
+		err = fmt.Errorf("failed to send telegram message: %w", err)
+		if isPermanent(err) {
+			return models.Receipt{}, models.NewPermanentError(err)
+		}
+		return models.Receipt{}, err
 	}
 
-	return nil
+	return models.Receipt{Notifier: t.Name(), MessageID: strconv.Itoa(sent.ID)}, nil
+}
+
+// isPermanent reports whether a Telegram API error will fail the same way on
+// retry, e.g. a blocked bot or an unknown chat. Rate limiting is transient.
+func isPermanent(err error) bool {
+	var floodErr telebot.FloodError
+	if errors.As(err, &floodErr) {
+		return false
+	}
+
+	var apiErr *telebot.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code >= 400 && apiErr.Code < 500 && apiErr.Code != 429
+	}
+
+	return false
+}
+
+// username is a recipient addressed by its public @username
+type username string
+
+// Recipient implements telebot.Recipient
+func (u username) Recipient() string {
+	return string(u)
 }
 
 // parseChatID converts a chat ID from string to int64
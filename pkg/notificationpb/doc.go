@@ -0,0 +1,11 @@
+// Package notificationpb is the generated Go client and server code of the
+// gRPC NotificationService defined in
+// proto/notification/v1/notification_service.proto.
+//
+//	conn, err := grpc.NewClient("localhost:9090", grpc.WithTransportCredentials(insecure.NewCredentials()))
+//	client := notificationpb.NewNotificationServiceClient(conn)
+//	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+//	resp, err := client.Send(ctx, &notificationpb.SendRequest{...})
+package notificationpb
+
+//go:generate sh -c "cd ../.. && buf generate"